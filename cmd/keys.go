@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/encryption"
+	"github.com/pki-vault/server/internal/service"
+	"github.com/pki-vault/server/internal/wire"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keysConfigFile       string
+	keysConfigType       string
+	keysRewrapBatchSize  int
+	keysEncryptBatchSize int
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "Manage the encryption of private keys and webhook secrets",
+}
+
+var keysRewrapCmd = &cobra.Command{
+	Use:   "rewrap",
+	Short: "Re-wrap all data keys with the current master key",
+	Long: `Re-wraps the data keys of all private keys and webhook secrets with the configured encryption.master_key.
+			If the shamir seal is used, the master key is reconstructed from unseal keys read from stdin.
+			Data keys wrapped by one of encryption.previous_master_keys are unwrapped and wrapped again, the encrypted
+			private keys and secrets themselves stay untouched. Keys are processed in batches, each batch in its own transaction, so an
+			interrupted run can simply be started again. The server keeps serving during the rotation as long as it is
+			configured with the new master key and all previous master keys.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(keysConfigFile, keysConfigType)
+		if err != nil {
+			panic(err)
+		}
+		if !config.Encryption.Enabled() {
+			panic(errors.New("encryption must be configured to rewrap data keys"))
+		}
+
+		encryptionService, closeDbFunc := initializeX509PrivateKeyEncryptionService(config)
+		defer closeDbFunc()
+
+		rewrappedKeys, err := encryptionService.RewrapDataKeys(context.Background(), keysRewrapBatchSize)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("Re-wrapped %d data keys\n", rewrappedKeys)
+		rewrappedKeys, err = encryptionService.RewrapWebhookDataKeys(context.Background(), keysRewrapBatchSize)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("Re-wrapped %d data keys of webhook secrets\n", rewrappedKeys)
+		if len(config.Encryption.PreviousMasterKeys) > 0 {
+			fmt.Println("All data keys are wrapped by the current master key, encryption.previous_master_keys can be removed")
+		}
+	},
+}
+
+var keysEncryptCmd = &cobra.Command{
+	Use:   "encrypt",
+	Short: "Encrypt all private keys and webhook secrets persisted before encryption was enabled",
+	Long: `Encrypts all private keys and webhook secrets which were persisted before encryption was enabled. The migrate command does this
+			automatically unless the shamir seal is used, in which case the unseal keys are read from stdin.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(keysConfigFile, keysConfigType)
+		if err != nil {
+			panic(err)
+		}
+		if !config.Encryption.Enabled() {
+			panic(errors.New("encryption must be configured to encrypt private keys"))
+		}
+
+		encryptPlaintextPrivateKeys(config, keysEncryptBatchSize)
+	},
+}
+
+// initializeKeyEncryptor returns the configured key encryptor and, if the shamir seal is used, the still sealed seal
+// which also serves as the key encryptor.
+func initializeKeyEncryptor(conf *config.Config) (encryption.KeyEncryptor, *encryption.ShamirSeal) {
+	if conf.Encryption.ShamirSeal() {
+		seal, err := wire.InitializeShamirSeal(conf.Encryption)
+		if err != nil {
+			panic(err)
+		}
+		return seal, seal
+	}
+
+	keyEncryptor, err := wire.InitializeKeyEncryptor(conf.Encryption)
+	if err != nil {
+		panic(err)
+	}
+	return keyEncryptor, nil
+}
+
+// initializeX509PrivateKeyEncryptionService returns the encryption service for the configured master keys.
+// If the shamir seal is used, the unseal keys are read from stdin first.
+func initializeX509PrivateKeyEncryptionService(conf *config.Config) (*service.X509PrivateKeyEncryptionService, func()) {
+	keyEncryptor, seal := initializeKeyEncryptor(conf)
+	repositoryBundle, closeDbFunc, err := wire.InitializePostgresqlRepositoryBundle(wire.DataSourceName(conf.DSN), keyEncryptor)
+	if err != nil {
+		panic(err)
+	}
+	if seal != nil {
+		sealService := service.NewSealService(repositoryBundle.SealConfigurationRepository(), seal, clockwork.NewRealClock())
+		if err := unsealFromStdin(context.Background(), sealService); err != nil {
+			closeDbFunc()
+			panic(err)
+		}
+	}
+	return service.NewX509PrivateKeyEncryptionService(repositoryBundle), closeDbFunc
+}
+
+func init() {
+	initConfig(keysRewrapCmd, &keysConfigFile, &keysConfigType)
+	keysRewrapCmd.Flags().IntVarP(&keysRewrapBatchSize, "batch-size", "", 100,
+		"Number of data keys re-wrapped per transaction")
+	keysCmd.AddCommand(keysRewrapCmd)
+
+	initConfig(keysEncryptCmd, &keysConfigFile, &keysConfigType)
+	keysEncryptCmd.Flags().IntVarP(&keysEncryptBatchSize, "batch-size", "", 100,
+		"Number of private keys encrypted per transaction")
+	keysCmd.AddCommand(keysEncryptCmd)
+	RootCmd.AddCommand(keysCmd)
+}
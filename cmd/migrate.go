@@ -1,23 +1,29 @@
 package cmd
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/golang-migrate/migrate/v4"
+	"github.com/pki-vault/server/internal/config"
 	"github.com/pki-vault/server/internal/db"
 	"github.com/pki-vault/server/internal/wire"
 	"github.com/spf13/cobra"
 )
 
 var (
-	migrateConfigFile string
-	migrateConfigType string
+	migrateConfigFile          string
+	migrateConfigType          string
+	migrateEncryptionBatchSize int
 )
 
 var migrateCmd = &cobra.Command{
 	Use:   "migrate",
 	Short: "Run database migrations",
 	Long: `Runs database migrations for the application. It uses the configured database backend to apply 
-			any pending database migrations found in the specified migrations directory.`,
+			any pending database migrations found in the specified migrations directory.
+			If encryption is enabled, private keys and webhook secrets persisted before encryption was enabled get
+			encrypted afterwards, unless the shamir seal is used.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		config, err := loadConfig(migrateConfigFile, migrateConfigType)
 		if err != nil {
@@ -33,10 +39,38 @@ var migrateCmd = &cobra.Command{
 			panic(err)
 		}
 		closeDbFunc()
+
+		switch {
+		case config.Encryption.ShamirSeal():
+			// Migrations must not block on unseal keys, so the encryption is left to the keys encrypt command
+			fmt.Println("Run the keys encrypt command to encrypt private keys and webhook secrets persisted before " +
+				"encryption was enabled")
+		case config.Encryption.Enabled():
+			encryptPlaintextPrivateKeys(config, migrateEncryptionBatchSize)
+		}
 	},
 }
 
+func encryptPlaintextPrivateKeys(conf *config.Config, batchSize int) {
+	encryptionService, closeDbFunc := initializeX509PrivateKeyEncryptionService(conf)
+	defer closeDbFunc()
+
+	encryptedKeys, err := encryptionService.EncryptPlaintextKeys(context.Background(), batchSize)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Encrypted %d private keys\n", encryptedKeys)
+
+	encryptedSecrets, err := encryptionService.EncryptPlaintextWebhookSecrets(context.Background(), batchSize)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("Encrypted %d webhook secrets\n", encryptedSecrets)
+}
+
 func init() {
 	initConfig(migrateCmd, &migrateConfigFile, &migrateConfigType)
+	migrateCmd.Flags().IntVarP(&migrateEncryptionBatchSize, "encryption-batch-size", "", 100,
+		"Number of private keys encrypted per transaction")
 	RootCmd.AddCommand(migrateCmd)
 }
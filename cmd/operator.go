@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/encryption"
+	"github.com/pki-vault/server/internal/service"
+	"github.com/pki-vault/server/internal/wire"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var (
+	operatorConfigFile      string
+	operatorConfigType      string
+	operatorSecretShares    int
+	operatorSecretThreshold int
+)
+
+var operatorCmd = &cobra.Command{
+	Use:   "operator",
+	Short: "Operate the seal of the vault",
+}
+
+var operatorInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Initialize the shamir seal",
+	Long: `Generates a new master key and splits it into unseal keys, of which the key threshold is required to unseal
+			the vault. The unseal keys are printed once and never stored, so they have to be distributed to the operators
+			right away. The master key itself is never printed or stored. Requires encryption.seal to be set to shamir.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(operatorConfigFile, operatorConfigType)
+		if err != nil {
+			panic(err)
+		}
+		if !config.Encryption.ShamirSeal() {
+			panic(errors.New("encryption.seal must be set to shamir to initialize the seal"))
+		}
+
+		keyEncryptor, seal := initializeKeyEncryptor(config)
+		repositoryBundle, closeDbFunc, err := wire.InitializePostgresqlRepositoryBundle(wire.DataSourceName(config.DSN), keyEncryptor)
+		if err != nil {
+			panic(err)
+		}
+		defer closeDbFunc()
+
+		sealService := service.NewSealService(repositoryBundle.SealConfigurationRepository(), seal, clockwork.NewRealClock())
+		initResult, err := sealService.Init(context.Background(), operatorSecretShares, operatorSecretThreshold)
+		if err != nil {
+			panic(err)
+		}
+
+		for idx, unsealKey := range initResult.UnsealKeys {
+			fmt.Printf("Unseal Key %d: %s\n", idx+1, unsealKey)
+		}
+		fmt.Printf("\nInitialized the seal with %d key shares and a key threshold of %d. Master key ID: %s\n",
+			initResult.SecretShares, initResult.SecretThreshold, initResult.MasterKeyID)
+		fmt.Printf("The vault starts sealed, submit %d of these unseal keys via /v1/sys/unseal to unseal it.\n",
+			initResult.SecretThreshold)
+	},
+}
+
+// unsealFromStdin reads unseal keys line by line from stdin until the seal is unsealed.
+func unsealFromStdin(ctx context.Context, sealService *service.SealService) error {
+	status, err := sealService.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if !status.Initialized {
+		return encryption.ErrSealNotInitialized
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for status.Sealed {
+		fmt.Printf("Unseal Key (%d/%d): ", status.Progress+1, status.SecretThreshold)
+		if !scanner.Scan() {
+			if err := scanner.Err(); err != nil {
+				return err
+			}
+			return errors.New("stdin closed before the vault was unsealed")
+		}
+
+		status, err = sealService.Unseal(ctx, strings.TrimSpace(scanner.Text()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func init() {
+	initConfig(operatorInitCmd, &operatorConfigFile, &operatorConfigType)
+	operatorInitCmd.Flags().IntVarP(&operatorSecretShares, "key-shares", "", 5,
+		"Number of unseal keys the master key is split into")
+	operatorInitCmd.Flags().IntVarP(&operatorSecretThreshold, "key-threshold", "", 3,
+		"Number of unseal keys required to unseal the vault")
+	operatorCmd.AddCommand(operatorInitCmd)
+	RootCmd.AddCommand(operatorCmd)
+}
@@ -1,12 +1,27 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"github.com/fsnotify/fsnotify"
 	"github.com/gin-gonic/gin"
 	"github.com/gin-gonic/gin/binding"
 	"github.com/go-playground/validator/v10"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/metrics"
+	"github.com/pki-vault/server/internal/service"
+	"github.com/pki-vault/server/internal/tlsconfig"
 	"github.com/pki-vault/server/internal/validation"
 	"github.com/pki-vault/server/internal/wire"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 )
 
 var (
@@ -33,17 +48,234 @@ var serveCmd = &cobra.Command{
 			panic("Expected a validator")
 		}
 
-		repositoryBundle, closeDbFunc, err := wire.InitializePostgresqlRepositoryBundle(wire.DataSourceName(config.DSN))
-		engine, err := wire.ProvideGinEngine(repositoryBundle)
+		shutdownTracing, err := wire.InitializeTracing(config.Tracing)
+		if err != nil {
+			panic(err)
+		}
 
-		err = engine.Run(config.ListenAddresses...)
+		// With the shamir seal the server starts sealed and has to be unsealed via the API
+		keyEncryptor, seal := initializeKeyEncryptor(config)
+
+		repositoryBundle, closeDbFunc, err := wire.InitializePostgresqlRepositoryBundle(wire.DataSourceName(config.DSN), keyEncryptor)
+		if err != nil {
+			panic(err)
+		}
+		// The probes use their own connection pool, so they don't wait for connections held by slow requests
+		dbBackend, closeBackendDbFunc, err := wire.InitializePostgresqlBackend(wire.DataSourceName(config.DSN))
+		if err != nil {
+			panic(err)
+		}
+		healthService := wire.InitializeHealthService(dbBackend, seal, config.Migration)
+		policyService, err := wire.InitializePolicyService(config.Policies)
+		if err != nil {
+			panic(err)
+		}
+		if err := watchPolicies(policyService); err != nil {
+			panic(err)
+		}
+		updatesHub, err := wire.InitializeUpdatesHub(repositoryBundle)
+		if err != nil {
+			panic(err)
+		}
+		serverMetrics := metrics.NewMetrics()
+		metricsInventory, err := wire.InitializeMetricsInventory(repositoryBundle, serverMetrics, config.Metrics)
 		if err != nil {
 			panic(err)
 		}
+		engine, err := wire.ProvideGinEngine(
+			repositoryBundle, seal, config.TLS, policyService, updatesHub, serverMetrics, healthService, config.HTTP,
+		)
+		if err != nil {
+			panic(err)
+		}
+		webhookDispatcher, err := wire.InitializeWebhookDispatcher(repositoryBundle, config.Webhooks)
+		if err != nil {
+			panic(err)
+		}
+		outboxDispatcher, err := wire.InitializeOutboxDispatcher(repositoryBundle, config.Outbox)
+		if err != nil {
+			panic(err)
+		}
+		expiryMonitor, err := wire.InitializeExpiryMonitor(repositoryBundle, config.Expiry)
+		if err != nil {
+			panic(err)
+		}
+		logger, err := wire.InitializeZapLogger()
+		if err != nil {
+			panic(err)
+		}
+
+		workers := newBackgroundWorkers()
+		workers.Go(updatesHub.Run)
+		workers.Go(webhookDispatcher.Run)
+		workers.Go(outboxDispatcher.Run)
+		workers.Go(expiryMonitor.Run)
+		workers.Go(metricsInventory.Run)
+
+		var tlsConfig *tls.Config
+		if config.TLS.Enabled() {
+			certificateService := wire.ProvideX509CertificateService(repositoryBundle, policyService)
+			tlsConfig, err = initializeServerTLSConfig(config, certificateService, workers, logger)
+			if err != nil {
+				panic(err)
+			}
+		}
+		servers, err := wire.InitializeHTTPServers(config.ListenAddresses, config.HTTP, engine, tlsConfig)
+		if err != nil {
+			panic(err)
+		}
+
+		signalCtx, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+		serveErr := serve(signalCtx, servers, logger)
+		// Another signal terminates the server immediately
+		stopSignals()
+
+		logger.Info("shutting down", zap.Duration("timeout", config.HTTP.ShutdownTimeout))
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), config.HTTP.ShutdownTimeout)
+		defer cancelShutdown()
+		// Long polls and update streams would otherwise hold up the drain until the timeout
+		updatesHub.Shutdown()
+		if err := shutdownServers(shutdownCtx, servers); err != nil {
+			logger.Error("could not drain all requests", zap.Error(err))
+		}
+		if err := workers.Stop(shutdownCtx); err != nil {
+			logger.Error("could not stop all background workers", zap.Error(err))
+		}
 		closeDbFunc()
+		closeBackendDbFunc()
+		shutdownTracing()
+		if serveErr != nil {
+			panic(serveErr)
+		}
 	},
 }
 
+// watchPolicies updates the policies whenever the config file changes.
+// Invalid policies are logged and the current ones are kept.
+func watchPolicies(policyService *service.PolicyService) error {
+	logger, err := wire.InitializeZapLogger()
+	if err != nil {
+		return err
+	}
+
+	viper.OnConfigChange(func(event fsnotify.Event) {
+		var policies []config.Policy
+		if err := viper.UnmarshalKey("policies", &policies); err != nil {
+			logger.Error("could not reload policies, keeping the current ones", zap.Error(err))
+			return
+		}
+		if err := policyService.Update(wire.PolicyDtos(policies)); err != nil {
+			logger.Error("could not reload policies, keeping the current ones", zap.Error(err))
+			return
+		}
+		logger.Info("reloaded policies", zap.Int("policies", len(policies)))
+	})
+	viper.WatchConfig()
+	return nil
+}
+
+// initializeServerTLSConfig returns the TLS config of the servers. The server certificate is reloaded periodically by a
+// background worker, so renewed certificates are served without a restart.
+func initializeServerTLSConfig(
+	conf *config.Config, certificateService *service.X509CertificateService, workers *backgroundWorkers,
+	logger *zap.Logger,
+) (*tls.Config, error) {
+	if conf.TLS.VaultCertificateSAN != "" && conf.Encryption.ShamirSeal() {
+		// The private key can't be decrypted before the server is unsealed, which requires the server to run
+		return nil, errors.New("tls.vault_certificate_san can't be used with the shamir seal")
+	}
+
+	reloader, err := wire.InitializeCertificateReloader(context.Background(), conf.TLS, certificateService, logger)
+	if err != nil {
+		return nil, err
+	}
+	workers.Go(func(ctx context.Context) {
+		reloader.Run(ctx, conf.TLS.ReloadInterval)
+	})
+	return tlsconfig.NewServerConfig(conf.TLS, reloader)
+}
+
+// serve serves on all servers until one of them fails or the context is done.
+func serve(ctx context.Context, servers []*http.Server, logger *zap.Logger) error {
+	serveErrs := make(chan error, len(servers))
+	for _, server := range servers {
+		server := server
+		go func() {
+			if server.TLSConfig != nil {
+				logger.Info("listening and serving HTTPS", zap.String("address", server.Addr))
+				// The certificate is provided by the TLS config
+				serveErrs <- server.ListenAndServeTLS("", "")
+				return
+			}
+			logger.Info("listening and serving HTTP", zap.String("address", server.Addr))
+			serveErrs <- server.ListenAndServe()
+		}()
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-serveErrs:
+		return err
+	}
+}
+
+// shutdownServers closes the listeners of all servers and waits until their in-flight requests are drained or the
+// context is done.
+func shutdownServers(ctx context.Context, servers []*http.Server) error {
+	shutdownErrs := make(chan error, len(servers))
+	for _, server := range servers {
+		server := server
+		go func() {
+			shutdownErrs <- server.Shutdown(ctx)
+		}()
+	}
+
+	var err error
+	for range servers {
+		err = errors.Join(err, <-shutdownErrs)
+	}
+	return err
+}
+
+// backgroundWorkers runs the background workers, e.g. the dispatchers, until they are stopped.
+type backgroundWorkers struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newBackgroundWorkers() *backgroundWorkers {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &backgroundWorkers{ctx: ctx, cancel: cancel}
+}
+
+// Go runs the worker until the workers are stopped.
+func (b *backgroundWorkers) Go(run func(ctx context.Context)) {
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		run(b.ctx)
+	}()
+}
+
+// Stop cancels the context of the workers and waits until all of them returned or the context is done.
+func (b *backgroundWorkers) Stop(ctx context.Context) error {
+	b.cancel()
+	stopped := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func init() {
 	initConfig(serveCmd, &serveConfigFile, &serveConfigType)
 	RootCmd.AddCommand(serveCmd)
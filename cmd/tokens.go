@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/service"
+	"github.com/pki-vault/server/internal/wire"
+	"github.com/spf13/cobra"
+	"strings"
+	"time"
+)
+
+var (
+	tokensConfigFile      string
+	tokensConfigType      string
+	tokensCreateName      string
+	tokensCreateScopes    []string
+	tokensCreateExpiresIn time.Duration
+)
+
+var tokensCmd = &cobra.Command{
+	Use:   "tokens",
+	Short: "Manage API tokens",
+}
+
+var tokensCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create an API token",
+	Long: `Creates an API token with the given scopes and prints it. The token is stored hashed and can't be retrieved
+			again. Use the admin scope to create a token for the admin endpoints.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(tokensConfigFile, tokensConfigType)
+		if err != nil {
+			panic(err)
+		}
+		apiTokenService, closeDbFunc := initializeAPITokenService(config)
+		defer closeDbFunc()
+
+		scopes := make([]service.APITokenScope, len(tokensCreateScopes))
+		for i, scope := range tokensCreateScopes {
+			scopes[i] = service.APITokenScope(scope)
+		}
+		var expiresAt *time.Time
+		if tokensCreateExpiresIn > 0 {
+			expiresAt = ptr(time.Now().Add(tokensCreateExpiresIn))
+		}
+
+		createdAPIToken, err := apiTokenService.Create(context.Background(),
+			service.NewCreateAPITokenDto(tokensCreateName, scopes, expiresAt))
+		if err != nil {
+			panic(err)
+		}
+		fmt.Printf("ID:     %s\n", createdAPIToken.ID)
+		fmt.Printf("Token:  %s\n", createdAPIToken.Token)
+		fmt.Printf("Scopes: %s\n", joinAPITokenScopes(createdAPIToken.Scopes))
+		if createdAPIToken.ExpiresAt != nil {
+			fmt.Printf("Expires At: %s\n", createdAPIToken.ExpiresAt.Format(time.RFC3339))
+		}
+	},
+}
+
+var tokensRevokeCmd = &cobra.Command{
+	Use:   "revoke <id>",
+	Short: "Revoke an API token",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		id, err := uuid.Parse(args[0])
+		if err != nil {
+			panic(fmt.Errorf("invalid API token ID: %w", err))
+		}
+		config, err := loadConfig(tokensConfigFile, tokensConfigType)
+		if err != nil {
+			panic(err)
+		}
+		apiTokenService, closeDbFunc := initializeAPITokenService(config)
+		defer closeDbFunc()
+
+		revoked, err := apiTokenService.Revoke(context.Background(), id)
+		if err != nil {
+			panic(err)
+		}
+		if !revoked {
+			panic(errors.New("API token does not exist or is already revoked"))
+		}
+		fmt.Printf("Revoked API token %s\n", id)
+	},
+}
+
+var tokensListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all API tokens",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := loadConfig(tokensConfigFile, tokensConfigType)
+		if err != nil {
+			panic(err)
+		}
+		apiTokenService, closeDbFunc := initializeAPITokenService(config)
+		defer closeDbFunc()
+
+		apiTokens, err := apiTokenService.FindAll(context.Background())
+		if err != nil {
+			panic(err)
+		}
+		for _, apiToken := range apiTokens {
+			status := "active"
+			switch {
+			case apiToken.RevokedAt != nil:
+				status = "revoked"
+			case apiToken.ExpiresAt != nil && !time.Now().Before(*apiToken.ExpiresAt):
+				status = "expired"
+			}
+			fmt.Printf("%s\t%s\t%s\t%s\n", apiToken.ID, status, apiToken.Name, joinAPITokenScopes(apiToken.Scopes))
+		}
+	},
+}
+
+func initializeAPITokenService(conf *config.Config) (*service.APITokenService, func()) {
+	keyEncryptor, _ := initializeKeyEncryptor(conf)
+	repositoryBundle, closeDbFunc, err := wire.InitializePostgresqlRepositoryBundle(wire.DataSourceName(conf.DSN), keyEncryptor)
+	if err != nil {
+		panic(err)
+	}
+	return service.NewAPITokenService(repositoryBundle.APITokenRepository(), clockwork.NewRealClock()), closeDbFunc
+}
+
+func joinAPITokenScopes(scopes []service.APITokenScope) string {
+	scopeStrings := make([]string, len(scopes))
+	for i, scope := range scopes {
+		scopeStrings[i] = string(scope)
+	}
+	return strings.Join(scopeStrings, ",")
+}
+
+func ptr[T any](input T) *T {
+	return &input
+}
+
+func init() {
+	var validScopes []string
+	for _, scope := range service.APITokenScopes {
+		validScopes = append(validScopes, string(scope))
+	}
+
+	initConfig(tokensCreateCmd, &tokensConfigFile, &tokensConfigType)
+	tokensCreateCmd.Flags().StringVarP(&tokensCreateName, "name", "", "", "Name describing the holder of the token")
+	tokensCreateCmd.Flags().StringSliceVarP(&tokensCreateScopes, "scope", "", nil,
+		"Scopes of the token, one of "+strings.Join(validScopes, ", "))
+	tokensCreateCmd.Flags().DurationVarP(&tokensCreateExpiresIn, "expires-in", "", 0,
+		"Duration after which the token expires, e.g. 720h, never if not set")
+	for _, flag := range []string{"name", "scope"} {
+		if err := tokensCreateCmd.MarkFlagRequired(flag); err != nil {
+			panic(err)
+		}
+	}
+	tokensCmd.AddCommand(tokensCreateCmd)
+
+	initConfig(tokensRevokeCmd, &tokensConfigFile, &tokensConfigType)
+	tokensCmd.AddCommand(tokensRevokeCmd)
+
+	initConfig(tokensListCmd, &tokensConfigFile, &tokensConfigType)
+	tokensCmd.AddCommand(tokensListCmd)
+
+	RootCmd.AddCommand(tokensCmd)
+}
@@ -0,0 +1,18 @@
+package buildinfo
+
+import "runtime/debug"
+
+// version is set at build time via -ldflags "-X github.com/pki-vault/server/internal/buildinfo.version=v1.2.3".
+var version string
+
+// Version returns the version the server was built with. Without a version set at build time, it is the module
+// version if the server was installed with go install, otherwise "dev".
+func Version() string {
+	if version != "" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}
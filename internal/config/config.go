@@ -1,25 +1,219 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"github.com/spf13/viper"
+	"time"
+)
 
 type Mode string
 
+// SealShamir reconstructs the master key from unseal keys submitted by operators instead of loading it from config.
+const SealShamir = "shamir"
+
+// Enum values for TLS.ClientAuth
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// Enum values for Tracing.Exporter
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
 var (
 	ModeRelease Mode = "release"
 	ModeDebug   Mode = "debug"
 )
 
 type Config struct {
-	Mode            string    `mapstructure:"mode"`
-	DSN             string    `mapstructure:"dsn"`
-	Migration       Migration `mapstructure:"migration"`
-	ListenAddresses []string  `mapstructure:"listen_addresses"`
+	Mode            string     `mapstructure:"mode"`
+	DSN             string     `mapstructure:"dsn"`
+	Migration       Migration  `mapstructure:"migration"`
+	ListenAddresses []string   `mapstructure:"listen_addresses"`
+	HTTP            HTTP       `mapstructure:"http"`
+	Encryption      Encryption `mapstructure:"encryption"`
+	TLS             TLS        `mapstructure:"tls"`
+	Policies        []Policy   `mapstructure:"policies"`
+	Webhooks        Webhooks   `mapstructure:"webhooks"`
+	Outbox          Outbox     `mapstructure:"outbox"`
+	Expiry          Expiry     `mapstructure:"expiry"`
+	Metrics         Metrics    `mapstructure:"metrics"`
+	Tracing         Tracing    `mapstructure:"tracing"`
 }
 
 type Migration struct {
 	BasePath string `mapstructure:"basePath"`
 }
 
+// HTTP configures the servers of the listen addresses. Requests have to be read within ReadTimeout and responses
+// written within WriteTimeout, which has to exceed the 60s long polls for updates may wait. Update streams aren't
+// limited by either timeout, long polls not by ReadTimeout. Idle keep-alive connections are closed after IdleTimeout
+// and request bodies are limited to MaxBodySize bytes. On SIGTERM or SIGINT, in-flight requests are drained, then the
+// background workers are stopped and the database is closed, all within ShutdownTimeout.
+type HTTP struct {
+	ReadTimeout     time.Duration `mapstructure:"read_timeout"`
+	WriteTimeout    time.Duration `mapstructure:"write_timeout"`
+	IdleTimeout     time.Duration `mapstructure:"idle_timeout"`
+	MaxBodySize     int64         `mapstructure:"max_body_size"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+}
+
+// Encryption configures the encryption of private keys at rest.
+// Private keys are stored unencrypted if no master key source is configured.
+// PreviousMasterKeys are only used for decryption while data keys get re-wrapped with a rotated master key.
+// If Seal is SealShamir, the master key is never configured but reconstructed from unseal keys at runtime.
+type Encryption struct {
+	Seal               string            `mapstructure:"seal"`
+	MasterKey          MasterKeySource   `mapstructure:"master_key"`
+	PreviousMasterKeys []MasterKeySource `mapstructure:"previous_master_keys"`
+}
+
+// MasterKeySource configures where the base64 encoded AES-256 master key is loaded from.
+// Only one of File and Env may be set.
+type MasterKeySource struct {
+	File string `mapstructure:"file"`
+	Env  string `mapstructure:"env"`
+}
+
+// TLS configures the listeners to serve TLS instead of plain HTTP.
+// The server certificate is either loaded from CertFile and KeyFile or, if VaultCertificateSAN is set, the latest
+// certificate with this SAN and a private key stored in the vault is served. It is reloaded every ReloadInterval.
+// Verified client certificates authenticate requests without API token. Their principal is taken from the SAN or
+// subject according to ClientPrincipal and is granted the scopes configured for it in ClientPrincipals.
+type TLS struct {
+	CertFile            string            `mapstructure:"cert_file"`
+	KeyFile             string            `mapstructure:"key_file"`
+	VaultCertificateSAN string            `mapstructure:"vault_certificate_san"`
+	ReloadInterval      time.Duration     `mapstructure:"reload_interval"`
+	ClientCAFile        string            `mapstructure:"client_ca_file"`
+	ClientAuth          string            `mapstructure:"client_auth"`
+	ClientPrincipal     string            `mapstructure:"client_principal"`
+	ClientPrincipals    []ClientPrincipal `mapstructure:"client_principals"`
+}
+
+type ClientPrincipal struct {
+	Name   string   `mapstructure:"name"`
+	Scopes []string `mapstructure:"scopes"`
+}
+
+// Policy limits the SAN patterns the principals bound to it may subscribe to and whether they may receive private
+// keys. Principals are bound by the names of their API tokens or client certificate principals.
+// Policies are reloaded when the config file changes.
+type Policy struct {
+	Name               string   `mapstructure:"name"`
+	APITokens          []string `mapstructure:"api_tokens"`
+	ClientCertificates []string `mapstructure:"client_certificates"`
+	SubjectAltNames    []string `mapstructure:"subject_alt_names"`
+	PrivateKeys        bool     `mapstructure:"private_keys"`
+}
+
+// Webhooks configures the delivery of subscription webhook events. Pending deliveries are polled every PollInterval.
+// Failed attempts are retried with exponential backoff starting at InitialBackoff and capped at MaxBackoff, until
+// the delivery is dead after MaxAttempts attempts. Delivered and dead deliveries are deleted after Retention.
+// Webhooks are only delivered to public addresses and addresses in the AllowedNetworks, given in CIDR notation.
+type Webhooks struct {
+	PollInterval    time.Duration `mapstructure:"poll_interval"`
+	Timeout         time.Duration `mapstructure:"timeout"`
+	MaxAttempts     int           `mapstructure:"max_attempts"`
+	InitialBackoff  time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff      time.Duration `mapstructure:"max_backoff"`
+	Retention       time.Duration `mapstructure:"retention"`
+	AllowedNetworks []string      `mapstructure:"allowed_networks"`
+}
+
+// Outbox configures the publishing of import events from the outbox. Pending events are polled every PollInterval
+// and published to all Sinks. Failed attempts are retried with exponential backoff starting at InitialBackoff and
+// capped at MaxBackoff until all sinks succeeded, so sinks may receive an event more than once. Published events are
+// deleted after Retention.
+type Outbox struct {
+	PollInterval   time.Duration `mapstructure:"poll_interval"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff"`
+	Retention      time.Duration `mapstructure:"retention"`
+	Sinks          OutboxSinks   `mapstructure:"sinks"`
+}
+
+// OutboxSinks configures where outbox events are published. Log logs every event, Webhooks posts every event signed
+// like subscription webhooks.
+type OutboxSinks struct {
+	Log            bool                `mapstructure:"log"`
+	Webhooks       []OutboxWebhookSink `mapstructure:"webhooks"`
+	WebhookTimeout time.Duration       `mapstructure:"webhook_timeout"`
+}
+
+type OutboxWebhookSink struct {
+	URL    string `mapstructure:"url"`
+	Secret string `mapstructure:"secret"`
+}
+
+// Expiry configures the monitoring of expiring certificates. Every ScanInterval, the certificates without a
+// replacement and the latest certificates of subscriptions are checked against the Thresholds, the durations before
+// their expiry. Once a certificate crossed a threshold, an alert is sent through all Notifiers. A certificate is only
+// alerted once per threshold, if it crossed multiple thresholds since the last scan only the shortest one is alerted.
+type Expiry struct {
+	ScanInterval time.Duration   `mapstructure:"scan_interval"`
+	Thresholds   []time.Duration `mapstructure:"thresholds"`
+	Notifiers    ExpiryNotifiers `mapstructure:"notifiers"`
+}
+
+// ExpiryNotifiers configures where expiry alerts are sent. Log logs every alert, Webhooks posts every alert signed
+// like subscription webhooks and SMTP mails every alert.
+type ExpiryNotifiers struct {
+	Log            bool                    `mapstructure:"log"`
+	Webhooks       []ExpiryWebhookNotifier `mapstructure:"webhooks"`
+	WebhookTimeout time.Duration           `mapstructure:"webhook_timeout"`
+	SMTP           ExpirySMTPNotifier      `mapstructure:"smtp"`
+}
+
+type ExpiryWebhookNotifier struct {
+	URL    string `mapstructure:"url"`
+	Secret string `mapstructure:"secret"`
+}
+
+// ExpirySMTPNotifier mails alerts from From to all To addresses. It is disabled if Host is empty.
+// If Username is set, the server is authenticated with PLAIN auth, which requires TLS unless the host is localhost.
+type ExpirySMTPNotifier struct {
+	Host     string   `mapstructure:"host"`
+	Port     int      `mapstructure:"port"`
+	Username string   `mapstructure:"username"`
+	Password string   `mapstructure:"password"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+}
+
+// Metrics configures the Prometheus metrics served at /metrics to principals with the metrics:read scope. The
+// inventory gauges are queried from the database every InventoryInterval.
+type Metrics struct {
+	InventoryInterval time.Duration `mapstructure:"inventory_interval"`
+}
+
+// Tracing configures the export of OpenTelemetry spans of requests, services and SQL statements. Exporter is one of
+// none, stdout or otlp, which exports via OTLP/HTTP to OTLPEndpoint, a host and port. SampleRatio is the share of
+// traces sampled, unless the caller propagated its sampling decision.
+type Tracing struct {
+	Exporter     string  `mapstructure:"exporter"`
+	ServiceName  string  `mapstructure:"service_name"`
+	SampleRatio  float64 `mapstructure:"sample_ratio"`
+	OTLPEndpoint string  `mapstructure:"otlp_endpoint"`
+	OTLPInsecure bool    `mapstructure:"otlp_insecure"`
+}
+
+func (t *TLS) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != "" || t.VaultCertificateSAN != ""
+}
+
+func (e *Encryption) Enabled() bool {
+	return e.ShamirSeal() || e.MasterKey.File != "" || e.MasterKey.Env != ""
+}
+
+func (e *Encryption) ShamirSeal() bool {
+	return e.Seal == SealShamir
+}
+
 func (c *Config) GetModeOrDefault(defaultMode Mode) Mode {
 	configMode := Mode(c.Mode)
 	switch configMode {
@@ -32,4 +226,34 @@ func (c *Config) GetModeOrDefault(defaultMode Mode) Mode {
 
 func init() {
 	viper.SetDefault("migration.basePath", "internal/db/migrations")
+	viper.SetDefault("http.read_timeout", 30*time.Second)
+	viper.SetDefault("http.write_timeout", 90*time.Second)
+	viper.SetDefault("http.idle_timeout", 2*time.Minute)
+	viper.SetDefault("http.max_body_size", 10<<20)
+	viper.SetDefault("http.shutdown_timeout", 30*time.Second)
+	viper.SetDefault("tls.reload_interval", time.Minute)
+	viper.SetDefault("tls.client_principal", "san")
+	viper.SetDefault("webhooks.poll_interval", 5*time.Second)
+	viper.SetDefault("webhooks.timeout", 10*time.Second)
+	viper.SetDefault("webhooks.max_attempts", 10)
+	viper.SetDefault("webhooks.initial_backoff", 30*time.Second)
+	viper.SetDefault("webhooks.max_backoff", time.Hour)
+	viper.SetDefault("webhooks.retention", 30*24*time.Hour)
+	viper.SetDefault("outbox.poll_interval", 5*time.Second)
+	viper.SetDefault("outbox.initial_backoff", 5*time.Second)
+	viper.SetDefault("outbox.max_backoff", 10*time.Minute)
+	viper.SetDefault("outbox.retention", 24*time.Hour)
+	viper.SetDefault("outbox.sinks.webhook_timeout", 10*time.Second)
+	viper.SetDefault("expiry.scan_interval", time.Hour)
+	viper.SetDefault("expiry.thresholds", []time.Duration{
+		30 * 24 * time.Hour, 14 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour,
+	})
+	viper.SetDefault("expiry.notifiers.log", true)
+	viper.SetDefault("expiry.notifiers.webhook_timeout", 10*time.Second)
+	viper.SetDefault("expiry.notifiers.smtp.port", 587)
+	viper.SetDefault("metrics.inventory_interval", time.Minute)
+	viper.SetDefault("tracing.exporter", TracingExporterNone)
+	viper.SetDefault("tracing.service_name", "pki-vault-server")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+	viper.SetDefault("tracing.otlp_endpoint", "localhost:4318")
 }
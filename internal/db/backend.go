@@ -1,6 +1,7 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 )
 
@@ -14,4 +15,7 @@ type SqlBackend interface {
 	MigrationDriver
 	Db() *sql.DB
 	DatabaseType() SQLDatabaseType
+	// SchemaVersion returns the version of the last migration applied to the database and whether it failed.
+	// It is 0 if no migration was applied yet.
+	SchemaVersion(ctx context.Context) (version uint, dirty bool, err error)
 }
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database"
+	"github.com/golang-migrate/migrate/v4/source"
+	"os"
 	"strings"
 )
 
@@ -15,18 +17,15 @@ type MigrationDriver interface {
 func RunMigrations(backend SqlBackend, migrationsBasePath string) error {
 	var driver database.Driver
 	var err error
-	var sourceURL string
 
 	driver, err = backend.MigrationDriver()
 	if err != nil {
 		return err
 	}
 
-	switch backend.DatabaseType() {
-	case PostgresqlDatabaseType:
-		sourceURL = fmt.Sprintf("file://%s/postgresql", strings.TrimPrefix(migrationsBasePath, "/"))
-	default:
-		return errors.New(fmt.Sprintf("Unsupported database driver '%s'", backend.DatabaseType()))
+	sourceURL, err := migrationsSourceURL(backend, migrationsBasePath)
+	if err != nil {
+		return err
 	}
 
 	m, err := migrate.NewWithDatabaseInstance(sourceURL, "postgres", driver)
@@ -35,3 +34,41 @@ func RunMigrations(backend SqlBackend, migrationsBasePath string) error {
 	}
 	return m.Up()
 }
+
+// LatestMigrationVersion returns the version of the last migration for the backend in the migrations base path,
+// which is the schema version the server expects.
+func LatestMigrationVersion(backend SqlBackend, migrationsBasePath string) (uint, error) {
+	sourceURL, err := migrationsSourceURL(backend, migrationsBasePath)
+	if err != nil {
+		return 0, err
+	}
+	migrations, err := source.Open(sourceURL)
+	if err != nil {
+		return 0, err
+	}
+	defer migrations.Close()
+
+	version, err := migrations.First()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		nextVersion, err := migrations.Next(version)
+		if errors.Is(err, os.ErrNotExist) {
+			return version, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		version = nextVersion
+	}
+}
+
+func migrationsSourceURL(backend SqlBackend, migrationsBasePath string) (string, error) {
+	switch backend.DatabaseType() {
+	case PostgresqlDatabaseType:
+		return fmt.Sprintf("file://%s/postgresql", strings.TrimPrefix(migrationsBasePath, "/")), nil
+	default:
+		return "", errors.New(fmt.Sprintf("Unsupported database driver '%s'", backend.DatabaseType()))
+	}
+}
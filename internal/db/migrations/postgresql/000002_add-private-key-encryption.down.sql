@@ -0,0 +1,5 @@
+drop index x509_private_keys_master_key_id_index;
+
+alter table x509_private_keys
+    drop column wrapped_data_key,
+    drop column master_key_id;
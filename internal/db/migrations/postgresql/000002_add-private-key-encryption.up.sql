@@ -0,0 +1,7 @@
+-- Private keys are encrypted with a per key data key which is wrapped by a master key.
+-- Rows without master key ID were persisted before encryption was enabled and hold the plaintext key in bytes.
+alter table x509_private_keys
+    add column wrapped_data_key bytea,
+    add column master_key_id    varchar;
+
+create index x509_private_keys_master_key_id_index on x509_private_keys (master_key_id);
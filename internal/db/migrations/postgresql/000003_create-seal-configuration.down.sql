@@ -0,0 +1 @@
+drop table seal_configurations;
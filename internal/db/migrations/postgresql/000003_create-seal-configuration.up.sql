@@ -0,0 +1,9 @@
+create table seal_configurations
+(
+    -- The seal configuration is a singleton
+    id               integer   not null primary key default 1 check (id = 1),
+    secret_shares    integer   not null,
+    secret_threshold integer   not null,
+    master_key_id    varchar   not null,
+    created_at       timestamp not null
+);
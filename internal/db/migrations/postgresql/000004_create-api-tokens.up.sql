@@ -0,0 +1,12 @@
+create table api_tokens
+(
+    id         uuid      not null primary key,
+    name       varchar   not null,
+    token_hash bytea     not null,
+    scopes     text[]    not null,
+    created_at timestamp not null,
+    expires_at timestamp,
+    revoked_at timestamp
+);
+
+create unique index api_tokens_token_hash_uindex on api_tokens (token_hash);
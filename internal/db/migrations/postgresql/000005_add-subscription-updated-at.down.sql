@@ -0,0 +1,2 @@
+alter table x509_certificate_subscriptions
+    drop column updated_at;
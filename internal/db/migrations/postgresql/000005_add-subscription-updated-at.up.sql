@@ -0,0 +1,10 @@
+-- Subscriptions are updated in place. Subscriptions updated after the last poll of a client get all matching
+-- certificates delivered again, as their new subject alt names may match certificates the client never received.
+alter table x509_certificate_subscriptions
+    add column updated_at timestamp;
+
+update x509_certificate_subscriptions
+set updated_at = created_at;
+
+alter table x509_certificate_subscriptions
+    alter column updated_at set not null;
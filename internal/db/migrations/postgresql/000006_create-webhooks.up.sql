@@ -0,0 +1,34 @@
+create table x509_certificate_subscription_webhooks
+(
+    subscription_id uuid      not null primary key
+        references x509_certificate_subscriptions (id) on delete cascade,
+    url             varchar   not null,
+    secret          varchar   not null,
+    created_at      timestamp not null,
+    updated_at      timestamp not null
+);
+
+-- Deliveries are kept as history after they were delivered or are dead.
+-- Pending deliveries are attempted once next_attempt_at is reached.
+create table webhook_deliveries
+(
+    id               uuid      not null primary key,
+    subscription_id  uuid      not null
+        references x509_certificate_subscriptions (id) on delete cascade,
+    event_type       varchar   not null,
+    payload          bytea     not null,
+    status           varchar   not null,
+    attempts         integer   not null,
+    next_attempt_at  timestamp,
+    last_attempt_at  timestamp,
+    last_status_code integer,
+    last_error       varchar,
+    created_at       timestamp not null,
+    delivered_at     timestamp
+);
+
+create index webhook_deliveries_next_attempt_at_index
+    on webhook_deliveries (next_attempt_at) where status = 'pending';
+
+create index webhook_deliveries_subscription_id_created_at_index
+    on webhook_deliveries (subscription_id, created_at);
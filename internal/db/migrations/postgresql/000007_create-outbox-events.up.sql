@@ -0,0 +1,19 @@
+-- Events are written within the transaction of the change they describe and published to the sinks afterwards.
+-- Unpublished events are attempted once next_attempt_at is reached, published events are deleted after a retention.
+create table outbox_events
+(
+    id              uuid      not null primary key,
+    event_type      varchar   not null,
+    payload         bytea     not null,
+    attempts        integer   not null,
+    next_attempt_at timestamp,
+    last_error      varchar,
+    created_at      timestamp not null,
+    published_at    timestamp
+);
+
+create index outbox_events_next_attempt_at_index
+    on outbox_events (next_attempt_at) where published_at is null;
+
+create index outbox_events_published_at_index
+    on outbox_events (published_at) where published_at is not null;
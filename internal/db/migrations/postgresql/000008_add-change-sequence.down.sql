@@ -0,0 +1,19 @@
+drop function get_certificate_changes(uuid, bigint, bigint);
+drop function get_latest_change_sequence();
+
+drop trigger x509_certificate_subscriptions_change_seq on x509_certificate_subscriptions;
+drop trigger x509_certificates_change_seq on x509_certificates;
+drop trigger x509_private_keys_change_seq on x509_private_keys;
+drop function set_x509_certificate_subscription_change_seq();
+drop function set_x509_certificate_change_seq();
+drop function set_x509_private_key_change_seq();
+
+alter table x509_certificate_subscriptions
+    drop column change_seq;
+alter table x509_certificates
+    drop column change_seq;
+alter table x509_private_keys
+    drop column change_seq;
+
+drop function next_change_sequence();
+drop sequence change_sequence;
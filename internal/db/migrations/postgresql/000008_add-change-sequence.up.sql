@@ -0,0 +1,186 @@
+-- Every change relevant to certificate updates draws the next value of change_sequence: creating certificates,
+-- private keys and subscriptions, linking certificates to their parent or private key and changing the subject alt
+-- names of subscriptions. Writers hold an advisory lock from their first change until they commit, so values become
+-- visible in ascending order and a reader never misses a change below the latest value it has seen.
+create sequence change_sequence;
+
+create function next_change_sequence() returns bigint as
+$$
+begin
+    perform pg_advisory_xact_lock(hashtext('change_sequence'));
+    return nextval('change_sequence');
+end;
+$$ language plpgsql;
+
+alter table x509_private_keys
+    add column change_seq bigint;
+alter table x509_certificates
+    add column change_seq bigint;
+alter table x509_certificate_subscriptions
+    add column change_seq bigint;
+
+update x509_private_keys
+set change_seq = nextval('change_sequence');
+update x509_certificates
+set change_seq = nextval('change_sequence');
+update x509_certificate_subscriptions
+set change_seq = nextval('change_sequence');
+
+alter table x509_private_keys
+    alter column change_seq set not null;
+alter table x509_certificates
+    alter column change_seq set not null;
+alter table x509_certificate_subscriptions
+    alter column change_seq set not null;
+
+create index x509_private_keys_change_seq_index on x509_private_keys (change_seq);
+create index x509_certificates_change_seq_index on x509_certificates (change_seq);
+create index x509_certificate_subscriptions_change_seq_index on x509_certificate_subscriptions (change_seq);
+
+-- Private keys never change after they were created, e.g. re-wrapping their data key keeps their change_seq
+create function set_x509_private_key_change_seq() returns trigger as
+$$
+begin
+    if tg_op = 'INSERT' then
+        new.change_seq := next_change_sequence();
+    else
+        new.change_seq := old.change_seq;
+    end if;
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger x509_private_keys_change_seq
+    before insert or update
+    on x509_private_keys
+    for each row
+execute function set_x509_private_key_change_seq();
+
+create function set_x509_certificate_change_seq() returns trigger as
+$$
+begin
+    if tg_op = 'INSERT' then
+        new.change_seq := next_change_sequence();
+    elsif new.parent_certificate_id is distinct from old.parent_certificate_id
+        or new.private_key_id is distinct from old.private_key_id then
+        new.change_seq := next_change_sequence();
+    else
+        new.change_seq := old.change_seq;
+    end if;
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger x509_certificates_change_seq
+    before insert or update
+    on x509_certificates
+    for each row
+execute function set_x509_certificate_change_seq();
+
+create function set_x509_certificate_subscription_change_seq() returns trigger as
+$$
+begin
+    if tg_op = 'INSERT' then
+        new.change_seq := next_change_sequence();
+    elsif new.subject_alt_names is distinct from old.subject_alt_names
+        or new.include_private_key is distinct from old.include_private_key then
+        new.change_seq := next_change_sequence();
+    else
+        new.change_seq := old.change_seq;
+    end if;
+    return new;
+end;
+$$ language plpgsql;
+
+create trigger x509_certificate_subscriptions_change_seq
+    before insert or update
+    on x509_certificate_subscriptions
+    for each row
+execute function set_x509_certificate_subscription_change_seq();
+
+-- get_latest_change_sequence returns the latest visible change, 0 if there are none.
+create function get_latest_change_sequence() returns bigint as
+$$
+begin
+    return coalesce(greatest((select max(xpk.change_seq) from x509_private_keys as xpk),
+                             (select max(xc.change_seq) from x509_certificates as xc),
+                             (select max(xcs.change_seq) from x509_certificate_subscriptions as xcs)), 0);
+end;
+$$ language plpgsql;
+
+-- get_certificate_changes returns the latest active certificates matching the subscription which changed after
+-- p_after_change_seq and up to p_until_change_seq. A certificate changes with itself, its chain and its private key,
+-- the returned change_seq is the latest of these changes. If the subscription itself changed after p_after_change_seq,
+-- its new subject alt names may match certificates which were never delivered for it, so all of them are returned.
+CREATE
+    OR REPLACE FUNCTION get_certificate_changes(
+    p_subscription_id uuid,
+    p_after_change_seq BIGINT,
+    p_until_change_seq BIGINT
+)
+    RETURNS TABLE
+            (
+                id                    uuid,
+                common_name           text,
+                subject_alt_names     text[],
+                issuer_hash           bytea,
+                subject_hash          bytea,
+                bytes                 bytea,
+                bytes_hash            bytea,
+                public_key_hash       bytea,
+                parent_certificate_id uuid,
+                private_key_id        uuid,
+                not_before            timestamp,
+                not_after             timestamp,
+                created_at            timestamp,
+                change_seq            bigint
+            )
+AS
+$$
+DECLARE
+    v_subject_alt_names TEXT[];
+    v_after_change_seq  BIGINT;
+BEGIN
+    SELECT xcs.subject_alt_names,
+           CASE WHEN xcs.change_seq > p_after_change_seq THEN 0 ELSE p_after_change_seq END
+    INTO v_subject_alt_names, v_after_change_seq
+    FROM x509_certificate_subscriptions AS xcs
+    WHERE xcs.id = p_subscription_id;
+    IF NOT FOUND THEN
+        RETURN;
+    END IF;
+
+    RETURN QUERY
+        SELECT latest.id,
+               latest.common_name,
+               latest.subject_alt_names,
+               latest.issuer_hash,
+               latest.subject_hash,
+               latest.bytes,
+               latest.bytes_hash,
+               latest.public_key_hash,
+               latest.parent_certificate_id,
+               latest.private_key_id,
+               latest.not_before,
+               latest.not_after,
+               latest.created_at,
+               changes.change_seq
+        FROM get_certificate_updates(v_subject_alt_names, '-infinity'::timestamp) AS latest
+                 CROSS JOIN LATERAL (
+            -- UNION instead of UNION ALL stops at certificates which are part of their own chain
+            WITH RECURSIVE chain AS (SELECT xc.id, xc.parent_certificate_id, xc.change_seq
+                                     FROM x509_certificates AS xc
+                                     WHERE xc.id = latest.id
+                                     UNION
+                                     SELECT parent.id, parent.parent_certificate_id, parent.change_seq
+                                     FROM x509_certificates AS parent
+                                              JOIN chain ON parent.id = chain.parent_certificate_id)
+            SELECT GREATEST(MAX(chain.change_seq), (SELECT xpk.change_seq
+                                                    FROM x509_private_keys AS xpk
+                                                    WHERE xpk.id = latest.private_key_id)) AS change_seq
+            FROM chain) AS changes
+        WHERE changes.change_seq > v_after_change_seq
+          AND changes.change_seq <= p_until_change_seq;
+END;
+$$
+    LANGUAGE plpgsql;
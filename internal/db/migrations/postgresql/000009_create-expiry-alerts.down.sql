@@ -0,0 +1,3 @@
+drop index x509_certificates_not_after_index;
+
+drop table expiry_alerts;
@@ -0,0 +1,21 @@
+-- Alerts sent for expiring certificates, so a certificate is alerted only once per threshold. Alerts about the latest
+-- certificate of a subscription reference the subscription, alerts about the certificate itself don't.
+create table expiry_alerts
+(
+    id                uuid      not null primary key,
+    certificate_id    uuid      not null
+        references x509_certificates (id) on delete cascade,
+    subscription_id   uuid
+        references x509_certificate_subscriptions (id) on delete cascade,
+    threshold_seconds bigint    not null,
+    created_at        timestamp not null
+);
+
+create unique index expiry_alerts_certificate_threshold_index
+    on expiry_alerts (certificate_id, threshold_seconds) where subscription_id is null;
+
+create unique index expiry_alerts_subscription_certificate_threshold_index
+    on expiry_alerts (subscription_id, certificate_id, threshold_seconds) where subscription_id is not null;
+
+create index x509_certificates_not_after_index
+    on x509_certificates (not_after);
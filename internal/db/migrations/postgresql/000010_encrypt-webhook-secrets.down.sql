@@ -0,0 +1,9 @@
+drop index x509_certificate_subscription_webhooks_secret_master_key_id_index;
+
+-- Encrypted secrets can't be decrypted here, their webhooks are removed and have to be set again
+delete from x509_certificate_subscription_webhooks where secret_master_key_id is not null;
+
+alter table x509_certificate_subscription_webhooks
+    alter column secret type varchar using convert_from(secret, 'UTF8'),
+    drop column secret_wrapped_data_key,
+    drop column secret_master_key_id;
@@ -0,0 +1,9 @@
+-- Webhook secrets are encrypted like private keys, with a per secret data key which is wrapped by a master key.
+-- Rows without master key ID were persisted before the secrets were encrypted and hold the plaintext secret.
+alter table x509_certificate_subscription_webhooks
+    alter column secret type bytea using convert_to(secret, 'UTF8'),
+    add column secret_wrapped_data_key bytea,
+    add column secret_master_key_id    varchar;
+
+create index x509_certificate_subscription_webhooks_secret_master_key_id_index
+    on x509_certificate_subscription_webhooks (secret_master_key_id);
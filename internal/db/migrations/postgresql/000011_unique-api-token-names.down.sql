@@ -0,0 +1 @@
+drop index api_tokens_name_uindex;
@@ -0,0 +1,3 @@
+-- Policies bind API tokens by name, so names must be unique among tokens which aren't revoked. Revoke or rename
+-- duplicate tokens before migrating, otherwise creating the index fails.
+create unique index api_tokens_name_uindex on api_tokens (name) where revoked_at is null;
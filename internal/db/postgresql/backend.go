@@ -1,9 +1,12 @@
 package postgresql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"github.com/golang-migrate/migrate/v4/database"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/lib/pq"
 	"github.com/pki-vault/server/internal/db"
 )
 
@@ -26,3 +29,20 @@ func (p *Backend) Db() *sql.DB {
 func (p *Backend) MigrationDriver() (database.Driver, error) {
 	return postgres.WithInstance(p.db, &postgres.Config{})
 }
+
+// SchemaVersion reads the version table of golang-migrate directly, as its driver locks the database to create the
+// table on every instantiation.
+func (p *Backend) SchemaVersion(ctx context.Context) (uint, bool, error) {
+	var version uint
+	var dirty bool
+	err := p.db.QueryRowContext(
+		ctx, "SELECT version, dirty FROM "+pq.QuoteIdentifier(postgres.DefaultMigrationsTable)+" LIMIT 1",
+	).Scan(&version, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return version, dirty, nil
+}
@@ -0,0 +1,127 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/lib/pq"
+	"github.com/pki-vault/server/internal/db/postgresql/models"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+	"time"
+)
+
+type APITokenRepository struct {
+	db    *sql.DB
+	clock clockwork.Clock
+}
+
+func NewAPITokenRepository(db *sql.DB, clock clockwork.Clock) *APITokenRepository {
+	return &APITokenRepository{db: db, clock: clock}
+}
+
+func (a *APITokenRepository) Create(
+	ctx context.Context, token *repository.APITokenDao,
+) (*repository.APITokenDao, error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, a.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenModel := &models.APIToken{
+		ID:        token.ID.String(),
+		Name:      token.Name,
+		TokenHash: token.TokenHash,
+		Scopes:    token.Scopes,
+		CreatedAt: normalizeTime(a.clock.Now()),
+		ExpiresAt: normalizedNullTimeFromPtr(token.ExpiresAt),
+		RevokedAt: normalizedNullTimeFromPtr(token.RevokedAt),
+	}
+	err = tokenModel.Insert(ctx, tx, boil.Infer())
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Constraint == "api_tokens_name_uindex" {
+			return nil, fmt.Errorf("%w: %s", repository.ErrDuplicateAPITokenName, token.Name)
+		}
+		return nil, err
+	}
+
+	return postgresqlAPITokenToDao(tokenModel), commitTxIfControlling(tx, controlsTx)
+}
+
+func (a *APITokenRepository) FindByTokenHash(
+	ctx context.Context, tokenHash []byte,
+) (token *repository.APITokenDao, exists bool, err error) {
+	executor, err := getCtxTxOrExecutor(ctx, a.db)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	tokenModel, err := models.APITokens(models.APITokenWhere.TokenHash.EQ(tokenHash)).One(ctx, executor)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	return postgresqlAPITokenToDao(tokenModel), true, nil
+}
+
+func (a *APITokenRepository) FindAll(ctx context.Context) ([]*repository.APITokenDao, error) {
+	executor, err := getCtxTxOrExecutor(ctx, a.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	tokenModels, err := models.APITokens(qm.OrderBy(models.APITokenColumns.CreatedAt)).All(ctx, executor)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]*repository.APITokenDao, len(tokenModels))
+	for idx, tokenModel := range tokenModels {
+		tokens[idx] = postgresqlAPITokenToDao(tokenModel)
+	}
+	return tokens, nil
+}
+
+func (a *APITokenRepository) Revoke(
+	ctx context.Context, id uuid.UUID, revokedAt time.Time,
+) (revoked bool, err error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, a.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return false, err
+	}
+
+	rowsUpdated, err := models.APITokens(
+		models.APITokenWhere.ID.EQ(id.String()),
+		models.APITokenWhere.RevokedAt.IsNull(),
+	).UpdateAll(ctx, tx, models.M{
+		models.APITokenColumns.RevokedAt: null.TimeFrom(normalizeTime(revokedAt)),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return rowsUpdated > 0, commitTxIfControlling(tx, controlsTx)
+}
+
+func postgresqlAPITokenToDao(token *models.APIToken) *repository.APITokenDao {
+	return repository.NewAPITokenDao(
+		uuid.MustParse(token.ID),
+		token.Name,
+		token.TokenHash,
+		token.Scopes,
+		normalizeTime(token.CreatedAt),
+		normalizedPtrFromNullTime(token.ExpiresAt),
+		normalizedPtrFromNullTime(token.RevokedAt),
+	)
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/testutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAPITokenRepository_CreateAndFindByTokenHash(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	repo := NewAPITokenRepository(postgresqlTestBackend.Db(), fakeClock)
+	t.Cleanup(cleanupAPITokenTestTables)
+
+	expiresAt := fakeClock.Now().Add(24 * time.Hour)
+	created, err := repo.Create(ctx, repository.NewAPITokenDao(
+		uuid.MustParse("5b0c3f4e-2d1a-4e8b-9c7d-6a5f4e3d2c1b"), "ci", []byte("token-hash"),
+		[]string{"import", "updates:read"}, fakeClock.Now(), &expiresAt, nil,
+	))
+	if err != nil {
+		t.Fatalf("Create() got unexpected error: %v", err)
+	}
+	expected := repository.NewAPITokenDao(
+		uuid.MustParse("5b0c3f4e-2d1a-4e8b-9c7d-6a5f4e3d2c1b"), "ci", []byte("token-hash"),
+		[]string{"import", "updates:read"}, normalizeTime(fakeClock.Now()), testutil.Ptr(normalizeTime(expiresAt)), nil,
+	)
+	if !reflect.DeepEqual(created, expected) {
+		t.Errorf("Create() = %v, want %v", created, expected)
+	}
+
+	found, exists, err := repo.FindByTokenHash(ctx, []byte("token-hash"))
+	if err != nil {
+		t.Fatalf("FindByTokenHash() got unexpected error: %v", err)
+	}
+	if !exists || !reflect.DeepEqual(found, expected) {
+		t.Errorf("FindByTokenHash() = %v, want %v", found, expected)
+	}
+
+	_, exists, err = repo.FindByTokenHash(ctx, []byte("unknown-hash"))
+	if err != nil {
+		t.Fatalf("FindByTokenHash() got unexpected error: %v", err)
+	}
+	if exists {
+		t.Errorf("FindByTokenHash() expected unknown token hash to not exist")
+	}
+
+	// Token hashes are unique
+	if _, err := repo.Create(ctx, repository.NewAPITokenDao(
+		uuid.New(), "duplicate", []byte("token-hash"), []string{"admin"}, fakeClock.Now(), nil, nil,
+	)); err == nil {
+		t.Errorf("Create() expected error for duplicate token hash")
+	}
+
+	// Names of tokens which aren't revoked are unique, as policies bind tokens by name
+	if _, err := repo.Create(ctx, repository.NewAPITokenDao(
+		uuid.New(), "ci", []byte("other-token-hash"), []string{"admin"}, fakeClock.Now(), nil, nil,
+	)); !errors.Is(err, repository.ErrDuplicateAPITokenName) {
+		t.Errorf("Create() error = %v, want %v", err, repository.ErrDuplicateAPITokenName)
+	}
+}
+
+func TestAPITokenRepository_Revoke(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	repo := NewAPITokenRepository(postgresqlTestBackend.Db(), fakeClock)
+	t.Cleanup(cleanupAPITokenTestTables)
+
+	token, err := repo.Create(ctx, repository.NewAPITokenDao(
+		uuid.New(), "ci", []byte("token-hash"), []string{"import"}, fakeClock.Now(), nil, nil,
+	))
+	if err != nil {
+		t.Fatalf("Create() got unexpected error: %v", err)
+	}
+
+	revokedAt := fakeClock.Now().Add(time.Hour)
+	revoked, err := repo.Revoke(ctx, token.ID, revokedAt)
+	if err != nil {
+		t.Fatalf("Revoke() got unexpected error: %v", err)
+	}
+	if !revoked {
+		t.Errorf("Revoke() expected token to be revoked")
+	}
+
+	// Revoking again must not overwrite the revocation time
+	revoked, err = repo.Revoke(ctx, token.ID, revokedAt.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Revoke() got unexpected error: %v", err)
+	}
+	if revoked {
+		t.Errorf("Revoke() expected already revoked token to not be revoked again")
+	}
+
+	// The name of a revoked token can be used again
+	fakeClock.Advance(time.Minute)
+	if _, err = repo.Create(ctx, repository.NewAPITokenDao(
+		uuid.New(), "ci", []byte("other-token-hash"), []string{"import"}, fakeClock.Now(), nil, nil,
+	)); err != nil {
+		t.Fatalf("Create() got unexpected error: %v", err)
+	}
+
+	revoked, err = repo.Revoke(ctx, uuid.New(), revokedAt)
+	if err != nil {
+		t.Fatalf("Revoke() got unexpected error: %v", err)
+	}
+	if revoked {
+		t.Errorf("Revoke() expected unknown token to not be revoked")
+	}
+
+	tokens, err := repo.FindAll(ctx)
+	if err != nil {
+		t.Fatalf("FindAll() got unexpected error: %v", err)
+	}
+	if len(tokens) != 2 {
+		t.Fatalf("FindAll() expected 2 tokens, but got %d", len(tokens))
+	}
+	if tokens[0].RevokedAt == nil || !tokens[0].RevokedAt.Equal(normalizeTime(revokedAt)) {
+		t.Errorf("FindAll() revoked at = %v, want %v", tokens[0].RevokedAt, normalizeTime(revokedAt))
+	}
+}
+
+func cleanupAPITokenTestTables() {
+	_, err := postgresqlTestBackend.Db().Exec("delete from api_tokens")
+	if err != nil {
+		panic(err)
+	}
+}
@@ -8,11 +8,18 @@ type Bundle struct {
 	x509CertificateRepository             *X509CertificateRepository
 	x509CertificateSubscriptionRepository *X509CertificateSubscriptionRepository
 	privateKeyRepository                  *X509PrivateKeyRepository
+	sealConfigurationRepository           *SealConfigurationRepository
+	apiTokenRepository                    *APITokenRepository
+	webhookRepository                     *WebhookRepository
+	webhookDeliveryRepository             *WebhookDeliveryRepository
+	x509CertificateUpdateNotifier         *X509CertificateUpdateNotifier
+	outboxEventRepository                 *OutboxEventRepository
+	expiryAlertRepository                 *ExpiryAlertRepository
 	transactionManager                    *TransactionManager
 }
 
-func NewRepositoryBundle(x509CertificateRepository *X509CertificateRepository, x509CertificateSubscriptionRepository *X509CertificateSubscriptionRepository, privateKeyRepository *X509PrivateKeyRepository, transactionManager *TransactionManager) *Bundle {
-	return &Bundle{x509CertificateRepository: x509CertificateRepository, x509CertificateSubscriptionRepository: x509CertificateSubscriptionRepository, privateKeyRepository: privateKeyRepository, transactionManager: transactionManager}
+func NewRepositoryBundle(x509CertificateRepository *X509CertificateRepository, x509CertificateSubscriptionRepository *X509CertificateSubscriptionRepository, privateKeyRepository *X509PrivateKeyRepository, sealConfigurationRepository *SealConfigurationRepository, apiTokenRepository *APITokenRepository, webhookRepository *WebhookRepository, webhookDeliveryRepository *WebhookDeliveryRepository, x509CertificateUpdateNotifier *X509CertificateUpdateNotifier, outboxEventRepository *OutboxEventRepository, expiryAlertRepository *ExpiryAlertRepository, transactionManager *TransactionManager) *Bundle {
+	return &Bundle{x509CertificateRepository: x509CertificateRepository, x509CertificateSubscriptionRepository: x509CertificateSubscriptionRepository, privateKeyRepository: privateKeyRepository, sealConfigurationRepository: sealConfigurationRepository, apiTokenRepository: apiTokenRepository, webhookRepository: webhookRepository, webhookDeliveryRepository: webhookDeliveryRepository, x509CertificateUpdateNotifier: x509CertificateUpdateNotifier, outboxEventRepository: outboxEventRepository, expiryAlertRepository: expiryAlertRepository, transactionManager: transactionManager}
 }
 
 func (p *Bundle) X509CertificateRepository() templaterepository.X509CertificateRepository {
@@ -27,6 +34,34 @@ func (p *Bundle) X509PrivateKeyRepository() templaterepository.PrivateKeyReposit
 	return p.privateKeyRepository
 }
 
+func (p *Bundle) SealConfigurationRepository() templaterepository.SealConfigurationRepository {
+	return p.sealConfigurationRepository
+}
+
+func (p *Bundle) APITokenRepository() templaterepository.APITokenRepository {
+	return p.apiTokenRepository
+}
+
+func (p *Bundle) WebhookRepository() templaterepository.WebhookRepository {
+	return p.webhookRepository
+}
+
+func (p *Bundle) WebhookDeliveryRepository() templaterepository.WebhookDeliveryRepository {
+	return p.webhookDeliveryRepository
+}
+
+func (p *Bundle) X509CertificateUpdateNotifier() templaterepository.X509CertificateUpdateNotifier {
+	return p.x509CertificateUpdateNotifier
+}
+
+func (p *Bundle) OutboxEventRepository() templaterepository.OutboxEventRepository {
+	return p.outboxEventRepository
+}
+
+func (p *Bundle) ExpiryAlertRepository() templaterepository.ExpiryAlertRepository {
+	return p.expiryAlertRepository
+}
+
 func (p *Bundle) TransactionManager() templaterepository.TransactionManager {
 	return p.transactionManager
 }
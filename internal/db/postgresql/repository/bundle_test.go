@@ -11,6 +11,13 @@ func TestNewRepositoryBundle(t *testing.T) {
 		x509CertificateRepository             *X509CertificateRepository
 		x509CertificateSubscriptionRepository *X509CertificateSubscriptionRepository
 		privateKeyRepository                  *X509PrivateKeyRepository
+		sealConfigurationRepository           *SealConfigurationRepository
+		apiTokenRepository                    *APITokenRepository
+		webhookRepository                     *WebhookRepository
+		webhookDeliveryRepository             *WebhookDeliveryRepository
+		x509CertificateUpdateNotifier         *X509CertificateUpdateNotifier
+		outboxEventRepository                 *OutboxEventRepository
+		expiryAlertRepository                 *ExpiryAlertRepository
 		transactionManager                    *TransactionManager
 	}
 	tests := []struct {
@@ -24,19 +31,33 @@ func TestNewRepositoryBundle(t *testing.T) {
 				x509CertificateRepository:             &X509CertificateRepository{},
 				x509CertificateSubscriptionRepository: &X509CertificateSubscriptionRepository{},
 				privateKeyRepository:                  &X509PrivateKeyRepository{},
+				sealConfigurationRepository:           &SealConfigurationRepository{},
+				apiTokenRepository:                    &APITokenRepository{},
+				webhookRepository:                     &WebhookRepository{},
+				webhookDeliveryRepository:             &WebhookDeliveryRepository{},
+				x509CertificateUpdateNotifier:         &X509CertificateUpdateNotifier{},
+				outboxEventRepository:                 &OutboxEventRepository{},
+				expiryAlertRepository:                 &ExpiryAlertRepository{},
 				transactionManager:                    &TransactionManager{},
 			},
 			want: &Bundle{
 				x509CertificateRepository:             &X509CertificateRepository{},
 				x509CertificateSubscriptionRepository: &X509CertificateSubscriptionRepository{},
 				privateKeyRepository:                  &X509PrivateKeyRepository{},
+				sealConfigurationRepository:           &SealConfigurationRepository{},
+				apiTokenRepository:                    &APITokenRepository{},
+				webhookRepository:                     &WebhookRepository{},
+				webhookDeliveryRepository:             &WebhookDeliveryRepository{},
+				x509CertificateUpdateNotifier:         &X509CertificateUpdateNotifier{},
+				outboxEventRepository:                 &OutboxEventRepository{},
+				expiryAlertRepository:                 &ExpiryAlertRepository{},
 				transactionManager:                    &TransactionManager{},
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := NewRepositoryBundle(tt.args.x509CertificateRepository, tt.args.x509CertificateSubscriptionRepository, tt.args.privateKeyRepository, tt.args.transactionManager)
+			got := NewRepositoryBundle(tt.args.x509CertificateRepository, tt.args.x509CertificateSubscriptionRepository, tt.args.privateKeyRepository, tt.args.sealConfigurationRepository, tt.args.apiTokenRepository, tt.args.webhookRepository, tt.args.webhookDeliveryRepository, tt.args.x509CertificateUpdateNotifier, tt.args.outboxEventRepository, tt.args.expiryAlertRepository, tt.args.transactionManager)
 			if !testutil.AllFieldsNotNilOrEmptyStruct(got) {
 				t.Errorf("NewRepositoryBundle() not all fields are set")
 			}
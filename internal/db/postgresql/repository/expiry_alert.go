@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/volatiletech/null/v8"
+	"time"
+)
+
+type ExpiryAlertRepository struct {
+	db    *sql.DB
+	clock clockwork.Clock
+}
+
+func NewExpiryAlertRepository(db *sql.DB, clock clockwork.Clock) *ExpiryAlertRepository {
+	return &ExpiryAlertRepository{db: db, clock: clock}
+}
+
+func (e *ExpiryAlertRepository) CreateIfNotExists(
+	ctx context.Context, alert *repository.ExpiryAlertDao,
+) (created bool, err error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, e.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return false, err
+	}
+
+	var subscriptionID null.String
+	if alert.SubscriptionID != nil {
+		subscriptionID = null.StringFrom(alert.SubscriptionID.String())
+	}
+	// Without a conflict target, the partial unique indexes for alerts with and without subscription are both checked
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO expiry_alerts (id, certificate_id, subscription_id, threshold_seconds, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING;`,
+		alert.ID.String(), alert.CertificateID.String(), subscriptionID, int64(alert.Threshold/time.Second),
+		normalizeTime(e.clock.Now()),
+	)
+	if err != nil {
+		return false, err
+	}
+	rowsInserted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsInserted == 1, commitTxIfControlling(tx, controlsTx)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/postgresql/models"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/testutil"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+	"testing"
+	"time"
+)
+
+func TestExpiryAlertRepository_CreateIfNotExists(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	repo := NewExpiryAlertRepository(postgresqlTestBackend.Db(), fakeClock)
+
+	if err := seedX509CertificateTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanX509CertificateTestTables)
+	t.Cleanup(cleanupWebhookTestTables)
+	sub := createWebhookTestSubscription(t, ctx, fakeClock)
+	cert, err := models.X509Certificates(qm.Limit(1)).One(ctx, postgresqlTestBackend.Db())
+	if err != nil {
+		t.Fatal(err)
+	}
+	certID := uuid.MustParse(cert.ID)
+
+	tests := []struct {
+		name           string
+		subscriptionID *uuid.UUID
+		threshold      time.Duration
+		want           bool
+	}{
+		{name: "create certificate alert", threshold: 24 * time.Hour, want: true},
+		{name: "skip existing certificate alert", threshold: 24 * time.Hour, want: false},
+		{name: "create certificate alert for another threshold", threshold: 7 * 24 * time.Hour, want: true},
+		{name: "create subscription alert", subscriptionID: testutil.Ptr(sub.ID), threshold: 24 * time.Hour, want: true},
+		{name: "skip existing subscription alert", subscriptionID: testutil.Ptr(sub.ID), threshold: 24 * time.Hour, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.CreateIfNotExists(ctx, repository.NewExpiryAlertDao(
+				uuid.New(), certID, tt.subscriptionID, tt.threshold, fakeClock.Now(),
+			))
+			if err != nil {
+				t.Fatalf("CreateIfNotExists() got unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CreateIfNotExists() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/postgresql/models"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"sort"
+	"time"
+)
+
+type OutboxEventRepository struct {
+	db    *sql.DB
+	clock clockwork.Clock
+}
+
+func NewOutboxEventRepository(db *sql.DB, clock clockwork.Clock) *OutboxEventRepository {
+	return &OutboxEventRepository{db: db, clock: clock}
+}
+
+func (o *OutboxEventRepository) Create(
+	ctx context.Context, event *repository.OutboxEventDao,
+) (createdEvent *repository.OutboxEventDao, err error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, o.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return nil, err
+	}
+
+	eventModel := &models.OutboxEvent{
+		ID:            event.ID.String(),
+		EventType:     event.EventType,
+		Payload:       event.Payload,
+		Attempts:      event.Attempts,
+		NextAttemptAt: normalizedNullTimeFromPtr(event.NextAttemptAt),
+		LastError:     null.StringFromPtr(event.LastError),
+		CreatedAt:     normalizeTime(o.clock.Now()),
+		PublishedAt:   normalizedNullTimeFromPtr(event.PublishedAt),
+	}
+	err = eventModel.Insert(ctx, tx, boil.Infer())
+	if err != nil {
+		return nil, err
+	}
+
+	return postgresqlOutboxEventToDao(eventModel), commitTxIfControlling(tx, controlsTx)
+}
+
+func (o *OutboxEventRepository) ClaimDue(
+	ctx context.Context, now time.Time, claimedUntil time.Time, limit int,
+) ([]*repository.OutboxEventDao, error) {
+	executor, err := getCtxTxOrExecutor(ctx, o.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	// Rows claimed by a concurrent dispatcher are skipped instead of waiting for their lock
+	query := queries.Raw(`
+		UPDATE outbox_events
+		SET next_attempt_at = $1
+		WHERE id IN (SELECT id
+		             FROM outbox_events
+		             WHERE published_at IS NULL
+		               AND next_attempt_at <= $2
+		             ORDER BY created_at, id
+		             LIMIT $3 FOR UPDATE SKIP LOCKED)
+		RETURNING *;`,
+		normalizeTime(claimedUntil), normalizeTime(now), limit,
+	)
+
+	var claimedEvents []*models.OutboxEvent
+	err = query.Bind(ctx, executor, &claimedEvents)
+	if err != nil {
+		return nil, err
+	}
+
+	// RETURNING doesn't keep the order of the subquery
+	events := make([]*repository.OutboxEventDao, len(claimedEvents))
+	for idx, eventModel := range claimedEvents {
+		events[idx] = postgresqlOutboxEventToDao(eventModel)
+	}
+	sortOutboxEventsByCreation(events)
+	return events, nil
+}
+
+func (o *OutboxEventRepository) Update(ctx context.Context, event *repository.OutboxEventDao) (err error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, o.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return err
+	}
+
+	_, err = models.OutboxEvents(models.OutboxEventWhere.ID.EQ(event.ID.String())).
+		UpdateAll(ctx, tx, models.M{
+			models.OutboxEventColumns.Attempts:      event.Attempts,
+			models.OutboxEventColumns.NextAttemptAt: normalizedNullTimeFromPtr(event.NextAttemptAt),
+			models.OutboxEventColumns.LastError:     null.StringFromPtr(event.LastError),
+			models.OutboxEventColumns.PublishedAt:   normalizedNullTimeFromPtr(event.PublishedAt),
+		})
+	if err != nil {
+		return err
+	}
+
+	return commitTxIfControlling(tx, controlsTx)
+}
+
+func (o *OutboxEventRepository) DeletePublishedBefore(
+	ctx context.Context, before time.Time,
+) (rowsDeleted int64, err error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, o.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsDeleted, err = models.OutboxEvents(
+		models.OutboxEventWhere.PublishedAt.LT(null.TimeFrom(normalizeTime(before))),
+	).DeleteAll(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsDeleted, commitTxIfControlling(tx, controlsTx)
+}
+
+func sortOutboxEventsByCreation(events []*repository.OutboxEventDao) {
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].CreatedAt.Equal(events[j].CreatedAt) {
+			return events[i].ID.String() < events[j].ID.String()
+		}
+		return events[i].CreatedAt.Before(events[j].CreatedAt)
+	})
+}
+
+func postgresqlOutboxEventToDao(event *models.OutboxEvent) *repository.OutboxEventDao {
+	return repository.NewOutboxEventDao(
+		uuid.MustParse(event.ID),
+		event.EventType,
+		event.Payload,
+		event.Attempts,
+		normalizedPtrFromNullTime(event.NextAttemptAt),
+		event.LastError.Ptr(),
+		normalizeTime(event.CreatedAt),
+		normalizedPtrFromNullTime(event.PublishedAt),
+	)
+}
@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOutboxEventRepository_ClaimDueUpdateAndDelete(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	repo := NewOutboxEventRepository(postgresqlTestBackend.Db(), fakeClock)
+	t.Cleanup(cleanupOutboxEventTestTables)
+
+	now := normalizeTime(fakeClock.Now())
+	later := now.Add(time.Hour)
+	due, err := repo.Create(ctx, repository.NewOutboxEventDao(
+		uuid.MustParse("1a3c5e7f-9b2d-4f6a-8c1e-3b5d7f9a2c4e"), "certificate.created", []byte(`{}`), 0, &now, nil,
+		now, nil,
+	))
+	if err != nil {
+		t.Fatalf("Create() got unexpected error: %v", err)
+	}
+	if _, err := repo.Create(ctx, repository.NewOutboxEventDao(
+		uuid.MustParse("3c5e7a9b-1d4f-4a6c-9e8b-5d7f1a3c5e7b"), "certificate.linked", []byte(`{}`), 0, &later, nil,
+		now, nil,
+	)); err != nil {
+		t.Fatalf("Create() got unexpected error: %v", err)
+	}
+
+	claimedUntil := now.Add(time.Minute)
+	claimed, err := repo.ClaimDue(ctx, now, claimedUntil, 10)
+	if err != nil {
+		t.Fatalf("ClaimDue() got unexpected error: %v", err)
+	}
+	expected := *due
+	expected.NextAttemptAt = &claimedUntil
+	if len(claimed) != 1 || !reflect.DeepEqual(claimed[0], &expected) {
+		t.Fatalf("ClaimDue() = %v, want [%v]", claimed, &expected)
+	}
+
+	// Claimed events aren't due until the claim expires
+	claimed, err = repo.ClaimDue(ctx, now, claimedUntil, 10)
+	if err != nil {
+		t.Fatalf("ClaimDue() got unexpected error: %v", err)
+	}
+	if len(claimed) != 0 {
+		t.Errorf("ClaimDue() = %v, want none", claimed)
+	}
+
+	expected.Attempts = 1
+	expected.NextAttemptAt = nil
+	expected.PublishedAt = &now
+	if err := repo.Update(ctx, &expected); err != nil {
+		t.Fatalf("Update() got unexpected error: %v", err)
+	}
+
+	// Published events are never due again
+	claimed, err = repo.ClaimDue(ctx, later, later.Add(time.Minute), 10)
+	if err != nil {
+		t.Fatalf("ClaimDue() got unexpected error: %v", err)
+	}
+	if len(claimed) != 1 || claimed[0].ID == expected.ID {
+		t.Errorf("ClaimDue() = %v, want only the unpublished event", claimed)
+	}
+
+	rowsDeleted, err := repo.DeletePublishedBefore(ctx, now)
+	if err != nil {
+		t.Fatalf("DeletePublishedBefore() got unexpected error: %v", err)
+	}
+	if rowsDeleted != 0 {
+		t.Errorf("DeletePublishedBefore() deleted %d events published at the time", rowsDeleted)
+	}
+	rowsDeleted, err = repo.DeletePublishedBefore(ctx, now.Add(time.Millisecond))
+	if err != nil {
+		t.Fatalf("DeletePublishedBefore() got unexpected error: %v", err)
+	}
+	if rowsDeleted != 1 {
+		t.Errorf("DeletePublishedBefore() got = %v, want %v", rowsDeleted, 1)
+	}
+}
+
+func cleanupOutboxEventTestTables() {
+	_, err := postgresqlTestBackend.Db().Exec("delete from outbox_events")
+	if err != nil {
+		panic(err)
+	}
+}
@@ -22,6 +22,8 @@ var (
 	testPostgresqlDB        = "test"
 	postgresqlTestContainer testcontainers.Container
 	postgresqlTestBackend   *postgresql.Backend
+	// postgresqlTestDataSourceName connects to the test container, e.g. for listeners requiring own connections
+	postgresqlTestDataSourceName string
 )
 
 func setupPostgresqlTestBackend() {
@@ -33,9 +35,9 @@ func setupPostgresqlTestBackend() {
 	if err != nil {
 		panic(err)
 	}
-	dbPool, err := sql.Open("postgres",
-		fmt.Sprintf("postgres://%s:%s@127.0.0.1:%d/%s?sslmode=disable",
-			testPostgresqlUser, testPostgresqlPassword, port.Int(), testPostgresqlDB))
+	postgresqlTestDataSourceName = fmt.Sprintf("postgres://%s:%s@127.0.0.1:%d/%s?sslmode=disable",
+		testPostgresqlUser, testPostgresqlPassword, port.Int(), testPostgresqlDB)
+	dbPool, err := sql.Open("postgres", postgresqlTestDataSourceName)
 	if err != nil {
 		panic(err)
 	}
@@ -9,16 +9,22 @@ import (
 	"github.com/jonboulle/clockwork"
 	"github.com/pki-vault/server/internal/db/postgresql/models"
 	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/encryption"
+	"github.com/volatiletech/null/v8"
 	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
 )
 
+// X509PrivateKeyRepository persists private keys encrypted with the keyEncryptor.
+// Hashes are computed from the plaintext key, so deduplication works independent of the encryption.
 type X509PrivateKeyRepository struct {
-	db    *sql.DB
-	clock clockwork.Clock
+	db           *sql.DB
+	keyEncryptor encryption.KeyEncryptor
+	clock        clockwork.Clock
 }
 
-func NewX509PrivateKeyRepository(db *sql.DB, clock clockwork.Clock) *X509PrivateKeyRepository {
-	return &X509PrivateKeyRepository{db: db, clock: clock}
+func NewX509PrivateKeyRepository(db *sql.DB, keyEncryptor encryption.KeyEncryptor, clock clockwork.Clock) *X509PrivateKeyRepository {
+	return &X509PrivateKeyRepository{db: db, keyEncryptor: keyEncryptor, clock: clock}
 }
 
 func (p *X509PrivateKeyRepository) GetOrCreate(
@@ -35,16 +41,28 @@ func (p *X509PrivateKeyRepository) GetOrCreate(
 		return nil, err
 	}
 	if fetchedPrivKey != nil {
-		return postgresqlPrivateKeyToDao(fetchedPrivKey), commitTxIfControlling(tx, controlsTx)
+		var fetchedPrivKeyDao *repository.X509PrivateKeyDao
+		fetchedPrivKeyDao, err = p.postgresqlPrivateKeyToDao(fetchedPrivKey)
+		if err != nil {
+			return nil, err
+		}
+		return fetchedPrivKeyDao, commitTxIfControlling(tx, controlsTx)
 	}
 
-	privKeyModel := p.postgresqlPrivateKeyToModel(privKey)
+	privKeyModel, err := p.postgresqlPrivateKeyToModel(privKey)
+	if err != nil {
+		return nil, err
+	}
 	err = privKeyModel.Insert(ctx, tx, boil.Infer())
 	if err != nil {
 		return nil, err
 	}
 
-	return postgresqlPrivateKeyToDao(privKeyModel), commitTxIfControlling(tx, controlsTx)
+	createdPrivKey, err := p.postgresqlPrivateKeyToDao(privKeyModel)
+	if err != nil {
+		return nil, err
+	}
+	return createdPrivKey, commitTxIfControlling(tx, controlsTx)
 }
 
 func (p *X509PrivateKeyRepository) FindByID(
@@ -63,7 +81,11 @@ func (p *X509PrivateKeyRepository) FindByID(
 		return nil, false, err
 	}
 
-	return postgresqlPrivateKeyToDao(privKeyModel), true, nil
+	privKey, err = p.postgresqlPrivateKeyToDao(privKeyModel)
+	if err != nil {
+		return nil, false, err
+	}
+	return privKey, true, nil
 }
 
 func (p *X509PrivateKeyRepository) FindByIDs(
@@ -80,7 +102,11 @@ func (p *X509PrivateKeyRepository) FindByIDs(
 	}
 
 	for _, privKeyModel := range privKeyModels {
-		privKeys = append(privKeys, postgresqlPrivateKeyToDao(privKeyModel))
+		privKey, err := p.postgresqlPrivateKeyToDao(privKeyModel)
+		if err != nil {
+			return nil, err
+		}
+		privKeys = append(privKeys, privKey)
 	}
 
 	return privKeys, nil
@@ -102,31 +128,159 @@ func (p *X509PrivateKeyRepository) FindByPublicKeyHash(
 		return nil, false, err
 	}
 
-	return postgresqlPrivateKeyToDao(privKeyModel), true, nil
+	privKey, err = p.postgresqlPrivateKeyToDao(privKeyModel)
+	if err != nil {
+		return nil, false, err
+	}
+	return privKey, true, nil
 }
 
-func (p *X509PrivateKeyRepository) postgresqlPrivateKeyToModel(privKey *repository.X509PrivateKeyDao) *models.X509PrivateKey {
-	return &models.X509PrivateKey{
+// EncryptPlaintextKeys encrypts up to limit private keys which were persisted before encryption was enabled.
+// The selected rows are locked until the transaction ends, so callers should pass a ctx holding a transaction per
+// batch.
+func (p *X509PrivateKeyRepository) EncryptPlaintextKeys(ctx context.Context, limit int) (encryptedKeys int64, err error) {
+	if p.keyEncryptor.MasterKeyID() == "" {
+		return 0, encryption.ErrEncryptionNotEnabled
+	}
+
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, p.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return 0, err
+	}
+
+	privKeyModels, err := models.X509PrivateKeys(
+		models.X509PrivateKeyWhere.MasterKeyID.IsNull(),
+		qm.OrderBy(models.X509PrivateKeyColumns.ID),
+		qm.Limit(limit),
+		qm.For("update"),
+	).All(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, privKeyModel := range privKeyModels {
+		var encryptedKey *encryption.EncryptedKey
+		encryptedKey, err = p.keyEncryptor.Encrypt(privKeyModel.Bytes, []byte(privKeyModel.ID))
+		if err != nil {
+			return 0, fmt.Errorf("unable to encrypt private key %s: %w", privKeyModel.ID, err)
+		}
+
+		err = p.updateEncryptedKey(ctx, tx, privKeyModel, encryptedKey)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(privKeyModels)), commitTxIfControlling(tx, controlsTx)
+}
+
+// RewrapDataKeys re-wraps the data keys of up to limit private keys which are wrapped by another than the current
+// master key. The ciphertexts stay untouched. The selected rows are locked until the transaction ends, so callers
+// should pass a ctx holding a transaction per batch.
+func (p *X509PrivateKeyRepository) RewrapDataKeys(ctx context.Context, limit int) (rewrappedKeys int64, err error) {
+	masterKeyID := p.keyEncryptor.MasterKeyID()
+	if masterKeyID == "" {
+		return 0, encryption.ErrEncryptionNotEnabled
+	}
+
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, p.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return 0, err
+	}
+
+	privKeyModels, err := models.X509PrivateKeys(
+		models.X509PrivateKeyWhere.MasterKeyID.IsNotNull(),
+		models.X509PrivateKeyWhere.MasterKeyID.NEQ(null.StringFrom(masterKeyID)),
+		qm.OrderBy(models.X509PrivateKeyColumns.ID),
+		qm.Limit(limit),
+		qm.For("update"),
+	).All(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, privKeyModel := range privKeyModels {
+		var encryptedKey *encryption.EncryptedKey
+		encryptedKey, err = p.keyEncryptor.Rewrap(&encryption.EncryptedKey{
+			Ciphertext:     privKeyModel.Bytes,
+			WrappedDataKey: privKeyModel.WrappedDataKey.Bytes,
+			MasterKeyID:    privKeyModel.MasterKeyID.String,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("unable to rewrap data key of private key %s: %w", privKeyModel.ID, err)
+		}
+
+		err = p.updateEncryptedKey(ctx, tx, privKeyModel, encryptedKey)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(privKeyModels)), commitTxIfControlling(tx, controlsTx)
+}
+
+func (p *X509PrivateKeyRepository) updateEncryptedKey(
+	ctx context.Context, tx *sql.Tx, privKeyModel *models.X509PrivateKey, encryptedKey *encryption.EncryptedKey,
+) error {
+	setEncryptedKey(privKeyModel, encryptedKey)
+	_, err := privKeyModel.Update(ctx, tx, boil.Whitelist(
+		models.X509PrivateKeyColumns.Bytes,
+		models.X509PrivateKeyColumns.WrappedDataKey,
+		models.X509PrivateKeyColumns.MasterKeyID,
+	))
+	return err
+}
+
+func (p *X509PrivateKeyRepository) postgresqlPrivateKeyToModel(privKey *repository.X509PrivateKeyDao) (*models.X509PrivateKey, error) {
+	encryptedKey, err := p.keyEncryptor.Encrypt(privKey.Bytes, []byte(privKey.ID.String()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt private key: %w", err)
+	}
+
+	privKeyModel := &models.X509PrivateKey{
 		ID:            privKey.ID.String(),
 		Type:          models.PrivateKeyType(privKey.Type),
 		PemBlockType:  privKey.PemBlockType,
-		Bytes:         privKey.Bytes,
 		BytesHash:     privKey.BytesHash,
 		PublicKeyHash: privKey.PublicKeyHash,
 		CreatedAt:     normalizeTime(privKey.CreatedAt),
 	}
+	setEncryptedKey(privKeyModel, encryptedKey)
+	return privKeyModel, nil
 }
 
-func postgresqlPrivateKeyToDao(privateKey *models.X509PrivateKey) *repository.X509PrivateKeyDao {
+func (p *X509PrivateKeyRepository) postgresqlPrivateKeyToDao(privateKey *models.X509PrivateKey) (*repository.X509PrivateKeyDao, error) {
+	plaintext, err := p.keyEncryptor.Decrypt(&encryption.EncryptedKey{
+		Ciphertext:     privateKey.Bytes,
+		WrappedDataKey: privateKey.WrappedDataKey.Bytes,
+		MasterKeyID:    privateKey.MasterKeyID.String,
+	}, []byte(privateKey.ID))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt private key %s: %w", privateKey.ID, err)
+	}
+
 	return repository.NewX509PrivateKeyDao(
 		uuid.MustParse(privateKey.ID),
 		repository.PrivateKeyType(privateKey.Type),
 		privateKey.PemBlockType,
 		privateKey.BytesHash,
-		privateKey.Bytes,
+		plaintext,
 		privateKey.PublicKeyHash,
 		normalizeTime(privateKey.CreatedAt),
-	)
+	), nil
+}
+
+func setEncryptedKey(privKeyModel *models.X509PrivateKey, encryptedKey *encryption.EncryptedKey) {
+	privKeyModel.Bytes = encryptedKey.Ciphertext
+	if encryptedKey.MasterKeyID != "" {
+		privKeyModel.WrappedDataKey = null.BytesFrom(encryptedKey.WrappedDataKey)
+		privKeyModel.MasterKeyID = null.StringFrom(encryptedKey.MasterKeyID)
+	} else {
+		privKeyModel.WrappedDataKey = null.Bytes{}
+		privKeyModel.MasterKeyID = null.String{}
+	}
 }
 
 func uuidsToStrings(ids []uuid.UUID) []string {
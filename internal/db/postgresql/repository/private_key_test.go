@@ -7,7 +7,9 @@ import (
 	"github.com/jonboulle/clockwork"
 	"github.com/pki-vault/server/internal/db/postgresql/models"
 	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/encryption"
 	"github.com/pki-vault/server/internal/testutil"
+	"github.com/volatiletech/null/v8"
 	"github.com/volatiletech/sqlboiler/v4/boil"
 	"reflect"
 	"testing"
@@ -18,9 +20,12 @@ func TestNewPrivateKeyRepository(t *testing.T) {
 	fakeClock := clockwork.NewFakeClock()
 	db := postgresqlTestBackend.Db()
 
+	keyEncryptor := encryption.NewPlaintextKeyEncryptor()
+
 	type args struct {
-		db    *sql.DB
-		clock clockwork.Clock
+		db           *sql.DB
+		keyEncryptor encryption.KeyEncryptor
+		clock        clockwork.Clock
 	}
 	tests := []struct {
 		name string
@@ -30,18 +35,20 @@ func TestNewPrivateKeyRepository(t *testing.T) {
 		{
 			name: "ensure all fields are set",
 			args: args{
-				db:    db,
-				clock: fakeClock,
+				db:           db,
+				keyEncryptor: keyEncryptor,
+				clock:        fakeClock,
 			},
 			want: &X509PrivateKeyRepository{
-				db:    db,
-				clock: fakeClock,
+				db:           db,
+				keyEncryptor: keyEncryptor,
+				clock:        fakeClock,
 			},
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := NewX509PrivateKeyRepository(tt.args.db, tt.args.clock)
+			got := NewX509PrivateKeyRepository(tt.args.db, tt.args.keyEncryptor, tt.args.clock)
 			if !testutil.AllFieldsNotNilOrEmptyStruct(got) {
 				t.Errorf("NewX509PrivateKeyRepository() not all fields are set")
 			}
@@ -62,8 +69,9 @@ func TestPrivateKeyRepository_FindById(t *testing.T) {
 	}
 
 	type fields struct {
-		db    *sql.DB
-		clock clockwork.Clock
+		db           *sql.DB
+		keyEncryptor encryption.KeyEncryptor
+		clock        clockwork.Clock
 	}
 	type args struct {
 		ctx context.Context
@@ -80,8 +88,9 @@ func TestPrivateKeyRepository_FindById(t *testing.T) {
 		{
 			name: "find existing",
 			fields: fields{
-				db:    db,
-				clock: fakeClock,
+				db:           db,
+				keyEncryptor: encryption.NewPlaintextKeyEncryptor(),
+				clock:        fakeClock,
 			},
 			args: args{
 				ctx: ctx,
@@ -102,8 +111,9 @@ func TestPrivateKeyRepository_FindById(t *testing.T) {
 		{
 			name: "dont find not existing",
 			fields: fields{
-				db:    db,
-				clock: fakeClock,
+				db:           db,
+				keyEncryptor: encryption.NewPlaintextKeyEncryptor(),
+				clock:        fakeClock,
 			},
 			args: args{
 				ctx: ctx,
@@ -117,8 +127,9 @@ func TestPrivateKeyRepository_FindById(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &X509PrivateKeyRepository{
-				db:    tt.fields.db,
-				clock: tt.fields.clock,
+				db:           tt.fields.db,
+				keyEncryptor: tt.fields.keyEncryptor,
+				clock:        tt.fields.clock,
 			}
 			gotPrivateKeyDao, gotExists, err := p.FindByID(tt.args.ctx, tt.args.id)
 			if (err != nil) != tt.wantErr {
@@ -140,8 +151,9 @@ func TestPrivateKeyRepository_GetOrCreate(t *testing.T) {
 	fakeClock := clockwork.NewFakeClock()
 	db := postgresqlTestBackend.Db()
 	repo := &X509PrivateKeyRepository{
-		db:    db,
-		clock: fakeClock,
+		db:           db,
+		keyEncryptor: encryption.NewPlaintextKeyEncryptor(),
+		clock:        fakeClock,
 	}
 
 	if err := seedX509CertificateTestData(t, ctx, fakeClock); err != nil {
@@ -189,7 +201,10 @@ func TestPrivateKeyRepository_GetOrCreate(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			fetchedCreatedPrivKey = postgresqlPrivateKeyToDao(fetchedCreatedPrivKeyModel)
+			fetchedCreatedPrivKey, err = repo.postgresqlPrivateKeyToDao(fetchedCreatedPrivKeyModel)
+			if err != nil {
+				t.Fatal(err)
+			}
 		}
 
 		if !reflect.DeepEqual(fetchedCreatedPrivKey, &expectedPrivKey) {
@@ -198,12 +213,179 @@ func TestPrivateKeyRepository_GetOrCreate(t *testing.T) {
 	})
 }
 
+func TestPrivateKeyRepository_EncryptPlaintextKeys(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+
+	if err := seedX509PrivateKeyTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+
+	masterKey := newTestMasterKey(t)
+	repo := &X509PrivateKeyRepository{
+		db:           db,
+		keyEncryptor: encryption.NewEnvelopeKeyEncryptor(masterKey),
+		clock:        fakeClock,
+	}
+
+	// Use a limit smaller than the amount of seeded keys to ensure only a single batch gets processed per call
+	encryptedKeys, err := repo.EncryptPlaintextKeys(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encryptedKeys != 2 {
+		t.Errorf("EncryptPlaintextKeys() encrypted %d keys, want 2", encryptedKeys)
+	}
+	encryptedKeys, err = repo.EncryptPlaintextKeys(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encryptedKeys != 1 {
+		t.Errorf("EncryptPlaintextKeys() encrypted %d keys, want 1", encryptedKeys)
+	}
+
+	plaintextKeys, err := models.X509PrivateKeys(models.X509PrivateKeyWhere.MasterKeyID.IsNull()).Count(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintextKeys != 0 {
+		t.Errorf("expected all keys to be encrypted, but %d keys are still plaintext", plaintextKeys)
+	}
+
+	privKeyModel, err := models.FindX509PrivateKey(ctx, db, "69de12f8-9542-4a9c-88f5-d7db600ce3ed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reflect.DeepEqual(privKeyModel.Bytes, []byte{0x6F, 0x1B, 0x59, 0xC8, 0x82}) {
+		t.Errorf("expected persisted private key bytes to be encrypted")
+	}
+
+	privKey, exists, err := repo.FindByID(ctx, uuid.MustParse("69de12f8-9542-4a9c-88f5-d7db600ce3ed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || !reflect.DeepEqual(privKey.Bytes, []byte{0x6F, 0x1B, 0x59, 0xC8, 0x82}) {
+		t.Errorf("FindByID() expected decrypted private key bytes, got %v", privKey)
+	}
+
+	// Running the encryption again must not touch already encrypted keys
+	encryptedKeys, err = repo.EncryptPlaintextKeys(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encryptedKeys != 0 {
+		t.Errorf("EncryptPlaintextKeys() encrypted %d keys on second run, want 0", encryptedKeys)
+	}
+}
+
+func TestPrivateKeyRepository_RewrapDataKeys(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+
+	if err := seedX509PrivateKeyTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+
+	oldMasterKey := newTestMasterKey(t)
+	oldRepo := &X509PrivateKeyRepository{
+		db:           db,
+		keyEncryptor: encryption.NewEnvelopeKeyEncryptor(oldMasterKey),
+		clock:        fakeClock,
+	}
+	if _, err := oldRepo.EncryptPlaintextKeys(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+
+	newMasterKey := newTestMasterKey(t)
+	repo := &X509PrivateKeyRepository{
+		db:           db,
+		keyEncryptor: encryption.NewEnvelopeKeyEncryptor(newMasterKey, oldMasterKey),
+		clock:        fakeClock,
+	}
+	ciphertextBefore, err := models.FindX509PrivateKey(ctx, db, "69de12f8-9542-4a9c-88f5-d7db600ce3ed")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys wrapped by the old master key must stay readable during the rotation
+	rewrappedKeys, err := repo.RewrapDataKeys(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrappedKeys != 2 {
+		t.Errorf("RewrapDataKeys() re-wrapped %d keys, want 2", rewrappedKeys)
+	}
+	privKeys, err := repo.FindByIDs(ctx, []uuid.UUID{
+		uuid.MustParse("69de12f8-9542-4a9c-88f5-d7db600ce3ed"),
+		uuid.MustParse("c56025a2-ea2c-4dec-8bd7-90190e64d913"),
+		uuid.MustParse("8b8ab80f-0f82-4a16-aa1a-5d8998173ed5"),
+	})
+	if err != nil {
+		t.Fatalf("FindByIDs() got unexpected error during rotation: %v", err)
+	}
+	if len(privKeys) != 3 {
+		t.Errorf("FindByIDs() returned %d keys during rotation, want 3", len(privKeys))
+	}
+
+	rewrappedKeys, err = repo.RewrapDataKeys(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrappedKeys != 1 {
+		t.Errorf("RewrapDataKeys() re-wrapped %d keys, want 1", rewrappedKeys)
+	}
+
+	oldMasterKeyKeys, err := models.X509PrivateKeys(
+		models.X509PrivateKeyWhere.MasterKeyID.EQ(null.StringFrom(oldMasterKey.ID())),
+	).Count(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if oldMasterKeyKeys != 0 {
+		t.Errorf("expected all data keys to be re-wrapped, but %d keys are still wrapped by the old master key", oldMasterKeyKeys)
+	}
+
+	ciphertextAfter, err := models.FindX509PrivateKey(ctx, db, "69de12f8-9542-4a9c-88f5-d7db600ce3ed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ciphertextAfter.Bytes, ciphertextBefore.Bytes) {
+		t.Errorf("RewrapDataKeys() must not re-encrypt the private key itself")
+	}
+
+	// Once the rotation finished the old master key is no longer needed
+	newOnlyRepo := &X509PrivateKeyRepository{
+		db:           db,
+		keyEncryptor: encryption.NewEnvelopeKeyEncryptor(newMasterKey),
+		clock:        fakeClock,
+	}
+	privKey, exists, err := newOnlyRepo.FindByID(ctx, uuid.MustParse("69de12f8-9542-4a9c-88f5-d7db600ce3ed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists || !reflect.DeepEqual(privKey.Bytes, []byte{0x6F, 0x1B, 0x59, 0xC8, 0x82}) {
+		t.Errorf("FindByID() expected decrypted private key bytes, got %v", privKey)
+	}
+
+	// Running the rotation again must not touch already re-wrapped keys
+	rewrappedKeys, err = repo.RewrapDataKeys(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rewrappedKeys != 0 {
+		t.Errorf("RewrapDataKeys() re-wrapped %d keys on second run, want 0", rewrappedKeys)
+	}
+}
+
 func TestPrivateKeyRepository_postgresqlPrivateKeyToModel(t *testing.T) {
 	fakeClock := clockwork.NewFakeClock()
 
 	type fields struct {
-		db    *sql.DB
-		clock clockwork.Clock
+		db           *sql.DB
+		keyEncryptor encryption.KeyEncryptor
+		clock        clockwork.Clock
 	}
 	type args struct {
 		privKey *repository.X509PrivateKeyDao
@@ -217,8 +399,9 @@ func TestPrivateKeyRepository_postgresqlPrivateKeyToModel(t *testing.T) {
 		{
 			name: "ensure correct transform",
 			fields: fields{
-				db:    nil,
-				clock: fakeClock,
+				db:           nil,
+				keyEncryptor: encryption.NewPlaintextKeyEncryptor(),
+				clock:        fakeClock,
 			},
 			args: args{
 				privKey: repository.NewX509PrivateKeyDao(
@@ -244,8 +427,9 @@ func TestPrivateKeyRepository_postgresqlPrivateKeyToModel(t *testing.T) {
 		{
 			name: "ensure correct time normalization",
 			fields: fields{
-				db:    nil,
-				clock: fakeClock,
+				db:           nil,
+				keyEncryptor: encryption.NewPlaintextKeyEncryptor(),
+				clock:        fakeClock,
 			},
 			args: args{
 				privKey: repository.NewX509PrivateKeyDao(
@@ -272,18 +456,27 @@ func TestPrivateKeyRepository_postgresqlPrivateKeyToModel(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := &X509PrivateKeyRepository{
-				db:    tt.fields.db,
-				clock: tt.fields.clock,
+				db:           tt.fields.db,
+				keyEncryptor: tt.fields.keyEncryptor,
+				clock:        tt.fields.clock,
 			}
-			if got := p.postgresqlPrivateKeyToModel(tt.args.privKey); !reflect.DeepEqual(got, tt.want) {
+			got, err := p.postgresqlPrivateKeyToModel(tt.args.privKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("postgresqlPrivateKeyToModel() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
 
-func Test_postgresqlPrivateKeyToDao(t *testing.T) {
+func TestPrivateKeyRepository_postgresqlPrivateKeyToDao(t *testing.T) {
 	fakeClock := clockwork.NewFakeClock()
+	repo := &X509PrivateKeyRepository{
+		keyEncryptor: encryption.NewPlaintextKeyEncryptor(),
+		clock:        fakeClock,
+	}
 
 	type args struct {
 		privateKey *models.X509PrivateKey
@@ -345,7 +538,11 @@ func Test_postgresqlPrivateKeyToDao(t *testing.T) {
 			if !testutil.AllFieldsNotNilOrEmptyStruct(tt.want) {
 				t.Errorf("postgresqlPrivateKeyToDao() not all fields are set")
 			}
-			if got := postgresqlPrivateKeyToDao(tt.args.privateKey); !reflect.DeepEqual(got, tt.want) {
+			got, err := repo.postgresqlPrivateKeyToDao(tt.args.privateKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("postgresqlPrivateKeyToDao() = %v, want %v", got, tt.want)
 			}
 		})
@@ -409,3 +606,15 @@ func cleanupX509PrivateKeyTestTables() {
 		panic(err)
 	}
 }
+
+func newTestMasterKey(t *testing.T) *encryption.MasterKey {
+	rawMasterKey, err := encryption.GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	masterKey, err := encryption.NewMasterKey(rawMasterKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return masterKey
+}
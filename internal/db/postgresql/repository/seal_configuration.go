@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/postgresql/models"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+)
+
+// sealConfigurationID is the ID of the only seal configuration row.
+const sealConfigurationID = 1
+
+type SealConfigurationRepository struct {
+	db    *sql.DB
+	clock clockwork.Clock
+}
+
+func NewSealConfigurationRepository(db *sql.DB, clock clockwork.Clock) *SealConfigurationRepository {
+	return &SealConfigurationRepository{db: db, clock: clock}
+}
+
+func (s *SealConfigurationRepository) Create(
+	ctx context.Context, sealConfig *repository.SealConfigurationDao,
+) (*repository.SealConfigurationDao, error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, s.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return nil, err
+	}
+
+	sealConfigModel := &models.SealConfiguration{
+		ID:              sealConfigurationID,
+		SecretShares:    sealConfig.SecretShares,
+		SecretThreshold: sealConfig.SecretThreshold,
+		MasterKeyID:     sealConfig.MasterKeyID,
+		CreatedAt:       normalizeTime(s.clock.Now()),
+	}
+	err = sealConfigModel.Insert(ctx, tx, boil.Infer())
+	if err != nil {
+		return nil, err
+	}
+
+	return postgresqlSealConfigurationToDao(sealConfigModel), commitTxIfControlling(tx, controlsTx)
+}
+
+func (s *SealConfigurationRepository) Find(
+	ctx context.Context,
+) (sealConfig *repository.SealConfigurationDao, exists bool, err error) {
+	executor, err := getCtxTxOrExecutor(ctx, s.db)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	sealConfigModel, err := models.FindSealConfiguration(ctx, executor, sealConfigurationID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	return postgresqlSealConfigurationToDao(sealConfigModel), true, nil
+}
+
+func postgresqlSealConfigurationToDao(sealConfig *models.SealConfiguration) *repository.SealConfigurationDao {
+	return repository.NewSealConfigurationDao(
+		sealConfig.SecretShares,
+		sealConfig.SecretThreshold,
+		sealConfig.MasterKeyID,
+		normalizeTime(sealConfig.CreatedAt),
+	)
+}
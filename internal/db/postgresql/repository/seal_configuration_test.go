@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"reflect"
+	"testing"
+)
+
+func TestSealConfigurationRepository_CreateAndFind(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	repo := NewSealConfigurationRepository(postgresqlTestBackend.Db(), fakeClock)
+	t.Cleanup(cleanupSealConfigurationTestTables)
+
+	_, exists, err := repo.Find(ctx)
+	if err != nil {
+		t.Fatalf("Find() got unexpected error: %v", err)
+	}
+	if exists {
+		t.Fatalf("Find() expected no seal configuration to exist")
+	}
+
+	created, err := repo.Create(ctx, repository.NewSealConfigurationDao(5, 3, "3f7a9c1d2e4b6a80", fakeClock.Now()))
+	if err != nil {
+		t.Fatalf("Create() got unexpected error: %v", err)
+	}
+	expected := repository.NewSealConfigurationDao(5, 3, "3f7a9c1d2e4b6a80", normalizeTime(fakeClock.Now()))
+	if !reflect.DeepEqual(created, expected) {
+		t.Errorf("Create() = %v, want %v", created, expected)
+	}
+
+	found, exists, err := repo.Find(ctx)
+	if err != nil {
+		t.Fatalf("Find() got unexpected error: %v", err)
+	}
+	if !exists || !reflect.DeepEqual(found, expected) {
+		t.Errorf("Find() = %v, want %v", found, expected)
+	}
+
+	// There is at most one seal configuration
+	if _, err := repo.Create(ctx, repository.NewSealConfigurationDao(3, 2, "0a1b2c3d4e5f6a7b", fakeClock.Now())); err == nil {
+		t.Errorf("Create() expected error for second seal configuration")
+	}
+}
+
+func cleanupSealConfigurationTestTables() {
+	_, err := postgresqlTestBackend.Db().Exec("delete from seal_configurations")
+	if err != nil {
+		panic(err)
+	}
+}
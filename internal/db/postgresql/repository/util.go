@@ -1,9 +1,32 @@
 package repository
 
 import (
+	"github.com/volatiletech/null/v8"
+	"strings"
 	"time"
 )
 
 func normalizeTime(t time.Time) time.Time {
 	return t.Round(time.Millisecond).UTC()
 }
+
+func normalizedNullTimeFromPtr(t *time.Time) null.Time {
+	if t == nil {
+		return null.Time{}
+	}
+	return null.TimeFrom(normalizeTime(*t))
+}
+
+func normalizedPtrFromNullTime(t null.Time) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	normalizedTime := normalizeTime(t.Time)
+	return &normalizedTime
+}
+
+// wildcardToLikePattern converts a pattern where * matches any sequence of characters to a LIKE pattern.
+// All other characters, including LIKE wildcards, match literally.
+func wildcardToLikePattern(pattern string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%").Replace(pattern)
+}
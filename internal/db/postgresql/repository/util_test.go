@@ -2,6 +2,8 @@ package repository
 
 import (
 	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/testutil"
+	"github.com/volatiletech/null/v8"
 	"reflect"
 	"testing"
 	"time"
@@ -34,3 +36,86 @@ func Test_normalizeTime(t *testing.T) {
 		})
 	}
 }
+
+func Test_normalizedNullTimeFromPtr(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	now := fakeClock.Now()
+
+	tests := []struct {
+		name string
+		t    *time.Time
+		want null.Time
+	}{
+		{
+			name: "ensure nil results in null",
+			t:    nil,
+			want: null.Time{},
+		},
+		{
+			name: "ensure time is normalized",
+			t:    &now,
+			want: null.TimeFrom(normalizeTime(now)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizedNullTimeFromPtr(tt.t); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizedNullTimeFromPtr() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_normalizedPtrFromNullTime(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+
+	tests := []struct {
+		name string
+		t    null.Time
+		want *time.Time
+	}{
+		{
+			name: "ensure null results in nil",
+			t:    null.Time{},
+			want: nil,
+		},
+		{
+			name: "ensure time is normalized",
+			t:    null.TimeFrom(fakeClock.Now()),
+			want: testutil.Ptr(normalizeTime(fakeClock.Now())),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizedPtrFromNullTime(tt.t); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("normalizedPtrFromNullTime() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_wildcardToLikePattern(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		want    string
+	}{
+		{
+			name:    "ensure wildcard matches any characters",
+			pattern: "*.example.invalid",
+			want:    "%.example.invalid",
+		},
+		{
+			name:    "ensure like wildcards are escaped",
+			pattern: `*_100%\*`,
+			want:    `%\_100\%\\%`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wildcardToLikePattern(tt.pattern); got != tt.want {
+				t.Errorf("wildcardToLikePattern() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/postgresql/models"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/encryption"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+)
+
+// WebhookRepository persists webhook secrets encrypted with the keyEncryptor, bound to the ID of their subscription.
+type WebhookRepository struct {
+	db           *sql.DB
+	keyEncryptor encryption.KeyEncryptor
+	clock        clockwork.Clock
+}
+
+func NewWebhookRepository(db *sql.DB, keyEncryptor encryption.KeyEncryptor, clock clockwork.Clock) *WebhookRepository {
+	return &WebhookRepository{db: db, keyEncryptor: keyEncryptor, clock: clock}
+}
+
+func (w *WebhookRepository) Save(
+	ctx context.Context, webhook *repository.WebhookDao,
+) (savedWebhook *repository.WebhookDao, err error) {
+	encryptedSecret, err := w.keyEncryptor.Encrypt([]byte(webhook.Secret), []byte(webhook.SubscriptionID.String()))
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt webhook secret: %w", err)
+	}
+
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, w.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := normalizeTime(w.clock.Now())
+	webhookModel, err := models.FindX509CertificateSubscriptionWebhook(ctx, tx, webhook.SubscriptionID.String())
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		webhookModel = &models.X509CertificateSubscriptionWebhook{
+			SubscriptionID: webhook.SubscriptionID.String(),
+			URL:            webhook.URL,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		setEncryptedSecret(webhookModel, encryptedSecret)
+		err = webhookModel.Insert(ctx, tx, boil.Infer())
+	case err == nil:
+		webhookModel.URL = webhook.URL
+		webhookModel.UpdatedAt = now
+		setEncryptedSecret(webhookModel, encryptedSecret)
+		_, err = webhookModel.Update(ctx, tx, boil.Whitelist(
+			models.X509CertificateSubscriptionWebhookColumns.URL,
+			models.X509CertificateSubscriptionWebhookColumns.Secret,
+			models.X509CertificateSubscriptionWebhookColumns.SecretWrappedDataKey,
+			models.X509CertificateSubscriptionWebhookColumns.SecretMasterKeyID,
+			models.X509CertificateSubscriptionWebhookColumns.UpdatedAt,
+		))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return repository.NewWebhookDao(
+		webhook.SubscriptionID,
+		webhookModel.URL,
+		webhook.Secret,
+		normalizeTime(webhookModel.CreatedAt),
+		normalizeTime(webhookModel.UpdatedAt),
+	), commitTxIfControlling(tx, controlsTx)
+}
+
+func (w *WebhookRepository) FindBySubscriptionID(
+	ctx context.Context, subID uuid.UUID,
+) (webhook *repository.WebhookDao, exists bool, err error) {
+	executor, err := getCtxTxOrExecutor(ctx, w.db)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	webhookModel, err := models.FindX509CertificateSubscriptionWebhook(ctx, executor, subID.String())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	webhook, err = w.postgresqlWebhookToDao(webhookModel)
+	if err != nil {
+		return nil, false, err
+	}
+	return webhook, true, nil
+}
+
+func (w *WebhookRepository) FindSubscriptionIDs(ctx context.Context) ([]uuid.UUID, error) {
+	executor, err := getCtxTxOrExecutor(ctx, w.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	webhookModels, err := models.X509CertificateSubscriptionWebhooks(
+		qm.Select(models.X509CertificateSubscriptionWebhookColumns.SubscriptionID),
+		qm.OrderBy(models.X509CertificateSubscriptionWebhookColumns.CreatedAt),
+	).All(ctx, executor)
+	if err != nil {
+		return nil, err
+	}
+
+	subIDs := make([]uuid.UUID, len(webhookModels))
+	for idx, webhookModel := range webhookModels {
+		subIDs[idx] = uuid.MustParse(webhookModel.SubscriptionID)
+	}
+	return subIDs, nil
+}
+
+func (w *WebhookRepository) Delete(
+	ctx context.Context, subID uuid.UUID,
+) (rowsDeleted int64, err error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, w.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsDeleted, err = models.
+		X509CertificateSubscriptionWebhooks(models.X509CertificateSubscriptionWebhookWhere.SubscriptionID.EQ(subID.String())).
+		DeleteAll(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsDeleted, commitTxIfControlling(tx, controlsTx)
+}
+
+// EncryptPlaintextSecrets encrypts up to limit secrets which were persisted before the secrets were encrypted or
+// encryption was enabled. The selected rows are locked until the transaction ends, so callers should pass a ctx
+// holding a transaction per batch.
+func (w *WebhookRepository) EncryptPlaintextSecrets(ctx context.Context, limit int) (encryptedSecrets int64, err error) {
+	if w.keyEncryptor.MasterKeyID() == "" {
+		return 0, encryption.ErrEncryptionNotEnabled
+	}
+
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, w.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return 0, err
+	}
+
+	webhookModels, err := models.X509CertificateSubscriptionWebhooks(
+		models.X509CertificateSubscriptionWebhookWhere.SecretMasterKeyID.IsNull(),
+		qm.OrderBy(models.X509CertificateSubscriptionWebhookColumns.SubscriptionID),
+		qm.Limit(limit),
+		qm.For("update"),
+	).All(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, webhookModel := range webhookModels {
+		var encryptedSecret *encryption.EncryptedKey
+		encryptedSecret, err = w.keyEncryptor.Encrypt(webhookModel.Secret, []byte(webhookModel.SubscriptionID))
+		if err != nil {
+			return 0, fmt.Errorf("unable to encrypt secret of webhook %s: %w", webhookModel.SubscriptionID, err)
+		}
+
+		err = w.updateEncryptedSecret(ctx, tx, webhookModel, encryptedSecret)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(webhookModels)), commitTxIfControlling(tx, controlsTx)
+}
+
+// RewrapDataKeys re-wraps the data keys of up to limit secrets which are wrapped by another than the current master
+// key. The ciphertexts stay untouched. The selected rows are locked until the transaction ends, so callers should
+// pass a ctx holding a transaction per batch.
+func (w *WebhookRepository) RewrapDataKeys(ctx context.Context, limit int) (rewrappedKeys int64, err error) {
+	masterKeyID := w.keyEncryptor.MasterKeyID()
+	if masterKeyID == "" {
+		return 0, encryption.ErrEncryptionNotEnabled
+	}
+
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, w.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return 0, err
+	}
+
+	webhookModels, err := models.X509CertificateSubscriptionWebhooks(
+		models.X509CertificateSubscriptionWebhookWhere.SecretMasterKeyID.IsNotNull(),
+		models.X509CertificateSubscriptionWebhookWhere.SecretMasterKeyID.NEQ(null.StringFrom(masterKeyID)),
+		qm.OrderBy(models.X509CertificateSubscriptionWebhookColumns.SubscriptionID),
+		qm.Limit(limit),
+		qm.For("update"),
+	).All(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, webhookModel := range webhookModels {
+		var encryptedSecret *encryption.EncryptedKey
+		encryptedSecret, err = w.keyEncryptor.Rewrap(&encryption.EncryptedKey{
+			Ciphertext:     webhookModel.Secret,
+			WrappedDataKey: webhookModel.SecretWrappedDataKey.Bytes,
+			MasterKeyID:    webhookModel.SecretMasterKeyID.String,
+		})
+		if err != nil {
+			return 0, fmt.Errorf("unable to rewrap data key of webhook %s: %w", webhookModel.SubscriptionID, err)
+		}
+
+		err = w.updateEncryptedSecret(ctx, tx, webhookModel, encryptedSecret)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int64(len(webhookModels)), commitTxIfControlling(tx, controlsTx)
+}
+
+func (w *WebhookRepository) updateEncryptedSecret(
+	ctx context.Context, tx *sql.Tx, webhookModel *models.X509CertificateSubscriptionWebhook,
+	encryptedSecret *encryption.EncryptedKey,
+) error {
+	setEncryptedSecret(webhookModel, encryptedSecret)
+	_, err := webhookModel.Update(ctx, tx, boil.Whitelist(
+		models.X509CertificateSubscriptionWebhookColumns.Secret,
+		models.X509CertificateSubscriptionWebhookColumns.SecretWrappedDataKey,
+		models.X509CertificateSubscriptionWebhookColumns.SecretMasterKeyID,
+	))
+	return err
+}
+
+func (w *WebhookRepository) postgresqlWebhookToDao(
+	webhook *models.X509CertificateSubscriptionWebhook,
+) (*repository.WebhookDao, error) {
+	secret, err := w.keyEncryptor.Decrypt(&encryption.EncryptedKey{
+		Ciphertext:     webhook.Secret,
+		WrappedDataKey: webhook.SecretWrappedDataKey.Bytes,
+		MasterKeyID:    webhook.SecretMasterKeyID.String,
+	}, []byte(webhook.SubscriptionID))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt secret of webhook %s: %w", webhook.SubscriptionID, err)
+	}
+
+	return repository.NewWebhookDao(
+		uuid.MustParse(webhook.SubscriptionID),
+		webhook.URL,
+		string(secret),
+		normalizeTime(webhook.CreatedAt),
+		normalizeTime(webhook.UpdatedAt),
+	), nil
+}
+
+func setEncryptedSecret(webhookModel *models.X509CertificateSubscriptionWebhook, encryptedSecret *encryption.EncryptedKey) {
+	webhookModel.Secret = encryptedSecret.Ciphertext
+	if encryptedSecret.MasterKeyID != "" {
+		webhookModel.SecretWrappedDataKey = null.BytesFrom(encryptedSecret.WrappedDataKey)
+		webhookModel.SecretMasterKeyID = null.StringFrom(encryptedSecret.MasterKeyID)
+	} else {
+		webhookModel.SecretWrappedDataKey = null.Bytes{}
+		webhookModel.SecretMasterKeyID = null.String{}
+	}
+}
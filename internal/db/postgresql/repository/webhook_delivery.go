@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/postgresql/models"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
+	"time"
+)
+
+type WebhookDeliveryRepository struct {
+	db    *sql.DB
+	clock clockwork.Clock
+}
+
+func NewWebhookDeliveryRepository(db *sql.DB, clock clockwork.Clock) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{db: db, clock: clock}
+}
+
+func (w *WebhookDeliveryRepository) Create(
+	ctx context.Context, delivery *repository.WebhookDeliveryDao,
+) (createdDelivery *repository.WebhookDeliveryDao, err error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, w.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveryModel := &models.WebhookDelivery{
+		ID:             delivery.ID.String(),
+		SubscriptionID: delivery.SubscriptionID.String(),
+		EventType:      delivery.EventType,
+		Payload:        delivery.Payload,
+		Status:         string(delivery.Status),
+		Attempts:       delivery.Attempts,
+		NextAttemptAt:  normalizedNullTimeFromPtr(delivery.NextAttemptAt),
+		LastAttemptAt:  normalizedNullTimeFromPtr(delivery.LastAttemptAt),
+		LastStatusCode: null.IntFromPtr(delivery.LastStatusCode),
+		LastError:      null.StringFromPtr(delivery.LastError),
+		CreatedAt:      normalizeTime(w.clock.Now()),
+		DeliveredAt:    normalizedNullTimeFromPtr(delivery.DeliveredAt),
+	}
+	err = deliveryModel.Insert(ctx, tx, boil.Infer())
+	if err != nil {
+		return nil, err
+	}
+
+	return postgresqlWebhookDeliveryToDao(deliveryModel), commitTxIfControlling(tx, controlsTx)
+}
+
+func (w *WebhookDeliveryRepository) ClaimDue(
+	ctx context.Context, now time.Time, claimedUntil time.Time, limit int,
+) ([]*repository.WebhookDeliveryDao, error) {
+	executor, err := getCtxTxOrExecutor(ctx, w.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	// Rows claimed by a concurrent dispatcher are skipped instead of waiting for their lock
+	query := queries.Raw(`
+		UPDATE webhook_deliveries
+		SET next_attempt_at = $1
+		WHERE id IN (SELECT id
+		             FROM webhook_deliveries
+		             WHERE status = $2
+		               AND next_attempt_at <= $3
+		             ORDER BY next_attempt_at
+		             LIMIT $4 FOR UPDATE SKIP LOCKED)
+		RETURNING *;`,
+		normalizeTime(claimedUntil), string(repository.WebhookDeliveryStatusPending), normalizeTime(now), limit,
+	)
+
+	var claimedDeliveries []*models.WebhookDelivery
+	err = query.Bind(ctx, executor, &claimedDeliveries)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*repository.WebhookDeliveryDao, len(claimedDeliveries))
+	for idx, deliveryModel := range claimedDeliveries {
+		deliveries[idx] = postgresqlWebhookDeliveryToDao(deliveryModel)
+	}
+	return deliveries, nil
+}
+
+func (w *WebhookDeliveryRepository) Update(
+	ctx context.Context, delivery *repository.WebhookDeliveryDao,
+) (err error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, w.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return err
+	}
+
+	_, err = models.WebhookDeliveries(models.WebhookDeliveryWhere.ID.EQ(delivery.ID.String())).
+		UpdateAll(ctx, tx, models.M{
+			models.WebhookDeliveryColumns.Status:         string(delivery.Status),
+			models.WebhookDeliveryColumns.Attempts:       delivery.Attempts,
+			models.WebhookDeliveryColumns.NextAttemptAt:  normalizedNullTimeFromPtr(delivery.NextAttemptAt),
+			models.WebhookDeliveryColumns.LastAttemptAt:  normalizedNullTimeFromPtr(delivery.LastAttemptAt),
+			models.WebhookDeliveryColumns.LastStatusCode: null.IntFromPtr(delivery.LastStatusCode),
+			models.WebhookDeliveryColumns.LastError:      null.StringFromPtr(delivery.LastError),
+			models.WebhookDeliveryColumns.DeliveredAt:    normalizedNullTimeFromPtr(delivery.DeliveredAt),
+		})
+	if err != nil {
+		return err
+	}
+
+	return commitTxIfControlling(tx, controlsTx)
+}
+
+func (w *WebhookDeliveryRepository) FindBySubscriptionID(
+	ctx context.Context, subID uuid.UUID, after *repository.WebhookDeliveryPosition, limit int,
+) ([]*repository.WebhookDeliveryDao, error) {
+	executor, err := getCtxTxOrExecutor(ctx, w.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	queryMods := []qm.QueryMod{models.WebhookDeliveryWhere.SubscriptionID.EQ(subID.String())}
+	if after != nil {
+		// Keyset pagination: continue before the creation time of the last delivery of the previous page
+		queryMods = append(queryMods, qm.Where("(created_at, id) < (?, ?)", after.CreatedAt, after.ID.String()))
+	}
+	queryMods = append(queryMods,
+		qm.OrderBy("created_at desc, id desc"),
+		qm.Limit(limit),
+	)
+
+	deliveryModels, err := models.WebhookDeliveries(queryMods...).All(ctx, executor)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]*repository.WebhookDeliveryDao, len(deliveryModels))
+	for idx, deliveryModel := range deliveryModels {
+		deliveries[idx] = postgresqlWebhookDeliveryToDao(deliveryModel)
+	}
+	return deliveries, nil
+}
+
+func (w *WebhookDeliveryRepository) DeleteFinishedBefore(
+	ctx context.Context, before time.Time,
+) (rowsDeleted int64, err error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, w.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return 0, err
+	}
+
+	rowsDeleted, err = models.WebhookDeliveries(
+		models.WebhookDeliveryWhere.Status.NEQ(string(repository.WebhookDeliveryStatusPending)),
+		models.WebhookDeliveryWhere.LastAttemptAt.LT(null.TimeFrom(normalizeTime(before))),
+	).DeleteAll(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+
+	return rowsDeleted, commitTxIfControlling(tx, controlsTx)
+}
+
+func postgresqlWebhookDeliveryToDao(delivery *models.WebhookDelivery) *repository.WebhookDeliveryDao {
+	return repository.NewWebhookDeliveryDao(
+		uuid.MustParse(delivery.ID),
+		uuid.MustParse(delivery.SubscriptionID),
+		delivery.EventType,
+		delivery.Payload,
+		repository.WebhookDeliveryStatus(delivery.Status),
+		delivery.Attempts,
+		normalizedPtrFromNullTime(delivery.NextAttemptAt),
+		normalizedPtrFromNullTime(delivery.LastAttemptAt),
+		delivery.LastStatusCode.Ptr(),
+		delivery.LastError.Ptr(),
+		normalizeTime(delivery.CreatedAt),
+		normalizedPtrFromNullTime(delivery.DeliveredAt),
+	)
+}
@@ -0,0 +1,312 @@
+package repository
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/postgresql/models"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/encryption"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWebhookRepository_SaveFindAndDelete(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	repo := NewWebhookRepository(postgresqlTestBackend.Db(), encryption.NewPlaintextKeyEncryptor(), fakeClock)
+	t.Cleanup(cleanupWebhookTestTables)
+	sub := createWebhookTestSubscription(t, ctx, fakeClock)
+
+	saved, err := repo.Save(ctx, repository.NewWebhookDao(
+		sub.ID, "https://hooks.example.invalid/a", "0123456789abcdef", fakeClock.Now(), fakeClock.Now(),
+	))
+	if err != nil {
+		t.Fatalf("Save() got unexpected error: %v", err)
+	}
+	expected := repository.NewWebhookDao(
+		sub.ID, "https://hooks.example.invalid/a", "0123456789abcdef",
+		normalizeTime(fakeClock.Now()), normalizeTime(fakeClock.Now()),
+	)
+	if !reflect.DeepEqual(saved, expected) {
+		t.Errorf("Save() = %v, want %v", saved, expected)
+	}
+
+	// Saving again replaces the webhook, but keeps its creation time
+	fakeClock.Advance(time.Hour)
+	replaced, err := repo.Save(ctx, repository.NewWebhookDao(
+		sub.ID, "https://hooks.example.invalid/b", "fedcba9876543210", fakeClock.Now(), fakeClock.Now(),
+	))
+	if err != nil {
+		t.Fatalf("Save() got unexpected error: %v", err)
+	}
+	expected = repository.NewWebhookDao(
+		sub.ID, "https://hooks.example.invalid/b", "fedcba9876543210",
+		expected.CreatedAt, normalizeTime(fakeClock.Now()),
+	)
+	if !reflect.DeepEqual(replaced, expected) {
+		t.Errorf("Save() = %v, want %v", replaced, expected)
+	}
+
+	found, exists, err := repo.FindBySubscriptionID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("FindBySubscriptionID() got unexpected error: %v", err)
+	}
+	if !exists || !reflect.DeepEqual(found, expected) {
+		t.Errorf("FindBySubscriptionID() = %v, want %v", found, expected)
+	}
+
+	subIDs, err := repo.FindSubscriptionIDs(ctx)
+	if err != nil {
+		t.Fatalf("FindSubscriptionIDs() got unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(subIDs, []uuid.UUID{sub.ID}) {
+		t.Errorf("FindSubscriptionIDs() = %v, want %v", subIDs, []uuid.UUID{sub.ID})
+	}
+
+	rowsDeleted, err := repo.Delete(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("Delete() got unexpected error: %v", err)
+	}
+	if rowsDeleted != 1 {
+		t.Errorf("Delete() rowsDeleted = %v, want 1", rowsDeleted)
+	}
+	_, exists, err = repo.FindBySubscriptionID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("FindBySubscriptionID() got unexpected error: %v", err)
+	}
+	if exists {
+		t.Errorf("FindBySubscriptionID() expected deleted webhook to not exist")
+	}
+}
+
+func TestWebhookRepository_EncryptedSecrets(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+	t.Cleanup(cleanupWebhookTestTables)
+	sub := createWebhookTestSubscription(t, ctx, fakeClock)
+	secret := "0123456789abcdef"
+
+	// A secret persisted before encryption was enabled is encrypted afterwards
+	plaintextRepo := NewWebhookRepository(db, encryption.NewPlaintextKeyEncryptor(), fakeClock)
+	if _, err := plaintextRepo.Save(ctx, repository.NewWebhookDao(
+		sub.ID, "https://hooks.example.invalid/a", secret, fakeClock.Now(), fakeClock.Now(),
+	)); err != nil {
+		t.Fatalf("Save() got unexpected error: %v", err)
+	}
+	oldMasterKey := newTestMasterKey(t)
+	oldRepo := NewWebhookRepository(db, encryption.NewEnvelopeKeyEncryptor(oldMasterKey), fakeClock)
+	encryptedSecrets, err := oldRepo.EncryptPlaintextSecrets(ctx, 10)
+	if err != nil {
+		t.Fatalf("EncryptPlaintextSecrets() got unexpected error: %v", err)
+	}
+	if encryptedSecrets != 1 {
+		t.Errorf("EncryptPlaintextSecrets() encrypted %d secrets, want 1", encryptedSecrets)
+	}
+	webhookModel, err := models.FindX509CertificateSubscriptionWebhook(ctx, db, sub.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(webhookModel.Secret) == secret || webhookModel.SecretMasterKeyID.String != oldMasterKey.ID() {
+		t.Errorf("expected persisted secret to be encrypted with the master key %s", oldMasterKey.ID())
+	}
+
+	// Rotating the master key re-wraps the data key, the secret stays decryptable
+	newRepo := NewWebhookRepository(
+		db, encryption.NewEnvelopeKeyEncryptor(newTestMasterKey(t), oldMasterKey), fakeClock,
+	)
+	rewrappedKeys, err := newRepo.RewrapDataKeys(ctx, 10)
+	if err != nil {
+		t.Fatalf("RewrapDataKeys() got unexpected error: %v", err)
+	}
+	if rewrappedKeys != 1 {
+		t.Errorf("RewrapDataKeys() re-wrapped %d data keys, want 1", rewrappedKeys)
+	}
+	found, exists, err := newRepo.FindBySubscriptionID(ctx, sub.ID)
+	if err != nil {
+		t.Fatalf("FindBySubscriptionID() got unexpected error: %v", err)
+	}
+	if !exists || found.Secret != secret {
+		t.Errorf("FindBySubscriptionID() = %v, want secret %v", found, secret)
+	}
+
+	// Decrypting with the wrong subscription ID as associated data fails
+	webhookModel, err = models.FindX509CertificateSubscriptionWebhook(ctx, db, sub.ID.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhookModel.SubscriptionID = "e2f4a6c8-1b3d-4f5a-9c7e-8b1d3f5a7c9e"
+	if _, err := newRepo.postgresqlWebhookToDao(webhookModel); err == nil {
+		t.Errorf("postgresqlWebhookToDao() expected error for secret bound to another subscription")
+	}
+}
+
+func TestWebhookDeliveryRepository_ClaimDueAndUpdate(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	repo := NewWebhookDeliveryRepository(postgresqlTestBackend.Db(), fakeClock)
+	t.Cleanup(cleanupWebhookTestTables)
+	sub := createWebhookTestSubscription(t, ctx, fakeClock)
+
+	now := fakeClock.Now()
+	later := now.Add(time.Hour)
+	due, err := repo.Create(ctx, repository.NewWebhookDeliveryDao(
+		uuid.MustParse("0d2f4b6c-8e1a-4c3e-9b5d-7f1a3c5e7b9d"), sub.ID, "x509_certificate_subscription.updated",
+		[]byte(`{}`), repository.WebhookDeliveryStatusPending, 0, &now, nil, nil, nil, now, nil,
+	))
+	if err != nil {
+		t.Fatalf("Create() got unexpected error: %v", err)
+	}
+	if _, err := repo.Create(ctx, repository.NewWebhookDeliveryDao(
+		uuid.MustParse("6b8d1f3a-5c7e-4a9b-8d2f-4a6c8e1b3d5f"), sub.ID, "x509_certificate_subscription.updated",
+		[]byte(`{}`), repository.WebhookDeliveryStatusPending, 0, &later, nil, nil, nil, now, nil,
+	)); err != nil {
+		t.Fatalf("Create() got unexpected error: %v", err)
+	}
+
+	claimedUntil := now.Add(time.Minute)
+	claimed, err := repo.ClaimDue(ctx, now, claimedUntil, 10)
+	if err != nil {
+		t.Fatalf("ClaimDue() got unexpected error: %v", err)
+	}
+	expected := *due
+	expected.NextAttemptAt = &claimedUntil
+	if len(claimed) != 1 || !reflect.DeepEqual(claimed[0], &expected) {
+		t.Fatalf("ClaimDue() = %v, want [%v]", claimed, &expected)
+	}
+
+	// Claimed deliveries aren't due until the claim expires
+	claimed, err = repo.ClaimDue(ctx, now, claimedUntil, 10)
+	if err != nil {
+		t.Fatalf("ClaimDue() got unexpected error: %v", err)
+	}
+	if len(claimed) != 0 {
+		t.Errorf("ClaimDue() = %v, want none", claimed)
+	}
+
+	statusCode := 204
+	expected.Status = repository.WebhookDeliveryStatusDelivered
+	expected.Attempts = 1
+	expected.NextAttemptAt = nil
+	expected.LastAttemptAt = &now
+	expected.LastStatusCode = &statusCode
+	expected.DeliveredAt = &now
+	if err := repo.Update(ctx, &expected); err != nil {
+		t.Fatalf("Update() got unexpected error: %v", err)
+	}
+
+	deliveries, err := repo.FindBySubscriptionID(ctx, sub.ID, nil, 10)
+	if err != nil {
+		t.Fatalf("FindBySubscriptionID() got unexpected error: %v", err)
+	}
+	if len(deliveries) != 2 {
+		t.Fatalf("FindBySubscriptionID() expected 2 deliveries, but got %d", len(deliveries))
+	}
+	for _, delivery := range deliveries {
+		if delivery.ID == expected.ID && !reflect.DeepEqual(delivery, &expected) {
+			t.Errorf("FindBySubscriptionID() delivery = %v, want %v", delivery, &expected)
+		}
+	}
+
+	nextDeliveries, err := repo.FindBySubscriptionID(ctx, sub.ID, &repository.WebhookDeliveryPosition{
+		CreatedAt: deliveries[0].CreatedAt, ID: deliveries[0].ID,
+	}, 10)
+	if err != nil {
+		t.Fatalf("FindBySubscriptionID() got unexpected error: %v", err)
+	}
+	if len(nextDeliveries) != 1 || nextDeliveries[0].ID != deliveries[1].ID {
+		t.Errorf("FindBySubscriptionID() after %v = %v, want [%v]", deliveries[0].ID, nextDeliveries, deliveries[1])
+	}
+
+	// Positions don't need to exist, so the history continues after cleaned up deliveries
+	deletedPosition := &repository.WebhookDeliveryPosition{
+		CreatedAt: now, ID: uuid.MustParse("5a7c9e1b-3d5f-4a7c-9e1b-3d5f7a9c1e3b"),
+	}
+	nextDeliveries, err = repo.FindBySubscriptionID(ctx, sub.ID, deletedPosition, 10)
+	if err != nil {
+		t.Fatalf("FindBySubscriptionID() got unexpected error: %v", err)
+	}
+	if len(nextDeliveries) != 1 || nextDeliveries[0].ID != due.ID {
+		t.Errorf("FindBySubscriptionID() after %v = %v, want [%v]", deletedPosition.ID, nextDeliveries, due)
+	}
+}
+
+func TestWebhookDeliveryRepository_DeleteFinishedBefore(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	repo := NewWebhookDeliveryRepository(postgresqlTestBackend.Db(), fakeClock)
+	t.Cleanup(cleanupWebhookTestTables)
+	sub := createWebhookTestSubscription(t, ctx, fakeClock)
+
+	now := fakeClock.Now()
+	earlier := now.Add(-2 * time.Hour)
+	deliveries := []*repository.WebhookDeliveryDao{
+		repository.NewWebhookDeliveryDao(
+			uuid.MustParse("1a3c5e7b-9d1f-4b3d-8f5a-7c9e1b3d5f7a"), sub.ID, "x509_certificate_subscription.updated",
+			[]byte(`{}`), repository.WebhookDeliveryStatusDelivered, 1, nil, &earlier, nil, nil, earlier, &earlier,
+		),
+		repository.NewWebhookDeliveryDao(
+			uuid.MustParse("2b4d6f8a-1c3e-4d5f-9a7b-8d1f3a5c7e9b"), sub.ID, "x509_certificate_subscription.updated",
+			[]byte(`{}`), repository.WebhookDeliveryStatusDead, 3, nil, &earlier, nil, nil, earlier, nil,
+		),
+		repository.NewWebhookDeliveryDao(
+			uuid.MustParse("3c5e7a9b-2d4f-4e6a-8b8c-9e2a4b6d8f1c"), sub.ID, "x509_certificate_subscription.updated",
+			[]byte(`{}`), repository.WebhookDeliveryStatusPending, 1, &now, &earlier, nil, nil, earlier, nil,
+		),
+		repository.NewWebhookDeliveryDao(
+			uuid.MustParse("4d6f8b1c-3e5a-4f7b-9c9d-1f3b5c7e9a2d"), sub.ID, "x509_certificate_subscription.updated",
+			[]byte(`{}`), repository.WebhookDeliveryStatusDelivered, 1, nil, &now, nil, nil, now, &now,
+		),
+	}
+	for _, delivery := range deliveries {
+		if _, err := repo.Create(ctx, delivery); err != nil {
+			t.Fatalf("Create() got unexpected error: %v", err)
+		}
+	}
+
+	// Only the delivered and the dead delivery last attempted before the cutoff are deleted
+	rowsDeleted, err := repo.DeleteFinishedBefore(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("DeleteFinishedBefore() got unexpected error: %v", err)
+	}
+	if rowsDeleted != 2 {
+		t.Errorf("DeleteFinishedBefore() rowsDeleted = %v, want 2", rowsDeleted)
+	}
+	remaining, err := repo.FindBySubscriptionID(ctx, sub.ID, nil, 10)
+	if err != nil {
+		t.Fatalf("FindBySubscriptionID() got unexpected error: %v", err)
+	}
+	var remainingIDs []uuid.UUID
+	for _, delivery := range remaining {
+		remainingIDs = append(remainingIDs, delivery.ID)
+	}
+	wantIDs := []uuid.UUID{deliveries[3].ID, deliveries[2].ID}
+	if !reflect.DeepEqual(remainingIDs, wantIDs) {
+		t.Errorf("FindBySubscriptionID() = %v, want %v", remainingIDs, wantIDs)
+	}
+}
+
+func createWebhookTestSubscription(
+	t *testing.T, ctx context.Context, clock clockwork.Clock,
+) *repository.X509CertificateSubscriptionDao {
+	sub, err := NewX509CertificateSubscriptionRepository(postgresqlTestBackend.Db(), clock).Create(
+		ctx, repository.NewX509CertificateSubscriptionDao(
+			uuid.MustParse("c1e3a5b7-9d2f-4a6c-8e1b-3d5f7a9c1e3b"), []string{"www.example.invalid"}, false,
+			clock.Now(), clock.Now(),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sub
+}
+
+func cleanupWebhookTestTables() {
+	// Deleting the subscriptions cascades to their webhooks and deliveries
+	_, err := postgresqlTestBackend.Db().Exec("delete from x509_certificate_subscriptions")
+	if err != nil {
+		panic(err)
+	}
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/volatiletech/sqlboiler/v4/queries"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
 	"github.com/volatiletech/sqlboiler/v4/types"
+	"strings"
 	"time"
 )
 
@@ -113,6 +114,124 @@ func (r *X509CertificateRepository) FindByPublicKeyHashAndNoPrivateKeySet(ctx co
 	return convertedCerts, nil
 }
 
+func (r *X509CertificateRepository) FindByID(
+	ctx context.Context, id uuid.UUID,
+) (cert *repository.X509CertificateDao, exists bool, err error) {
+	executor, err := getCtxTxOrExecutor(ctx, r.db)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	fetchedCert, err := postgresqlmodels.FindX509Certificate(ctx, executor, id.String())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	return postgresqlCertificateToDao(fetchedCert), true, nil
+}
+
+func (r *X509CertificateRepository) Search(
+	ctx context.Context, search *repository.X509CertificateSearchDao,
+) ([]*repository.X509CertificateDao, error) {
+	executor, err := getCtxTxOrExecutor(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	var queryMods []qm.QueryMod
+	if search.SubjectAltName != "" {
+		if strings.Contains(search.SubjectAltName, "*") {
+			queryMods = append(queryMods, qm.Where(
+				"exists (select 1 from unnest(subject_alt_names) as san where san like ?)",
+				wildcardToLikePattern(search.SubjectAltName),
+			))
+		} else {
+			queryMods = append(queryMods, qm.Where("subject_alt_names @> ?", types.StringArray{search.SubjectAltName}))
+		}
+	}
+	if search.CommonName != "" {
+		if strings.Contains(search.CommonName, "*") {
+			queryMods = append(queryMods, qm.Where("common_name like ?", wildcardToLikePattern(search.CommonName)))
+		} else {
+			queryMods = append(queryMods, postgresqlmodels.X509CertificateWhere.CommonName.EQ(search.CommonName))
+		}
+	}
+	if search.IssuerID != nil {
+		// Uses the issuer hash index and also finds certificates which aren't linked to their issuer yet
+		queryMods = append(queryMods, qm.Where(
+			"issuer_hash = (select subject_hash from x509_certificates where id = ?)", search.IssuerID.String(),
+		))
+	}
+	if search.NotAfterBefore != nil {
+		queryMods = append(queryMods, postgresqlmodels.X509CertificateWhere.NotAfter.LT(*search.NotAfterBefore))
+	}
+	if search.NotAfterAfter != nil {
+		queryMods = append(queryMods, postgresqlmodels.X509CertificateWhere.NotAfter.GT(*search.NotAfterAfter))
+	}
+	if search.HasPrivateKey != nil {
+		if *search.HasPrivateKey {
+			queryMods = append(queryMods, postgresqlmodels.X509CertificateWhere.PrivateKeyID.IsNotNull())
+		} else {
+			queryMods = append(queryMods, postgresqlmodels.X509CertificateWhere.PrivateKeyID.IsNull())
+		}
+	}
+	if search.CreatedBefore != nil {
+		queryMods = append(queryMods, postgresqlmodels.X509CertificateWhere.CreatedAt.LT(*search.CreatedBefore))
+	}
+	if search.CreatedAfter != nil {
+		queryMods = append(queryMods, postgresqlmodels.X509CertificateWhere.CreatedAt.GT(*search.CreatedAfter))
+	}
+
+	var sortColumn string
+	switch search.SortBy {
+	case repository.X509CertificateSortCreatedAt, "":
+		sortColumn = postgresqlmodels.X509CertificateColumns.CreatedAt
+	case repository.X509CertificateSortNotAfter:
+		sortColumn = postgresqlmodels.X509CertificateColumns.NotAfter
+	case repository.X509CertificateSortCommonName:
+		sortColumn = postgresqlmodels.X509CertificateColumns.CommonName
+	default:
+		return nil, fmt.Errorf("unknown sort field %s", search.SortBy)
+	}
+	comparator, direction := ">", "asc"
+	if search.SortDescending {
+		comparator, direction = "<", "desc"
+	}
+	if search.After != nil {
+		// Keyset pagination: continue after the sort values of the last certificate of the previous page
+		var afterValue interface{}
+		switch sortColumn {
+		case postgresqlmodels.X509CertificateColumns.CreatedAt:
+			afterValue = search.After.CreatedAt
+		case postgresqlmodels.X509CertificateColumns.NotAfter:
+			afterValue = search.After.NotAfter
+		case postgresqlmodels.X509CertificateColumns.CommonName:
+			afterValue = search.After.CommonName
+		}
+		queryMods = append(queryMods, qm.Where(
+			fmt.Sprintf("(%s, id) %s (?, ?)", sortColumn, comparator), afterValue, search.After.ID.String(),
+		))
+	}
+	queryMods = append(queryMods,
+		qm.OrderBy(fmt.Sprintf("%[1]s %[2]s, id %[2]s", sortColumn, direction)),
+		qm.Limit(search.Limit),
+	)
+
+	fetchedCerts, err := postgresqlmodels.X509Certificates(queryMods...).All(ctx, executor)
+	if err != nil {
+		return nil, err
+	}
+
+	convertedCerts := make([]*repository.X509CertificateDao, len(fetchedCerts))
+	for i, cert := range fetchedCerts {
+		convertedCerts[i] = postgresqlCertificateToDao(cert)
+	}
+	return convertedCerts, nil
+}
+
 func (r *X509CertificateRepository) FindBySubjectHash(ctx context.Context, subjectHash []byte) ([]*repository.X509CertificateDao, error) {
 	executor, err := getCtxTxOrExecutor(ctx, r.db)
 	if err != nil {
@@ -181,6 +300,149 @@ func (r *X509CertificateRepository) FindLatestActiveBySANsAndCreatedAtAfter(
 	return convertedCertDaos, nil
 }
 
+func (r *X509CertificateRepository) FindLatestActiveWithPrivateKeyBySAN(
+	ctx context.Context, subjectAltName string,
+) (cert *repository.X509CertificateDao, exists bool, err error) {
+	executor, err := getCtxTxOrExecutor(ctx, r.db)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	// Certificates without a private key are filtered before picking the latest, so a renewal which has no private key
+	// yet doesn't hide the previous certificate
+	fetchedCert, err := postgresqlmodels.X509Certificates(
+		postgresqlmodels.X509CertificateWhere.PrivateKeyID.IsNotNull(),
+		qm.Where("not_before < now() and not_after > now()"),
+		qm.Where("? = any(subject_alt_names || array[common_name])", subjectAltName),
+		qm.OrderBy(postgresqlmodels.X509CertificateColumns.NotBefore+" desc, "+postgresqlmodels.X509CertificateColumns.ID),
+		qm.Limit(1),
+	).One(ctx, executor)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return postgresqlCertificateToDao(fetchedCert), true, nil
+}
+
+func (r *X509CertificateRepository) GetLatestChangeSequence(ctx context.Context) (int64, error) {
+	executor, err := getCtxTxOrExecutor(ctx, r.db)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	var latestChangeSeq int64
+	err = executor.QueryRowContext(ctx, `SELECT get_latest_change_sequence();`).Scan(&latestChangeSeq)
+	if err != nil {
+		return 0, err
+	}
+	return latestChangeSeq, nil
+}
+
+func (r *X509CertificateRepository) FindLatestActiveBySubscriptionAndChangedBetween(
+	ctx context.Context, subID uuid.UUID, changedAfter int64, changedUntil int64,
+) ([]*repository.X509CertificateDao, error) {
+	executor, err := getCtxTxOrExecutor(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	query := queries.Raw(
+		`SELECT * FROM get_certificate_changes($1::uuid, $2::bigint, $3::bigint);`,
+		subID.String(), changedAfter, changedUntil,
+	)
+
+	var fetchedCerts []*postgresqlmodels.X509Certificate
+	err = query.Bind(ctx, executor, &fetchedCerts)
+	if err != nil {
+		return nil, err
+	}
+
+	convertedCertDaos := make([]*repository.X509CertificateDao, len(fetchedCerts))
+	for i, foundCert := range fetchedCerts {
+		convertedCertDaos[i] = postgresqlCertificateToDao(foundCert)
+	}
+
+	return convertedCertDaos, nil
+}
+
+func (r *X509CertificateRepository) FindLatestActiveExpiringBetween(
+	ctx context.Context, now time.Time, expiringUntil time.Time,
+) ([]*repository.X509CertificateDao, error) {
+	executor, err := getCtxTxOrExecutor(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	fetchedCerts, err := postgresqlmodels.X509Certificates(
+		postgresqlmodels.X509CertificateWhere.NotBefore.LTE(normalizeTime(now)),
+		postgresqlmodels.X509CertificateWhere.NotAfter.GT(normalizeTime(now)),
+		postgresqlmodels.X509CertificateWhere.NotAfter.LTE(normalizeTime(expiringUntil)),
+		qm.Where(`not exists (select 1
+		                      from x509_certificates replacement
+		                      where replacement.subject_alt_names = x509_certificates.subject_alt_names
+		                        and replacement.common_name = x509_certificates.common_name
+		                        and replacement.not_after > x509_certificates.not_after)`),
+		qm.OrderBy(postgresqlmodels.X509CertificateColumns.NotAfter+", "+postgresqlmodels.X509CertificateColumns.ID),
+	).All(ctx, executor)
+	if err != nil {
+		return nil, err
+	}
+
+	convertedCerts := make([]*repository.X509CertificateDao, len(fetchedCerts))
+	for i, cert := range fetchedCerts {
+		convertedCerts[i] = postgresqlCertificateToDao(cert)
+	}
+	return convertedCerts, nil
+}
+
+func (r *X509CertificateRepository) CountByNotAfter(ctx context.Context, bounds []time.Time) ([]int64, error) {
+	executor, err := getCtxTxOrExecutor(ctx, r.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	normalizedBounds := make([]string, len(bounds))
+	for i, bound := range bounds {
+		normalizedBounds[i] = normalizeTime(bound).Format("2006-01-02 15:04:05.999999")
+	}
+	// width_bucket returns 0 below the first bound and i from bound i-1 until before bound i
+	rows, err := executor.QueryContext(ctx, `
+		SELECT width_bucket(not_after, $1::timestamp[]) AS bucket, count(*)
+		FROM x509_certificates
+		GROUP BY bucket;`,
+		types.StringArray(normalizedBounds),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make([]int64, len(bounds)+1)
+	for rows.Next() {
+		var bucket int
+		var count int64
+		if err := rows.Scan(&bucket, &count); err != nil {
+			return nil, err
+		}
+		counts[bucket] = count
+	}
+	return counts, rows.Err()
+}
+
+func (r *X509CertificateRepository) CountOrphans(ctx context.Context) (int64, error) {
+	executor, err := getCtxTxOrExecutor(ctx, r.db)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	return postgresqlmodels.X509Certificates(
+		postgresqlmodels.X509CertificateWhere.ParentCertificateID.IsNull(),
+		qm.Where("issuer_hash <> subject_hash"),
+	).Count(ctx, executor)
+}
+
 func (r *X509CertificateRepository) FindCertificateChain(ctx context.Context, startCertId uuid.UUID) ([]*repository.X509CertificateDao, error) {
 	executor, err := getCtxTxOrExecutor(ctx, r.db)
 	if err != nil {
@@ -3,12 +3,14 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jonboulle/clockwork"
 	"github.com/pki-vault/server/internal/db/postgresql/models"
 	"github.com/pki-vault/server/internal/db/repository"
 	"github.com/volatiletech/sqlboiler/v4/boil"
+	"github.com/volatiletech/sqlboiler/v4/queries/qm"
 )
 
 type X509CertificateSubscriptionRepository struct {
@@ -29,11 +31,13 @@ func (x *X509CertificateSubscriptionRepository) Create(
 		return nil, err
 	}
 
+	now := normalizeTime(x.clock.Now())
 	sub := &models.X509CertificateSubscription{
 		ID:                certSub.ID.String(),
 		SubjectAltNames:   certSub.SubjectAltNames,
 		IncludePrivateKey: certSub.IncludePrivateKey,
-		CreatedAt:         normalizeTime(x.clock.Now()),
+		CreatedAt:         now,
+		UpdatedAt:         now,
 	}
 	err = sub.Insert(ctx, x.db, boil.Infer())
 	if err != nil {
@@ -43,6 +47,25 @@ func (x *X509CertificateSubscriptionRepository) Create(
 	return postgresqlCertificateSubscriptionToDto(sub), commitTxIfControlling(tx, controlsTx)
 }
 
+func (x *X509CertificateSubscriptionRepository) FindByID(
+	ctx context.Context, id uuid.UUID,
+) (sub *repository.X509CertificateSubscriptionDao, exists bool, err error) {
+	executor, err := getCtxTxOrExecutor(ctx, x.db)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	fetchedSub, err := models.FindX509CertificateSubscription(ctx, executor, id.String())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+
+	return postgresqlCertificateSubscriptionToDto(fetchedSub), true, nil
+}
+
 func (x *X509CertificateSubscriptionRepository) FindByIDs(
 	ctx context.Context, IDs []uuid.UUID,
 ) ([]*repository.X509CertificateSubscriptionDao, error) {
@@ -70,6 +93,68 @@ func (x *X509CertificateSubscriptionRepository) FindByIDs(
 	return convertedSubs, nil
 }
 
+func (x *X509CertificateSubscriptionRepository) FindAll(
+	ctx context.Context, after *repository.X509CertificateSubscriptionPosition, limit int,
+) ([]*repository.X509CertificateSubscriptionDao, error) {
+	executor, err := getCtxTxOrExecutor(ctx, x.db)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	var queryMods []qm.QueryMod
+	if after != nil {
+		// Keyset pagination: continue after the creation time of the last subscription of the previous page
+		queryMods = append(queryMods, qm.Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID.String()))
+	}
+	queryMods = append(queryMods,
+		qm.OrderBy(models.X509CertificateSubscriptionColumns.CreatedAt+", "+models.X509CertificateSubscriptionColumns.ID),
+		qm.Limit(limit),
+	)
+
+	fetchedSubs, err := models.X509CertificateSubscriptions(queryMods...).All(ctx, executor)
+	if err != nil {
+		return nil, err
+	}
+
+	convertedSubs := make([]*repository.X509CertificateSubscriptionDao, len(fetchedSubs))
+	for i, result := range fetchedSubs {
+		convertedSubs[i] = postgresqlCertificateSubscriptionToDto(result)
+	}
+	return convertedSubs, nil
+}
+
+func (x *X509CertificateSubscriptionRepository) Update(
+	ctx context.Context, certSub *repository.X509CertificateSubscriptionDao,
+) (updatedSub *repository.X509CertificateSubscriptionDao, exists bool, err error) {
+	tx, ctx, controlsTx, err := getOrCreateTx(ctx, x.db)
+	defer rollbackTxOnErrIfControlling(tx, &err, controlsTx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	sub, err := models.FindX509CertificateSubscription(ctx, tx, certSub.ID.String())
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, false, commitTxIfControlling(tx, controlsTx)
+		}
+		return nil, false, err
+	}
+
+	sub.SubjectAltNames = certSub.SubjectAltNames
+	sub.IncludePrivateKey = certSub.IncludePrivateKey
+	sub.UpdatedAt = normalizeTime(x.clock.Now())
+	_, err = sub.Update(ctx, tx, boil.Whitelist(
+		models.X509CertificateSubscriptionColumns.SubjectAltNames,
+		models.X509CertificateSubscriptionColumns.IncludePrivateKey,
+		models.X509CertificateSubscriptionColumns.UpdatedAt,
+	))
+	if err != nil {
+		return nil, false, err
+	}
+
+	return postgresqlCertificateSubscriptionToDto(sub), true, commitTxIfControlling(tx, controlsTx)
+}
+
 func (x *X509CertificateSubscriptionRepository) Delete(
 	ctx context.Context, id uuid.UUID,
 ) (rowsDeleted int64, err error) {
@@ -89,11 +174,30 @@ func (x *X509CertificateSubscriptionRepository) Delete(
 	return rowsDeleted, commitTxIfControlling(tx, controlsTx)
 }
 
+func (x *X509CertificateSubscriptionRepository) CountWithoutActiveCertificate(ctx context.Context) (int64, error) {
+	executor, err := getCtxTxOrExecutor(ctx, x.db)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	var count int64
+	err = executor.QueryRowContext(ctx, `
+		SELECT count(*)
+		FROM x509_certificate_subscriptions sub
+		WHERE NOT EXISTS (SELECT 1 FROM get_certificate_updates(sub.subject_alt_names, '-infinity'::timestamp));`,
+	).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 func postgresqlCertificateSubscriptionToDto(sub *models.X509CertificateSubscription) *repository.X509CertificateSubscriptionDao {
 	return repository.NewX509CertificateSubscriptionDao(
 		uuid.MustParse(sub.ID),
 		sub.SubjectAltNames,
 		sub.IncludePrivateKey,
 		normalizeTime(sub.CreatedAt),
+		normalizeTime(sub.UpdatedAt),
 	)
 }
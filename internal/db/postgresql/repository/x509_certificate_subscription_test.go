@@ -72,9 +72,11 @@ func TestX509CertificateSubscriptionRepository_Create(t *testing.T) {
 			SubjectAltNames:   []string{"test.example.invalid", "sub.example.invalid"},
 			IncludePrivateKey: true,
 			CreatedAt:         fakeClock.Now(),
+			UpdatedAt:         fakeClock.Now(),
 		}
 		expectedSub := toBeCreatedSub
 		expectedSub.CreatedAt = normalizeTime(expectedSub.CreatedAt)
+		expectedSub.UpdatedAt = normalizeTime(expectedSub.UpdatedAt)
 
 		exists, err := models.X509CertificateSubscriptions(models.X509CertificateSubscriptionWhere.ID.EQ(id.String())).Exists(ctx, db)
 		if err != nil {
@@ -130,6 +132,7 @@ func TestX509CertificateSubscriptionRepository_Delete(t *testing.T) {
 			SubjectAltNames:   []string{"test.example.invalid", "sub.example.invalid"},
 			IncludePrivateKey: true,
 			CreatedAt:         fakeClock.Now(),
+			UpdatedAt:         fakeClock.Now(),
 		}
 		err := toBeCreatedSub.Insert(ctx, db, boil.Infer())
 		if err != nil {
@@ -194,6 +197,7 @@ func TestX509CertificateSubscriptionRepository_FindByIDs(t *testing.T) {
 					SubjectAltNames:   []string{"test.example.invalid"},
 					IncludePrivateKey: false,
 					CreatedAt:         normalizeTime(fakeClock.Now()),
+					UpdatedAt:         normalizeTime(fakeClock.Now()),
 				},
 			},
 			wantErr: false,
@@ -232,6 +236,221 @@ func TestX509CertificateSubscriptionRepository_FindByIDs(t *testing.T) {
 	}
 }
 
+func TestX509CertificateSubscriptionRepository_FindByID(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	repo := NewX509CertificateSubscriptionRepository(postgresqlTestBackend.Db(), fakeClock)
+
+	if err := seedX509CertificateSubscriptionTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		id         uuid.UUID
+		want       *repository.X509CertificateSubscriptionDao
+		wantExists bool
+	}{
+		{
+			name: "find existing",
+			id:   uuid.MustParse("bd319c37-f6ff-4ca8-9bd2-2d17d962387c"),
+			want: &repository.X509CertificateSubscriptionDao{
+				ID:                uuid.MustParse("bd319c37-f6ff-4ca8-9bd2-2d17d962387c"),
+				SubjectAltNames:   []string{"sub.pki-vault.invalid"},
+				IncludePrivateKey: true,
+				CreatedAt:         normalizeTime(fakeClock.Now().Add(2 * 24 * time.Hour)),
+				UpdatedAt:         normalizeTime(fakeClock.Now().Add(2 * 24 * time.Hour)),
+			},
+			wantExists: true,
+		},
+		{
+			name:       "dont find not existing",
+			id:         uuid.MustParse("26a1e6ec-570f-44e2-b2bf-8c43ea90ce68"),
+			wantExists: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, exists, err := repo.FindByID(ctx, tt.id)
+			if err != nil {
+				t.Fatalf("FindByID() got unexpected error: %v", err)
+			}
+			if exists != tt.wantExists {
+				t.Errorf("FindByID() exists = %v, want %v", exists, tt.wantExists)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindByID() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestX509CertificateSubscriptionRepository_FindAll(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	repo := NewX509CertificateSubscriptionRepository(postgresqlTestBackend.Db(), fakeClock)
+
+	if err := seedX509CertificateSubscriptionTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		after   *repository.X509CertificateSubscriptionPosition
+		limit   int
+		wantIDs []string
+	}{
+		{
+			name:  "first page",
+			limit: 2,
+			wantIDs: []string{
+				"7c9098f4-7dbd-471e-83fb-19be7095ae04",
+				"fea3641b-d12c-41e2-880e-e9c27c7adc35",
+			},
+		},
+		{
+			name: "continue after subscription",
+			after: &repository.X509CertificateSubscriptionPosition{
+				CreatedAt: normalizeTime(fakeClock.Now().Add(1 * 24 * time.Hour)),
+				ID:        uuid.MustParse("fea3641b-d12c-41e2-880e-e9c27c7adc35"),
+			},
+			limit:   2,
+			wantIDs: []string{"bd319c37-f6ff-4ca8-9bd2-2d17d962387c"},
+		},
+		{
+			name: "continue after deleted subscription",
+			after: &repository.X509CertificateSubscriptionPosition{
+				CreatedAt: normalizeTime(fakeClock.Now().Add(12 * time.Hour)),
+				ID:        uuid.MustParse("0b5c4f0e-2a57-4c4e-9d0c-6f7b1f1f4e21"),
+			},
+			limit: 2,
+			wantIDs: []string{
+				"fea3641b-d12c-41e2-880e-e9c27c7adc35",
+				"bd319c37-f6ff-4ca8-9bd2-2d17d962387c",
+			},
+		},
+		{
+			name: "continue after last subscription",
+			after: &repository.X509CertificateSubscriptionPosition{
+				CreatedAt: normalizeTime(fakeClock.Now().Add(2 * 24 * time.Hour)),
+				ID:        uuid.MustParse("bd319c37-f6ff-4ca8-9bd2-2d17d962387c"),
+			},
+			limit:   2,
+			wantIDs: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.FindAll(ctx, tt.after, tt.limit)
+			if err != nil {
+				t.Fatalf("FindAll() got unexpected error: %v", err)
+			}
+			gotIDs := make([]string, len(got))
+			for i, sub := range got {
+				gotIDs[i] = sub.ID.String()
+			}
+			if !reflect.DeepEqual(gotIDs, tt.wantIDs) {
+				t.Errorf("FindAll() got = %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestX509CertificateSubscriptionRepository_Update(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+	repo := NewX509CertificateSubscriptionRepository(db, fakeClock)
+
+	if err := seedX509CertificateSubscriptionTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("update existing", func(t *testing.T) {
+		fakeClock.Advance(time.Hour)
+		id := uuid.MustParse("7c9098f4-7dbd-471e-83fb-19be7095ae04")
+		expectedSub := &repository.X509CertificateSubscriptionDao{
+			ID:                id,
+			SubjectAltNames:   []string{"test.example.invalid", "other.example.invalid"},
+			IncludePrivateKey: true,
+			CreatedAt:         normalizeTime(fakeClock.Now().Add(-time.Hour)),
+			UpdatedAt:         normalizeTime(fakeClock.Now()),
+		}
+
+		updatedSub, exists, err := repo.Update(ctx, &repository.X509CertificateSubscriptionDao{
+			ID:                id,
+			SubjectAltNames:   []string{"test.example.invalid", "other.example.invalid"},
+			IncludePrivateKey: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !exists {
+			t.Fatal("Update() expected subscription to exist")
+		}
+		if !reflect.DeepEqual(updatedSub, expectedSub) {
+			t.Errorf("Update() = %+v, want %+v", updatedSub, expectedSub)
+		}
+
+		// Ensure the updated record in the database is correct
+		fetchedSubModel, err := models.FindX509CertificateSubscription(ctx, db, id.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fetchedSub := postgresqlCertificateSubscriptionToDto(fetchedSubModel); !reflect.DeepEqual(fetchedSub, expectedSub) {
+			t.Errorf("Update() persisted = %+v, want %+v", fetchedSub, expectedSub)
+		}
+	})
+
+	t.Run("dont update not existing", func(t *testing.T) {
+		_, exists, err := repo.Update(ctx, &repository.X509CertificateSubscriptionDao{
+			ID:              uuid.MustParse("26a1e6ec-570f-44e2-b2bf-8c43ea90ce68"),
+			SubjectAltNames: []string{"test.example.invalid"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exists {
+			t.Error("Update() expected subscription to not exist")
+		}
+	})
+}
+
+func TestX509CertificateSubscriptionRepository_CountWithoutActiveCertificate(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+	repo := NewX509CertificateSubscriptionRepository(db, fakeClock)
+
+	if err := seedX509CertificateTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanX509CertificateTestTables)
+	t.Cleanup(cleanupX509CertificateSubscriptionTestTables)
+	for _, sub := range []*repository.X509CertificateSubscriptionDao{
+		repository.NewX509CertificateSubscriptionDao(
+			uuid.MustParse("7a9c1e3b-5d7f-4a2c-8e4b-6d8f0a2c4e6a"), []string{"example.invalid"}, false,
+			fakeClock.Now(), fakeClock.Now(),
+		),
+		repository.NewX509CertificateSubscriptionDao(
+			uuid.MustParse("8b0d2f4a-6c8e-4b3d-9f5c-7e9a1b3d5f7b"), []string{"unknown.invalid"}, false,
+			fakeClock.Now(), fakeClock.Now(),
+		),
+	} {
+		if _, err := repo.Create(ctx, sub); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := repo.CountWithoutActiveCertificate(ctx)
+	if err != nil {
+		t.Fatalf("CountWithoutActiveCertificate() got unexpected error: %v", err)
+	}
+	if got != 1 {
+		t.Errorf("CountWithoutActiveCertificate() got = %v, want %v", got, 1)
+	}
+}
+
 func Test_postgresqlSubscriptionToDto(t *testing.T) {
 	fakeClock := clockwork.NewFakeClock()
 
@@ -251,6 +470,7 @@ func Test_postgresqlSubscriptionToDto(t *testing.T) {
 					SubjectAltNames:   []string{"test.example.invalid", "test2.example.invalid"},
 					IncludePrivateKey: true,
 					CreatedAt:         fakeClock.Now(),
+					UpdatedAt:         fakeClock.Now().Add(time.Hour),
 				},
 			},
 			want: &repository.X509CertificateSubscriptionDao{
@@ -258,6 +478,7 @@ func Test_postgresqlSubscriptionToDto(t *testing.T) {
 				SubjectAltNames:   []string{"test.example.invalid", "test2.example.invalid"},
 				IncludePrivateKey: true,
 				CreatedAt:         normalizeTime(fakeClock.Now()),
+				UpdatedAt:         normalizeTime(fakeClock.Now().Add(time.Hour)),
 			},
 		},
 		{
@@ -268,6 +489,7 @@ func Test_postgresqlSubscriptionToDto(t *testing.T) {
 					SubjectAltNames:   []string{"example.invalid"},
 					IncludePrivateKey: false,
 					CreatedAt:         testutil.TimeMustParse(time.RFC3339, "2022-04-15T14:30:00.0016Z"),
+					UpdatedAt:         testutil.TimeMustParse(time.RFC3339, "2022-04-15T14:30:00.0016Z"),
 				},
 			},
 			want: &repository.X509CertificateSubscriptionDao{
@@ -275,6 +497,7 @@ func Test_postgresqlSubscriptionToDto(t *testing.T) {
 				SubjectAltNames:   []string{"example.invalid"},
 				IncludePrivateKey: false,
 				CreatedAt:         testutil.TimeMustParse(time.RFC3339, "2022-04-15T14:30:00.002Z"),
+				UpdatedAt:         testutil.TimeMustParse(time.RFC3339, "2022-04-15T14:30:00.002Z"),
 			},
 		},
 	}
@@ -298,6 +521,7 @@ func seedX509CertificateSubscriptionTestData(t *testing.T, ctx context.Context,
 			SubjectAltNames:   []string{"test.example.invalid"},
 			IncludePrivateKey: false,
 			CreatedAt:         normalizeTime(clock.Now()),
+			UpdatedAt:         normalizeTime(clock.Now()),
 		}
 		err := sub.Insert(ctx, postgresqlTestBackend.Db(), boil.Infer())
 		if err != nil {
@@ -310,6 +534,7 @@ func seedX509CertificateSubscriptionTestData(t *testing.T, ctx context.Context,
 			SubjectAltNames:   []string{"pki-vault.invalid"},
 			IncludePrivateKey: false,
 			CreatedAt:         normalizeTime(clock.Now().Add(1 * 24 * time.Hour)),
+			UpdatedAt:         normalizeTime(clock.Now().Add(1 * 24 * time.Hour)),
 		}
 		err := sub.Insert(ctx, postgresqlTestBackend.Db(), boil.Infer())
 		if err != nil {
@@ -322,6 +547,7 @@ func seedX509CertificateSubscriptionTestData(t *testing.T, ctx context.Context,
 			SubjectAltNames:   []string{"sub.pki-vault.invalid"},
 			IncludePrivateKey: true,
 			CreatedAt:         normalizeTime(clock.Now().Add(2 * 24 * time.Hour)),
+			UpdatedAt:         normalizeTime(clock.Now().Add(2 * 24 * time.Hour)),
 		}
 		err := sub.Insert(ctx, postgresqlTestBackend.Db(), boil.Infer())
 		if err != nil {
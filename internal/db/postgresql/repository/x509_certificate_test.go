@@ -12,12 +12,15 @@ import (
 	"github.com/jonboulle/clockwork"
 	"github.com/pki-vault/server/internal/db/postgresql/models"
 	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/encryption"
 	"github.com/pki-vault/server/internal/service"
 	"github.com/pki-vault/server/internal/testutil"
 	"github.com/volatiletech/null/v8"
+	"github.com/volatiletech/sqlboiler/v4/boil"
 	"github.com/volatiletech/sqlboiler/v4/queries/qm"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
@@ -248,6 +251,198 @@ func TestCertificateRepository_FindBySubjectHash(t *testing.T) {
 	}
 }
 
+func TestCertificateRepository_FindByID(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+
+	if err := seedX509CertificateTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+
+	fetchedCert, err := models.X509Certificates(
+		models.X509CertificateWhere.CommonName.EQ("example.invalid"),
+		qm.Limit(1),
+	).One(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedCert := postgresqlCertificateToDao(fetchedCert)
+
+	tests := []struct {
+		name       string
+		id         uuid.UUID
+		want       *repository.X509CertificateDao
+		wantExists bool
+	}{
+		{
+			name:       "find existing",
+			id:         expectedCert.ID,
+			want:       expectedCert,
+			wantExists: true,
+		},
+		{
+			name:       "dont find non existing",
+			id:         uuid.MustParse("00000000-0000-4000-8000-000000000000"),
+			want:       nil,
+			wantExists: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewX509CertificateRepository(db, nil, fakeClock)
+			got, exists, err := r.FindByID(ctx, tt.id)
+			if err != nil {
+				t.Fatalf("FindByID() got unexpected error: %v", err)
+			}
+			if exists != tt.wantExists {
+				t.Errorf("FindByID() exists = %v, want %v", exists, tt.wantExists)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindByID() got = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCertificateRepository_Search(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+
+	if err := seedX509CertificateTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+	rootCert, err := models.X509Certificates(models.X509CertificateWhere.CommonName.EQ("Test Root CA Alpha")).One(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name            string
+		search          *repository.X509CertificateSearchDao
+		wantCommonNames []string
+	}{
+		{
+			name: "exact SAN",
+			search: &repository.X509CertificateSearchDao{
+				SubjectAltName: "example.invalid",
+				SortBy:         repository.X509CertificateSortNotAfter,
+			},
+			wantCommonNames: []string{"example.invalid", "example.invalid"},
+		},
+		{
+			name: "wildcard SAN matches literal wildcard SAN",
+			search: &repository.X509CertificateSearchDao{
+				SubjectAltName: "*.invalid",
+			},
+			wantCommonNames: []string{"*.wildcard.invalid", "example.invalid", "example.invalid"},
+		},
+		{
+			name: "wildcard common name",
+			search: &repository.X509CertificateSearchDao{
+				CommonName:    "Intermediate *",
+				NotAfterAfter: testutil.Ptr(time.Now()),
+				SortBy:        repository.X509CertificateSortCommonName,
+			},
+			wantCommonNames: []string{"Intermediate wildcard.invalid CA", "Intermediate example.invalid CA"},
+		},
+		{
+			name: "issuer",
+			search: &repository.X509CertificateSearchDao{
+				IssuerID:       testutil.Ptr(uuid.MustParse(rootCert.ID)),
+				NotAfterBefore: testutil.Ptr(time.Now()),
+			},
+			wantCommonNames: []string{"Intermediate example.invalid CA"},
+		},
+		{
+			name: "without private key",
+			search: &repository.X509CertificateSearchDao{
+				HasPrivateKey: testutil.Ptr(false),
+			},
+			wantCommonNames: []string{"Test Root CA Alpha"},
+		},
+		{
+			name: "created after",
+			search: &repository.X509CertificateSearchDao{
+				CreatedAfter: testutil.Ptr(fakeClock.Now()),
+			},
+			wantCommonNames: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.search.Limit = 10
+			r := NewX509CertificateRepository(db, nil, fakeClock)
+			got, err := r.Search(ctx, tt.search)
+			if err != nil {
+				t.Fatalf("Search() got unexpected error: %v", err)
+			}
+			// The order of text depends on the collation of the database
+			gotCommonNames := make([]string, len(got))
+			for i, cert := range got {
+				gotCommonNames[i] = cert.CommonName
+			}
+			sort.Strings(gotCommonNames)
+			sort.Strings(tt.wantCommonNames)
+			if !reflect.DeepEqual(gotCommonNames, tt.wantCommonNames) {
+				t.Errorf("Search() got common names = %v, want %v", gotCommonNames, tt.wantCommonNames)
+			}
+		})
+	}
+
+	t.Run("paginate", func(t *testing.T) {
+		r := NewX509CertificateRepository(db, nil, fakeClock)
+		allCerts, err := r.Search(ctx, &repository.X509CertificateSearchDao{Limit: 100})
+		if err != nil {
+			t.Fatalf("Search() got unexpected error: %v", err)
+		}
+
+		// All certificates are created at the same time, so pages are sorted by ID
+		var pagedCerts []*repository.X509CertificateDao
+		search := &repository.X509CertificateSearchDao{Limit: 2}
+		for {
+			page, err := r.Search(ctx, search)
+			if err != nil {
+				t.Fatalf("Search() got unexpected error: %v", err)
+			}
+			if len(page) == 0 {
+				break
+			}
+			pagedCerts = append(pagedCerts, page...)
+			lastCert := page[len(page)-1]
+			search.After = &repository.X509CertificatePosition{CreatedAt: lastCert.CreatedAt, ID: lastCert.ID}
+		}
+		if !reflect.DeepEqual(pagedCerts, allCerts) {
+			t.Errorf("Search() paginated certificates differ from all certificates")
+		}
+
+		// Positions don't need to exist, so the search continues after deleted certificates
+		afterDeleted, err := r.Search(ctx, &repository.X509CertificateSearchDao{
+			After: &repository.X509CertificatePosition{CreatedAt: allCerts[0].CreatedAt, ID: uuid.Nil},
+			Limit: 100,
+		})
+		if err != nil {
+			t.Fatalf("Search() got unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(afterDeleted, allCerts) {
+			t.Errorf("Search() certificates after deleted certificate differ from all certificates")
+		}
+
+		descendingCerts, err := r.Search(ctx, &repository.X509CertificateSearchDao{SortDescending: true, Limit: 100})
+		if err != nil {
+			t.Fatalf("Search() got unexpected error: %v", err)
+		}
+		for i, cert := range descendingCerts {
+			if cert.ID != allCerts[len(allCerts)-1-i].ID {
+				t.Errorf("Search() descending certificates are not in reverse order")
+				break
+			}
+		}
+	})
+}
+
 func TestCertificateRepository_FindCertificateChain(t *testing.T) {
 	ctx := context.Background()
 	fakeClock := clockwork.NewFakeClock()
@@ -485,13 +680,226 @@ func TestCertificateRepository_FindLatestActiveBySANsAndCreatedAtAfter(t *testin
 	}
 }
 
+func TestCertificateRepository_FindLatestActiveBySubscriptionAndChangedBetween(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+	repo := NewX509CertificateRepository(
+		db, NewX509PrivateKeyRepository(db, encryption.NewPlaintextKeyEncryptor(), fakeClock), fakeClock,
+	)
+	subRepo := NewX509CertificateSubscriptionRepository(db, fakeClock)
+
+	if err := seedX509CertificateTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanupWebhookTestTables)
+	sub, err := subRepo.Create(ctx, repository.NewX509CertificateSubscriptionDao(
+		uuid.MustParse("5e7a9c1e-3b5d-4f7a-9c2e-4b6d8f0a2c4e"), []string{"example.invalid"}, false,
+		fakeClock.Now(), fakeClock.Now(),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exampleCert, err := models.X509Certificates(
+		models.X509CertificateWhere.CommonName.EQ("example.invalid"),
+		models.X509CertificateWhere.NotBefore.LTE(time.Now()),
+		models.X509CertificateWhere.NotAfter.GTE(time.Now()),
+		qm.OrderBy(models.X509CertificateColumns.NotAfter+" desc"),
+		qm.Limit(1),
+	).One(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertChanged := func(changedAfter int64, wantChanged bool) int64 {
+		t.Helper()
+		changedUntil, err := repo.GetLatestChangeSequence(ctx)
+		if err != nil {
+			t.Fatalf("GetLatestChangeSequence() got unexpected error: %v", err)
+		}
+		if changedUntil < changedAfter {
+			t.Fatalf("GetLatestChangeSequence() = %d, want at least %d", changedUntil, changedAfter)
+		}
+		got, err := repo.FindLatestActiveBySubscriptionAndChangedBetween(ctx, sub.ID, changedAfter, changedUntil)
+		if err != nil {
+			t.Fatalf("FindLatestActiveBySubscriptionAndChangedBetween() got unexpected error: %v", err)
+		}
+		if wantChanged && (len(got) != 1 || got[0].ID.String() != exampleCert.ID) {
+			t.Errorf("FindLatestActiveBySubscriptionAndChangedBetween(%d, %d) = %v, want certificate %s",
+				changedAfter, changedUntil, got, exampleCert.ID)
+		}
+		if !wantChanged && len(got) != 0 {
+			t.Errorf("FindLatestActiveBySubscriptionAndChangedBetween(%d, %d) = %v, want none",
+				changedAfter, changedUntil, got)
+		}
+		return changedUntil
+	}
+
+	cursor := assertChanged(0, true)
+	// Nothing changed since the cursor
+	cursor = assertChanged(cursor, false)
+
+	// Unlinking the parent changes the certificate, though it wasn't created again
+	exampleCertDao := postgresqlCertificateToDao(exampleCert)
+	exampleCertDao.ParentCertificateID = nil
+	if _, _, err := repo.Update(ctx, exampleCertDao); err != nil {
+		t.Fatal(err)
+	}
+	cursor = assertChanged(cursor, true)
+
+	// Updating the subscription delivers all of its certificates again
+	sub.IncludePrivateKey = true
+	if _, _, err := subRepo.Update(ctx, sub); err != nil {
+		t.Fatal(err)
+	}
+	cursor = assertChanged(cursor, true)
+	assertChanged(cursor, false)
+}
+
+func TestCertificateRepository_FindLatestActiveWithPrivateKeyBySAN(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+	repo := NewX509CertificateRepository(
+		db, NewX509PrivateKeyRepository(db, encryption.NewPlaintextKeyEncryptor(), fakeClock), fakeClock,
+	)
+
+	if err := seedX509CertificateTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanX509CertificateTestTables)
+
+	exampleCert, err := models.X509Certificates(
+		models.X509CertificateWhere.CommonName.EQ("example.invalid"),
+		models.X509CertificateWhere.PrivateKeyID.IsNotNull(),
+		models.X509CertificateWhere.NotBefore.LTE(time.Now()),
+		qm.OrderBy(models.X509CertificateColumns.NotAfter+" desc"),
+		qm.Limit(1),
+	).One(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A renewal without a private key doesn't hide the certificate with one
+	renewal := *exampleCert
+	renewal.ID = uuid.NewString()
+	renewal.BytesHash = []byte(renewal.ID)
+	renewal.PrivateKeyID = null.String{}
+	renewal.NotBefore = exampleCert.NotBefore.Add(time.Second)
+	if err = renewal.Insert(ctx, db, boil.Infer()); err != nil {
+		t.Fatal(err)
+	}
+
+	got, exists, err := repo.FindLatestActiveWithPrivateKeyBySAN(ctx, "example.invalid")
+	if err != nil {
+		t.Fatalf("FindLatestActiveWithPrivateKeyBySAN() got unexpected error: %v", err)
+	}
+	if !exists || got.ID.String() != exampleCert.ID {
+		t.Errorf("FindLatestActiveWithPrivateKeyBySAN() = %v, %v, want certificate %s", got, exists, exampleCert.ID)
+	}
+
+	_, exists, err = repo.FindLatestActiveWithPrivateKeyBySAN(ctx, "unknown.invalid")
+	if err != nil {
+		t.Fatalf("FindLatestActiveWithPrivateKeyBySAN() got unexpected error: %v", err)
+	}
+	if exists {
+		t.Errorf("FindLatestActiveWithPrivateKeyBySAN() exists = %v, want false", exists)
+	}
+}
+
+func TestCertificateRepository_FindLatestActiveExpiringBetween(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+	repo := NewX509CertificateRepository(
+		db, NewX509PrivateKeyRepository(db, encryption.NewPlaintextKeyEncryptor(), fakeClock), fakeClock,
+	)
+
+	if err := seedX509CertificateTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanX509CertificateTestTables)
+
+	exampleCert, err := models.X509Certificates(
+		models.X509CertificateWhere.CommonName.EQ("example.invalid"),
+		models.X509CertificateWhere.NotBefore.LTE(time.Now()),
+		qm.OrderBy(models.X509CertificateColumns.NotAfter+" desc"),
+		qm.Limit(1),
+	).One(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	got, err := repo.FindLatestActiveExpiringBetween(ctx, now, exampleCert.NotAfter)
+	if err != nil {
+		t.Fatalf("FindLatestActiveExpiringBetween() got unexpected error: %v", err)
+	}
+	found := false
+	for _, cert := range got {
+		if cert.NotAfter.Before(now) || cert.NotAfter.After(exampleCert.NotAfter) {
+			t.Errorf("FindLatestActiveExpiringBetween() got certificate %s expiring at %s", cert.ID, cert.NotAfter)
+		}
+		if cert.CommonName == "example.invalid" && cert.ID.String() != exampleCert.ID {
+			t.Errorf("FindLatestActiveExpiringBetween() got replaced certificate %s", cert.ID)
+		}
+		found = found || cert.ID.String() == exampleCert.ID
+	}
+	if !found {
+		t.Errorf("FindLatestActiveExpiringBetween() = %v, want certificate %s", got, exampleCert.ID)
+	}
+
+	// Certificates expiring after the window aren't alerted yet
+	got, err = repo.FindLatestActiveExpiringBetween(ctx, now, exampleCert.NotAfter.Add(-time.Second))
+	if err != nil {
+		t.Fatalf("FindLatestActiveExpiringBetween() got unexpected error: %v", err)
+	}
+	for _, cert := range got {
+		if cert.ID.String() == exampleCert.ID {
+			t.Errorf("FindLatestActiveExpiringBetween() got certificate %s after the window", cert.ID)
+		}
+	}
+}
+
+func TestCertificateRepository_CountByNotAfter(t *testing.T) {
+	ctx := context.Background()
+	fakeClock := clockwork.NewFakeClock()
+	db := postgresqlTestBackend.Db()
+	repo := NewX509CertificateRepository(
+		db, NewX509PrivateKeyRepository(db, encryption.NewPlaintextKeyEncryptor(), fakeClock), fakeClock,
+	)
+
+	if err := seedX509CertificateTestData(t, ctx, fakeClock); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(cleanX509CertificateTestTables)
+
+	now := time.Now()
+	got, err := repo.CountByNotAfter(ctx, []time.Time{now, now.Add(365 * 24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("CountByNotAfter() got unexpected error: %v", err)
+	}
+	wantExpired, err := models.X509Certificates(models.X509CertificateWhere.NotAfter.LT(now)).Count(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTotal, err := models.X509Certificates().Count(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0] != wantExpired || got[0]+got[1]+got[2] != wantTotal {
+		t.Errorf("CountByNotAfter() = %v, want 3 buckets of %d certificates with %d expired", got, wantTotal, wantExpired)
+	}
+}
+
 func TestCertificateRepository_GetOrCreate(t *testing.T) {
 	ctx := context.Background()
 	fakeClock := clockwork.NewFakeClock()
 	db := postgresqlTestBackend.Db()
 	repo := &X509CertificateRepository{
 		db:                   db,
-		privateKeyRepository: NewX509PrivateKeyRepository(db, fakeClock),
+		privateKeyRepository: NewX509PrivateKeyRepository(db, encryption.NewPlaintextKeyEncryptor(), fakeClock),
 		clock:                fakeClock,
 	}
 
@@ -790,7 +1198,7 @@ func seedX509CertificateTestData(t *testing.T, ctx context.Context, clock clockw
 	db := postgresqlTestBackend.Db()
 	t.Cleanup(cleanX509CertificateTestTables)
 
-	pkr := NewX509PrivateKeyRepository(db, clock)
+	pkr := NewX509PrivateKeyRepository(db, encryption.NewPlaintextKeyEncryptor(), clock)
 	xcr := NewX509CertificateRepository(db, pkr, clock)
 
 	// active certificates
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"time"
+)
+
+// x509CertificateUpdateChannel is the channel of the notifications, shared by all server replicas.
+const x509CertificateUpdateChannel = "x509_certificate_updates"
+
+// X509CertificateUpdateNotifier publishes notifications via LISTEN/NOTIFY. Listening requires a dedicated connection
+// which is opened with the data source name.
+type X509CertificateUpdateNotifier struct {
+	db             *sql.DB
+	dataSourceName string
+}
+
+func NewX509CertificateUpdateNotifier(db *sql.DB, dataSourceName string) *X509CertificateUpdateNotifier {
+	return &X509CertificateUpdateNotifier{db: db, dataSourceName: dataSourceName}
+}
+
+func (x *X509CertificateUpdateNotifier) Notify(ctx context.Context) error {
+	executor, err := getCtxTxOrExecutor(ctx, x.db)
+	if err != nil {
+		return fmt.Errorf("failed to get executor: %w", err)
+	}
+
+	// Notifications within a transaction are only delivered once it commits
+	_, err = executor.ExecContext(ctx, `SELECT pg_notify($1, '');`, x509CertificateUpdateChannel)
+	return err
+}
+
+func (x *X509CertificateUpdateNotifier) Listen(ctx context.Context, handle func()) error {
+	listener := pq.NewListener(x.dataSourceName, time.Second, time.Minute, nil)
+	defer listener.Close()
+	go func() {
+		// Unblocks Listen, which waits for a connection
+		<-ctx.Done()
+		_ = listener.Close()
+	}()
+
+	if err := listener.Listen(x509CertificateUpdateChannel); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-listener.Notify:
+			if !ok {
+				return nil
+			}
+			// The nil notification sent after a reconnect is handled too, as any certificates may have been
+			// imported in the meantime
+			handle()
+		}
+	}
+}
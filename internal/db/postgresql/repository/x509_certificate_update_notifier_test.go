@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestX509CertificateUpdateNotifier_NotifyAndListen(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	notifier := NewX509CertificateUpdateNotifier(postgresqlTestBackend.Db(), postgresqlTestDataSourceName)
+	txManager := NewTransactionManager(postgresqlTestBackend.Db())
+
+	notifications := make(chan struct{}, 10)
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- notifier.Listen(ctx, func() {
+			notifications <- struct{}{}
+		})
+	}()
+
+	// Notify until the listener is connected
+	connected := false
+	for i := 0; i < 100 && !connected; i++ {
+		if err := notifier.Notify(ctx); err != nil {
+			t.Fatalf("Notify() got unexpected error: %v", err)
+		}
+		select {
+		case <-notifications:
+			connected = true
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	if !connected {
+		t.Fatalf("Listen() got no notification")
+	}
+	for len(notifications) != 0 {
+		<-notifications
+	}
+
+	txCtx, err := txManager.BeginTx(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notifier.Notify(txCtx); err != nil {
+		t.Fatalf("Notify() got unexpected error: %v", err)
+	}
+	select {
+	case <-notifications:
+		t.Fatalf("Listen() got notification before the transaction was committed")
+	case <-time.After(200 * time.Millisecond):
+	}
+	if err := txManager.CommitTx(txCtx); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-notifications:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Listen() got no notification after the transaction was committed")
+	}
+
+	cancel()
+	if err := <-listenErr; err != nil {
+		t.Errorf("Listen() got unexpected error: %v", err)
+	}
+}
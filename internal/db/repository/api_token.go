@@ -0,0 +1,38 @@
+package repository
+
+//go:generate mockgen -destination=../../mocks/db/api_token.go -source api_token.go
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ErrDuplicateAPITokenName is returned when creating a token with the name of a token which isn't revoked.
+var ErrDuplicateAPITokenName = errors.New("an API token with this name already exists")
+
+// APITokenDao serves as an abstraction for all the different per database API token structs.
+// Only the hash of the token is persisted.
+type APITokenDao struct {
+	ID        uuid.UUID
+	Name      string
+	TokenHash []byte
+	Scopes    []string
+	CreatedAt time.Time
+	ExpiresAt *time.Time
+	RevokedAt *time.Time
+}
+
+func NewAPITokenDao(ID uuid.UUID, name string, tokenHash []byte, scopes []string, createdAt time.Time, expiresAt *time.Time, revokedAt *time.Time) *APITokenDao {
+	return &APITokenDao{ID: ID, Name: name, TokenHash: tokenHash, Scopes: scopes, CreatedAt: createdAt, ExpiresAt: expiresAt, RevokedAt: revokedAt}
+}
+
+type APITokenRepository interface {
+	// Create persists the token, or returns ErrDuplicateAPITokenName if a token which isn't revoked has its name.
+	Create(ctx context.Context, token *APITokenDao) (*APITokenDao, error)
+	FindByTokenHash(ctx context.Context, tokenHash []byte) (token *APITokenDao, exists bool, err error)
+	FindAll(ctx context.Context) ([]*APITokenDao, error)
+	// Revoke marks the token as revoked. Already revoked tokens are left untouched and not counted as revoked.
+	Revoke(ctx context.Context, id uuid.UUID, revokedAt time.Time) (revoked bool, err error)
+}
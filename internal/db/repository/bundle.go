@@ -4,5 +4,12 @@ type Bundle interface {
 	X509CertificateRepository() X509CertificateRepository
 	X509CertificateSubscriptionRepository() X509CertificateSubscriptionRepository
 	X509PrivateKeyRepository() PrivateKeyRepository
+	SealConfigurationRepository() SealConfigurationRepository
+	APITokenRepository() APITokenRepository
+	WebhookRepository() WebhookRepository
+	WebhookDeliveryRepository() WebhookDeliveryRepository
+	X509CertificateUpdateNotifier() X509CertificateUpdateNotifier
+	OutboxEventRepository() OutboxEventRepository
+	ExpiryAlertRepository() ExpiryAlertRepository
 	TransactionManager() TransactionManager
 }
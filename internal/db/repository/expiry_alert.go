@@ -0,0 +1,30 @@
+package repository
+
+//go:generate mockgen -destination=../../mocks/db/expiry_alert.go -source expiry_alert.go
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ExpiryAlertDao serves as an abstraction for all the different per database expiry alert structs.
+// SubscriptionID is only set for alerts about the latest certificate of a subscription.
+type ExpiryAlertDao struct {
+	ID             uuid.UUID
+	CertificateID  uuid.UUID
+	SubscriptionID *uuid.UUID
+	Threshold      time.Duration
+	CreatedAt      time.Time
+}
+
+func NewExpiryAlertDao(ID uuid.UUID, certificateID uuid.UUID, subscriptionID *uuid.UUID, threshold time.Duration, createdAt time.Time) *ExpiryAlertDao {
+	return &ExpiryAlertDao{ID: ID, CertificateID: certificateID, SubscriptionID: subscriptionID, Threshold: threshold, CreatedAt: createdAt}
+}
+
+type ExpiryAlertRepository interface {
+	// CreateIfNotExists creates the alert unless an alert for the same certificate, subscription and threshold exists.
+	// A concurrent create of the same alert waits until the transaction of the other create ended, so only one of
+	// them is created.
+	CreateIfNotExists(ctx context.Context, alert *ExpiryAlertDao) (created bool, err error)
+}
@@ -0,0 +1,37 @@
+package repository
+
+//go:generate mockgen -destination=../../mocks/db/outbox_event.go -source outbox_event.go
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+// OutboxEventDao serves as an abstraction for all the different per database outbox event structs.
+// NextAttemptAt is only set for unpublished events, LastError describes the most recent failed attempt.
+type OutboxEventDao struct {
+	ID            uuid.UUID
+	EventType     string
+	Payload       []byte
+	Attempts      int
+	NextAttemptAt *time.Time
+	LastError     *string
+	CreatedAt     time.Time
+	PublishedAt   *time.Time
+}
+
+func NewOutboxEventDao(ID uuid.UUID, eventType string, payload []byte, attempts int, nextAttemptAt *time.Time, lastError *string, createdAt time.Time, publishedAt *time.Time) *OutboxEventDao {
+	return &OutboxEventDao{ID: ID, EventType: eventType, Payload: payload, Attempts: attempts, NextAttemptAt: nextAttemptAt, LastError: lastError, CreatedAt: createdAt, PublishedAt: publishedAt}
+}
+
+type OutboxEventRepository interface {
+	Create(ctx context.Context, event *OutboxEventDao) (*OutboxEventDao, error)
+	// ClaimDue returns up to limit unpublished events whose next attempt is due at now, oldest first, and postpones
+	// their next attempt to claimedUntil, so concurrent dispatchers don't publish them too.
+	ClaimDue(ctx context.Context, now time.Time, claimedUntil time.Time, limit int) ([]*OutboxEventDao, error)
+	// Update persists the attempt fields and the publication time of the event.
+	Update(ctx context.Context, event *OutboxEventDao) error
+	// DeletePublishedBefore deletes the events published before the given time.
+	DeletePublishedBefore(ctx context.Context, before time.Time) (rowsDeleted int64, err error)
+}
@@ -36,4 +36,8 @@ type PrivateKeyRepository interface {
 	GetOrCreate(ctx context.Context, privKey *X509PrivateKeyDao) (*X509PrivateKeyDao, error)
 	FindByIDs(ctx context.Context, ids []uuid.UUID) ([]*X509PrivateKeyDao, error)
 	FindByPublicKeyHash(ctx context.Context, pubKeyHash []byte) (privKey *X509PrivateKeyDao, exists bool, err error)
+	// EncryptPlaintextKeys encrypts up to limit private keys persisted before encryption was enabled.
+	EncryptPlaintextKeys(ctx context.Context, limit int) (encryptedKeys int64, err error)
+	// RewrapDataKeys re-wraps up to limit data keys which are not wrapped by the current master key.
+	RewrapDataKeys(ctx context.Context, limit int) (rewrappedKeys int64, err error)
 }
@@ -0,0 +1,26 @@
+package repository
+
+//go:generate mockgen -destination=../../mocks/db/seal_configuration.go -source seal_configuration.go
+
+import (
+	"context"
+	"time"
+)
+
+// SealConfigurationDao describes how the master key was split into unseal keys. There is at most one configuration.
+type SealConfigurationDao struct {
+	SecretShares    int
+	SecretThreshold int
+	MasterKeyID     string
+	CreatedAt       time.Time
+}
+
+func NewSealConfigurationDao(secretShares int, secretThreshold int, masterKeyID string, createdAt time.Time) *SealConfigurationDao {
+	return &SealConfigurationDao{SecretShares: secretShares, SecretThreshold: secretThreshold, MasterKeyID: masterKeyID, CreatedAt: createdAt}
+}
+
+type SealConfigurationRepository interface {
+	// Create persists the seal configuration. It fails if a configuration already exists.
+	Create(ctx context.Context, sealConfig *SealConfigurationDao) (*SealConfigurationDao, error)
+	Find(ctx context.Context) (sealConfig *SealConfigurationDao, exists bool, err error)
+}
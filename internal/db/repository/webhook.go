@@ -0,0 +1,38 @@
+package repository
+
+//go:generate mockgen -destination=../../mocks/db/webhook.go -source webhook.go
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+// WebhookDao serves as an abstraction for all the different per database subscription webhook structs.
+// The secret signs the events delivered to the URL, so it can't be hashed. Repositories persist it encrypted like
+// private keys instead.
+type WebhookDao struct {
+	SubscriptionID uuid.UUID
+	URL            string
+	Secret         string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+func NewWebhookDao(subscriptionID uuid.UUID, URL string, secret string, createdAt time.Time, updatedAt time.Time) *WebhookDao {
+	return &WebhookDao{SubscriptionID: subscriptionID, URL: URL, Secret: secret, CreatedAt: createdAt, UpdatedAt: updatedAt}
+}
+
+type WebhookRepository interface {
+	// Save creates the webhook of the subscription or replaces the URL and secret of the existing one.
+	Save(ctx context.Context, webhook *WebhookDao) (*WebhookDao, error)
+	FindBySubscriptionID(ctx context.Context, subID uuid.UUID) (webhook *WebhookDao, exists bool, err error)
+	// FindSubscriptionIDs returns the IDs of all subscriptions with a webhook. Unlike loading the webhooks, it
+	// doesn't decrypt their secrets, so it works while the vault is sealed.
+	FindSubscriptionIDs(ctx context.Context) ([]uuid.UUID, error)
+	Delete(ctx context.Context, subID uuid.UUID) (rowsDeleted int64, err error)
+	// EncryptPlaintextSecrets encrypts up to limit secrets persisted before the secrets were encrypted.
+	EncryptPlaintextSecrets(ctx context.Context, limit int) (encryptedSecrets int64, err error)
+	// RewrapDataKeys re-wraps up to limit data keys of secrets which are not wrapped by the current master key.
+	RewrapDataKeys(ctx context.Context, limit int) (rewrappedKeys int64, err error)
+}
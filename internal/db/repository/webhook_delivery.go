@@ -0,0 +1,62 @@
+package repository
+
+//go:generate mockgen -destination=../../mocks/db/webhook_delivery.go -source webhook_delivery.go
+
+import (
+	"context"
+	"github.com/google/uuid"
+	"time"
+)
+
+type WebhookDeliveryStatus string
+
+// Enum values for WebhookDeliveryStatus
+const (
+	WebhookDeliveryStatusPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryStatusDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryStatusDead      WebhookDeliveryStatus = "dead"
+)
+
+// WebhookDeliveryDao serves as an abstraction for all the different per database webhook delivery structs.
+// NextAttemptAt is only set for pending deliveries, the Last fields describe the most recent attempt.
+type WebhookDeliveryDao struct {
+	ID             uuid.UUID
+	SubscriptionID uuid.UUID
+	EventType      string
+	Payload        []byte
+	Status         WebhookDeliveryStatus
+	Attempts       int
+	NextAttemptAt  *time.Time
+	LastAttemptAt  *time.Time
+	LastStatusCode *int
+	LastError      *string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+func NewWebhookDeliveryDao(ID uuid.UUID, subscriptionID uuid.UUID, eventType string, payload []byte, status WebhookDeliveryStatus, attempts int, nextAttemptAt *time.Time, lastAttemptAt *time.Time, lastStatusCode *int, lastError *string, createdAt time.Time, deliveredAt *time.Time) *WebhookDeliveryDao {
+	return &WebhookDeliveryDao{ID: ID, SubscriptionID: subscriptionID, EventType: eventType, Payload: payload, Status: status, Attempts: attempts, NextAttemptAt: nextAttemptAt, LastAttemptAt: lastAttemptAt, LastStatusCode: lastStatusCode, LastError: lastError, CreatedAt: createdAt, DeliveredAt: deliveredAt}
+}
+
+// WebhookDeliveryPosition is the position of a delivery in the history of FindBySubscriptionID. It holds the sort key
+// instead of only the ID, so listing continues even if the delivery was cleaned up meanwhile.
+type WebhookDeliveryPosition struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+type WebhookDeliveryRepository interface {
+	Create(ctx context.Context, delivery *WebhookDeliveryDao) (*WebhookDeliveryDao, error)
+	// ClaimDue returns up to limit pending deliveries whose next attempt is due at now and postpones their next
+	// attempt to claimedUntil, so concurrent dispatchers don't attempt them too.
+	ClaimDue(ctx context.Context, now time.Time, claimedUntil time.Time, limit int) ([]*WebhookDeliveryDao, error)
+	// Update persists the status and the attempt fields of the delivery.
+	Update(ctx context.Context, delivery *WebhookDeliveryDao) error
+	// FindBySubscriptionID returns up to limit deliveries of the subscription, newest first, starting after the
+	// position if set.
+	FindBySubscriptionID(
+		ctx context.Context, subID uuid.UUID, after *WebhookDeliveryPosition, limit int,
+	) ([]*WebhookDeliveryDao, error)
+	// DeleteFinishedBefore deletes the delivered and dead deliveries whose last attempt was before the given time.
+	DeleteFinishedBefore(ctx context.Context, before time.Time) (rowsDeleted int64, err error)
+}
@@ -32,13 +32,77 @@ func NewX509CertificateDao(ID uuid.UUID, commonName string, subjectAltNames []st
 	return &X509CertificateDao{ID: ID, CommonName: commonName, SubjectAltNames: subjectAltNames, IssuerHash: issuerHash, SubjectHash: subjectHash, BytesHash: bytesHash, Bytes: bytes, PublicKeyHash: pubKeyHash, ParentCertificateID: parentCertID, PrivateKeyID: privKeyID, NotBefore: notBefore, NotAfter: notAfter, CreatedAt: createdAt}
 }
 
+type X509CertificateSortField string
+
+// Enum values for X509CertificateSortField
+const (
+	X509CertificateSortCreatedAt  X509CertificateSortField = "created_at"
+	X509CertificateSortNotAfter   X509CertificateSortField = "not_after"
+	X509CertificateSortCommonName X509CertificateSortField = "common_name"
+)
+
+// X509CertificateSearchDao filters and sorts certificates. Unset filters are ignored. SubjectAltName and CommonName
+// match exactly unless they contain *, which matches any sequence of characters. IssuerID matches the certificates
+// issued by the certificate with this ID, whether they are linked to it or not. Certificates with equal sort values
+// are sorted by ID. After continues the search after this position, which must match the sorting.
+type X509CertificateSearchDao struct {
+	SubjectAltName string
+	CommonName     string
+	IssuerID       *uuid.UUID
+	NotAfterBefore *time.Time
+	NotAfterAfter  *time.Time
+	HasPrivateKey  *bool
+	CreatedBefore  *time.Time
+	CreatedAfter   *time.Time
+	SortBy         X509CertificateSortField
+	SortDescending bool
+	After          *X509CertificatePosition
+	Limit          int
+}
+
+// X509CertificatePosition is the position of a certificate in a search. It holds the sort values instead of only the
+// ID, so a search continues even if the certificate was deleted meanwhile. Only the value of the sort field is used.
+type X509CertificatePosition struct {
+	CreatedAt  time.Time
+	NotAfter   time.Time
+	CommonName string
+	ID         uuid.UUID
+}
+
 type X509CertificateRepository interface {
 	GetOrCreate(ctx context.Context, cert *X509CertificateDao) (*X509CertificateDao, error)
 	Update(ctx context.Context, cert *X509CertificateDao) (updatedCert *X509CertificateDao, updated bool, err error)
+	FindByID(ctx context.Context, id uuid.UUID) (cert *X509CertificateDao, exists bool, err error)
+	Search(ctx context.Context, search *X509CertificateSearchDao) ([]*X509CertificateDao, error)
 	FindByIssuerHashAndNoParentSet(ctx context.Context, issuerHash []byte) ([]*X509CertificateDao, error)
 	FindByPublicKeyHashAndNoPrivateKeySet(ctx context.Context, pubKeyHash []byte) ([]*X509CertificateDao, error)
 	FindBySubjectHash(ctx context.Context, subjectHash []byte) ([]*X509CertificateDao, error)
 	FindAllByByteHashes(ctx context.Context, byteHashes []*[]byte) ([]*X509CertificateDao, error)
 	FindLatestActiveBySANsAndCreatedAtAfter(ctx context.Context, subjectAltNames []string, sinceAfter time.Time) ([]*X509CertificateDao, error)
+	// FindLatestActiveWithPrivateKeyBySAN returns the active certificate with a private key, having subjectAltName as
+	// SAN or common name, which became valid last.
+	FindLatestActiveWithPrivateKeyBySAN(
+		ctx context.Context, subjectAltName string,
+	) (cert *X509CertificateDao, exists bool, err error)
+	// GetLatestChangeSequence returns the sequence number of the latest change of certificates, private keys and
+	// subscriptions, or 0 if there are none. Changes with lower sequence numbers can't be committed anymore.
+	GetLatestChangeSequence(ctx context.Context) (int64, error)
+	// FindLatestActiveBySubscriptionAndChangedBetween returns the latest active certificates matching the subscription
+	// which, including their chain and private key, changed after changedAfter and up to changedUntil. If the
+	// subscription itself changed after changedAfter, all of its latest active certificates up to changedUntil are
+	// returned.
+	FindLatestActiveBySubscriptionAndChangedBetween(
+		ctx context.Context, subID uuid.UUID, changedAfter int64, changedUntil int64,
+	) ([]*X509CertificateDao, error)
+	// FindLatestActiveExpiringBetween returns the certificates which are valid at now and expire after now and up to
+	// expiringUntil, and have no replacement, a certificate with the same subject alt names and common name which
+	// expires later. They are ordered by expiry.
+	FindLatestActiveExpiringBetween(ctx context.Context, now time.Time, expiringUntil time.Time) ([]*X509CertificateDao, error)
+	// CountByNotAfter returns the number of certificates per not after bucket. counts[0] are the certificates expiring
+	// before bounds[0], counts[i] the ones expiring from bounds[i-1] until before bounds[i] and the last count the ones
+	// expiring from the last bound on. The bounds must be ascending.
+	CountByNotAfter(ctx context.Context, bounds []time.Time) (counts []int64, err error)
+	// CountOrphans returns the number of certificates which aren't self-signed and aren't linked to a parent.
+	CountOrphans(ctx context.Context) (int64, error)
 	FindCertificateChain(ctx context.Context, startCertId uuid.UUID) ([]*X509CertificateDao, error)
 }
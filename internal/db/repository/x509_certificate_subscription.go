@@ -14,14 +14,31 @@ type X509CertificateSubscriptionDao struct {
 	SubjectAltNames   []string  `binding:"required" validate:"required" json:"subject_alternative_names" toml:"subject_alternative_names" yaml:"subject_alternative_names"`
 	IncludePrivateKey bool      `binding:"required" validate:"required" json:"include_private_key" toml:"include_private_key" yaml:"include_private_key"`
 	CreatedAt         time.Time `binding:"required" validate:"required" json:"created_at" toml:"created_at" yaml:"created_at"`
+	UpdatedAt         time.Time `binding:"required" validate:"required" json:"updated_at" toml:"updated_at" yaml:"updated_at"`
 }
 
-func NewX509CertificateSubscriptionDao(ID uuid.UUID, subjectAltNames []string, includePrivateKey bool, createdAt time.Time) *X509CertificateSubscriptionDao {
-	return &X509CertificateSubscriptionDao{ID: ID, SubjectAltNames: subjectAltNames, IncludePrivateKey: includePrivateKey, CreatedAt: createdAt}
+func NewX509CertificateSubscriptionDao(ID uuid.UUID, subjectAltNames []string, includePrivateKey bool, createdAt time.Time, updatedAt time.Time) *X509CertificateSubscriptionDao {
+	return &X509CertificateSubscriptionDao{ID: ID, SubjectAltNames: subjectAltNames, IncludePrivateKey: includePrivateKey, CreatedAt: createdAt, UpdatedAt: updatedAt}
+}
+
+// X509CertificateSubscriptionPosition is the position of a subscription in the creation order of FindAll. It holds the
+// sort key instead of only the ID, so listing continues even if the subscription was deleted meanwhile.
+type X509CertificateSubscriptionPosition struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
 }
 
 type X509CertificateSubscriptionRepository interface {
 	Create(ctx context.Context, cert *X509CertificateSubscriptionDao) (*X509CertificateSubscriptionDao, error)
+	FindByID(ctx context.Context, id uuid.UUID) (sub *X509CertificateSubscriptionDao, exists bool, err error)
 	FindByIDs(ctx context.Context, publicIDs []uuid.UUID) ([]*X509CertificateSubscriptionDao, error)
+	// FindAll returns up to limit subscriptions ordered by creation, starting after the position if set.
+	FindAll(
+		ctx context.Context, after *X509CertificateSubscriptionPosition, limit int,
+	) ([]*X509CertificateSubscriptionDao, error)
+	// Update updates the subject alt names and whether private keys are included of the subscription with the ID of sub.
+	Update(ctx context.Context, sub *X509CertificateSubscriptionDao) (updatedSub *X509CertificateSubscriptionDao, exists bool, err error)
 	Delete(ctx context.Context, subID uuid.UUID) (rowsDeleted int64, err error)
+	// CountWithoutActiveCertificate returns the number of subscriptions no currently valid certificate matches.
+	CountWithoutActiveCertificate(ctx context.Context) (int64, error)
 }
@@ -0,0 +1,17 @@
+package repository
+
+//go:generate mockgen -destination=../../mocks/db/x509_certificate_update_notifier.go -source x509_certificate_update_notifier.go
+
+import (
+	"context"
+)
+
+// X509CertificateUpdateNotifier publishes notifications that certificates changed to the listeners of all server
+// replicas. Notifications carry no payload, listeners read the changes from the change sequence.
+type X509CertificateUpdateNotifier interface {
+	// Notify publishes a notification once the transaction in the context is committed, or immediately without one.
+	Notify(ctx context.Context) error
+	// Listen calls handle for every published notification until the context is done. Notifications which may have
+	// been missed while reconnecting are reported as a single notification.
+	Listen(ctx context.Context, handle func()) error
+}
@@ -0,0 +1,111 @@
+package encryption
+
+import (
+	"errors"
+	"fmt"
+)
+
+// EnvelopeKeyEncryptor encrypts every private key with its own random data key.
+// The data key is wrapped by the master key and stored next to the encrypted private key.
+// Previous master keys are only used to unwrap data keys, e.g. while they get re-wrapped during a master key rotation.
+type EnvelopeKeyEncryptor struct {
+	masterKey  *MasterKey
+	masterKeys map[string]*MasterKey
+}
+
+func NewEnvelopeKeyEncryptor(masterKey *MasterKey, previousMasterKeys ...*MasterKey) *EnvelopeKeyEncryptor {
+	masterKeys := make(map[string]*MasterKey, len(previousMasterKeys)+1)
+	for _, previousMasterKey := range previousMasterKeys {
+		masterKeys[previousMasterKey.ID()] = previousMasterKey
+	}
+	masterKeys[masterKey.ID()] = masterKey
+	return &EnvelopeKeyEncryptor{masterKey: masterKey, masterKeys: masterKeys}
+}
+
+func (e *EnvelopeKeyEncryptor) MasterKeyID() string {
+	return e.masterKey.ID()
+}
+
+func (e *EnvelopeKeyEncryptor) Encrypt(plaintext []byte, associatedData []byte) (*EncryptedKey, error) {
+	dataKey, err := generateKey()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate data key: %w", err)
+	}
+	dataKeyAead, err := newAesGcm(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ciphertext, err := seal(dataKeyAead, plaintext, associatedData)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encrypt private key: %w", err)
+	}
+	wrappedDataKey, err := e.masterKey.WrapDataKey(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to wrap data key: %w", err)
+	}
+
+	return &EncryptedKey{
+		Ciphertext:     ciphertext,
+		WrappedDataKey: wrappedDataKey,
+		MasterKeyID:    e.masterKey.ID(),
+	}, nil
+}
+
+func (e *EnvelopeKeyEncryptor) Decrypt(encryptedKey *EncryptedKey, associatedData []byte) ([]byte, error) {
+	// Keys persisted before encryption was enabled are stored in plaintext
+	if encryptedKey.MasterKeyID == "" {
+		return encryptedKey.Ciphertext, nil
+	}
+
+	dataKey, err := e.unwrapDataKey(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	dataKeyAead, err := newAesGcm(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := open(dataKeyAead, encryptedKey.Ciphertext, associatedData)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt private key: %w", err)
+	}
+	return plaintext, nil
+}
+
+func (e *EnvelopeKeyEncryptor) Rewrap(encryptedKey *EncryptedKey) (*EncryptedKey, error) {
+	if encryptedKey.MasterKeyID == "" {
+		return nil, errors.New("unable to rewrap data key of a not encrypted private key")
+	}
+	if encryptedKey.MasterKeyID == e.masterKey.ID() {
+		return encryptedKey, nil
+	}
+
+	dataKey, err := e.unwrapDataKey(encryptedKey)
+	if err != nil {
+		return nil, err
+	}
+	wrappedDataKey, err := e.masterKey.WrapDataKey(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to wrap data key: %w", err)
+	}
+
+	return &EncryptedKey{
+		Ciphertext:     encryptedKey.Ciphertext,
+		WrappedDataKey: wrappedDataKey,
+		MasterKeyID:    e.masterKey.ID(),
+	}, nil
+}
+
+func (e *EnvelopeKeyEncryptor) unwrapDataKey(encryptedKey *EncryptedKey) ([]byte, error) {
+	masterKey, exists := e.masterKeys[encryptedKey.MasterKeyID]
+	if !exists {
+		return nil, ErrUnknownMasterKey
+	}
+	dataKey, err := masterKey.UnwrapDataKey(encryptedKey.WrappedDataKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
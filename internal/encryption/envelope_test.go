@@ -0,0 +1,146 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEnvelopeKeyEncryptor_EncryptDecrypt(t *testing.T) {
+	masterKey := newTestMasterKey(t)
+	encryptor := NewEnvelopeKeyEncryptor(masterKey)
+	plaintext := []byte("private key der")
+	associatedData := []byte("db79f4ba-18cb-4c6e-8712-2821b2696d50")
+
+	encryptedKey, err := encryptor.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("Encrypt() got unexpected error: %v", err)
+	}
+	if bytes.Contains(encryptedKey.Ciphertext, plaintext) {
+		t.Errorf("Encrypt() ciphertext contains the plaintext")
+	}
+	if encryptedKey.MasterKeyID != masterKey.ID() {
+		t.Errorf("Encrypt() master key ID = %s, want %s", encryptedKey.MasterKeyID, masterKey.ID())
+	}
+
+	decrypted, err := encryptor.Decrypt(encryptedKey, associatedData)
+	if err != nil {
+		t.Fatalf("Decrypt() got unexpected error: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Decrypt() = %v, want %v", decrypted, plaintext)
+	}
+}
+
+func TestEnvelopeKeyEncryptor_Decrypt(t *testing.T) {
+	masterKey := newTestMasterKey(t)
+	encryptor := NewEnvelopeKeyEncryptor(masterKey)
+	associatedData := []byte("db79f4ba-18cb-4c6e-8712-2821b2696d50")
+
+	encryptedKey, err := encryptor.Encrypt([]byte("private key der"), associatedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("plaintext key", func(t *testing.T) {
+		decrypted, err := encryptor.Decrypt(&EncryptedKey{Ciphertext: []byte("plaintext")}, associatedData)
+		if err != nil {
+			t.Fatalf("Decrypt() got unexpected error: %v", err)
+		}
+		if !bytes.Equal(decrypted, []byte("plaintext")) {
+			t.Errorf("Decrypt() = %v, want plaintext to be returned as is", decrypted)
+		}
+	})
+	t.Run("different associated data", func(t *testing.T) {
+		if _, err := encryptor.Decrypt(encryptedKey, []byte("other")); err == nil {
+			t.Errorf("Decrypt() expected error for different associated data")
+		}
+	})
+	t.Run("unknown master key", func(t *testing.T) {
+		otherEncryptor := NewEnvelopeKeyEncryptor(newTestMasterKey(t))
+		if _, err := otherEncryptor.Decrypt(encryptedKey, associatedData); !errors.Is(err, ErrUnknownMasterKey) {
+			t.Errorf("Decrypt() error = %v, want %v", err, ErrUnknownMasterKey)
+		}
+	})
+}
+
+func TestEnvelopeKeyEncryptor_Rewrap(t *testing.T) {
+	oldMasterKey := newTestMasterKey(t)
+	newMasterKey := newTestMasterKey(t)
+	oldEncryptor := NewEnvelopeKeyEncryptor(oldMasterKey)
+	rotatingEncryptor := NewEnvelopeKeyEncryptor(newMasterKey, oldMasterKey)
+	plaintext := []byte("private key der")
+	associatedData := []byte("db79f4ba-18cb-4c6e-8712-2821b2696d50")
+
+	encryptedKey, err := oldEncryptor.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys wrapped by a previous master key must stay readable until they are re-wrapped
+	decrypted, err := rotatingEncryptor.Decrypt(encryptedKey, associatedData)
+	if err != nil {
+		t.Fatalf("Decrypt() got unexpected error for previous master key: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Decrypt() = %v, want %v", decrypted, plaintext)
+	}
+
+	rewrappedKey, err := rotatingEncryptor.Rewrap(encryptedKey)
+	if err != nil {
+		t.Fatalf("Rewrap() got unexpected error: %v", err)
+	}
+	if rewrappedKey.MasterKeyID != newMasterKey.ID() {
+		t.Errorf("Rewrap() master key ID = %s, want %s", rewrappedKey.MasterKeyID, newMasterKey.ID())
+	}
+	if !bytes.Equal(rewrappedKey.Ciphertext, encryptedKey.Ciphertext) {
+		t.Errorf("Rewrap() must not change the ciphertext")
+	}
+
+	decrypted, err = NewEnvelopeKeyEncryptor(newMasterKey).Decrypt(rewrappedKey, associatedData)
+	if err != nil {
+		t.Fatalf("Decrypt() got unexpected error for re-wrapped key: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Decrypt() = %v, want %v", decrypted, plaintext)
+	}
+
+	t.Run("already re-wrapped key", func(t *testing.T) {
+		got, err := rotatingEncryptor.Rewrap(rewrappedKey)
+		if err != nil {
+			t.Fatalf("Rewrap() got unexpected error: %v", err)
+		}
+		if got != rewrappedKey {
+			t.Errorf("Rewrap() expected key wrapped by the current master key to be returned as is")
+		}
+	})
+	t.Run("plaintext key", func(t *testing.T) {
+		if _, err := rotatingEncryptor.Rewrap(&EncryptedKey{Ciphertext: plaintext}); err == nil {
+			t.Errorf("Rewrap() expected error for plaintext key")
+		}
+	})
+	t.Run("unknown master key", func(t *testing.T) {
+		otherEncryptor := NewEnvelopeKeyEncryptor(newTestMasterKey(t))
+		if _, err := otherEncryptor.Rewrap(encryptedKey); !errors.Is(err, ErrUnknownMasterKey) {
+			t.Errorf("Rewrap() error = %v, want %v", err, ErrUnknownMasterKey)
+		}
+	})
+}
+
+func TestNewMasterKey(t *testing.T) {
+	if _, err := NewMasterKey([]byte("too short")); err == nil {
+		t.Errorf("NewMasterKey() expected error for invalid key size")
+	}
+}
+
+func newTestMasterKey(t *testing.T) *MasterKey {
+	rawKey, err := GenerateMasterKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	masterKey, err := NewMasterKey(rawKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return masterKey
+}
@@ -0,0 +1,54 @@
+package encryption
+
+import "errors"
+
+var (
+	ErrUnknownMasterKey     = errors.New("private key is encrypted with an unknown master key")
+	ErrEncryptionNotEnabled = errors.New("encryption of private keys is not enabled")
+)
+
+// EncryptedKey is the persisted form of an encrypted private key.
+// Ciphertext is encrypted with a per key data key, which itself is wrapped by the master key with the ID MasterKeyID.
+// An empty MasterKeyID marks a not encrypted key where Ciphertext holds the plaintext.
+type EncryptedKey struct {
+	Ciphertext     []byte
+	WrappedDataKey []byte
+	MasterKeyID    string
+}
+
+// KeyEncryptor encrypts private keys before they are persisted and decrypts them after they are loaded.
+// The associated data is authenticated but not encrypted and binds the ciphertext to its owner, e.g. the key ID.
+type KeyEncryptor interface {
+	// MasterKeyID returns the ID of the master key new data keys are wrapped with, empty if encryption is disabled.
+	MasterKeyID() string
+	Encrypt(plaintext []byte, associatedData []byte) (*EncryptedKey, error)
+	Decrypt(encryptedKey *EncryptedKey, associatedData []byte) ([]byte, error)
+	// Rewrap unwraps the data key and wraps it with the current master key. The ciphertext stays untouched.
+	Rewrap(encryptedKey *EncryptedKey) (*EncryptedKey, error)
+}
+
+// PlaintextKeyEncryptor is used if no master key is configured. It stores private keys unencrypted.
+type PlaintextKeyEncryptor struct{}
+
+func NewPlaintextKeyEncryptor() *PlaintextKeyEncryptor {
+	return &PlaintextKeyEncryptor{}
+}
+
+func (p *PlaintextKeyEncryptor) MasterKeyID() string {
+	return ""
+}
+
+func (p *PlaintextKeyEncryptor) Encrypt(plaintext []byte, _ []byte) (*EncryptedKey, error) {
+	return &EncryptedKey{Ciphertext: plaintext}, nil
+}
+
+func (p *PlaintextKeyEncryptor) Decrypt(encryptedKey *EncryptedKey, _ []byte) ([]byte, error) {
+	if encryptedKey.MasterKeyID != "" {
+		return nil, ErrUnknownMasterKey
+	}
+	return encryptedKey.Ciphertext, nil
+}
+
+func (p *PlaintextKeyEncryptor) Rewrap(_ *EncryptedKey) (*EncryptedKey, error) {
+	return nil, ErrEncryptionNotEnabled
+}
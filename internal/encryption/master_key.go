@@ -0,0 +1,117 @@
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// MasterKeySize is the size of AES-256 master and data keys in bytes.
+const MasterKeySize = 32
+
+// MasterKey wraps and unwraps data keys with AES-256-GCM.
+type MasterKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+func NewMasterKey(key []byte) (*MasterKey, error) {
+	if len(key) != MasterKeySize {
+		return nil, fmt.Errorf("master key must be %d bytes long but is %d bytes long", MasterKeySize, len(key))
+	}
+	aead, err := newAesGcm(key)
+	if err != nil {
+		return nil, err
+	}
+	return &MasterKey{id: computeMasterKeyID(key), aead: aead}, nil
+}
+
+// ID identifies the master key without revealing it. It is stored next to every data key wrapped by the master key.
+func (m *MasterKey) ID() string {
+	return m.id
+}
+
+func (m *MasterKey) WrapDataKey(dataKey []byte) ([]byte, error) {
+	return seal(m.aead, dataKey, []byte(m.id))
+}
+
+func (m *MasterKey) UnwrapDataKey(wrappedDataKey []byte) ([]byte, error) {
+	return open(m.aead, wrappedDataKey, []byte(m.id))
+}
+
+// LoadMasterKeyFromFile loads a base64 encoded master key from the file at the given path.
+func LoadMasterKeyFromFile(path string) (*MasterKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read master key file: %w", err)
+	}
+	return parseBase64MasterKey(string(content))
+}
+
+// LoadMasterKeyFromEnv loads a base64 encoded master key from the environment variable with the given name.
+func LoadMasterKeyFromEnv(name string) (*MasterKey, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return nil, fmt.Errorf("master key environment variable %s is not set", name)
+	}
+	return parseBase64MasterKey(value)
+}
+
+// GenerateMasterKey returns a new random master key as raw bytes.
+func GenerateMasterKey() ([]byte, error) {
+	return generateKey()
+}
+
+func generateKey() ([]byte, error) {
+	key := make([]byte, MasterKeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func parseBase64MasterKey(encodedKey string) (*MasterKey, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil {
+		return nil, fmt.Errorf("master key is not valid base64: %w", err)
+	}
+	return NewMasterKey(key)
+}
+
+func computeMasterKeyID(key []byte) string {
+	hash := sha256.Sum256(append([]byte("pki-vault master key id:"), key...))
+	return hex.EncodeToString(hash[:8])
+}
+
+func newAesGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext and prepends the random nonce to the ciphertext.
+func seal(aead cipher.AEAD, plaintext []byte, associatedData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+func open(aead cipher.AEAD, ciphertext []byte, associatedData []byte) ([]byte, error) {
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext is too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, associatedData)
+}
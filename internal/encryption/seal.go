@@ -0,0 +1,192 @@
+package encryption
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pki-vault/server/internal/encryption/shamir"
+	"sync"
+)
+
+var (
+	ErrSealed                = errors.New("the vault is sealed")
+	ErrSealNotInitialized    = errors.New("the seal is not initialized")
+	ErrInvalidUnsealKeys     = errors.New("unseal keys do not reconstruct the master key")
+	ErrDuplicateUnsealKey    = errors.New("unseal key was already submitted")
+	ErrInvalidUnsealKeyShare = errors.New("unseal key is not a valid key share")
+)
+
+// SealConfig describes how the master key was split into unseal keys. It doesn't contain any secret.
+type SealConfig struct {
+	SecretShares    int
+	SecretThreshold int
+	// MasterKeyID verifies the master key reconstructed from the unseal keys.
+	MasterKeyID string
+}
+
+type SealStatus struct {
+	Initialized bool
+	Sealed      bool
+	// Progress is the number of unseal keys submitted since the last unseal attempt.
+	Progress        int
+	SecretShares    int
+	SecretThreshold int
+}
+
+// InitShamirSeal generates a new master key and splits it into secretShares unseal keys,
+// of which any secretThreshold keys reconstruct the master key. The master key itself is never returned.
+func InitShamirSeal(secretShares int, secretThreshold int) (*SealConfig, [][]byte, error) {
+	rawMasterKey, err := GenerateMasterKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to generate master key: %w", err)
+	}
+	unsealKeys, err := shamir.Split(rawMasterKey, secretShares, secretThreshold)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to split master key: %w", err)
+	}
+
+	return &SealConfig{
+		SecretShares:    secretShares,
+		SecretThreshold: secretThreshold,
+		MasterKeyID:     computeMasterKeyID(rawMasterKey),
+	}, unsealKeys, nil
+}
+
+// ShamirSeal is a KeyEncryptor which starts sealed and refuses to encrypt or decrypt private keys with ErrSealed
+// until enough unseal keys were submitted to reconstruct the master key. The master key is only held in memory.
+type ShamirSeal struct {
+	mu                 sync.RWMutex
+	config             *SealConfig
+	previousMasterKeys []*MasterKey
+	unsealKeys         [][]byte
+	keyEncryptor       *EnvelopeKeyEncryptor
+}
+
+// NewShamirSeal returns a sealed ShamirSeal. The previous master keys are used for decryption once unsealed,
+// e.g. while data keys get re-wrapped during a master key rotation.
+func NewShamirSeal(previousMasterKeys ...*MasterKey) *ShamirSeal {
+	return &ShamirSeal{previousMasterKeys: previousMasterKeys}
+}
+
+// Initialize sets the config the unseal keys are verified against. A config can only be set once.
+func (s *ShamirSeal) Initialize(config *SealConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.config != nil {
+		return errors.New("seal is already initialized")
+	}
+	s.config = config
+	return nil
+}
+
+func (s *ShamirSeal) Status() SealStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status()
+}
+
+// Unseal submits an unseal key. Once the threshold is reached the master key is reconstructed and verified.
+// If the verification fails, all submitted unseal keys are discarded and ErrInvalidUnsealKeys is returned.
+func (s *ShamirSeal) Unseal(unsealKey []byte) (SealStatus, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.config == nil {
+		return s.status(), ErrSealNotInitialized
+	}
+	if s.keyEncryptor != nil {
+		return s.status(), nil
+	}
+	if len(unsealKey) != MasterKeySize+1 {
+		return s.status(), ErrInvalidUnsealKeyShare
+	}
+	for _, submittedUnsealKey := range s.unsealKeys {
+		if submittedUnsealKey[MasterKeySize] == unsealKey[MasterKeySize] {
+			return s.status(), ErrDuplicateUnsealKey
+		}
+	}
+
+	s.unsealKeys = append(s.unsealKeys, append([]byte(nil), unsealKey...))
+	if len(s.unsealKeys) < s.config.SecretThreshold {
+		return s.status(), nil
+	}
+
+	unsealKeys := s.unsealKeys
+	s.unsealKeys = nil
+	rawMasterKey, err := shamir.Combine(unsealKeys)
+	if err != nil {
+		return s.status(), fmt.Errorf("%w: %s", ErrInvalidUnsealKeys, err)
+	}
+	masterKey, err := NewMasterKey(rawMasterKey)
+	if err != nil {
+		return s.status(), fmt.Errorf("%w: %s", ErrInvalidUnsealKeys, err)
+	}
+	if masterKey.ID() != s.config.MasterKeyID {
+		return s.status(), ErrInvalidUnsealKeys
+	}
+
+	s.keyEncryptor = NewEnvelopeKeyEncryptor(masterKey, s.previousMasterKeys...)
+	return s.status(), nil
+}
+
+// ResetUnsealProgress discards all unseal keys submitted since the last unseal attempt.
+func (s *ShamirSeal) ResetUnsealProgress() SealStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.unsealKeys = nil
+	return s.status()
+}
+
+func (s *ShamirSeal) MasterKeyID() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.config == nil {
+		return ""
+	}
+	return s.config.MasterKeyID
+}
+
+func (s *ShamirSeal) Encrypt(plaintext []byte, associatedData []byte) (*EncryptedKey, error) {
+	keyEncryptor, err := s.unsealedKeyEncryptor()
+	if err != nil {
+		return nil, err
+	}
+	return keyEncryptor.Encrypt(plaintext, associatedData)
+}
+
+func (s *ShamirSeal) Decrypt(encryptedKey *EncryptedKey, associatedData []byte) ([]byte, error) {
+	keyEncryptor, err := s.unsealedKeyEncryptor()
+	if err != nil {
+		return nil, err
+	}
+	return keyEncryptor.Decrypt(encryptedKey, associatedData)
+}
+
+func (s *ShamirSeal) Rewrap(encryptedKey *EncryptedKey) (*EncryptedKey, error) {
+	keyEncryptor, err := s.unsealedKeyEncryptor()
+	if err != nil {
+		return nil, err
+	}
+	return keyEncryptor.Rewrap(encryptedKey)
+}
+
+func (s *ShamirSeal) unsealedKeyEncryptor() (*EnvelopeKeyEncryptor, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.keyEncryptor == nil {
+		return nil, ErrSealed
+	}
+	return s.keyEncryptor, nil
+}
+
+func (s *ShamirSeal) status() SealStatus {
+	status := SealStatus{
+		Initialized: s.config != nil,
+		Sealed:      s.keyEncryptor == nil,
+		Progress:    len(s.unsealKeys),
+	}
+	if s.config != nil {
+		status.SecretShares = s.config.SecretShares
+		status.SecretThreshold = s.config.SecretThreshold
+	}
+	return status
+}
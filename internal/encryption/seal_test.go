@@ -0,0 +1,101 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestShamirSeal_Unseal(t *testing.T) {
+	config, unsealKeys, err := InitShamirSeal(3, 2)
+	if err != nil {
+		t.Fatalf("InitShamirSeal() got unexpected error: %v", err)
+	}
+	if len(unsealKeys) != 3 {
+		t.Fatalf("InitShamirSeal() returned %d unseal keys, want 3", len(unsealKeys))
+	}
+
+	seal := NewShamirSeal()
+	if _, err := seal.Unseal(unsealKeys[0]); !errors.Is(err, ErrSealNotInitialized) {
+		t.Errorf("Unseal() error = %v, want %v", err, ErrSealNotInitialized)
+	}
+	if err := seal.Initialize(config); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := seal.Encrypt([]byte("private key der"), nil); !errors.Is(err, ErrSealed) {
+		t.Errorf("Encrypt() error = %v, want %v while sealed", err, ErrSealed)
+	}
+
+	status, err := seal.Unseal(unsealKeys[2])
+	if err != nil {
+		t.Fatalf("Unseal() got unexpected error: %v", err)
+	}
+	if !status.Sealed || status.Progress != 1 {
+		t.Errorf("Unseal() status = %+v, want sealed with progress 1", status)
+	}
+	if _, err := seal.Unseal(unsealKeys[2]); !errors.Is(err, ErrDuplicateUnsealKey) {
+		t.Errorf("Unseal() error = %v, want %v", err, ErrDuplicateUnsealKey)
+	}
+
+	status, err = seal.Unseal(unsealKeys[0])
+	if err != nil {
+		t.Fatalf("Unseal() got unexpected error: %v", err)
+	}
+	if status.Sealed || status.Progress != 0 {
+		t.Errorf("Unseal() status = %+v, want unsealed", status)
+	}
+	if seal.MasterKeyID() != config.MasterKeyID {
+		t.Errorf("MasterKeyID() = %s, want %s", seal.MasterKeyID(), config.MasterKeyID)
+	}
+
+	plaintext := []byte("private key der")
+	encryptedKey, err := seal.Encrypt(plaintext, nil)
+	if err != nil {
+		t.Fatalf("Encrypt() got unexpected error: %v", err)
+	}
+	decrypted, err := seal.Decrypt(encryptedKey, nil)
+	if err != nil {
+		t.Fatalf("Decrypt() got unexpected error: %v", err)
+	}
+	if !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("Decrypt() = %v, want %v", decrypted, plaintext)
+	}
+}
+
+func TestShamirSeal_UnsealInvalidKeys(t *testing.T) {
+	config, unsealKeys, err := InitShamirSeal(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, otherUnsealKeys, err := InitShamirSeal(3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seal := NewShamirSeal()
+	if err := seal.Initialize(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := seal.Unseal([]byte("too short")); !errors.Is(err, ErrInvalidUnsealKeyShare) {
+		t.Errorf("Unseal() error = %v, want %v", err, ErrInvalidUnsealKeyShare)
+	}
+
+	if _, err := seal.Unseal(unsealKeys[0]); err != nil {
+		t.Fatal(err)
+	}
+	status, err := seal.Unseal(otherUnsealKeys[1])
+	if !errors.Is(err, ErrInvalidUnsealKeys) {
+		t.Errorf("Unseal() error = %v, want %v", err, ErrInvalidUnsealKeys)
+	}
+	if !status.Sealed || status.Progress != 0 {
+		t.Errorf("Unseal() status = %+v, want sealed with reset progress", status)
+	}
+
+	if _, err := seal.Unseal(unsealKeys[0]); err != nil {
+		t.Fatal(err)
+	}
+	if status := seal.ResetUnsealProgress(); status.Progress != 0 {
+		t.Errorf("ResetUnsealProgress() progress = %d, want 0", status.Progress)
+	}
+}
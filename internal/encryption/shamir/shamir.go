@@ -0,0 +1,146 @@
+// Package shamir implements Shamir's secret sharing over GF(2^8).
+// Every byte of the secret is the constant term of its own random polynomial, shares are points on these polynomials.
+package shamir
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxParts is the maximum amount of shares a secret can be split into, limited by the non-zero elements of GF(2^8).
+const MaxParts = 255
+
+// Split splits the secret into parts shares of which any threshold shares reconstruct the secret.
+// Each share is one byte longer than the secret, the last byte holds the x coordinate of the share.
+func Split(secret []byte, parts int, threshold int) ([][]byte, error) {
+	switch {
+	case len(secret) == 0:
+		return nil, errors.New("secret must not be empty")
+	case threshold < 2:
+		return nil, errors.New("threshold must be at least 2")
+	case parts < threshold:
+		return nil, errors.New("parts must not be less than threshold")
+	case parts > MaxParts:
+		return nil, fmt.Errorf("parts must not exceed %d", MaxParts)
+	}
+
+	shares := make([][]byte, parts)
+	for idx := range shares {
+		shares[idx] = make([]byte, len(secret)+1)
+		shares[idx][len(secret)] = byte(idx + 1)
+	}
+
+	coefficients := make([]byte, threshold)
+	for byteIdx, secretByte := range secret {
+		coefficients[0] = secretByte
+		if _, err := io.ReadFull(rand.Reader, coefficients[1:]); err != nil {
+			return nil, fmt.Errorf("unable to generate polynomial: %w", err)
+		}
+		for _, share := range shares {
+			share[byteIdx] = evaluate(coefficients, share[len(secret)])
+		}
+	}
+
+	return shares, nil
+}
+
+// Combine reconstructs the secret from shares created by Split.
+// Passing fewer shares than the threshold used to split the secret silently results in a wrong secret.
+func Combine(shares [][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, errors.New("at least 2 shares are required")
+	}
+	shareLen := len(shares[0])
+	if shareLen < 2 {
+		return nil, errors.New("shares must be at least 2 bytes long")
+	}
+
+	xCoordinates := make([]byte, len(shares))
+	seenXCoordinates := make(map[byte]bool, len(shares))
+	for idx, share := range shares {
+		if len(share) != shareLen {
+			return nil, errors.New("all shares must have the same length")
+		}
+		xCoordinate := share[shareLen-1]
+		if xCoordinate == 0 {
+			return nil, errors.New("share has an invalid x coordinate")
+		}
+		if seenXCoordinates[xCoordinate] {
+			return nil, errors.New("duplicate share")
+		}
+		seenXCoordinates[xCoordinate] = true
+		xCoordinates[idx] = xCoordinate
+	}
+
+	secret := make([]byte, shareLen-1)
+	yCoordinates := make([]byte, len(shares))
+	for byteIdx := range secret {
+		for idx, share := range shares {
+			yCoordinates[idx] = share[byteIdx]
+		}
+		secret[byteIdx] = interpolateAtZero(xCoordinates, yCoordinates)
+	}
+	return secret, nil
+}
+
+// evaluate evaluates the polynomial with the given coefficients at x using Horner's method.
+func evaluate(coefficients []byte, x byte) byte {
+	result := coefficients[len(coefficients)-1]
+	for idx := len(coefficients) - 2; idx >= 0; idx-- {
+		result = mul(result, x) ^ coefficients[idx]
+	}
+	return result
+}
+
+// interpolateAtZero computes the constant term of the polynomial through the given points with Lagrange interpolation.
+func interpolateAtZero(xCoordinates []byte, yCoordinates []byte) byte {
+	var result byte
+	for i, xi := range xCoordinates {
+		basis := byte(1)
+		for j, xj := range xCoordinates {
+			if i == j {
+				continue
+			}
+			// Subtraction is addition, which is xor in GF(2^8)
+			basis = mul(basis, div(xj, xj^xi))
+		}
+		result ^= mul(yCoordinates[i], basis)
+	}
+	return result
+}
+
+// mul multiplies a and b in GF(2^8) reduced by the AES polynomial x^8 + x^4 + x^3 + x + 1.
+func mul(a byte, b byte) byte {
+	var product byte
+	for b != 0 {
+		if b&1 != 0 {
+			product ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return product
+}
+
+// div divides a by the non-zero b in GF(2^8).
+func div(a byte, b byte) byte {
+	return mul(a, inverse(b))
+}
+
+// inverse returns the multiplicative inverse of the non-zero a, which is a^254 in GF(2^8).
+func inverse(a byte) byte {
+	result := byte(1)
+	for exponent := 254; exponent > 0; exponent >>= 1 {
+		if exponent&1 != 0 {
+			result = mul(result, a)
+		}
+		a = mul(a, a)
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package shamir
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSplitCombine(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+
+	shares, err := Split(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Split() got unexpected error: %v", err)
+	}
+	if len(shares) != 5 {
+		t.Fatalf("Split() returned %d shares, want 5", len(shares))
+	}
+
+	// Every combination of threshold shares must reconstruct the secret
+	for i := 0; i < len(shares); i++ {
+		for j := i + 1; j < len(shares); j++ {
+			for k := j + 1; k < len(shares); k++ {
+				combined, err := Combine([][]byte{shares[i], shares[j], shares[k]})
+				if err != nil {
+					t.Fatalf("Combine() got unexpected error: %v", err)
+				}
+				if !bytes.Equal(combined, secret) {
+					t.Errorf("Combine() of shares %d, %d, %d = %x, want %x", i, j, k, combined, secret)
+				}
+			}
+		}
+	}
+
+	combined, err := Combine(shares)
+	if err != nil {
+		t.Fatalf("Combine() got unexpected error: %v", err)
+	}
+	if !bytes.Equal(combined, secret) {
+		t.Errorf("Combine() of all shares = %x, want %x", combined, secret)
+	}
+
+	combined, err = Combine(shares[:2])
+	if err != nil {
+		t.Fatalf("Combine() got unexpected error: %v", err)
+	}
+	if bytes.Equal(combined, secret) {
+		t.Errorf("Combine() with fewer shares than the threshold must not reconstruct the secret")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    []byte
+		parts     int
+		threshold int
+	}{
+		{name: "empty secret", secret: nil, parts: 3, threshold: 2},
+		{name: "threshold too small", secret: []byte("secret"), parts: 3, threshold: 1},
+		{name: "less parts than threshold", secret: []byte("secret"), parts: 2, threshold: 3},
+		{name: "too many parts", secret: []byte("secret"), parts: MaxParts + 1, threshold: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Split(tt.secret, tt.parts, tt.threshold); err == nil {
+				t.Errorf("Split() expected error")
+			}
+		})
+	}
+}
+
+func TestCombine(t *testing.T) {
+	shares, err := Split([]byte("secret"), 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		shares [][]byte
+	}{
+		{name: "single share", shares: shares[:1]},
+		{name: "duplicate share", shares: [][]byte{shares[0], shares[0]}},
+		{name: "different lengths", shares: [][]byte{shares[0], shares[1][1:]}},
+		{name: "share too short", shares: [][]byte{{0x01}, {0x02}}},
+		{name: "invalid x coordinate", shares: [][]byte{shares[0], {0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x00}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Combine(tt.shares); err == nil {
+				t.Errorf("Combine() expected error")
+			}
+		})
+	}
+}
+
+func TestInverse(t *testing.T) {
+	for a := 1; a < 256; a++ {
+		if product := mul(byte(a), inverse(byte(a))); product != 1 {
+			t.Errorf("mul(%d, inverse(%d)) = %d, want 1", a, a, product)
+		}
+	}
+}
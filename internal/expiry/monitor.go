@@ -0,0 +1,198 @@
+package expiry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db/repository"
+	"go.uber.org/zap"
+	"sort"
+	"time"
+)
+
+// subscriptionBatchSize is the number of subscriptions checked per query.
+const subscriptionBatchSize = 100
+
+// Monitor alerts expiring certificates through its notifiers. An alert is recorded within the transaction in which it
+// is sent, so multiple server replicas can scan concurrently without sending it twice. If a notifier fails, the alert
+// isn't recorded and is sent again on the next scan.
+type Monitor struct {
+	certRepo   repository.X509CertificateRepository
+	subRepo    repository.X509CertificateSubscriptionRepository
+	alertRepo  repository.ExpiryAlertRepository
+	txManager  repository.TransactionManager
+	notifiers  []Notifier
+	thresholds []time.Duration
+	config     config.Expiry
+	clock      clockwork.Clock
+	logger     *zap.Logger
+}
+
+func NewMonitor(
+	certRepo repository.X509CertificateRepository, subRepo repository.X509CertificateSubscriptionRepository,
+	alertRepo repository.ExpiryAlertRepository, txManager repository.TransactionManager, notifiers []Notifier,
+	config config.Expiry, clock clockwork.Clock, logger *zap.Logger,
+) *Monitor {
+	// Shortest threshold first
+	thresholds := append([]time.Duration(nil), config.Thresholds...)
+	sort.Slice(thresholds, func(i, j int) bool {
+		return thresholds[i] < thresholds[j]
+	})
+	return &Monitor{
+		certRepo: certRepo, subRepo: subRepo, alertRepo: alertRepo, txManager: txManager, notifiers: notifiers,
+		thresholds: thresholds, config: config, clock: clock, logger: logger,
+	}
+}
+
+// Run scans for expiring certificates immediately and then every scan interval until the context is done.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := m.clock.NewTicker(m.config.ScanInterval)
+	defer ticker.Stop()
+	for {
+		if err := m.Scan(ctx); err != nil {
+			m.logger.Error("could not alert expiring certificates", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+		}
+	}
+}
+
+// Scan alerts the certificates without a replacement and the latest certificates of subscriptions which crossed a
+// threshold and weren't alerted for it yet. Failed alerts don't stop the scan, their errors are returned joined.
+func (m *Monitor) Scan(ctx context.Context) error {
+	if len(m.thresholds) == 0 {
+		return nil
+	}
+	now := m.clock.Now()
+	expiringUntil := now.Add(m.thresholds[len(m.thresholds)-1])
+
+	var errs []error
+	certs, err := m.certRepo.FindLatestActiveExpiringBetween(ctx, now, expiringUntil)
+	if err != nil {
+		return err
+	}
+	for _, cert := range certs {
+		if err := m.alert(ctx, AlertCertificateExpiring, cert, nil, now); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	var after *repository.X509CertificateSubscriptionPosition
+	for {
+		subs, err := m.subRepo.FindAll(ctx, after, subscriptionBatchSize)
+		if err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+		for _, sub := range subs {
+			latestCert, err := m.findLatestSubscriptionCertificate(ctx, sub)
+			if err != nil {
+				return errors.Join(append(errs, err)...)
+			}
+			if latestCert == nil || latestCert.NotAfter.After(expiringUntil) {
+				continue
+			}
+			if err := m.alert(ctx, AlertSubscriptionExpiring, latestCert, &sub.ID, now); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(subs) < subscriptionBatchSize {
+			return errors.Join(errs...)
+		}
+		lastSub := subs[len(subs)-1]
+		after = &repository.X509CertificateSubscriptionPosition{CreatedAt: lastSub.CreatedAt, ID: lastSub.ID}
+	}
+}
+
+// findLatestSubscriptionCertificate returns the active certificate matching the subscription which expires last, or
+// nil if there is none. The subscription only expires once this certificate expires.
+func (m *Monitor) findLatestSubscriptionCertificate(
+	ctx context.Context, sub *repository.X509CertificateSubscriptionDao,
+) (*repository.X509CertificateDao, error) {
+	certs, err := m.certRepo.FindLatestActiveBySANsAndCreatedAtAfter(ctx, sub.SubjectAltNames, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	var latestCert *repository.X509CertificateDao
+	for _, cert := range certs {
+		if latestCert == nil || cert.NotAfter.After(latestCert.NotAfter) {
+			latestCert = cert
+		}
+	}
+	return latestCert, nil
+}
+
+// alert sends an alert for the shortest threshold the certificate crossed, unless it was already sent. All crossed
+// thresholds are recorded, so longer thresholds aren't alerted afterwards.
+func (m *Monitor) alert(
+	ctx context.Context, alertType string, cert *repository.X509CertificateDao, subID *uuid.UUID, now time.Time,
+) (err error) {
+	var crossedThresholds []time.Duration
+	for _, threshold := range m.thresholds {
+		if !cert.NotAfter.After(now.Add(threshold)) {
+			crossedThresholds = append(crossedThresholds, threshold)
+		}
+	}
+	if len(crossedThresholds) == 0 {
+		return nil
+	}
+
+	txCtx, err := m.txManager.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := m.txManager.RollbackTx(txCtx); rollbackErr != nil {
+				err = errors.Join(err, fmt.Errorf("unable to rollback transaction: %w", rollbackErr))
+			}
+		}
+	}()
+
+	alert := &Alert{
+		ID:             uuid.New(),
+		Type:           alertType,
+		Threshold:      crossedThresholds[0],
+		Certificate:    cert,
+		SubscriptionID: subID,
+		CreatedAt:      now,
+	}
+	created, err := m.alertRepo.CreateIfNotExists(
+		txCtx, repository.NewExpiryAlertDao(alert.ID, cert.ID, subID, alert.Threshold, now),
+	)
+	if err != nil {
+		return err
+	}
+	for _, threshold := range crossedThresholds[1:] {
+		_, err = m.alertRepo.CreateIfNotExists(
+			txCtx, repository.NewExpiryAlertDao(uuid.New(), cert.ID, subID, threshold, now),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if created {
+		var errs []error
+		for _, notifier := range m.notifiers {
+			if err := notifier.Notify(ctx, alert); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if err = errors.Join(errs...); err != nil {
+			return fmt.Errorf("could not send alert for certificate %s: %w", cert.ID, err)
+		}
+		m.logger.Debug("sent expiry alert",
+			zap.String("expiry-alert-id", alert.ID.String()),
+			zap.String("alert-type", alert.Type),
+			zap.String("certificate-id", cert.ID.String()),
+		)
+	}
+
+	return m.txManager.CommitTx(txCtx)
+}
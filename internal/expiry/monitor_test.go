@@ -0,0 +1,174 @@
+package expiry
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"github.com/pki-vault/server/internal/testutil"
+	"go.uber.org/zap"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testNotifier struct {
+	err    error
+	alerts []*Alert
+}
+
+func (t *testNotifier) Notify(_ context.Context, alert *Alert) error {
+	t.alerts = append(t.alerts, alert)
+	return t.err
+}
+
+func TestMonitor_Scan(t *testing.T) {
+	type txCtxKey struct{}
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	txCtx := context.WithValue(ctx, txCtxKey{}, "tx")
+	day := 24 * time.Hour
+	expiryConfig := config.Expiry{ScanInterval: time.Hour, Thresholds: []time.Duration{30 * day, day, 14 * day, 7 * day}}
+	subID := uuid.MustParse("4b6d8f0a-2c4e-4a6c-8e0b-2d4f6a8c0e2b")
+	newCert := func(id string, notAfter time.Time) *repository.X509CertificateDao {
+		return repository.NewX509CertificateDao(
+			uuid.MustParse(id), "example.invalid", []string{"example.invalid"}, nil, nil, nil, nil, nil, nil, nil,
+			fakeClock.Now().Add(-day), notAfter, fakeClock.Now().Add(-day),
+		)
+	}
+	expiringCert := newCert("9c1e3a5b-7d9f-4b2c-8e4a-6c8e0a2b4d6f", fakeClock.Now().Add(10*day))
+	subCert := newCert("2d4f6a8c-0e2b-4d6f-8a0c-2e4b6d8f0a2c", fakeClock.Now().Add(3*day))
+	otherSubCertID := "6f8a0c2e-4b6d-4f8a-9c2e-4b6d8f0a2c4e"
+
+	tests := []struct {
+		name           string
+		certs          []*repository.X509CertificateDao
+		subCerts       []*repository.X509CertificateDao
+		alerted        bool
+		notifierErr    error
+		wantAlerts     []*Alert
+		wantThresholds []time.Duration
+		wantErr        bool
+	}{
+		{
+			name:  "alert shortest crossed threshold",
+			certs: []*repository.X509CertificateDao{expiringCert},
+			wantAlerts: []*Alert{
+				{Type: AlertCertificateExpiring, Threshold: 14 * day, Certificate: expiringCert, CreatedAt: fakeClock.Now()},
+			},
+			wantThresholds: []time.Duration{14 * day, 30 * day},
+		},
+		{
+			name:           "skip alerted threshold",
+			certs:          []*repository.X509CertificateDao{expiringCert},
+			alerted:        true,
+			wantThresholds: []time.Duration{14 * day, 30 * day},
+		},
+		{
+			name: "alert latest subscription certificate",
+			subCerts: []*repository.X509CertificateDao{
+				newCert(otherSubCertID, fakeClock.Now().Add(2*day)), subCert,
+			},
+			wantAlerts: []*Alert{
+				{
+					Type: AlertSubscriptionExpiring, Threshold: 7 * day, Certificate: subCert,
+					SubscriptionID: testutil.Ptr(subID), CreatedAt: fakeClock.Now(),
+				},
+			},
+			wantThresholds: []time.Duration{7 * day, 14 * day, 30 * day},
+		},
+		{
+			name: "skip subscription with a certificate outside the thresholds",
+			subCerts: []*repository.X509CertificateDao{
+				subCert, newCert(otherSubCertID, fakeClock.Now().Add(60*day)),
+			},
+		},
+		{
+			name:        "keep alert unsent if a notifier failed",
+			certs:       []*repository.X509CertificateDao{expiringCert},
+			notifierErr: errors.New("notifier unavailable"),
+			wantAlerts: []*Alert{
+				{Type: AlertCertificateExpiring, Threshold: 14 * day, Certificate: expiringCert, CreatedAt: fakeClock.Now()},
+			},
+			wantThresholds: []time.Duration{14 * day, 30 * day},
+			wantErr:        true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+			subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+			alertRepo := mock_repository.NewMockExpiryAlertRepository(ctrl)
+			txManager := mock_repository.NewMockTransactionManager(ctrl)
+
+			certRepo.EXPECT().FindLatestActiveExpiringBetween(ctx, fakeClock.Now(), fakeClock.Now().Add(30*day)).
+				Return(tt.certs, nil)
+			sub := repository.NewX509CertificateSubscriptionDao(
+				subID, []string{"example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+			)
+			subRepo.EXPECT().FindAll(ctx, nil, subscriptionBatchSize).
+				Return([]*repository.X509CertificateSubscriptionDao{sub}, nil)
+			certRepo.EXPECT().FindLatestActiveBySANsAndCreatedAtAfter(ctx, sub.SubjectAltNames, time.Time{}).
+				Return(tt.subCerts, nil)
+
+			var gotAlerts []*repository.ExpiryAlertDao
+			if tt.wantThresholds != nil {
+				txManager.EXPECT().BeginTx(ctx).Return(txCtx, nil)
+				created := !tt.alerted
+				alertRepo.EXPECT().CreateIfNotExists(txCtx, gomock.Any()).
+					DoAndReturn(func(_ context.Context, alert *repository.ExpiryAlertDao) (bool, error) {
+						gotAlerts = append(gotAlerts, alert)
+						createdAlert := created
+						created = false
+						return createdAlert, nil
+					}).Times(len(tt.wantThresholds))
+				if tt.wantErr {
+					txManager.EXPECT().RollbackTx(txCtx).Return(nil)
+				} else {
+					txManager.EXPECT().CommitTx(txCtx).Return(nil)
+				}
+			}
+
+			notifier := &testNotifier{err: tt.notifierErr}
+			monitor := NewMonitor(
+				certRepo, subRepo, alertRepo, txManager, []Notifier{notifier}, expiryConfig, fakeClock, zap.NewNop(),
+			)
+			if err := monitor.Scan(ctx); (err != nil) != tt.wantErr {
+				t.Fatalf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var gotThresholds []time.Duration
+			for _, alert := range gotAlerts {
+				gotThresholds = append(gotThresholds, alert.Threshold)
+				wantCert := expiringCert
+				if alert.SubscriptionID != nil {
+					wantCert = subCert
+				}
+				if alert.CertificateID != wantCert.ID || !alert.CreatedAt.Equal(fakeClock.Now()) {
+					t.Errorf("Scan() created alert %v for certificate %s", alert, wantCert.ID)
+				}
+			}
+			if !reflect.DeepEqual(gotThresholds, tt.wantThresholds) {
+				t.Errorf("Scan() created alerts for thresholds %v, want %v", gotThresholds, tt.wantThresholds)
+			}
+
+			if len(notifier.alerts) != len(tt.wantAlerts) {
+				t.Fatalf("Scan() sent %d alerts, want %d", len(notifier.alerts), len(tt.wantAlerts))
+			}
+			for idx, alert := range notifier.alerts {
+				if alert.ID != gotAlerts[0].ID {
+					t.Errorf("Scan() sent alert %s, want the ID of the created alert %s", alert.ID, gotAlerts[0].ID)
+				}
+				alert.ID = uuid.Nil
+				if !reflect.DeepEqual(alert, tt.wantAlerts[idx]) {
+					t.Errorf("Scan() sent alert %v, want %v", alert, tt.wantAlerts[idx])
+				}
+			}
+		})
+	}
+}
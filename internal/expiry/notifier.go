@@ -0,0 +1,164 @@
+package expiry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/outbox"
+	"go.uber.org/zap"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Enum values for Alert.Type
+const (
+	// AlertCertificateExpiring alerts about a certificate without a replacement.
+	AlertCertificateExpiring = "certificate.expiring"
+	// AlertSubscriptionExpiring alerts about the latest certificate of a subscription.
+	AlertSubscriptionExpiring = "subscription.expiring"
+)
+
+// Alert is sent once the Certificate expires within the Threshold. SubscriptionID is only set for
+// AlertSubscriptionExpiring.
+type Alert struct {
+	ID             uuid.UUID
+	Type           string
+	Threshold      time.Duration
+	Certificate    *repository.X509CertificateDao
+	SubscriptionID *uuid.UUID
+	CreatedAt      time.Time
+}
+
+// AlertData is the data of alerts posted by the WebhookNotifier.
+type AlertData struct {
+	CertificateID    uuid.UUID  `json:"certificate_id"`
+	CommonName       string     `json:"common_name"`
+	SubjectAltNames  []string   `json:"subject_alt_names"`
+	NotAfter         time.Time  `json:"not_after"`
+	ThresholdSeconds int64      `json:"threshold_seconds"`
+	SubscriptionID   *uuid.UUID `json:"subscription_id,omitempty"`
+}
+
+// Notifier sends expiry alerts. If a notifier fails, the alert is sent through all notifiers again on the next scan,
+// so notifiers may send an alert more than once.
+type Notifier interface {
+	Notify(ctx context.Context, alert *Alert) error
+}
+
+// LogNotifier logs every alert.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (l *LogNotifier) Notify(_ context.Context, alert *Alert) error {
+	fields := []zap.Field{
+		zap.String("expiry-alert-id", alert.ID.String()),
+		zap.String("alert-type", alert.Type),
+		zap.String("certificate-id", alert.Certificate.ID.String()),
+		zap.String("common-name", alert.Certificate.CommonName),
+		zap.Strings("subject-alt-names", alert.Certificate.SubjectAltNames),
+		zap.Time("not-after", alert.Certificate.NotAfter),
+		zap.Duration("threshold", alert.Threshold),
+	}
+	if alert.SubscriptionID != nil {
+		fields = append(fields, zap.String("subscription-id", alert.SubscriptionID.String()))
+	}
+	l.logger.Warn("certificate expires soon", fields...)
+	return nil
+}
+
+// WebhookNotifier posts every alert as an event like the outbox.WebhookSink, the event ID is the alert ID and the
+// data is AlertData.
+type WebhookNotifier struct {
+	sink *outbox.WebhookSink
+}
+
+func NewWebhookNotifier(url string, secret string, timeout time.Duration, clock clockwork.Clock) *WebhookNotifier {
+	return &WebhookNotifier{sink: outbox.NewWebhookSink(url, secret, timeout, clock)}
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, alert *Alert) error {
+	data, err := json.Marshal(&AlertData{
+		CertificateID:    alert.Certificate.ID,
+		CommonName:       alert.Certificate.CommonName,
+		SubjectAltNames:  alert.Certificate.SubjectAltNames,
+		NotAfter:         alert.Certificate.NotAfter,
+		ThresholdSeconds: int64(alert.Threshold / time.Second),
+		SubscriptionID:   alert.SubscriptionID,
+	})
+	if err != nil {
+		return err
+	}
+	return w.sink.Publish(ctx, &outbox.Event{ID: alert.ID, Type: alert.Type, CreatedAt: alert.CreatedAt, Data: data})
+}
+
+// SendMailFunc sends a mail like smtp.SendMail.
+type SendMailFunc func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+
+// SMTPNotifier mails every alert as plain text.
+type SMTPNotifier struct {
+	addr     string
+	auth     smtp.Auth
+	from     string
+	to       []string
+	sendMail SendMailFunc
+}
+
+// NewSMTPNotifier returns a notifier which sends mails with sendMail, usually smtp.SendMail. auth may be nil if the
+// server doesn't require authentication.
+func NewSMTPNotifier(
+	host string, port int, auth smtp.Auth, from string, to []string, sendMail SendMailFunc,
+) *SMTPNotifier {
+	return &SMTPNotifier{
+		addr: net.JoinHostPort(host, strconv.Itoa(port)), auth: auth, from: from, to: to, sendMail: sendMail,
+	}
+}
+
+func (s *SMTPNotifier) Notify(_ context.Context, alert *Alert) error {
+	return s.sendMail(s.addr, s.auth, s.from, s.to, s.message(alert))
+}
+
+// message formats the alert as mail with CRLF line endings.
+func (s *SMTPNotifier) message(alert *Alert) []byte {
+	cert := alert.Certificate
+	name := cert.CommonName
+	if name == "" && len(cert.SubjectAltNames) != 0 {
+		name = cert.SubjectAltNames[0]
+	}
+	// The name is taken from the certificate and must not add header lines
+	name = strings.NewReplacer("\r", " ", "\n", " ").Replace(name)
+
+	var body strings.Builder
+	fmt.Fprintf(&body, "The certificate %s expires at %s.\r\n\r\n", name, cert.NotAfter.UTC().Format(time.RFC3339))
+	if alert.SubscriptionID != nil {
+		fmt.Fprintf(&body, "It is the latest certificate of subscription %s and no replacement was imported.\r\n\r\n",
+			alert.SubscriptionID)
+	}
+	fmt.Fprintf(&body, "Certificate ID: %s\r\n", cert.ID)
+	fmt.Fprintf(&body, "Common name: %s\r\n", cert.CommonName)
+	fmt.Fprintf(&body, "Subject alt names: %s\r\n", strings.Join(cert.SubjectAltNames, ", "))
+	fmt.Fprintf(&body, "Alert threshold: %s\r\n", alert.Threshold)
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", s.from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&message, "Subject: Certificate %s expires at %s\r\n", name, cert.NotAfter.UTC().Format(time.DateOnly))
+	fmt.Fprintf(&message, "Date: %s\r\n", alert.CreatedAt.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "Message-ID: <%s@pki-vault>\r\n", alert.ID)
+	message.WriteString("MIME-Version: 1.0\r\n")
+	message.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	message.WriteString("\r\n")
+	message.WriteString(body.String())
+	return message.Bytes()
+}
@@ -0,0 +1,130 @@
+package expiry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/outbox"
+	"github.com/pki-vault/server/internal/testutil"
+	"github.com/pki-vault/server/internal/webhook"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestAlert(clock clockwork.Clock) *Alert {
+	return &Alert{
+		ID:        uuid.MustParse("8e0a2c4e-6b8d-4f0a-9c4e-6b8d0f2a4c6e"),
+		Type:      AlertSubscriptionExpiring,
+		Threshold: 7 * 24 * time.Hour,
+		Certificate: repository.NewX509CertificateDao(
+			uuid.MustParse("9c1e3a5b-7d9f-4b2c-8e4a-6c8e0a2b4d6f"), "example.invalid",
+			[]string{"example.invalid", "www.example.invalid"}, nil, nil, nil, nil, nil, nil, nil,
+			clock.Now().Add(-24*time.Hour), clock.Now().Add(3*24*time.Hour), clock.Now().Add(-24*time.Hour),
+		),
+		SubscriptionID: testutil.Ptr(uuid.MustParse("4b6d8f0a-2c4e-4a6c-8e0b-2d4f6a8c0e2b")),
+		CreatedAt:      clock.Now(),
+	}
+}
+
+func TestWebhookNotifier_Notify(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	alert := newTestAlert(fakeClock)
+
+	var gotEvent outbox.Event
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get(webhook.EventHeader); got != AlertSubscriptionExpiring {
+			t.Errorf("%s = %v, want %v", webhook.EventHeader, got, AlertSubscriptionExpiring)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&gotEvent); err != nil {
+			t.Errorf("could not decode event: %v", err)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	notifier := NewWebhookNotifier(server.URL, "0123456789abcdef", 10*time.Second, fakeClock)
+	if err := notifier.Notify(context.Background(), alert); err != nil {
+		t.Fatalf("Notify() got unexpected error: %v", err)
+	}
+
+	if gotEvent.ID != alert.ID || gotEvent.Type != alert.Type || !gotEvent.CreatedAt.Equal(alert.CreatedAt) {
+		t.Errorf("Notify() posted event %v, want the ID, type and creation of alert %v", gotEvent, alert)
+	}
+	var gotData AlertData
+	if err := json.Unmarshal(gotEvent.Data, &gotData); err != nil {
+		t.Fatal(err)
+	}
+	gotData.NotAfter = gotData.NotAfter.UTC()
+	wantData := AlertData{
+		CertificateID:    alert.Certificate.ID,
+		CommonName:       "example.invalid",
+		SubjectAltNames:  []string{"example.invalid", "www.example.invalid"},
+		NotAfter:         alert.Certificate.NotAfter.UTC(),
+		ThresholdSeconds: 7 * 24 * 60 * 60,
+		SubscriptionID:   alert.SubscriptionID,
+	}
+	if !reflect.DeepEqual(gotData, wantData) {
+		t.Errorf("Notify() posted data %v, want %v", gotData, wantData)
+	}
+}
+
+func TestSMTPNotifier_Notify(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	alert := newTestAlert(fakeClock)
+	alert.Certificate.CommonName = "example.invalid\r\nBcc: attacker@example.invalid"
+
+	tests := []struct {
+		name        string
+		sendMailErr error
+		wantErr     bool
+	}{
+		{name: "send mail"},
+		{name: "failed mail", sendMailErr: errors.New("connection refused"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAddr, gotFrom string
+			var gotTo []string
+			var gotMessage []byte
+			sendMail := func(addr string, _ smtp.Auth, from string, to []string, msg []byte) error {
+				gotAddr, gotFrom, gotTo, gotMessage = addr, from, to, msg
+				return tt.sendMailErr
+			}
+
+			notifier := NewSMTPNotifier(
+				"mail.example.invalid", 587, nil, "pki-vault@example.invalid", []string{"ops@example.invalid"}, sendMail,
+			)
+			if err := notifier.Notify(context.Background(), alert); (err != nil) != tt.wantErr {
+				t.Fatalf("Notify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if gotAddr != "mail.example.invalid:587" || gotFrom != "pki-vault@example.invalid" ||
+				!reflect.DeepEqual(gotTo, []string{"ops@example.invalid"}) {
+				t.Errorf("Notify() sent mail from %s via %s to %v", gotFrom, gotAddr, gotTo)
+			}
+			headers, body, found := strings.Cut(string(gotMessage), "\r\n\r\n")
+			if !found {
+				t.Fatalf("Notify() sent message without body: %q", gotMessage)
+			}
+			wantSubject := "Subject: Certificate example.invalid  Bcc: attacker@example.invalid expires at " +
+				alert.Certificate.NotAfter.UTC().Format(time.DateOnly)
+			if !strings.Contains(headers, wantSubject+"\r\n") {
+				t.Errorf("Notify() sent headers %q, want subject %q", headers, wantSubject)
+			}
+			if strings.Contains(headers, "\r\nBcc:") {
+				t.Errorf("Notify() sent headers %q with injected header", headers)
+			}
+			if !strings.Contains(body, alert.SubscriptionID.String()) || !strings.Contains(body, alert.Certificate.ID.String()) {
+				t.Errorf("Notify() sent body %q without subscription and certificate ID", body)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package metrics
+
+import (
+	"context"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"go.uber.org/zap"
+	"strconv"
+	"time"
+)
+
+// expiryBucketDays are the bounds in days of the buckets of the certificates gauge. Certificates below the first bound
+// are expired.
+var expiryBucketDays = []int{0, 7, 30, 90}
+
+// Inventory updates the inventory gauges of the metrics from the database.
+type Inventory struct {
+	certRepo repository.X509CertificateRepository
+	subRepo  repository.X509CertificateSubscriptionRepository
+	metrics  *Metrics
+	interval time.Duration
+	clock    clockwork.Clock
+	logger   *zap.Logger
+}
+
+func NewInventory(
+	certRepo repository.X509CertificateRepository, subRepo repository.X509CertificateSubscriptionRepository,
+	metrics *Metrics, interval time.Duration, clock clockwork.Clock, logger *zap.Logger,
+) *Inventory {
+	return &Inventory{
+		certRepo: certRepo, subRepo: subRepo, metrics: metrics, interval: interval, clock: clock, logger: logger,
+	}
+}
+
+// Run updates the gauges immediately and then every interval until the context is done.
+func (i *Inventory) Run(ctx context.Context) {
+	ticker := i.clock.NewTicker(i.interval)
+	defer ticker.Stop()
+	for {
+		if err := i.Update(ctx); err != nil {
+			i.logger.Error("could not update inventory metrics", zap.Error(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+		}
+	}
+}
+
+// Update queries the inventory and sets the gauges. The gauges keep their values if a query fails.
+func (i *Inventory) Update(ctx context.Context) error {
+	now := i.clock.Now()
+	bounds := make([]time.Time, len(expiryBucketDays))
+	for idx, days := range expiryBucketDays {
+		bounds[idx] = now.Add(time.Duration(days) * 24 * time.Hour)
+	}
+	certCounts, err := i.certRepo.CountByNotAfter(ctx, bounds)
+	if err != nil {
+		return err
+	}
+	orphanCount, err := i.certRepo.CountOrphans(ctx)
+	if err != nil {
+		return err
+	}
+	subCount, err := i.subRepo.CountWithoutActiveCertificate(ctx)
+	if err != nil {
+		return err
+	}
+
+	for idx, count := range certCounts {
+		i.metrics.certificatesByExpiry.WithLabelValues(expiryBucketLabel(idx)).Set(float64(count))
+	}
+	i.metrics.orphanCertificates.Set(float64(orphanCount))
+	i.metrics.subscriptionsWithoutValidCertificate.Set(float64(subCount))
+	i.metrics.inventoryUpdatedAt.Set(float64(now.Unix()))
+	return nil
+}
+
+// expiryBucketLabel returns the label of the bucket at the index of the counts of CountByNotAfter, e.g. "7-30".
+func expiryBucketLabel(idx int) string {
+	switch idx {
+	case 0:
+		return "expired"
+	case len(expiryBucketDays):
+		return strconv.Itoa(expiryBucketDays[idx-1]) + "+"
+	default:
+		return strconv.Itoa(expiryBucketDays[idx-1]) + "-" + strconv.Itoa(expiryBucketDays[idx])
+	}
+}
@@ -0,0 +1,65 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/jonboulle/clockwork"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestInventory_Update(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	day := 24 * time.Hour
+	wantBounds := []time.Time{
+		fakeClock.Now(), fakeClock.Now().Add(7 * day), fakeClock.Now().Add(30 * day), fakeClock.Now().Add(90 * day),
+	}
+
+	tests := []struct {
+		name     string
+		countErr error
+		wantErr  bool
+	}{
+		{name: "set gauges"},
+		{name: "keep gauges if a query failed", countErr: errors.New("connection refused"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+			subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+			certRepo.EXPECT().CountByNotAfter(ctx, wantBounds).Return([]int64{1, 2, 3, 4, 5}, nil)
+			certRepo.EXPECT().CountOrphans(ctx).Return(int64(6), nil)
+			subRepo.EXPECT().CountWithoutActiveCertificate(ctx).Return(int64(7), tt.countErr)
+
+			metrics := NewMetrics()
+			inventory := NewInventory(certRepo, subRepo, metrics, time.Minute, fakeClock, zap.NewNop())
+			if err := inventory.Update(ctx); (err != nil) != tt.wantErr {
+				t.Fatalf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			wantGauges := map[string]float64{"expired": 1, "0-7": 2, "7-30": 3, "30-90": 4, "90+": 5}
+			wantOrphans, wantSubs := float64(6), float64(7)
+			if tt.wantErr {
+				wantGauges = map[string]float64{"expired": 0, "0-7": 0, "7-30": 0, "30-90": 0, "90+": 0}
+				wantOrphans, wantSubs = 0, 0
+			}
+			for label, want := range wantGauges {
+				if got := testutil.ToFloat64(metrics.certificatesByExpiry.WithLabelValues(label)); got != want {
+					t.Errorf("Update() set certificates{expires_in_days=%q} = %v, want %v", label, got, want)
+				}
+			}
+			if got := testutil.ToFloat64(metrics.orphanCertificates); got != wantOrphans {
+				t.Errorf("Update() set orphan certificates = %v, want %v", got, wantOrphans)
+			}
+			if got := testutil.ToFloat64(metrics.subscriptionsWithoutValidCertificate); got != wantSubs {
+				t.Errorf("Update() set subscriptions without valid certificate = %v, want %v", got, wantSubs)
+			}
+		})
+	}
+}
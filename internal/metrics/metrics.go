@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"github.com/pki-vault/server/internal/service"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const namespace = "pki_vault"
+
+// Enum values for the result label of the imported certificates counter
+const (
+	importResultCreated  = "created"
+	importResultExisting = "existing"
+	importResultLinked   = "linked"
+)
+
+// Metrics holds the Prometheus metrics of the server in its own registry, so only these and the Go and process
+// metrics are served.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+
+	importedCertificates *prometheus.CounterVec
+	importedPrivateKeys  prometheus.Counter
+	importDuration       prometheus.Histogram
+
+	certificatesByExpiry                 *prometheus.GaugeVec
+	subscriptionsWithoutValidCertificate prometheus.Gauge
+	orphanCertificates                   prometheus.Gauge
+	inventoryUpdatedAt                   prometheus.Gauge
+}
+
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by OpenAPI operation ID, method and status code.",
+		}, []string{"operation", "method", "code"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Duration of HTTP requests by OpenAPI operation ID and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation", "method"}),
+		importedCertificates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "import_certificates_total",
+			Help: "Certificates of committed imports by result: created, already existing, or stored before and " +
+				"linked to a parent or private key of the import.",
+		}, []string{"result"}),
+		importedPrivateKeys: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "import_private_keys_created_total",
+			Help:      "Private keys created by committed imports.",
+		}),
+		importDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "import_duration_seconds",
+			Help:      "Duration of committed imports.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		certificatesByExpiry: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "certificates",
+			Help:      "Stored certificates by days until their expiry.",
+		}, []string{"expires_in_days"}),
+		subscriptionsWithoutValidCertificate: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "subscriptions_without_valid_certificate",
+			Help:      "Subscriptions without a currently valid matching certificate.",
+		}),
+		orphanCertificates: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "orphan_certificates",
+			Help:      "Certificates which aren't self-signed and lack their parent certificate.",
+		}),
+		inventoryUpdatedAt: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "inventory_updated_timestamp_seconds",
+			Help:      "Unix time of the last successful update of the inventory gauges.",
+		}),
+	}
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.importedCertificates,
+		m.importedPrivateKeys,
+		m.importDuration,
+		m.certificatesByExpiry,
+		m.subscriptionsWithoutValidCertificate,
+		m.orphanCertificates,
+		m.inventoryUpdatedAt,
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) ObserveHTTPRequest(operationID string, method string, statusCode int, duration time.Duration) {
+	m.httpRequests.WithLabelValues(operationID, method, strconv.Itoa(statusCode)).Inc()
+	m.httpRequestDuration.WithLabelValues(operationID, method).Observe(duration.Seconds())
+}
+
+// ObserveX509Import implements service.X509ImportObserver.
+func (m *Metrics) ObserveX509Import(stats *service.X509ImportStatsDto, duration time.Duration) {
+	m.importedCertificates.WithLabelValues(importResultCreated).Add(float64(stats.CreatedCertificates))
+	m.importedCertificates.WithLabelValues(importResultExisting).Add(float64(stats.ExistingCertificates))
+	m.importedCertificates.WithLabelValues(importResultLinked).Add(float64(stats.LinkedCertificates))
+	m.importedPrivateKeys.Add(float64(stats.CreatedPrivateKeys))
+	m.importDuration.Observe(duration.Seconds())
+}
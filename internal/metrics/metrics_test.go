@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"github.com/pki-vault/server/internal/service"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics_ObserveX509Import(t *testing.T) {
+	metrics := NewMetrics()
+	stats := &service.X509ImportStatsDto{
+		CreatedCertificates: 3, ExistingCertificates: 2, LinkedCertificates: 1, CreatedPrivateKeys: 1,
+	}
+	metrics.ObserveX509Import(stats, time.Second)
+	metrics.ObserveX509Import(stats, time.Second)
+
+	for result, want := range map[string]float64{
+		importResultCreated: 6, importResultExisting: 4, importResultLinked: 2,
+	} {
+		if got := testutil.ToFloat64(metrics.importedCertificates.WithLabelValues(result)); got != want {
+			t.Errorf("ObserveX509Import() counted %v %s certificates, want %v", got, result, want)
+		}
+	}
+	if got := testutil.ToFloat64(metrics.importedPrivateKeys); got != 2 {
+		t.Errorf("ObserveX509Import() counted %v created private keys, want %v", got, 2)
+	}
+	if got := testutil.CollectAndCount(metrics.importDuration); got != 1 {
+		t.Errorf("ObserveX509Import() collected %v duration histograms, want %v", got, 1)
+	}
+}
+
+func TestMetrics_Handler(t *testing.T) {
+	metrics := NewMetrics()
+	metrics.ObserveHTTPRequest("GetX509CertificateUpdatesV1", http.MethodGet, http.StatusOK, time.Second)
+
+	recorder := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	want := `pki_vault_http_requests_total{code="200",method="GET",operation="GetX509CertificateUpdatesV1"} 1`
+	if !strings.Contains(recorder.Body.String(), want) {
+		t.Errorf("Handler() served %s, want it to contain %s", recorder.Body.String(), want)
+	}
+}
@@ -0,0 +1,110 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/webhook"
+	"go.uber.org/zap"
+	"time"
+)
+
+// Dispatcher publishes pending outbox events to its sinks. Events are claimed before they are published, so multiple
+// server replicas can dispatch concurrently. A claim expires if the result isn't recorded, e.g. because the server
+// stopped, and the event is published again.
+type Dispatcher struct {
+	repo   repository.OutboxEventRepository
+	sinks  []Sink
+	config config.Outbox
+	clock  clockwork.Clock
+	logger *zap.Logger
+}
+
+func NewDispatcher(
+	repo repository.OutboxEventRepository, sinks []Sink, config config.Outbox, clock clockwork.Clock,
+	logger *zap.Logger,
+) *Dispatcher {
+	return &Dispatcher{repo: repo, sinks: sinks, config: config, clock: clock, logger: logger}
+}
+
+// Run dispatches due events and deletes expired published events every poll interval until the context is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := d.clock.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+			if err := d.DispatchDue(ctx); err != nil {
+				d.logger.Error("could not dispatch outbox events", zap.Error(err))
+			}
+			if _, err := d.Cleanup(ctx); err != nil {
+				d.logger.Error("could not delete published outbox events", zap.Error(err))
+			}
+		}
+	}
+}
+
+// DispatchDue publishes all events which are due, oldest first. Events are claimed one at a time right before they
+// are published, so a claim can't expire while the events claimed before it are published.
+func (d *Dispatcher) DispatchDue(ctx context.Context) error {
+	for {
+		now := d.clock.Now()
+		events, err := d.repo.ClaimDue(ctx, now, now.Add(claimDuration(d.config)), 1)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+		if err = d.publish(ctx, events[0]); err != nil {
+			return err
+		}
+	}
+}
+
+// Cleanup deletes the events which were published longer than the retention ago.
+func (d *Dispatcher) Cleanup(ctx context.Context) (rowsDeleted int64, err error) {
+	return d.repo.DeletePublishedBefore(ctx, d.clock.Now().Add(-d.config.Retention))
+}
+
+// claimDuration returns how long a claimed event isn't claimed again. It outlasts publishing the event to the webhook
+// sinks one after another, plus a minute to record the result.
+func claimDuration(outboxConfig config.Outbox) time.Duration {
+	return time.Duration(len(outboxConfig.Sinks.Webhooks))*outboxConfig.Sinks.WebhookTimeout + time.Minute
+}
+
+// publish publishes the event to all sinks and records the result. If a sink fails, the event is published to all
+// sinks again on the next attempt.
+func (d *Dispatcher) publish(ctx context.Context, event *repository.OutboxEventDao) error {
+	publishedEvent := &Event{ID: event.ID, Type: event.EventType, CreatedAt: event.CreatedAt, Data: event.Payload}
+	var errs []error
+	for _, sink := range d.sinks {
+		if err := sink.Publish(ctx, publishedEvent); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	err := errors.Join(errs...)
+
+	now := d.clock.Now()
+	event.Attempts++
+	logger := d.logger.With(
+		zap.String("outbox-event-id", event.ID.String()),
+		zap.String("event-type", event.EventType),
+		zap.Int("attempts", event.Attempts),
+	)
+	if err == nil {
+		event.NextAttemptAt = nil
+		event.LastError = nil
+		event.PublishedAt = &now
+		logger.Debug("published outbox event")
+	} else {
+		errMessage := err.Error()
+		nextAttemptAt := now.Add(webhook.Backoff(event.Attempts, d.config.InitialBackoff, d.config.MaxBackoff))
+		event.NextAttemptAt = &nextAttemptAt
+		event.LastError = &errMessage
+		logger.Warn("could not publish outbox event, retrying", zap.Time("next-attempt-at", nextAttemptAt), zap.Error(err))
+	}
+
+	return d.repo.Update(ctx, event)
+}
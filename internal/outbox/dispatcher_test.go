@@ -0,0 +1,132 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"github.com/pki-vault/server/internal/testutil"
+	"go.uber.org/zap"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type testSink struct {
+	err    error
+	events []*Event
+}
+
+func (t *testSink) Publish(_ context.Context, event *Event) error {
+	t.events = append(t.events, event)
+	return t.err
+}
+
+func TestDispatcher_DispatchDue(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	outboxConfig := config.Outbox{
+		PollInterval:   5 * time.Second,
+		InitialBackoff: 5 * time.Second,
+		MaxBackoff:     10 * time.Minute,
+		Retention:      24 * time.Hour,
+		Sinks: config.OutboxSinks{
+			Webhooks:       []config.OutboxWebhookSink{{URL: "https://a.example.invalid"}, {URL: "https://b.example.invalid"}},
+			WebhookTimeout: 10 * time.Second,
+		},
+	}
+	// The claim outlasts publishing to both webhook sinks and recording the result
+	claimedUntil := fakeClock.Now().Add(time.Minute + 20*time.Second)
+	eventID := uuid.MustParse("7c9e1a3b-5d7f-4b2c-9e4a-6b8d0f2a4c6e")
+	payload := []byte(`{"certificate_id":"2f4a6c8e-0b1d-4e3f-8a5c-7e9b1d3f5a7c"}`)
+	createdAt := fakeClock.Now().Add(-time.Minute)
+
+	tests := []struct {
+		name     string
+		attempts int
+		sinkErrs []error
+		want     *repository.OutboxEventDao
+	}{
+		{
+			name:     "published to all sinks",
+			sinkErrs: []error{nil, nil},
+			want: repository.NewOutboxEventDao(
+				eventID, "certificate.created", payload, 1, nil, nil, createdAt, testutil.Ptr(fakeClock.Now()),
+			),
+		},
+		{
+			name:     "failed sink is retried",
+			attempts: 2,
+			sinkErrs: []error{nil, errors.New("sink unavailable")},
+			want: repository.NewOutboxEventDao(
+				eventID, "certificate.created", payload, 3, testutil.Ptr(fakeClock.Now().Add(20*time.Second)),
+				testutil.Ptr("sink unavailable"), createdAt, nil,
+			),
+		},
+		{
+			name:     "retries are capped at max backoff",
+			attempts: 100,
+			sinkErrs: []error{errors.New("sink unavailable")},
+			want: repository.NewOutboxEventDao(
+				eventID, "certificate.created", payload, 101, testutil.Ptr(fakeClock.Now().Add(10*time.Minute)),
+				testutil.Ptr("sink unavailable"), createdAt, nil,
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mock_repository.NewMockOutboxEventRepository(ctrl)
+
+			event := repository.NewOutboxEventDao(
+				eventID, "certificate.created", payload, tt.attempts, testutil.Ptr(createdAt), nil, createdAt, nil,
+			)
+			gomock.InOrder(
+				repo.EXPECT().ClaimDue(gomock.Any(), fakeClock.Now(), claimedUntil, 1).
+					Return([]*repository.OutboxEventDao{event}, nil),
+				repo.EXPECT().ClaimDue(gomock.Any(), fakeClock.Now(), claimedUntil, 1).Return(nil, nil),
+			)
+			repo.EXPECT().Update(gomock.Any(), tt.want).Return(nil)
+
+			sinks := make([]Sink, len(tt.sinkErrs))
+			testSinks := make([]*testSink, len(tt.sinkErrs))
+			for idx, sinkErr := range tt.sinkErrs {
+				testSinks[idx] = &testSink{err: sinkErr}
+				sinks[idx] = testSinks[idx]
+			}
+
+			dispatcher := NewDispatcher(repo, sinks, outboxConfig, fakeClock, zap.NewNop())
+			if err := dispatcher.DispatchDue(ctx); err != nil {
+				t.Fatalf("DispatchDue() got unexpected error: %v", err)
+			}
+
+			wantEvent := &Event{ID: eventID, Type: "certificate.created", CreatedAt: createdAt, Data: payload}
+			for idx, sink := range testSinks {
+				if !reflect.DeepEqual(sink.events, []*Event{wantEvent}) {
+					t.Errorf("DispatchDue() sink %d got events %v, want %v", idx, sink.events, []*Event{wantEvent})
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_Cleanup(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	repo := mock_repository.NewMockOutboxEventRepository(ctrl)
+	repo.EXPECT().DeletePublishedBefore(ctx, fakeClock.Now().Add(-24*time.Hour)).Return(int64(3), nil)
+
+	dispatcher := NewDispatcher(repo, nil, config.Outbox{Retention: 24 * time.Hour}, fakeClock, zap.NewNop())
+	got, err := dispatcher.Cleanup(ctx)
+	if err != nil {
+		t.Fatalf("Cleanup() got unexpected error: %v", err)
+	}
+	if got != 3 {
+		t.Errorf("Cleanup() got = %v, want %v", got, 3)
+	}
+}
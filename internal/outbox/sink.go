@@ -0,0 +1,92 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/webhook"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Event is an outbox event as published to sinks. Data is the payload written by the import, its schema depends on
+// the Type.
+type Event struct {
+	ID        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	CreatedAt time.Time       `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Sink publishes outbox events. Events are published at least once, so sinks should deduplicate by the event ID.
+type Sink interface {
+	Publish(ctx context.Context, event *Event) error
+}
+
+// LogSink logs every event.
+type LogSink struct {
+	logger *zap.Logger
+}
+
+func NewLogSink(logger *zap.Logger) *LogSink {
+	return &LogSink{logger: logger}
+}
+
+func (l *LogSink) Publish(_ context.Context, event *Event) error {
+	l.logger.Info("published outbox event",
+		zap.String("outbox-event-id", event.ID.String()),
+		zap.String("event-type", event.Type),
+		zap.Time("created-at", event.CreatedAt),
+		zap.ByteString("data", event.Data),
+	)
+	return nil
+}
+
+// WebhookSink posts every event as JSON to a URL. Requests are signed like subscription webhooks, see webhook.Sign.
+// Only 2xx status codes are successful.
+type WebhookSink struct {
+	url    string
+	secret string
+	client *http.Client
+	clock  clockwork.Clock
+}
+
+func NewWebhookSink(url string, secret string, timeout time.Duration, clock clockwork.Clock) *WebhookSink {
+	return &WebhookSink{url: url, secret: secret, client: &http.Client{Timeout: timeout}, clock: clock}
+}
+
+func (w *WebhookSink) Publish(ctx context.Context, event *Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	now := w.clock.Now()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(webhook.EventHeader, event.Type)
+	request.Header.Set(webhook.DeliveryHeader, event.ID.String())
+	request.Header.Set(webhook.SignatureHeader, fmt.Sprintf(
+		"t=%d,v1=%s", now.Unix(), webhook.Sign(w.secret, now, payload),
+	))
+
+	response, err := w.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	// Drain a bounded part of the body, so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s responded with status code %d", w.url, response.StatusCode)
+	}
+	return nil
+}
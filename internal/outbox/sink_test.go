@@ -0,0 +1,70 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWebhookSink_Publish(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	secret := "0123456789abcdef"
+	event := &Event{
+		ID:        uuid.MustParse("7c9e1a3b-5d7f-4b2c-9e4a-6b8d0f2a4c6e"),
+		Type:      "certificate.linked",
+		CreatedAt: fakeClock.Now(),
+		Data:      json.RawMessage(`{"certificate_id":"2f4a6c8e-0b1d-4e3f-8a5c-7e9b1d3f5a7c"}`),
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		statusCode int
+		wantErr    bool
+	}{
+		{name: "accepted", statusCode: http.StatusAccepted},
+		{name: "rejected", statusCode: http.StatusServiceUnavailable, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				wantSignature := fmt.Sprintf(
+					"t=%d,v1=%s", fakeClock.Now().Unix(), webhook.Sign(secret, fakeClock.Now(), payload),
+				)
+				if got := r.Header.Get(webhook.SignatureHeader); got != wantSignature {
+					t.Errorf("%s = %v, want %v", webhook.SignatureHeader, got, wantSignature)
+				}
+				if got := r.Header.Get(webhook.EventHeader); got != event.Type {
+					t.Errorf("%s = %v, want %v", webhook.EventHeader, got, event.Type)
+				}
+				if got := r.Header.Get(webhook.DeliveryHeader); got != event.ID.String() {
+					t.Errorf("%s = %v, want %v", webhook.DeliveryHeader, got, event.ID)
+				}
+				if !reflect.DeepEqual(body, payload) {
+					t.Errorf("body = %s, want %s", body, payload)
+				}
+				w.WriteHeader(tt.statusCode)
+			}))
+			t.Cleanup(server.Close)
+
+			sink := NewWebhookSink(server.URL, secret, 10*time.Second, fakeClock)
+			if err := sink.Publish(ctx, event); (err != nil) != tt.wantErr {
+				t.Errorf("Publish() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,12 +1,21 @@
 package restserver
 
 import (
+	"bytes"
 	"context"
 	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/pki-vault/server/internal/encryption"
 	"github.com/pki-vault/server/internal/service"
+	"github.com/pki-vault/server/internal/updates"
 	"go.uber.org/zap"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 )
 
 type RestHandlerImpl struct {
@@ -14,22 +23,210 @@ type RestHandlerImpl struct {
 	x509CertificateSubscriptionService *service.X509CertificateSubscriptionService
 	x509CertificateService             *service.X509CertificateService
 	x509ImportService                  *service.X509ImportService
+	sealService                        *service.SealService
+	apiTokenService                    *service.APITokenService
+	policyService                      *service.PolicyService
+	webhookService                     *service.WebhookService
+	updatesHub                         *updates.Hub
 }
 
-func NewRestHandlerImpl(logger *zap.Logger, x509CertificateSubscriptionService *service.X509CertificateSubscriptionService, x509CertificateService *service.X509CertificateService, x509ImportServiceV2 *service.X509ImportService) *RestHandlerImpl {
-	return &RestHandlerImpl{logger: logger, x509CertificateSubscriptionService: x509CertificateSubscriptionService, x509CertificateService: x509CertificateService, x509ImportService: x509ImportServiceV2}
+func NewRestHandlerImpl(logger *zap.Logger, x509CertificateSubscriptionService *service.X509CertificateSubscriptionService, x509CertificateService *service.X509CertificateService, x509ImportServiceV2 *service.X509ImportService, sealService *service.SealService, apiTokenService *service.APITokenService, policyService *service.PolicyService, webhookService *service.WebhookService, updatesHub *updates.Hub) *RestHandlerImpl {
+	return &RestHandlerImpl{logger: logger, x509CertificateSubscriptionService: x509CertificateSubscriptionService, x509CertificateService: x509CertificateService, x509ImportService: x509ImportServiceV2, sealService: sealService, apiTokenService: apiTokenService, policyService: policyService, webhookService: webhookService, updatesHub: updatesHub}
+}
+
+func (r *RestHandlerImpl) SearchX509CertificatesV1(
+	ctx context.Context, request SearchX509CertificatesV1RequestObject,
+) (SearchX509CertificatesV1ResponseObject, error) {
+	search := &service.SearchX509CertificatesDto{
+		IssuerID:       request.Params.IssuerId,
+		NotAfterBefore: request.Params.NotAfterBefore,
+		NotAfterAfter:  request.Params.NotAfterAfter,
+		HasPrivateKey:  request.Params.HasPrivateKey,
+		CreatedBefore:  request.Params.CreatedBefore,
+		CreatedAfter:   request.Params.CreatedAfter,
+		SortDescending: request.Params.Order != nil && *request.Params.Order == Desc,
+	}
+	if request.Params.San != nil {
+		search.SubjectAltName = *request.Params.San
+	}
+	if request.Params.CommonName != nil {
+		search.CommonName = *request.Params.CommonName
+	}
+	if request.Params.Sort != nil {
+		search.SortBy = service.X509CertificateSortField(*request.Params.Sort)
+	}
+	if request.Params.Cursor != nil {
+		search.Cursor = *request.Params.Cursor
+	}
+	if request.Params.Limit != nil {
+		search.Limit = *request.Params.Limit
+	}
+
+	page, err := r.x509CertificateService.Search(ctx, r.principal(ctx), search)
+	if errors.Is(err, service.ErrInvalidSearch) {
+		message := "invalid certificate search"
+		return SearchX509CertificatesV1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if err != nil {
+		message := "could not search certificates"
+		r.l(ctx).Error(message, zap.Error(err))
+		return SearchX509CertificatesV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	certs := make([]X509Certificate, len(page.Certificates))
+	for i, cert := range page.Certificates {
+		certs[i] = dtoToX509Certificate(cert)
+	}
+
+	response := SearchX509CertificatesV1200JSONResponse{Certificates: certs}
+	if page.NextCursor != "" {
+		response.NextCursor = &page.NextCursor
+	}
+	return response, nil
 }
 
 func (r *RestHandlerImpl) GetX509CertificateUpdatesV1(ctx context.Context, request GetX509CertificateUpdatesV1RequestObject) (GetX509CertificateUpdatesV1ResponseObject, error) {
-	notExistingIDs, err := r.x509CertificateSubscriptionService.Exists(ctx, request.Params.Subscriptions)
+	_, statusCode, errBody := r.authorizeUpdateSubscriptions(ctx, request.Params.Subscriptions)
+	switch statusCode {
+	case http.StatusBadRequest:
+		return GetX509CertificateUpdatesV1400JSONResponse(*errBody), nil
+	case http.StatusForbidden:
+		return GetX509CertificateUpdatesV1403JSONResponse(*errBody), nil
+	case http.StatusInternalServerError:
+		return GetX509CertificateUpdatesV1defaultJSONResponse{Body: *errBody, StatusCode: statusCode}, nil
+	}
+
+	var cursor string
+	if request.Params.Cursor != nil {
+		cursor = *request.Params.Cursor
+	}
+	wait := updatesWait(request.Params.Wait)
+	if ginCtx, ok := ctx.(*gin.Context); ok && wait > 0 {
+		// Long polls outlive the read timeout of the server
+		if err := clearReadDeadline(ginCtx.Writer); err != nil {
+			r.l(ctx).Debug("could not clear read deadline", zap.Error(err))
+		}
+	}
+	updates, err := r.waitForX509CertificateUpdates(ctx, request.Params.Subscriptions, cursor, wait)
+	if errors.Is(err, service.ErrInvalidUpdatesCursor) {
+		message := "invalid updates cursor"
+		r.l(ctx).Debug(message, zap.Error(err))
+		return GetX509CertificateUpdatesV1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		r.l(ctx).Debug(message)
+		return GetX509CertificateUpdatesV1503JSONResponse{
+			Code:    ptr(http.StatusServiceUnavailable),
+			Message: &message,
+		}, nil
+	}
+	if err != nil {
+		message := "could not load certificate updates"
+		r.l(ctx).Error(message, zap.Error(err))
+		return GetX509CertificateUpdatesV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return GetX509CertificateUpdatesV1200JSONResponse(dtoToX509CertificateUpdates(updates)), nil
+}
+
+// MaxUpdatesWait is the longest wait of long polls for updates the API spec allows.
+const MaxUpdatesWait = 60 * time.Second
+
+// updatesWait returns the requested wait of a long poll for updates, clamped to MaxUpdatesWait, as the write timeout
+// of the server only covers waits up to it.
+func updatesWait(waitSeconds *int) time.Duration {
+	switch {
+	case waitSeconds == nil || *waitSeconds <= 0:
+		return 0
+	case *waitSeconds >= int(MaxUpdatesWait/time.Second):
+		return MaxUpdatesWait
+	}
+	return time.Duration(*waitSeconds) * time.Second
+}
+
+// waitForX509CertificateUpdates returns the updates since the cursor. If none of the subscriptions has certificates,
+// it waits until an import notifies about changes which update one of them, or returns the empty updates once wait
+// elapsed, the client disconnected or the server shuts down.
+func (r *RestHandlerImpl) waitForX509CertificateUpdates(
+	ctx context.Context, subIDs []uuid.UUID, cursor string, wait time.Duration,
+) (*service.X509CertificateUpdatesDto, error) {
+	// The hub is subscribed before loading the updates, so no notifications are missed in between
+	subscription := r.updatesHub.Subscribe()
+	defer subscription.Close()
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+
+	for {
+		certUpdates, err := r.x509CertificateService.GetUpdates(ctx, subIDs, cursor, true)
+		if err != nil || wait <= 0 {
+			return certUpdates, err
+		}
+		for _, subUpdate := range certUpdates.Subscriptions {
+			if len(subUpdate.CertificateIDs) != 0 {
+				return certUpdates, nil
+			}
+		}
+		// Nothing changed up to the next cursor, so only later changes have to be loaded after a notification
+		cursor = certUpdates.NextCursor
+
+		select {
+		case <-ctx.Done():
+			return certUpdates, nil
+		case <-deadline.C:
+			return certUpdates, nil
+		case <-subscription.Done():
+			return certUpdates, nil
+		case <-subscription.Ready():
+			subscription.Take()
+		}
+	}
+}
+
+// clearReadDeadline lifts the read timeout of the server for a request without body which is held open. net/http
+// cancels the context of a request once its read deadline expires, even if the request was read completely.
+func clearReadDeadline(w http.ResponseWriter) error {
+	err := http.NewResponseController(w).SetReadDeadline(time.Time{})
+	if errors.Is(err, http.ErrNotSupported) {
+		return nil
+	}
+	return err
+}
+
+// authorizeUpdateSubscriptions returns the subscriptions if all of them exist and are allowed for the principal.
+// Otherwise, it returns the status code and body of the error response.
+func (r *RestHandlerImpl) authorizeUpdateSubscriptions(
+	ctx context.Context, subIDs []uuid.UUID,
+) (subscriptions []*service.X509CertificateSubscriptionDto, statusCode int, errBody *Error) {
+	notExistingIDs, err := r.x509CertificateSubscriptionService.Exists(ctx, subIDs)
 	if err != nil {
 		message := "could not load certificate updates"
 		r.l(ctx).Debug(message)
-		return GetX509CertificateUpdatesV1400JSONResponse{
+		return nil, http.StatusBadRequest, &Error{
 			Code:          ptr(http.StatusBadRequest),
 			Message:       &message,
 			DetailMessage: ptr("unable to check if all certificate subscriptions exist"),
-		}, nil
+		}
 	}
 	if len(notExistingIDs) != 0 {
 		message := "one or more certificate subscriptions don't exist"
@@ -39,39 +236,47 @@ func (r *RestHandlerImpl) GetX509CertificateUpdatesV1(ctx context.Context, reque
 		for _, id := range notExistingIDs {
 			notExistingIDStrings = append(notExistingIDStrings, id.String())
 		}
-		return GetX509CertificateUpdatesV1400JSONResponse{
+		return nil, http.StatusBadRequest, &Error{
 			Code:          ptr(http.StatusBadRequest),
 			Message:       &message,
 			DetailMessage: ptr("missing certificate subscriptions: " + strings.Join(notExistingIDStrings, ", ")),
-		}, nil
+		}
 	}
 
-	certDtos, privKeyDtos, err := r.x509CertificateService.GetUpdates(ctx, request.Params.Subscriptions, request.Params.After, true)
+	subscriptions, err = r.x509CertificateSubscriptionService.FindByIDs(ctx, subIDs)
 	if err != nil {
 		message := "could not load certificate updates"
 		r.l(ctx).Error(message, zap.Error(err))
-		return GetX509CertificateUpdatesV1defaultJSONResponse{
-			Body: Error{
-				Code:    ptr(http.StatusInternalServerError),
-				Message: &message,
-			},
-			StatusCode: http.StatusInternalServerError,
-		}, nil
+		return nil, http.StatusInternalServerError, &Error{
+			Code:    ptr(http.StatusInternalServerError),
+			Message: &message,
+		}
 	}
-
-	certs := make([]X509Certificate, len(certDtos))
-	for i, cert := range certDtos {
-		certs[i] = dtoToX509Certificate(cert)
+	// The scope is required upfront, so private keys aren't loaded and decrypted for principals which may not read them
+	for _, subscription := range subscriptions {
+		if subscription.IncludePrivateKey && !r.principal(ctx).HasScope(service.APITokenScopeKeysRead) {
+			message := "principal lacks scope keys:read"
+			r.l(ctx).Info(message, zap.String("subscription-id", subscription.ID.String()))
+			return nil, http.StatusForbidden, &Error{
+				Code:          ptr(http.StatusForbidden),
+				Message:       &message,
+				DetailMessage: ptr("private keys of subscriptions including private keys require scope keys:read"),
+			}
+		}
 	}
-	privKeys := make([]X509PrivateKey, len(privKeyDtos))
-	for i, privKey := range privKeyDtos {
-		privKeys[i] = dtoToX509PrivateKey(privKey)
+	for _, subscription := range subscriptions {
+		err := r.policyService.AuthorizeSubscription(r.principal(ctx), subscription.SANs, subscription.IncludePrivateKey)
+		if err != nil {
+			message := "access to certificate subscription denied"
+			r.l(ctx).Info(message, zap.String("subscription-id", subscription.ID.String()), zap.Error(err))
+			return nil, http.StatusForbidden, &Error{
+				Code:          ptr(http.StatusForbidden),
+				Message:       &message,
+				DetailMessage: ptr(fmt.Sprintf("subscription %s: %s", subscription.ID, err)),
+			}
+		}
 	}
-
-	return GetX509CertificateUpdatesV1200JSONResponse{
-		Certificates: &certs,
-		PrivateKeys:  &privKeys,
-	}, nil
+	return subscriptions, 0, nil
 }
 
 func (r *RestHandlerImpl) BulkImportX509V1(
@@ -89,6 +294,21 @@ func (r *RestHandlerImpl) BulkImportX509V1(
 					Message: &message,
 				}, nil
 			}
+			if certificate != nil && certificate.Type == "PKCS7" {
+				// Unpack the certificates of .p7b chains as handed out by many CAs
+				p7bCertPems, err := service.ParsePKCS7(certificate.Bytes)
+				if err != nil {
+					message := "could not decode PKCS#7 certificates"
+					r.l(ctx).Debug(message, zap.Error(err))
+					return BulkImportX509V1400JSONResponse{
+						Code:          ptr(http.StatusBadRequest),
+						Message:       &message,
+						DetailMessage: ptr(err.Error()),
+					}, nil
+				}
+				certPems = append(certPems, p7bCertPems...)
+				continue
+			}
 			certPems = append(certPems, certificate)
 		}
 	}
@@ -105,11 +325,23 @@ func (r *RestHandlerImpl) BulkImportX509V1(
 					Message: &message,
 				}, nil
 			}
+			privateKey, errBody := r.decryptPrivateKeyPem(ctx, privateKey, request.Body.Passphrase)
+			if errBody != nil {
+				return BulkImportX509V1400JSONResponse(*errBody), nil
+			}
 			privKeyPems = append(privKeyPems, privateKey)
 		}
 	}
 
 	createdCerts, createdPrivKeys, err := r.x509ImportService.Import(ctx, certPems, privKeyPems)
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		r.l(ctx).Debug(message)
+		return BulkImportX509V1503JSONResponse{
+			Code:    ptr(http.StatusServiceUnavailable),
+			Message: &message,
+		}, nil
+	}
 	if err != nil {
 		message := "could not create certificates and private keys"
 		r.l(ctx).Error(message, zap.Error(err))
@@ -137,6 +369,28 @@ func (r *RestHandlerImpl) BulkImportX509V1(
 	}, nil
 }
 
+// decryptPrivateKeyPem decrypts the private key with the passphrase of the import if it's encrypted. If it can't, it
+// returns the body of the bad request response.
+func (r *RestHandlerImpl) decryptPrivateKeyPem(
+	ctx context.Context, privKeyPem *pem.Block, passphrase *string,
+) (*pem.Block, *Error) {
+	var decryptPassphrase string
+	if passphrase != nil {
+		decryptPassphrase = *passphrase
+	}
+	decryptedPrivKeyPem, err := service.DecryptPrivateKeyPem(privKeyPem, decryptPassphrase)
+	if err != nil {
+		message := "could not decrypt private key"
+		r.l(ctx).Debug(message, zap.Error(err))
+		return nil, &Error{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}
+	}
+	return decryptedPrivKeyPem, nil
+}
+
 func (r *RestHandlerImpl) ImportX509BundleV1(
 	ctx context.Context, request ImportX509BundleV1RequestObject,
 ) (ImportX509BundleV1ResponseObject, error) {
@@ -150,9 +404,9 @@ func (r *RestHandlerImpl) ImportX509BundleV1(
 		}, nil
 	}
 
-	var privateKeyPemBlock *pem.Block
+	var privateKeyPemBlocks []*pem.Block
 	if request.Body.PrivateKey != nil {
-		privateKeyPemBlock, rest = pem.Decode([]byte(*request.Body.PrivateKey))
+		privateKeyPemBlock, rest := pem.Decode([]byte(*request.Body.PrivateKey))
 		if len(rest) != 0 {
 			message := "private key pem has invalid extra data"
 			r.l(ctx).Debug(message)
@@ -161,6 +415,11 @@ func (r *RestHandlerImpl) ImportX509BundleV1(
 				Message: &message,
 			}, nil
 		}
+		privateKeyPemBlock, errBody := r.decryptPrivateKeyPem(ctx, privateKeyPemBlock, request.Body.Passphrase)
+		if errBody != nil {
+			return ImportX509BundleV1400JSONResponse(*errBody), nil
+		}
+		privateKeyPemBlocks = append(privateKeyPemBlocks, privateKeyPemBlock)
 	}
 
 	// Add chain certificates
@@ -175,7 +434,15 @@ func (r *RestHandlerImpl) ImportX509BundleV1(
 		}, nil
 	}
 
-	createdCerts, createdPrivKeys, err := r.x509ImportService.Import(ctx, append([]*pem.Block{certPemBlock}, chainPemBlocks...), []*pem.Block{privateKeyPemBlock})
+	createdCerts, createdPrivKeys, err := r.x509ImportService.Import(ctx, append([]*pem.Block{certPemBlock}, chainPemBlocks...), privateKeyPemBlocks)
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		r.l(ctx).Debug(message)
+		return ImportX509BundleV1503JSONResponse{
+			Code:    ptr(http.StatusServiceUnavailable),
+			Message: &message,
+		}, nil
+	}
 	if err != nil {
 		message := "could not create certificates and private keys"
 		r.l(ctx).Error(message, zap.Error(err))
@@ -203,17 +470,31 @@ func (r *RestHandlerImpl) ImportX509BundleV1(
 	}, nil
 }
 
-func (r *RestHandlerImpl) CreateX509CertificateSubscriptionV1(
-	ctx context.Context, request CreateX509CertificateSubscriptionV1RequestObject,
-) (CreateX509CertificateSubscriptionV1ResponseObject, error) {
-	createRequest := service.NewCreateX509CertificateSubscriptionDto(
-		request.Body.SubjectAltNames,
-		request.Body.IncludePrivateKey)
-	createdSubscription, err := r.x509CertificateSubscriptionService.Create(ctx, createRequest)
+func (r *RestHandlerImpl) ImportX509PKCS12V1(
+	ctx context.Context, request ImportX509PKCS12V1RequestObject,
+) (ImportX509PKCS12V1ResponseObject, error) {
+	createdCerts, createdPrivKeys, err := r.x509ImportService.ImportPKCS12(ctx, request.Body.Pfx, request.Body.Password)
+	if errors.Is(err, service.ErrInvalidPKCS12) {
+		message := "could not decode PKCS#12 file"
+		r.l(ctx).Debug(message, zap.Error(err))
+		return ImportX509PKCS12V1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr("the file is malformed, the password is wrong or it lacks a certificate or private key"),
+		}, nil
+	}
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		r.l(ctx).Debug(message)
+		return ImportX509PKCS12V1503JSONResponse{
+			Code:    ptr(http.StatusServiceUnavailable),
+			Message: &message,
+		}, nil
+	}
 	if err != nil {
-		message := "could not create subscription"
+		message := "could not create certificates and private keys"
 		r.l(ctx).Error(message, zap.Error(err))
-		return CreateX509CertificateSubscriptionV1defaultJSONResponse{
+		return ImportX509PKCS12V1defaultJSONResponse{
 			Body: Error{
 				Code:    ptr(http.StatusInternalServerError),
 				Message: &message,
@@ -221,17 +502,39 @@ func (r *RestHandlerImpl) CreateX509CertificateSubscriptionV1(
 			StatusCode: http.StatusInternalServerError,
 		}, nil
 	}
-	return CreateX509CertificateSubscriptionV1200JSONResponse(dtoToX509CertificateSubscription(createdSubscription)), nil
+
+	certs := make([]X509Certificate, len(createdCerts))
+	for i, cert := range createdCerts {
+		certs[i] = dtoToX509Certificate(cert)
+	}
+	privKeys := make([]X509PrivateKey, len(createdPrivKeys))
+	for i, privKey := range createdPrivKeys {
+		privKeys[i] = dtoToX509PrivateKey(privKey)
+	}
+
+	return ImportX509PKCS12V1201JSONResponse{
+		Certificates: &certs,
+		PrivateKeys:  &privKeys,
+	}, nil
 }
 
-func (r *RestHandlerImpl) DeleteX509CertificateSubscriptionV1(
-	ctx context.Context, request DeleteX509CertificateSubscriptionV1RequestObject,
-) (DeleteX509CertificateSubscriptionV1ResponseObject, error) {
-	rowsDeleted, err := r.x509CertificateSubscriptionService.Delete(ctx, request.Id)
+func (r *RestHandlerImpl) ImportX509PKCS7V1(
+	ctx context.Context, request ImportX509PKCS7V1RequestObject,
+) (ImportX509PKCS7V1ResponseObject, error) {
+	createdCerts, err := r.x509ImportService.ImportPKCS7(ctx, request.Body.P7b)
+	if errors.Is(err, service.ErrInvalidPKCS7) {
+		message := "could not decode PKCS#7 file"
+		r.l(ctx).Debug(message, zap.Error(err))
+		return ImportX509PKCS7V1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
 	if err != nil {
-		message := "could not delete subscription"
+		message := "could not create certificates"
 		r.l(ctx).Error(message, zap.Error(err))
-		return DeleteX509CertificateSubscriptionV1defaultJSONResponse{
+		return ImportX509PKCS7V1defaultJSONResponse{
 			Body: Error{
 				Code:    ptr(http.StatusInternalServerError),
 				Message: &message,
@@ -239,66 +542,999 @@ func (r *RestHandlerImpl) DeleteX509CertificateSubscriptionV1(
 			StatusCode: http.StatusInternalServerError,
 		}, nil
 	}
-	if rowsDeleted < 1 {
-		return DeleteX509CertificateSubscriptionV1404JSONResponse{
-			Code:    ptr(http.StatusNotFound),
-			Message: ptr("subscription does not exist"),
-		}, nil
-	}
-	return DeleteX509CertificateSubscriptionV1204Response{}, nil
-}
 
-func dtoToX509PrivateKey(privKeyDto *service.X509PrivateKeyDto) X509PrivateKey {
-	return X509PrivateKey{
-		Id:  privKeyDto.ID,
-		Key: privKeyDto.PemPrivateKey,
+	certs := make([]X509Certificate, len(createdCerts))
+	for i, cert := range createdCerts {
+		certs[i] = dtoToX509Certificate(cert)
 	}
-}
 
-func dtoToX509Certificate(certDto *service.X509CertificateDto) X509Certificate {
-	return X509Certificate{
-		Certificate:         certDto.CertificatePem,
-		CommonName:          ptr(certDto.CommonName),
-		CreatedAt:           certDto.CreatedAt,
-		Id:                  certDto.ID,
-		NotAfter:            certDto.NotAfter,
-		NotBefore:           certDto.NotBefore,
-		ParentCertificateId: certDto.ParentCertificateID,
-		PrivateKeyId:        certDto.PrivateKeyID,
-		Sans:                certDto.SubjectAltNames,
-	}
+	return ImportX509PKCS7V1201JSONResponse{
+		Certificates: &certs,
+	}, nil
 }
 
-func dtoToX509CertificateSubscription(dto *service.X509CertificateSubscriptionDto) X509CertificateSubscription {
-	return X509CertificateSubscription{
-		CreatedAt:         dto.CreatedAt,
-		Id:                dto.ID,
-		IncludePrivateKey: dto.IncludePrivateKey,
-		SubjectAltNames:   dto.SANs,
+func (r *RestHandlerImpl) ImportX509FilesV1(
+	ctx context.Context, request ImportX509FilesV1RequestObject,
+) (ImportX509FilesV1ResponseObject, error) {
+	var files []*service.X509ImportFileDto
+	var password, passphrase string
+	for {
+		part, err := request.Body.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var data []byte
+		if err == nil {
+			// The size of the body is limited by the BodyLimitMiddleware
+			data, err = io.ReadAll(part)
+		}
+		if err != nil {
+			message := "could not read multipart body"
+			r.l(ctx).Debug(message, zap.Error(err))
+			return ImportX509FilesV1400JSONResponse{
+				Code:          ptr(http.StatusBadRequest),
+				Message:       &message,
+				DetailMessage: ptr(err.Error()),
+			}, nil
+		}
+		switch part.FormName() {
+		case "files":
+			files = append(files, &service.X509ImportFileDto{Name: part.FileName(), Data: data})
+		case "password":
+			password = string(data)
+		case "passphrase":
+			passphrase = string(data)
+		}
 	}
-}
 
-func separatePemBlocks(pemBlocks []byte) (blocks []*pem.Block, rest []byte) {
-	return separatePemBlocksRecursively(pemBlocks, nil)
-}
+	createdCerts, createdPrivKeys, reports, err := r.x509ImportService.ImportFiles(ctx, files, password, passphrase)
+	if errors.Is(err, service.ErrInvalidImportFile) {
+		message := "files exceed the import limits"
+		r.l(ctx).Debug(message, zap.Error(err))
+		return ImportX509FilesV1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		r.l(ctx).Debug(message)
+		return ImportX509FilesV1503JSONResponse{
+			Code:    ptr(http.StatusServiceUnavailable),
+			Message: &message,
+		}, nil
+	}
+	if err != nil {
+		message := "could not create certificates and private keys"
+		r.l(ctx).Error(message, zap.Error(err))
+		return ImportX509FilesV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
 
-func separatePemBlocksRecursively(pemBlocks []byte, foundPemBlocks []*pem.Block) (blocks []*pem.Block, rest []byte) {
-	pemBlock, rest := pem.Decode(pemBlocks)
-	if pemBlock == nil {
-		return foundPemBlocks, rest
+	certs := make([]X509Certificate, len(createdCerts))
+	for i, cert := range createdCerts {
+		certs[i] = dtoToX509Certificate(cert)
+	}
+	privKeys := make([]X509PrivateKey, len(createdPrivKeys))
+	for i, privKey := range createdPrivKeys {
+		privKeys[i] = dtoToX509PrivateKey(privKey)
+	}
+	fileReports := make([]X509ImportFileReport, len(reports))
+	for i, report := range reports {
+		fileReports[i] = dtoToX509ImportFileReport(report)
 	}
 
-	return separatePemBlocksRecursively(rest, append(foundPemBlocks, pemBlock))
+	return ImportX509FilesV1201JSONResponse{
+		Certificates: certs,
+		PrivateKeys:  privKeys,
+		Files:        fileReports,
+	}, nil
 }
 
-func (r *RestHandlerImpl) l(ctx context.Context) *zap.Logger {
-	logger := ctx.Value(GinCtxLoggerKey)
-	if logger == nil {
-		panic("")
+func (r *RestHandlerImpl) GetX509CertificateV1(
+	ctx context.Context, request GetX509CertificateV1RequestObject,
+) (GetX509CertificateV1ResponseObject, error) {
+	includeChain := request.Params.IncludeChain != nil && *request.Params.IncludeChain
+	includePrivateKey := request.Params.IncludePrivateKey != nil && *request.Params.IncludePrivateKey
+	if includePrivateKey && !r.principal(ctx).HasScope(service.APITokenScopeKeysRead) {
+		message := "principal lacks scope keys:read"
+		r.l(ctx).Info(message)
+		return GetX509CertificateV1403JSONResponse{
+			Code:          ptr(http.StatusForbidden),
+			Message:       &message,
+			DetailMessage: ptr("including the private key requires scope keys:read"),
+		}, nil
 	}
-	return logger.(*zap.Logger)
-}
 
-func ptr[T any](input T) *T {
-	return &input
+	details, exists, err := r.x509CertificateService.FindByID(
+		ctx, r.principal(ctx), request.Id, includeChain, includePrivateKey,
+	)
+	if errors.Is(err, service.ErrAccessDenied) {
+		// Answered like a missing certificate, so principals can't probe which certificate IDs exist
+		r.l(ctx).Info("access to certificate denied", zap.String("certificate-id", request.Id.String()), zap.Error(err))
+		message := "certificate does not exist"
+		return GetX509CertificateV1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: &message,
+		}, nil
+	}
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		r.l(ctx).Debug(message)
+		return GetX509CertificateV1503JSONResponse{
+			Code:    ptr(http.StatusServiceUnavailable),
+			Message: &message,
+		}, nil
+	}
+	if err != nil {
+		message := "could not load certificate"
+		r.l(ctx).Error(message, zap.Error(err))
+		return GetX509CertificateV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if !exists {
+		message := "certificate does not exist"
+		return GetX509CertificateV1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: &message,
+		}, nil
+	}
+
+	response := GetX509CertificateV1200JSONResponse{Certificate: dtoToX509Certificate(details.Certificate)}
+	if details.Chain != nil {
+		chain := make([]X509Certificate, len(details.Chain))
+		for i, chainCert := range details.Chain {
+			chain[i] = dtoToX509Certificate(chainCert)
+		}
+		response.Chain = &chain
+	}
+	if details.PrivateKey != nil {
+		response.PrivateKey = ptr(dtoToX509PrivateKey(details.PrivateKey))
+	}
+	return response, nil
+}
+
+func (r *RestHandlerImpl) ExportX509PKCS12V1(
+	ctx context.Context, request ExportX509PKCS12V1RequestObject,
+) (ExportX509PKCS12V1ResponseObject, error) {
+	algorithm := service.PKCS12AlgorithmAES256
+	if request.Params.Algorithm != nil {
+		algorithm = service.PKCS12Algorithm(*request.Params.Algorithm)
+	}
+	var friendlyName string
+	if request.Params.FriendlyName != nil {
+		friendlyName = *request.Params.FriendlyName
+	}
+
+	details, exists, err := r.x509CertificateService.FindByID(ctx, r.principal(ctx), request.Id, true, true)
+	if errors.Is(err, service.ErrAccessDenied) {
+		// Answered like a missing certificate, so principals can't probe which certificate IDs exist
+		r.l(ctx).Info("access to certificate denied", zap.String("certificate-id", request.Id.String()), zap.Error(err))
+		message := "certificate does not exist"
+		return ExportX509PKCS12V1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: &message,
+		}, nil
+	}
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		r.l(ctx).Debug(message)
+		return ExportX509PKCS12V1503JSONResponse{
+			Code:    ptr(http.StatusServiceUnavailable),
+			Message: &message,
+		}, nil
+	}
+	if err != nil {
+		message := "could not load certificate"
+		r.l(ctx).Error(message, zap.Error(err))
+		return ExportX509PKCS12V1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if !exists {
+		message := "certificate does not exist"
+		return ExportX509PKCS12V1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: &message,
+		}, nil
+	}
+
+	pfxData, err := service.EncodePKCS12(details, request.Params.XPKCS12Password, algorithm, friendlyName)
+	if errors.Is(err, service.ErrNoPrivateKey) {
+		message := "certificate has no private key"
+		return ExportX509PKCS12V1409JSONResponse{
+			Code:    ptr(http.StatusConflict),
+			Message: &message,
+		}, nil
+	}
+	if err != nil {
+		message := "could not encode PKCS#12 file"
+		r.l(ctx).Error(message, zap.Error(err))
+		return ExportX509PKCS12V1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return ExportX509PKCS12V1200ApplicationxPkcs12Response{
+		Body:          bytes.NewReader(pfxData),
+		ContentLength: int64(len(pfxData)),
+	}, nil
+}
+
+func (r *RestHandlerImpl) ExportX509PKCS7V1(
+	ctx context.Context, request ExportX509PKCS7V1RequestObject,
+) (ExportX509PKCS7V1ResponseObject, error) {
+	details, exists, err := r.x509CertificateService.FindByID(ctx, r.principal(ctx), request.Id, true, false)
+	if errors.Is(err, service.ErrAccessDenied) {
+		// Answered like a missing certificate, so principals can't probe which certificate IDs exist
+		r.l(ctx).Info("access to certificate denied", zap.String("certificate-id", request.Id.String()), zap.Error(err))
+		message := "certificate does not exist"
+		return ExportX509PKCS7V1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: &message,
+		}, nil
+	}
+	if err != nil {
+		message := "could not load certificate"
+		r.l(ctx).Error(message, zap.Error(err))
+		return ExportX509PKCS7V1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if !exists {
+		message := "certificate does not exist"
+		return ExportX509PKCS7V1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: &message,
+		}, nil
+	}
+
+	p7bData, err := service.EncodePKCS7(details)
+	if err != nil {
+		message := "could not encode PKCS#7 file"
+		r.l(ctx).Error(message, zap.Error(err))
+		return ExportX509PKCS7V1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	return ExportX509PKCS7V1200ApplicationxPkcs7CertificatesResponse{
+		Body:          bytes.NewReader(p7bData),
+		ContentLength: int64(len(p7bData)),
+	}, nil
+}
+
+func (r *RestHandlerImpl) ListX509CertificateSubscriptionsV1(
+	ctx context.Context, request ListX509CertificateSubscriptionsV1RequestObject,
+) (ListX509CertificateSubscriptionsV1ResponseObject, error) {
+	var cursor string
+	if request.Params.Cursor != nil {
+		cursor = *request.Params.Cursor
+	}
+	var limit int
+	if request.Params.Limit != nil {
+		limit = *request.Params.Limit
+	}
+
+	page, err := r.x509CertificateSubscriptionService.List(ctx, r.principal(ctx), cursor, limit)
+	if errors.Is(err, service.ErrInvalidSubscriptionListing) {
+		message := "invalid subscription listing"
+		return ListX509CertificateSubscriptionsV1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if err != nil {
+		message := "could not list subscriptions"
+		r.l(ctx).Error(message, zap.Error(err))
+		return ListX509CertificateSubscriptionsV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	subscriptions := make([]X509CertificateSubscription, len(page.Subscriptions))
+	for i, subscription := range page.Subscriptions {
+		subscriptions[i] = dtoToX509CertificateSubscription(subscription)
+	}
+
+	response := ListX509CertificateSubscriptionsV1200JSONResponse{Subscriptions: subscriptions}
+	if page.NextCursor != "" {
+		response.NextCursor = &page.NextCursor
+	}
+	return response, nil
+}
+
+func (r *RestHandlerImpl) CreateX509CertificateSubscriptionV1(
+	ctx context.Context, request CreateX509CertificateSubscriptionV1RequestObject,
+) (CreateX509CertificateSubscriptionV1ResponseObject, error) {
+	createRequest := service.NewCreateX509CertificateSubscriptionDto(
+		request.Body.SubjectAltNames,
+		request.Body.IncludePrivateKey)
+	createdSubscription, err := r.x509CertificateSubscriptionService.Create(ctx, r.principal(ctx), createRequest)
+	if errors.Is(err, service.ErrAccessDenied) {
+		message := "subscription denied by policy"
+		r.l(ctx).Info(message, zap.Error(err))
+		return CreateX509CertificateSubscriptionV1403JSONResponse{
+			Code:          ptr(http.StatusForbidden),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if err != nil {
+		message := "could not create subscription"
+		r.l(ctx).Error(message, zap.Error(err))
+		return CreateX509CertificateSubscriptionV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	return CreateX509CertificateSubscriptionV1200JSONResponse(dtoToX509CertificateSubscription(createdSubscription)), nil
+}
+
+func (r *RestHandlerImpl) GetX509CertificateSubscriptionV1(
+	ctx context.Context, request GetX509CertificateSubscriptionV1RequestObject,
+) (GetX509CertificateSubscriptionV1ResponseObject, error) {
+	subscription, exists, err := r.x509CertificateSubscriptionService.FindByID(ctx, request.Id)
+	if err != nil {
+		message := "could not load subscription"
+		r.l(ctx).Error(message, zap.Error(err))
+		return GetX509CertificateSubscriptionV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if !exists {
+		return GetX509CertificateSubscriptionV1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: ptr("subscription does not exist"),
+		}, nil
+	}
+
+	err = r.policyService.AuthorizeSubscription(r.principal(ctx), subscription.SANs, subscription.IncludePrivateKey)
+	if err != nil {
+		message := "access to certificate subscription denied"
+		r.l(ctx).Info(message, zap.String("subscription-id", request.Id.String()), zap.Error(err))
+		return GetX509CertificateSubscriptionV1403JSONResponse{
+			Code:          ptr(http.StatusForbidden),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	return GetX509CertificateSubscriptionV1200JSONResponse(dtoToX509CertificateSubscription(subscription)), nil
+}
+
+func (r *RestHandlerImpl) UpdateX509CertificateSubscriptionV1(
+	ctx context.Context, request UpdateX509CertificateSubscriptionV1RequestObject,
+) (UpdateX509CertificateSubscriptionV1ResponseObject, error) {
+	updateRequest := service.NewUpdateX509CertificateSubscriptionDto(nil, nil)
+	if request.Body != nil {
+		if request.Body.SubjectAltNames != nil {
+			updateRequest.SubjectAltNames = *request.Body.SubjectAltNames
+		}
+		updateRequest.IncludePrivateKey = request.Body.IncludePrivateKey
+	}
+
+	updatedSubscription, exists, err := r.x509CertificateSubscriptionService.Update(
+		ctx, r.principal(ctx), request.Id, updateRequest,
+	)
+	if errors.Is(err, service.ErrAccessDenied) {
+		message := "subscription denied by policy"
+		r.l(ctx).Info(message, zap.String("subscription-id", request.Id.String()), zap.Error(err))
+		return UpdateX509CertificateSubscriptionV1403JSONResponse{
+			Code:          ptr(http.StatusForbidden),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if err != nil {
+		message := "could not update subscription"
+		r.l(ctx).Error(message, zap.Error(err))
+		return UpdateX509CertificateSubscriptionV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if !exists {
+		return UpdateX509CertificateSubscriptionV1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: ptr("subscription does not exist"),
+		}, nil
+	}
+	return UpdateX509CertificateSubscriptionV1200JSONResponse(dtoToX509CertificateSubscription(updatedSubscription)), nil
+}
+
+func (r *RestHandlerImpl) DeleteX509CertificateSubscriptionV1(
+	ctx context.Context, request DeleteX509CertificateSubscriptionV1RequestObject,
+) (DeleteX509CertificateSubscriptionV1ResponseObject, error) {
+	rowsDeleted, err := r.x509CertificateSubscriptionService.Delete(ctx, r.principal(ctx), request.Id)
+	if errors.Is(err, service.ErrAccessDenied) {
+		message := "access to certificate subscription denied"
+		r.l(ctx).Info(message, zap.String("subscription-id", request.Id.String()), zap.Error(err))
+		return DeleteX509CertificateSubscriptionV1403JSONResponse{
+			Code:          ptr(http.StatusForbidden),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if err != nil {
+		message := "could not delete subscription"
+		r.l(ctx).Error(message, zap.Error(err))
+		return DeleteX509CertificateSubscriptionV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if rowsDeleted < 1 {
+		return DeleteX509CertificateSubscriptionV1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: ptr("subscription does not exist"),
+		}, nil
+	}
+	return DeleteX509CertificateSubscriptionV1204Response{}, nil
+}
+
+func (r *RestHandlerImpl) GetX509CertificateSubscriptionWebhookV1(
+	ctx context.Context, request GetX509CertificateSubscriptionWebhookV1RequestObject,
+) (GetX509CertificateSubscriptionWebhookV1ResponseObject, error) {
+	webhook, exists, err := r.webhookService.Find(ctx, r.principal(ctx), request.Id)
+	if errors.Is(err, service.ErrAccessDenied) {
+		message := "access to certificate subscription denied"
+		r.l(ctx).Info(message, zap.String("subscription-id", request.Id.String()), zap.Error(err))
+		return GetX509CertificateSubscriptionWebhookV1403JSONResponse{
+			Code:          ptr(http.StatusForbidden),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		r.l(ctx).Debug(message)
+		return GetX509CertificateSubscriptionWebhookV1503JSONResponse{
+			Code:    ptr(http.StatusServiceUnavailable),
+			Message: &message,
+		}, nil
+	}
+	if err != nil {
+		message := "could not load webhook"
+		r.l(ctx).Error(message, zap.Error(err))
+		return GetX509CertificateSubscriptionWebhookV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if !exists {
+		return GetX509CertificateSubscriptionWebhookV1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: ptr("subscription or webhook does not exist"),
+		}, nil
+	}
+	return GetX509CertificateSubscriptionWebhookV1200JSONResponse(dtoToWebhook(webhook)), nil
+}
+
+func (r *RestHandlerImpl) SetX509CertificateSubscriptionWebhookV1(
+	ctx context.Context, request SetX509CertificateSubscriptionWebhookV1RequestObject,
+) (SetX509CertificateSubscriptionWebhookV1ResponseObject, error) {
+	webhook, exists, err := r.webhookService.Save(
+		ctx, r.principal(ctx), request.Id, request.Body.Url, request.Body.Secret,
+	)
+	if errors.Is(err, service.ErrInvalidWebhook) {
+		message := "invalid webhook"
+		return SetX509CertificateSubscriptionWebhookV1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if errors.Is(err, service.ErrAccessDenied) {
+		message := "access to certificate subscription denied"
+		r.l(ctx).Info(message, zap.String("subscription-id", request.Id.String()), zap.Error(err))
+		return SetX509CertificateSubscriptionWebhookV1403JSONResponse{
+			Code:          ptr(http.StatusForbidden),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		r.l(ctx).Debug(message)
+		return SetX509CertificateSubscriptionWebhookV1503JSONResponse{
+			Code:    ptr(http.StatusServiceUnavailable),
+			Message: &message,
+		}, nil
+	}
+	if err != nil {
+		message := "could not set webhook"
+		r.l(ctx).Error(message, zap.Error(err))
+		return SetX509CertificateSubscriptionWebhookV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if !exists {
+		return SetX509CertificateSubscriptionWebhookV1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: ptr("subscription does not exist"),
+		}, nil
+	}
+
+	r.l(ctx).Info("set webhook", zap.String("subscription-id", request.Id.String()))
+	return SetX509CertificateSubscriptionWebhookV1200JSONResponse(dtoToWebhook(webhook)), nil
+}
+
+func (r *RestHandlerImpl) DeleteX509CertificateSubscriptionWebhookV1(
+	ctx context.Context, request DeleteX509CertificateSubscriptionWebhookV1RequestObject,
+) (DeleteX509CertificateSubscriptionWebhookV1ResponseObject, error) {
+	rowsDeleted, err := r.webhookService.Delete(ctx, r.principal(ctx), request.Id)
+	if errors.Is(err, service.ErrAccessDenied) {
+		message := "access to certificate subscription denied"
+		r.l(ctx).Info(message, zap.String("subscription-id", request.Id.String()), zap.Error(err))
+		return DeleteX509CertificateSubscriptionWebhookV1403JSONResponse{
+			Code:          ptr(http.StatusForbidden),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if err != nil {
+		message := "could not delete webhook"
+		r.l(ctx).Error(message, zap.Error(err))
+		return DeleteX509CertificateSubscriptionWebhookV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if rowsDeleted < 1 {
+		return DeleteX509CertificateSubscriptionWebhookV1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: ptr("subscription or webhook does not exist"),
+		}, nil
+	}
+	return DeleteX509CertificateSubscriptionWebhookV1204Response{}, nil
+}
+
+func (r *RestHandlerImpl) ListX509CertificateSubscriptionWebhookDeliveriesV1(
+	ctx context.Context, request ListX509CertificateSubscriptionWebhookDeliveriesV1RequestObject,
+) (ListX509CertificateSubscriptionWebhookDeliveriesV1ResponseObject, error) {
+	var cursor string
+	if request.Params.Cursor != nil {
+		cursor = *request.Params.Cursor
+	}
+	var limit int
+	if request.Params.Limit != nil {
+		limit = *request.Params.Limit
+	}
+
+	page, exists, err := r.webhookService.ListDeliveries(ctx, r.principal(ctx), request.Id, cursor, limit)
+	if errors.Is(err, service.ErrInvalidWebhookDeliveryListing) {
+		message := "invalid webhook delivery listing"
+		return ListX509CertificateSubscriptionWebhookDeliveriesV1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if errors.Is(err, service.ErrAccessDenied) {
+		message := "access to certificate subscription denied"
+		r.l(ctx).Info(message, zap.String("subscription-id", request.Id.String()), zap.Error(err))
+		return ListX509CertificateSubscriptionWebhookDeliveriesV1403JSONResponse{
+			Code:          ptr(http.StatusForbidden),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if err != nil {
+		message := "could not list webhook deliveries"
+		r.l(ctx).Error(message, zap.Error(err))
+		return ListX509CertificateSubscriptionWebhookDeliveriesV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if !exists {
+		return ListX509CertificateSubscriptionWebhookDeliveriesV1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: ptr("subscription does not exist"),
+		}, nil
+	}
+
+	deliveries := make([]WebhookDelivery, len(page.Deliveries))
+	for i, delivery := range page.Deliveries {
+		deliveries[i] = dtoToWebhookDelivery(delivery)
+	}
+	response := ListX509CertificateSubscriptionWebhookDeliveriesV1200JSONResponse{Deliveries: deliveries}
+	if page.NextCursor != "" {
+		response.NextCursor = &page.NextCursor
+	}
+	return response, nil
+}
+
+func (r *RestHandlerImpl) GetSealStatusV1(
+	ctx context.Context, _ GetSealStatusV1RequestObject,
+) (GetSealStatusV1ResponseObject, error) {
+	status, err := r.sealService.Status(ctx)
+	if err != nil {
+		message := "could not load seal status"
+		r.l(ctx).Error(message, zap.Error(err))
+		return GetSealStatusV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	return GetSealStatusV1200JSONResponse(dtoToSealStatus(status)), nil
+}
+
+func (r *RestHandlerImpl) UnsealV1(
+	ctx context.Context, request UnsealV1RequestObject,
+) (UnsealV1ResponseObject, error) {
+	var status *service.SealStatusDto
+	var err error
+	switch {
+	case request.Body.Reset != nil && *request.Body.Reset:
+		status, err = r.sealService.ResetUnsealProgress(ctx)
+	case request.Body.Key != nil:
+		status, err = r.sealService.Unseal(ctx, *request.Body.Key)
+	default:
+		message := "either key or reset must be set"
+		r.l(ctx).Debug(message)
+		return UnsealV1400JSONResponse{
+			Code:    ptr(http.StatusBadRequest),
+			Message: &message,
+		}, nil
+	}
+
+	switch {
+	case errors.Is(err, service.ErrShamirSealNotConfigured),
+		errors.Is(err, encryption.ErrSealNotInitialized),
+		errors.Is(err, encryption.ErrInvalidUnsealKeyShare),
+		errors.Is(err, encryption.ErrDuplicateUnsealKey),
+		errors.Is(err, encryption.ErrInvalidUnsealKeys):
+		message := "could not unseal"
+		r.l(ctx).Info(message, zap.Error(err))
+		return UnsealV1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	case err != nil:
+		message := "could not unseal"
+		r.l(ctx).Error(message, zap.Error(err))
+		return UnsealV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	if !status.Sealed {
+		r.l(ctx).Info("vault unsealed")
+	}
+	return UnsealV1200JSONResponse(dtoToSealStatus(status)), nil
+}
+
+func (r *RestHandlerImpl) ListApiTokensV1(
+	ctx context.Context, _ ListApiTokensV1RequestObject,
+) (ListApiTokensV1ResponseObject, error) {
+	apiTokens, err := r.apiTokenService.FindAll(ctx)
+	if err != nil {
+		message := "could not load API tokens"
+		r.l(ctx).Error(message, zap.Error(err))
+		return ListApiTokensV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	response := make(ListApiTokensV1200JSONResponse, len(apiTokens))
+	for i, apiToken := range apiTokens {
+		response[i] = dtoToApiToken(apiToken)
+	}
+	return response, nil
+}
+
+func (r *RestHandlerImpl) CreateApiTokenV1(
+	ctx context.Context, request CreateApiTokenV1RequestObject,
+) (CreateApiTokenV1ResponseObject, error) {
+	scopes := make([]service.APITokenScope, len(request.Body.Scopes))
+	for i, scope := range request.Body.Scopes {
+		scopes[i] = service.APITokenScope(scope)
+	}
+
+	createdAPIToken, err := r.apiTokenService.Create(ctx, service.NewCreateAPITokenDto(
+		request.Body.Name,
+		scopes,
+		request.Body.ExpiresAt,
+	))
+	if errors.Is(err, service.ErrInvalidAPITokenScope) {
+		message := "invalid API token scopes"
+		r.l(ctx).Debug(message)
+		return CreateApiTokenV1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if errors.Is(err, service.ErrDuplicateAPITokenName) {
+		message := "API token name is already in use"
+		r.l(ctx).Debug(message)
+		return CreateApiTokenV1409JSONResponse{
+			Code:          ptr(http.StatusConflict),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if err != nil {
+		message := "could not create API token"
+		r.l(ctx).Error(message, zap.Error(err))
+		return CreateApiTokenV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+
+	apiToken := dtoToApiToken(createdAPIToken.APITokenDto)
+	r.l(ctx).Info("created API token", zap.String("created-api-token-id", apiToken.Id.String()))
+	return CreateApiTokenV1201JSONResponse{
+		CreatedAt: apiToken.CreatedAt,
+		ExpiresAt: apiToken.ExpiresAt,
+		Id:        apiToken.Id,
+		Name:      apiToken.Name,
+		RevokedAt: apiToken.RevokedAt,
+		Scopes:    apiToken.Scopes,
+		Token:     createdAPIToken.Token,
+	}, nil
+}
+
+func (r *RestHandlerImpl) RevokeApiTokenV1(
+	ctx context.Context, request RevokeApiTokenV1RequestObject,
+) (RevokeApiTokenV1ResponseObject, error) {
+	revoked, err := r.apiTokenService.Revoke(ctx, request.Id)
+	if err != nil {
+		message := "could not revoke API token"
+		r.l(ctx).Error(message, zap.Error(err))
+		return RevokeApiTokenV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	if !revoked {
+		return RevokeApiTokenV1404JSONResponse{
+			Code:    ptr(http.StatusNotFound),
+			Message: ptr("API token does not exist or is already revoked"),
+		}, nil
+	}
+
+	r.l(ctx).Info("revoked API token", zap.String("revoked-api-token-id", request.Id.String()))
+	return RevokeApiTokenV1204Response{}, nil
+}
+
+func dtoToX509PrivateKey(privKeyDto *service.X509PrivateKeyDto) X509PrivateKey {
+	return X509PrivateKey{
+		Id:  privKeyDto.ID,
+		Key: privKeyDto.PemPrivateKey,
+	}
+}
+
+func dtoToX509ImportFileReport(reportDto *service.X509ImportFileReportDto) X509ImportFileReport {
+	report := X509ImportFileReport{
+		Name:                  reportDto.Name,
+		Format:                X509ImportFileReportFormat(reportDto.Format),
+		CreatedCertificateIds: emptyIfNil(reportDto.CreatedCertificateIDs),
+		SkippedCertificateIds: emptyIfNil(reportDto.SkippedCertificateIDs),
+		CreatedPrivateKeyIds:  emptyIfNil(reportDto.CreatedPrivateKeyIDs),
+		SkippedPrivateKeyIds:  emptyIfNil(reportDto.SkippedPrivateKeyIDs),
+	}
+	if reportDto.SkippedReason != "" {
+		report.SkippedReason = &reportDto.SkippedReason
+	}
+	return report
+}
+
+func dtoToX509Certificate(certDto *service.X509CertificateDto) X509Certificate {
+	return X509Certificate{
+		Certificate:         certDto.CertificatePem,
+		CommonName:          ptr(certDto.CommonName),
+		CreatedAt:           certDto.CreatedAt,
+		Id:                  certDto.ID,
+		NotAfter:            certDto.NotAfter,
+		NotBefore:           certDto.NotBefore,
+		ParentCertificateId: certDto.ParentCertificateID,
+		PrivateKeyId:        certDto.PrivateKeyID,
+		Sans:                certDto.SubjectAltNames,
+	}
+}
+
+func dtoToX509CertificateSubscription(dto *service.X509CertificateSubscriptionDto) X509CertificateSubscription {
+	return X509CertificateSubscription{
+		CreatedAt:         dto.CreatedAt,
+		Id:                dto.ID,
+		IncludePrivateKey: dto.IncludePrivateKey,
+		SubjectAltNames:   dto.SANs,
+		UpdatedAt:         dto.UpdatedAt,
+	}
+}
+
+func dtoToX509CertificateUpdates(dto *service.X509CertificateUpdatesDto) X509CertificateUpdates {
+	certs := make([]X509Certificate, len(dto.Certificates))
+	for i, cert := range dto.Certificates {
+		certs[i] = dtoToX509Certificate(cert)
+	}
+	privKeys := make([]X509PrivateKey, len(dto.PrivateKeys))
+	for i, privKey := range dto.PrivateKeys {
+		privKeys[i] = dtoToX509PrivateKey(privKey)
+	}
+	subUpdates := make([]X509CertificateSubscriptionUpdate, len(dto.Subscriptions))
+	for i, subUpdate := range dto.Subscriptions {
+		subUpdates[i] = dtoToX509CertificateSubscriptionUpdate(subUpdate)
+	}
+
+	return X509CertificateUpdates{
+		Certificates:  &certs,
+		PrivateKeys:   &privKeys,
+		Subscriptions: &subUpdates,
+		NextCursor:    dto.NextCursor,
+	}
+}
+
+func dtoToX509CertificateSubscriptionUpdate(dto *service.X509CertificateSubscriptionUpdateDto) X509CertificateSubscriptionUpdate {
+	return X509CertificateSubscriptionUpdate{
+		SubscriptionId: dto.SubscriptionID,
+		CertificateIds: dto.CertificateIDs,
+		PrivateKeyIds:  dto.PrivateKeyIDs,
+	}
+}
+
+func dtoToWebhook(dto *service.WebhookDto) Webhook {
+	return Webhook{
+		CreatedAt: dto.CreatedAt,
+		UpdatedAt: dto.UpdatedAt,
+		Url:       dto.URL,
+	}
+}
+
+func dtoToWebhookDelivery(dto *service.WebhookDeliveryDto) WebhookDelivery {
+	return WebhookDelivery{
+		Attempts:       dto.Attempts,
+		CreatedAt:      dto.CreatedAt,
+		DeliveredAt:    dto.DeliveredAt,
+		EventType:      dto.EventType,
+		Id:             dto.ID,
+		LastAttemptAt:  dto.LastAttemptAt,
+		LastError:      dto.LastError,
+		LastStatusCode: dto.LastStatusCode,
+		NextAttemptAt:  dto.NextAttemptAt,
+		Status:         WebhookDeliveryStatus(dto.Status),
+	}
+}
+
+func dtoToSealStatus(dto *service.SealStatusDto) SealStatus {
+	return SealStatus{
+		Initialized:     dto.Initialized,
+		Progress:        dto.Progress,
+		Sealed:          dto.Sealed,
+		SecretShares:    dto.SecretShares,
+		SecretThreshold: dto.SecretThreshold,
+	}
+}
+
+func dtoToApiToken(dto *service.APITokenDto) ApiToken {
+	scopes := make([]ApiTokenScope, len(dto.Scopes))
+	for i, scope := range dto.Scopes {
+		scopes[i] = ApiTokenScope(scope)
+	}
+	return ApiToken{
+		CreatedAt: dto.CreatedAt,
+		ExpiresAt: dto.ExpiresAt,
+		Id:        dto.ID,
+		Name:      dto.Name,
+		RevokedAt: dto.RevokedAt,
+		Scopes:    scopes,
+	}
+}
+
+func separatePemBlocks(pemBlocks []byte) (blocks []*pem.Block, rest []byte) {
+	return separatePemBlocksRecursively(pemBlocks, nil)
+}
+
+func separatePemBlocksRecursively(pemBlocks []byte, foundPemBlocks []*pem.Block) (blocks []*pem.Block, rest []byte) {
+	pemBlock, rest := pem.Decode(pemBlocks)
+	if pemBlock == nil {
+		return foundPemBlocks, rest
+	}
+
+	return separatePemBlocksRecursively(rest, append(foundPemBlocks, pemBlock))
+}
+
+func (r *RestHandlerImpl) l(ctx context.Context) *zap.Logger {
+	logger := ctx.Value(GinCtxLoggerKey)
+	if logger == nil {
+		panic("")
+	}
+	return logger.(*zap.Logger)
+}
+
+// principal returns the principal the request was authenticated as, nil for public operations.
+func (r *RestHandlerImpl) principal(ctx context.Context) *service.PrincipalDto {
+	principal, _ := ctx.Value(GinCtxPrincipalKey).(*service.PrincipalDto)
+	return principal
+}
+
+func ptr[T any](input T) *T {
+	return &input
+}
+
+// emptyIfNil returns an empty slice for nil, so required arrays are encoded as [] instead of null.
+func emptyIfNil[T any](input []T) []T {
+	if input == nil {
+		return []T{}
+	}
+	return input
 }
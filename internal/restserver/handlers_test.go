@@ -0,0 +1,170 @@
+package restserver
+
+import (
+	"context"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"github.com/pki-vault/server/internal/service"
+	"github.com/pki-vault/server/internal/updates"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+func TestUpdatesWait(t *testing.T) {
+	tests := []struct {
+		name        string
+		waitSeconds *int
+		want        time.Duration
+	}{
+		{name: "no wait", want: 0},
+		{name: "negative wait", waitSeconds: ptr(-1), want: 0},
+		{name: "wait", waitSeconds: ptr(30), want: 30 * time.Second},
+		{name: "maximum wait", waitSeconds: ptr(60), want: MaxUpdatesWait},
+		{name: "wait above maximum", waitSeconds: ptr(3600), want: MaxUpdatesWait},
+		{name: "overflowing wait", waitSeconds: ptr(int(^uint(0) >> 1)), want: MaxUpdatesWait},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := updatesWait(tt.waitSeconds); got != tt.want {
+				t.Errorf("updatesWait() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRestHandlerImpl_waitForX509CertificateUpdates(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	sub := repository.NewX509CertificateSubscriptionDao(
+		uuid.New(), []string{"example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+	)
+	cert := repository.NewX509CertificateDao(
+		uuid.New(), "example.invalid", []string{"example.invalid"}, nil, nil, nil, nil, nil, nil, nil,
+		fakeClock.Now(), fakeClock.Now().Add(24*time.Hour), fakeClock.Now(),
+	)
+
+	tests := []struct {
+		name string
+		wait time.Duration
+		// wakeUp is called while the first, empty updates are loaded
+		wakeUp     func(hub *updates.Hub, cancel context.CancelFunc)
+		wantCert   bool
+		wantMinDur time.Duration
+	}{
+		{
+			name:     "notification",
+			wait:     time.Minute,
+			wakeUp:   func(hub *updates.Hub, _ context.CancelFunc) { hub.Publish() },
+			wantCert: true,
+		},
+		{
+			name:       "timeout",
+			wait:       50 * time.Millisecond,
+			wakeUp:     func(*updates.Hub, context.CancelFunc) {},
+			wantMinDur: 50 * time.Millisecond,
+		},
+		{
+			name:   "client disconnect",
+			wait:   time.Minute,
+			wakeUp: func(_ *updates.Hub, cancel context.CancelFunc) { cancel() },
+		},
+		{
+			name:   "shutdown",
+			wait:   time.Minute,
+			wakeUp: func(hub *updates.Hub, _ context.CancelFunc) { hub.Shutdown() },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			t.Cleanup(cancel)
+			ctrl := gomock.NewController(t)
+			subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+			certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+			hub := updates.NewHub(nil, fakeClock, zap.NewNop())
+			subService := service.NewX509CertificateSubscriptionService(subRepo, nil, fakeClock)
+			handler := &RestHandlerImpl{
+				logger:                 zap.NewNop(),
+				x509CertificateService: service.NewX509CertificateService(certRepo, subService, nil),
+				updatesHub:             hub,
+			}
+
+			subRepo.EXPECT().FindByIDs(gomock.Any(), []uuid.UUID{sub.ID}).
+				Return([]*repository.X509CertificateSubscriptionDao{sub}, nil).AnyTimes()
+			certRepo.EXPECT().FindCertificateChain(gomock.Any(), cert.ID).
+				Return([]*repository.X509CertificateDao{cert}, nil).AnyTimes()
+			gomock.InOrder(
+				certRepo.EXPECT().GetLatestChangeSequence(gomock.Any()).Return(int64(1), nil),
+				certRepo.EXPECT().FindLatestActiveBySubscriptionAndChangedBetween(gomock.Any(), sub.ID, int64(0), int64(1)).
+					DoAndReturn(func(context.Context, uuid.UUID, int64, int64) ([]*repository.X509CertificateDao, error) {
+						tt.wakeUp(hub, cancel)
+						return nil, nil
+					}),
+			)
+			if tt.wantCert {
+				// Only the changes after the empty updates are loaded again
+				gomock.InOrder(
+					certRepo.EXPECT().GetLatestChangeSequence(gomock.Any()).Return(int64(2), nil),
+					certRepo.EXPECT().FindLatestActiveBySubscriptionAndChangedBetween(gomock.Any(), sub.ID, int64(1), int64(2)).
+						Return([]*repository.X509CertificateDao{cert}, nil),
+				)
+			}
+
+			startedAt := time.Now()
+			got, err := handler.waitForX509CertificateUpdates(ctx, []uuid.UUID{sub.ID}, "", tt.wait)
+			if err != nil {
+				t.Fatalf("waitForX509CertificateUpdates() got unexpected error: %v", err)
+			}
+			if gotCert := len(got.Certificates) != 0; gotCert != tt.wantCert {
+				t.Errorf("waitForX509CertificateUpdates() = %d certificates, want certificate %v",
+					len(got.Certificates), tt.wantCert)
+			}
+			if elapsed := time.Since(startedAt); elapsed < tt.wantMinDur || elapsed > tt.wait/2+tt.wantMinDur {
+				t.Errorf("waitForX509CertificateUpdates() returned after %v with wait %v", elapsed, tt.wait)
+			}
+		})
+	}
+}
+
+func TestRestHandlerImpl_GetX509CertificateUpdatesV1_KeysReadScope(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	sub := repository.NewX509CertificateSubscriptionDao(
+		uuid.New(), []string{"example.invalid"}, true, fakeClock.Now(), fakeClock.Now(),
+	)
+	principal := &service.PrincipalDto{
+		Type: service.PrincipalTypeAPIToken, Name: "ci", Scopes: []service.APITokenScope{service.APITokenScopeUpdatesRead},
+	}
+	ctx := context.WithValue(context.Background(), GinCtxPrincipalKey, principal)
+	ctx = context.WithValue(ctx, GinCtxLoggerKey, zap.NewNop())
+
+	ctrl := gomock.NewController(t)
+	subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+	// The certificates and private keys aren't loaded at all
+	certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+	policyService, err := service.NewPolicyService(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subService := service.NewX509CertificateSubscriptionService(subRepo, policyService, fakeClock)
+	handler := &RestHandlerImpl{
+		logger:                             zap.NewNop(),
+		x509CertificateSubscriptionService: subService,
+		x509CertificateService:             service.NewX509CertificateService(certRepo, subService, nil),
+		policyService:                      policyService,
+	}
+	subRepo.EXPECT().FindByIDs(gomock.Any(), []uuid.UUID{sub.ID}).
+		Return([]*repository.X509CertificateSubscriptionDao{sub}, nil).AnyTimes()
+
+	response, err := handler.GetX509CertificateUpdatesV1(ctx, GetX509CertificateUpdatesV1RequestObject{
+		Params: GetX509CertificateUpdatesV1Params{Subscriptions: []uuid.UUID{sub.ID}},
+	})
+	if err != nil {
+		t.Fatalf("GetX509CertificateUpdatesV1() got unexpected error: %v", err)
+	}
+	if _, ok := response.(GetX509CertificateUpdatesV1403JSONResponse); !ok {
+		t.Errorf("GetX509CertificateUpdatesV1() = %T, want 403 response", response)
+	}
+}
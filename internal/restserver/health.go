@@ -0,0 +1,69 @@
+package restserver
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pki-vault/server/internal/service"
+	"go.uber.org/zap"
+	"net/http"
+)
+
+// Values of the status of readiness checks
+const (
+	healthCheckStatusOk     = "ok"
+	healthCheckStatusFailed = "failed"
+)
+
+type readinessResponse struct {
+	Ready  bool              `json:"ready"`
+	Checks map[string]string `json:"checks"`
+}
+
+type versionResponse struct {
+	Version       string `json:"version"`
+	SchemaVersion uint   `json:"schema_version"`
+	DatabaseType  string `json:"database_type"`
+}
+
+// registerHealthRoutes registers the probes /healthz and /readyz and /version. They aren't part of the API spec and
+// are public, so probes don't need credentials. The errors of failed checks are only logged, as they may disclose
+// internals like database addresses.
+func registerHealthRoutes(engine *gin.Engine, logger *zap.Logger, healthService *service.HealthService) {
+	engine.GET("/healthz", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"status": healthCheckStatusOk})
+	})
+
+	engine.GET("/readyz", LoggerMiddleware(logger), func(c *gin.Context) {
+		readiness := healthService.Ready(c)
+		response := readinessResponse{Ready: readiness.Ready, Checks: make(map[string]string, len(readiness.Checks))}
+		for _, check := range readiness.Checks {
+			if check.Err != nil {
+				c.MustGet(GinCtxLoggerKey).(*zap.Logger).Warn("readiness check failed",
+					zap.String("check", check.Name), zap.Error(check.Err),
+				)
+				response.Checks[check.Name] = healthCheckStatusFailed
+				continue
+			}
+			response.Checks[check.Name] = healthCheckStatusOk
+		}
+
+		statusCode := http.StatusOK
+		if !readiness.Ready {
+			statusCode = http.StatusServiceUnavailable
+		}
+		c.JSON(statusCode, response)
+	})
+
+	engine.GET("/version", LoggerMiddleware(logger), func(c *gin.Context) {
+		version, err := healthService.Version(c)
+		if err != nil {
+			c.MustGet(GinCtxLoggerKey).(*zap.Logger).Error("could not read version", zap.Error(err))
+			abortWithError(c, http.StatusServiceUnavailable, "could not read schema version")
+			return
+		}
+		c.JSON(http.StatusOK, versionResponse{
+			Version:       version.Version,
+			SchemaVersion: version.SchemaVersion,
+			DatabaseType:  version.DatabaseType,
+		})
+	})
+}
@@ -1,15 +1,193 @@
 package restserver
 
 import (
+	"errors"
+	"fmt"
+	"github.com/getkin/kin-openapi/openapi3"
 	"github.com/gin-gonic/gin"
+	"github.com/pki-vault/server/internal/metrics"
+	"github.com/pki-vault/server/internal/service"
+	"github.com/pki-vault/server/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
 )
 
-var GinCtxLoggerKey = "ginCtxLoggerKey"
+var (
+	GinCtxLoggerKey    = "ginCtxLoggerKey"
+	GinCtxPrincipalKey = "ginCtxPrincipalKey"
+)
 
 func LoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Set(GinCtxLoggerKey, logger.With(zap.String("remote-ip", c.ClientIP())))
+		fields := append([]zap.Field{zap.String("remote-ip", c.ClientIP())}, tracing.LoggerFields(c.Request.Context())...)
+		c.Set(GinCtxLoggerKey, logger.With(fields...))
+		c.Next()
+	}
+}
+
+// AuthMiddleware authenticates the principal of the request and ensures it has all scopes the operation requires.
+// The principal is the bearer API token or, if no Authorization header is sent, the client certificate verified by
+// the TLS handshake. The generated server sets the required scopes of the operation in the context. Operations without
+// security requirements in the spec, e.g. unsealing, are public.
+func AuthMiddleware(
+	apiTokenService *service.APITokenService, clientCertificateAuthenticator *service.ClientCertificateAuthenticator,
+) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requiredScopes, ok := c.Get(ApiTokenScopes)
+		if !ok {
+			c.Next()
+			return
+		}
+		logger := c.MustGet(GinCtxLoggerKey).(*zap.Logger)
+
+		var principal *service.PrincipalDto
+		authorizationHeader := c.GetHeader("Authorization")
+		switch {
+		case authorizationHeader != "":
+			token, ok := bearerToken(authorizationHeader)
+			if !ok {
+				abortWithError(c, http.StatusUnauthorized, "missing bearer API token")
+				return
+			}
+			apiToken, err := apiTokenService.Authenticate(c, token)
+			if errors.Is(err, service.ErrInvalidAPIToken) {
+				logger.Info("rejected invalid API token")
+				abortWithError(c, http.StatusUnauthorized, "invalid API token")
+				return
+			}
+			if err != nil {
+				logger.Error("could not authenticate API token", zap.Error(err))
+				abortWithError(c, http.StatusInternalServerError, "could not authenticate API token")
+				return
+			}
+			principal = apiToken.Principal()
+		case c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) != 0:
+			var err error
+			principal, err = clientCertificateAuthenticator.Authenticate(c.Request.TLS.VerifiedChains[0][0])
+			if err != nil {
+				logger.Info("rejected invalid client certificate", zap.Error(err))
+				abortWithError(c, http.StatusUnauthorized, "invalid client certificate")
+				return
+			}
+		default:
+			abortWithError(c, http.StatusUnauthorized, "missing bearer API token or client certificate")
+			return
+		}
+
+		logger = logger.With(
+			zap.String("principal-type", string(principal.Type)),
+			zap.String("principal-id", principal.ID),
+			zap.String("principal", principal.Name),
+		)
+		for _, requiredScope := range requiredScopes.([]string) {
+			if !principal.HasScope(service.APITokenScope(requiredScope)) {
+				logger.Info("rejected principal lacking scope", zap.String("scope", requiredScope))
+				abortWithError(c, http.StatusForbidden, fmt.Sprintf("principal lacks scope %s", requiredScope))
+				return
+			}
+		}
+
+		c.Set(GinCtxLoggerKey, logger)
+		c.Set(GinCtxPrincipalKey, principal)
+		c.Next()
+	}
+}
+
+// MetricsMiddleware observes every request with the operation ID of its route, also if it is rejected before reaching
+// its handler, e.g. by the AuthMiddleware. It has to be used by the engine, so it wraps the handlers of all routes.
+// Requests without an operation, e.g. to unknown paths, are observed as operation "unknown".
+func MetricsMiddleware(m *metrics.Metrics, swagger *openapi3.T) gin.HandlerFunc {
+	operationIDs := operationIDsByRoute(swagger)
+	return func(c *gin.Context) {
+		startedAt := time.Now()
+		c.Next()
+
+		m.ObserveHTTPRequest(routeOperationID(operationIDs, c), c.Request.Method, c.Writer.Status(), time.Since(startedAt))
+	}
+}
+
+// TracingMiddleware starts a server span named by the operation ID of the route for every request, continuing the
+// trace propagated by the caller. The span is put into the context of the request, so the spans of the services and
+// SQL statements of the handler are its children. It has to be used by the engine before all other middlewares.
+func TracingMiddleware(swagger *openapi3.T) gin.HandlerFunc {
+	operationIDs := operationIDsByRoute(swagger)
+	tracer := otel.Tracer(tracing.InstrumentationName)
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracer.Start(ctx, routeOperationID(operationIDs, c),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(semconv.HTTPMethod(c.Request.Method), semconv.HTTPRoute(c.FullPath())),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		statusCode := c.Writer.Status()
+		span.SetAttributes(semconv.HTTPStatusCode(statusCode))
+		if statusCode >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(statusCode))
+		}
+	}
+}
+
+// BodyLimitMiddleware rejects requests declaring bodies larger than maxBodySize bytes. Bodies without declared length
+// are cut off at the limit, which fails their decoding.
+func BodyLimitMiddleware(maxBodySize int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > maxBodySize {
+			abortWithError(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("request body exceeds %d bytes", maxBodySize))
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBodySize)
 		c.Next()
 	}
 }
+
+// routeOperationID returns the operation ID of the route of the request, or "unknown" if the route has no operation,
+// e.g. if the path is unknown.
+func routeOperationID(operationIDs map[string]string, c *gin.Context) string {
+	operationID, ok := operationIDs[c.Request.Method+" "+c.FullPath()]
+	if !ok {
+		return "unknown"
+	}
+	return operationID
+}
+
+var pathParameterPattern = regexp.MustCompile(`{([^}]+)}`)
+
+// operationIDsByRoute maps "<method> <gin route>" to the operation IDs of the spec. Path parameters are written as
+// :param in gin routes.
+func operationIDsByRoute(swagger *openapi3.T) map[string]string {
+	operationIDs := make(map[string]string)
+	for path, pathItem := range swagger.Paths {
+		route := pathParameterPattern.ReplaceAllString(path, ":$1")
+		for method, operation := range pathItem.Operations() {
+			operationIDs[method+" "+route] = operation.OperationID
+		}
+	}
+	return operationIDs
+}
+
+func bearerToken(authorizationHeader string) (string, bool) {
+	scheme, token, found := strings.Cut(authorizationHeader, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func abortWithError(c *gin.Context, statusCode int, message string) {
+	c.AbortWithStatusJSON(statusCode, Error{
+		Code:    ptr(statusCode),
+		Message: &message,
+	})
+}
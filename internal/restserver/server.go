@@ -3,28 +3,61 @@ package restserver
 import (
 	"fmt"
 	middleware "github.com/deepmap/oapi-codegen/pkg/gin-middleware"
+	"github.com/getkin/kin-openapi/openapi3filter"
 	"github.com/gin-gonic/gin"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/metrics"
+	"github.com/pki-vault/server/internal/service"
 	"go.uber.org/zap"
 )
 
 func InitializeGinEngine(
 	logger *zap.Logger,
 	handler StrictServerInterface,
+	apiTokenService *service.APITokenService,
+	clientCertificateAuthenticator *service.ClientCertificateAuthenticator,
+	serverMetrics *metrics.Metrics,
+	healthService *service.HealthService,
+	httpConfig config.HTTP,
 ) (*gin.Engine, error) {
 	engine := gin.New()
+	// Cancel the contexts of handlers when clients disconnect, which ends update streams
+	engine.ContextWithFallback = true
 
 	swagger, err := GetSwagger()
 	if err != nil {
 		return nil, fmt.Errorf("unable to load swagger spec: %w", err)
 	}
+	// Registered before the routes, so they wrap all of their handlers
+	engine.Use(
+		TracingMiddleware(swagger),
+		MetricsMiddleware(serverMetrics, swagger),
+		BodyLimitMiddleware(httpConfig.MaxBodySize),
+	)
 
 	RegisterHandlersWithOptions(engine, NewStrictHandler(handler, []StrictMiddlewareFunc{}), GinServerOptions{
 		Middlewares: []MiddlewareFunc{
 			MiddlewareFunc(LoggerMiddleware(logger)),
-			MiddlewareFunc(middleware.OapiRequestValidator(swagger)),
+			MiddlewareFunc(AuthMiddleware(apiTokenService, clientCertificateAuthenticator)),
+			MiddlewareFunc(middleware.OapiRequestValidatorWithOptions(swagger, &middleware.Options{
+				// Principals are already authenticated by the AuthMiddleware
+				Options: openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+			})),
 		},
 		ErrorHandler: nil,
 	})
 
+	// The metrics aren't part of the API spec, so the scope is set like the generated server does for operations
+	engine.GET("/metrics",
+		func(c *gin.Context) {
+			c.Set(ApiTokenScopes, []string{string(service.APITokenScopeMetricsRead)})
+		},
+		LoggerMiddleware(logger),
+		AuthMiddleware(apiTokenService, clientCertificateAuthenticator),
+		gin.WrapH(serverMetrics.Handler()),
+	)
+
+	registerHealthRoutes(engine, logger, healthService)
+
 	return engine, nil
 }
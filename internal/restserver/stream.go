@@ -0,0 +1,228 @@
+package restserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pki-vault/server/internal/encryption"
+	"github.com/pki-vault/server/internal/service"
+	"github.com/pki-vault/server/internal/updates"
+	"go.uber.org/zap"
+	"net/http"
+	"time"
+)
+
+// updatesStreamKeepAliveInterval is the interval of the comments keeping idle update streams open, e.g. through
+// proxies closing idle connections.
+const updatesStreamKeepAliveInterval = 30 * time.Second
+
+func (r *RestHandlerImpl) GetX509CertificateUpdatesStreamV1(
+	ctx context.Context, request GetX509CertificateUpdatesStreamV1RequestObject,
+) (GetX509CertificateUpdatesStreamV1ResponseObject, error) {
+	_, statusCode, errBody := r.authorizeUpdateSubscriptions(ctx, request.Params.Subscriptions)
+	switch statusCode {
+	case http.StatusBadRequest:
+		return GetX509CertificateUpdatesStreamV1400JSONResponse(*errBody), nil
+	case http.StatusForbidden:
+		return GetX509CertificateUpdatesStreamV1403JSONResponse(*errBody), nil
+	case http.StatusInternalServerError:
+		return GetX509CertificateUpdatesStreamV1defaultJSONResponse{Body: *errBody, StatusCode: statusCode}, nil
+	}
+
+	// The hub is subscribed before the cursor is loaded, so no updates are missed in between
+	stream := &x509CertificateUpdatesStreamResponse{
+		ctx:          ctx,
+		handler:      r,
+		subIDs:       request.Params.Subscriptions,
+		subscription: r.updatesHub.Subscribe(),
+	}
+	if request.Params.Cursor == nil {
+		cursor, err := r.x509CertificateService.GetLatestUpdatesCursor(ctx)
+		if err != nil {
+			stream.subscription.Close()
+			message := "could not load certificate updates"
+			r.l(ctx).Error(message, zap.Error(err))
+			return GetX509CertificateUpdatesStreamV1defaultJSONResponse{
+				Body: Error{
+					Code:    ptr(http.StatusInternalServerError),
+					Message: &message,
+				},
+				StatusCode: http.StatusInternalServerError,
+			}, nil
+		}
+		stream.cursor = cursor
+		return stream, nil
+	}
+
+	catchUp, err := r.x509CertificateService.GetUpdates(ctx, stream.subIDs, *request.Params.Cursor, true)
+	if err != nil {
+		stream.subscription.Close()
+	}
+	if errors.Is(err, service.ErrInvalidUpdatesCursor) {
+		message := "invalid updates cursor"
+		r.l(ctx).Debug(message, zap.Error(err))
+		return GetX509CertificateUpdatesStreamV1400JSONResponse{
+			Code:          ptr(http.StatusBadRequest),
+			Message:       &message,
+			DetailMessage: ptr(err.Error()),
+		}, nil
+	}
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		r.l(ctx).Debug(message)
+		return GetX509CertificateUpdatesStreamV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusServiceUnavailable),
+				Message: &message,
+			},
+			StatusCode: http.StatusServiceUnavailable,
+		}, nil
+	}
+	if err != nil {
+		message := "could not load certificate updates"
+		r.l(ctx).Error(message, zap.Error(err))
+		return GetX509CertificateUpdatesStreamV1defaultJSONResponse{
+			Body: Error{
+				Code:    ptr(http.StatusInternalServerError),
+				Message: &message,
+			},
+			StatusCode: http.StatusInternalServerError,
+		}, nil
+	}
+	stream.cursor = catchUp.NextCursor
+	stream.catchUp = catchUp
+	return stream, nil
+}
+
+// x509CertificateUpdatesStreamResponse pushes the updates of the subscriptions as Server-Sent Events until the
+// client disconnects or the server shuts down. cursor is the position up to which updates were pushed, catchUp the
+// updates missed before connecting if the client passed a cursor.
+type x509CertificateUpdatesStreamResponse struct {
+	ctx          context.Context
+	handler      *RestHandlerImpl
+	subIDs       []uuid.UUID
+	cursor       string
+	catchUp      *service.X509CertificateUpdatesDto
+	subscription *updates.Subscription
+}
+
+func (s *x509CertificateUpdatesStreamResponse) VisitGetX509CertificateUpdatesStreamV1Response(
+	w http.ResponseWriter,
+) error {
+	defer s.subscription.Close()
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("response writer can't flush events")
+	}
+
+	// Streams outlive the read and write timeouts of the server
+	if err := clearReadDeadline(w); err != nil {
+		return err
+	}
+	err := http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	if err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Disable the response buffering of nginx
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if s.catchUp != nil {
+		if err := writeX509CertificateUpdatesEvent(w, flusher, s.catchUp); err != nil {
+			return err
+		}
+	}
+
+	keepAliveTicker := time.NewTicker(updatesStreamKeepAliveInterval)
+	defer keepAliveTicker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return nil
+		case <-s.subscription.Done():
+			return nil
+		case <-keepAliveTicker.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return err
+			}
+			flusher.Flush()
+		case <-s.subscription.Ready():
+			// Notifications only wake the stream, the cursor tells which updates are new
+			if !s.subscription.Take() {
+				continue
+			}
+			if ended, err := s.push(w, flusher); ended || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// push writes an update event with the subscriptions which have certificates changed since the cursor and advances
+// the cursor. The subscriptions are authorized again, as policies may have changed since the stream started. ended is
+// true if an error event ended the stream.
+func (s *x509CertificateUpdatesStreamResponse) push(w http.ResponseWriter, flusher http.Flusher) (ended bool, err error) {
+	ctx := s.ctx
+	if _, _, errBody := s.handler.authorizeUpdateSubscriptions(ctx, s.subIDs); errBody != nil {
+		return true, writeServerSentEvent(w, flusher, "error", errBody)
+	}
+
+	certUpdates, err := s.handler.x509CertificateService.GetUpdates(ctx, s.subIDs, s.cursor, true)
+	if errors.Is(err, encryption.ErrSealed) {
+		message := "the vault is sealed"
+		s.handler.l(ctx).Debug(message)
+		return true, writeServerSentEvent(w, flusher, "error", &Error{
+			Code:    ptr(http.StatusServiceUnavailable),
+			Message: &message,
+		})
+	}
+	if err != nil {
+		message := "could not load certificate updates"
+		s.handler.l(ctx).Error(message, zap.Error(err))
+		return true, writeServerSentEvent(w, flusher, "error", &Error{
+			Code:    ptr(http.StatusInternalServerError),
+			Message: &message,
+		})
+	}
+
+	s.cursor = certUpdates.NextCursor
+	return false, writeX509CertificateUpdatesEvent(w, flusher, certUpdates)
+}
+
+// writeX509CertificateUpdatesEvent writes an update event with the subscriptions which have certificates. Nothing is
+// written if none of them has.
+func writeX509CertificateUpdatesEvent(
+	w http.ResponseWriter, flusher http.Flusher, certUpdates *service.X509CertificateUpdatesDto,
+) error {
+	var subUpdates []*service.X509CertificateSubscriptionUpdateDto
+	for _, subUpdate := range certUpdates.Subscriptions {
+		if len(subUpdate.CertificateIDs) != 0 {
+			subUpdates = append(subUpdates, subUpdate)
+		}
+	}
+	if len(subUpdates) == 0 {
+		return nil
+	}
+	certUpdates.Subscriptions = subUpdates
+
+	return writeServerSentEvent(w, flusher, "update", dtoToX509CertificateUpdates(certUpdates))
+}
+
+func writeServerSentEvent(w http.ResponseWriter, flusher http.Flusher, event string, data any) error {
+	encodedData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// Encoded JSON has no line breaks, so it fits into a single data field
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encodedData); err != nil {
+		return err
+	}
+	flusher.Flush()
+	return nil
+}
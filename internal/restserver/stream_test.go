@@ -0,0 +1,57 @@
+package restserver
+
+import (
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/updates"
+	"go.uber.org/zap"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestX509CertificateUpdatesStreamResponse_ReadTimeout(t *testing.T) {
+	for _, http2 := range []bool{false, true} {
+		name := "HTTP/1.1"
+		if http2 {
+			name = "HTTP/2"
+		}
+		t.Run(name, func(t *testing.T) {
+			hub := updates.NewHub(nil, clockwork.NewRealClock(), zap.NewNop())
+			streamEnded := make(chan struct{})
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+				defer close(streamEnded)
+				stream := &x509CertificateUpdatesStreamResponse{ctx: req.Context(), subscription: hub.Subscribe()}
+				if err := stream.VisitGetX509CertificateUpdatesStreamV1Response(w); err != nil {
+					t.Errorf("VisitGetX509CertificateUpdatesStreamV1Response() got unexpected error: %v", err)
+				}
+			}))
+			server.Config.ReadTimeout = 50 * time.Millisecond
+			server.Config.WriteTimeout = 50 * time.Millisecond
+			server.EnableHTTP2 = http2
+			if http2 {
+				server.StartTLS()
+			} else {
+				server.Start()
+			}
+			t.Cleanup(server.Close)
+
+			response, err := server.Client().Get(server.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = response.Body.Close() })
+			if http2 && response.ProtoMajor != 2 {
+				t.Fatalf("response protocol = %s, want HTTP/2", response.Proto)
+			}
+
+			select {
+			case <-streamEnded:
+				t.Fatal("stream ended at the timeouts of the server")
+			case <-time.After(10 * server.Config.ReadTimeout):
+			}
+			hub.Shutdown()
+			<-streamEnded
+		})
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"io"
+	"strings"
+	"time"
+)
+
+type APITokenScope string
+
+// Enum values for APITokenScope
+const (
+	APITokenScopeImport             APITokenScope = "import"
+	APITokenScopeSubscriptionManage APITokenScope = "subscription:manage"
+	APITokenScopeUpdatesRead        APITokenScope = "updates:read"
+	APITokenScopeKeysRead           APITokenScope = "keys:read"
+	APITokenScopeAdmin              APITokenScope = "admin"
+	APITokenScopeMetricsRead        APITokenScope = "metrics:read"
+)
+
+var APITokenScopes = []APITokenScope{
+	APITokenScopeImport,
+	APITokenScopeSubscriptionManage,
+	APITokenScopeUpdatesRead,
+	APITokenScopeKeysRead,
+	APITokenScopeAdmin,
+	APITokenScopeMetricsRead,
+}
+
+// apiTokenPrefix makes tokens recognizable, e.g. for secret scanners.
+const apiTokenPrefix = "pkv_"
+
+var (
+	ErrInvalidAPIToken      = errors.New("invalid API token")
+	ErrInvalidAPITokenScope = errors.New("invalid API token scope")
+	// ErrDuplicateAPITokenName is returned when creating a token with the name of a token which isn't revoked, as
+	// policies bind tokens by name.
+	ErrDuplicateAPITokenName = repository.ErrDuplicateAPITokenName
+)
+
+type APITokenDto struct {
+	ID        uuid.UUID       `json:"id" toml:"id" yaml:"id"`
+	Name      string          `json:"name" toml:"name" yaml:"name"`
+	Scopes    []APITokenScope `json:"scopes" toml:"scopes" yaml:"scopes"`
+	CreatedAt time.Time       `json:"created_at" toml:"created_at" yaml:"created_at"`
+	ExpiresAt *time.Time      `json:"expires_at" toml:"expires_at" yaml:"expires_at"`
+	RevokedAt *time.Time      `json:"revoked_at" toml:"revoked_at" yaml:"revoked_at"`
+}
+
+// HasScope reports whether the token has the scope. A nil token has no scopes.
+func (a *APITokenDto) HasScope(scope APITokenScope) bool {
+	if a == nil {
+		return false
+	}
+	return containsScope(a.Scopes, scope)
+}
+
+type CreatedAPITokenDto struct {
+	*APITokenDto
+	// Token is the bearer token. Only its hash is persisted, so it can't be retrieved again.
+	Token string
+}
+
+type CreateAPITokenDto struct {
+	Name      string
+	Scopes    []APITokenScope
+	ExpiresAt *time.Time
+}
+
+func NewCreateAPITokenDto(name string, scopes []APITokenScope, expiresAt *time.Time) *CreateAPITokenDto {
+	return &CreateAPITokenDto{Name: name, Scopes: scopes, ExpiresAt: expiresAt}
+}
+
+type APITokenService struct {
+	repository repository.APITokenRepository
+	clock      clockwork.Clock
+}
+
+func NewAPITokenService(repository repository.APITokenRepository, clock clockwork.Clock) *APITokenService {
+	return &APITokenService{repository: repository, clock: clock}
+}
+
+func (a *APITokenService) Create(ctx context.Context, request *CreateAPITokenDto) (*CreatedAPITokenDto, error) {
+	if strings.TrimSpace(request.Name) == "" {
+		return nil, errors.New("API token name must not be empty")
+	}
+	if len(request.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidAPITokenScope)
+	}
+	scopes := make([]string, len(request.Scopes))
+	for idx, scope := range request.Scopes {
+		if !isValidAPITokenScope(scope) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidAPITokenScope, scope)
+		}
+		scopes[idx] = string(scope)
+	}
+
+	token, err := generateAPIToken()
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate API token: %w", err)
+	}
+	createdToken, err := a.repository.Create(ctx, repository.NewAPITokenDao(
+		uuid.New(),
+		request.Name,
+		hashAPIToken(token),
+		scopes,
+		a.clock.Now(),
+		request.ExpiresAt,
+		nil,
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreatedAPITokenDto{APITokenDto: apiTokenDaoToDto(createdToken), Token: token}, nil
+}
+
+// Authenticate returns the token if it exists and is neither expired nor revoked, otherwise ErrInvalidAPIToken.
+func (a *APITokenService) Authenticate(ctx context.Context, token string) (*APITokenDto, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	apiToken, exists, err := a.repository.FindByTokenHash(ctx, hashAPIToken(token))
+	if err != nil {
+		return nil, fmt.Errorf("unable to find API token: %w", err)
+	}
+	if !exists || apiToken.RevokedAt != nil {
+		return nil, ErrInvalidAPIToken
+	}
+	if apiToken.ExpiresAt != nil && !a.clock.Now().Before(*apiToken.ExpiresAt) {
+		return nil, ErrInvalidAPIToken
+	}
+
+	return apiTokenDaoToDto(apiToken), nil
+}
+
+func (a *APITokenService) FindAll(ctx context.Context) ([]*APITokenDto, error) {
+	apiTokens, err := a.repository.FindAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	apiTokenDtos := make([]*APITokenDto, len(apiTokens))
+	for idx, apiToken := range apiTokens {
+		apiTokenDtos[idx] = apiTokenDaoToDto(apiToken)
+	}
+	return apiTokenDtos, nil
+}
+
+// Revoke revokes the token. It returns false if the token doesn't exist or is already revoked.
+func (a *APITokenService) Revoke(ctx context.Context, id uuid.UUID) (bool, error) {
+	return a.repository.Revoke(ctx, id, a.clock.Now())
+}
+
+func isValidAPITokenScope(scope APITokenScope) bool {
+	return containsScope(APITokenScopes, scope)
+}
+
+func generateAPIToken() (string, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, tokenBytes); err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(tokenBytes), nil
+}
+
+// hashAPIToken hashes the token without salt, so it can be looked up by its hash.
+// This is fine because tokens are random with 256 bits of entropy, unlike passwords.
+func hashAPIToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+func apiTokenDaoToDto(apiToken *repository.APITokenDao) *APITokenDto {
+	scopes := make([]APITokenScope, len(apiToken.Scopes))
+	for idx, scope := range apiToken.Scopes {
+		scopes[idx] = APITokenScope(scope)
+	}
+	return &APITokenDto{
+		ID:        apiToken.ID,
+		Name:      apiToken.Name,
+		Scopes:    scopes,
+		CreatedAt: apiToken.CreatedAt,
+		ExpiresAt: apiToken.ExpiresAt,
+		RevokedAt: apiToken.RevokedAt,
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"github.com/pki-vault/server/internal/testutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPITokenService_Create(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	tests := []struct {
+		name    string
+		request *CreateAPITokenDto
+		repoErr error
+		wantErr bool
+	}{
+		{
+			name:    "valid token",
+			request: NewCreateAPITokenDto("ci", []APITokenScope{APITokenScopeImport, APITokenScopeKeysRead}, nil),
+		},
+		{
+			name:    "empty name",
+			request: NewCreateAPITokenDto(" ", []APITokenScope{APITokenScopeImport}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "no scopes",
+			request: NewCreateAPITokenDto("ci", nil, nil),
+			wantErr: true,
+		},
+		{
+			name:    "unknown scope",
+			request: NewCreateAPITokenDto("ci", []APITokenScope{"unknown"}, nil),
+			wantErr: true,
+		},
+		{
+			name:    "duplicate name",
+			request: NewCreateAPITokenDto("ci", []APITokenScope{APITokenScopeImport}, nil),
+			repoErr: ErrDuplicateAPITokenName,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mock_repository.NewMockAPITokenRepository(ctrl)
+			if !tt.wantErr || tt.repoErr != nil {
+				repo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(ctx context.Context, token *repository.APITokenDao) (*repository.APITokenDao, error) {
+						if tt.repoErr != nil {
+							return nil, tt.repoErr
+						}
+						return token, nil
+					})
+			}
+
+			created, err := NewAPITokenService(repo, fakeClock).Create(context.Background(), tt.request)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Create() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.repoErr != nil && !errors.Is(err, tt.repoErr) {
+				t.Errorf("Create() error = %v, want %v", err, tt.repoErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !strings.HasPrefix(created.Token, apiTokenPrefix) {
+				t.Errorf("Create() token = %s, want prefix %s", created.Token, apiTokenPrefix)
+			}
+			if !created.HasScope(APITokenScopeKeysRead) || created.HasScope(APITokenScopeAdmin) {
+				t.Errorf("Create() scopes = %v, want %v", created.Scopes, tt.request.Scopes)
+			}
+		})
+	}
+}
+
+func TestAPITokenService_Authenticate(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	token := "pkv_Q2hhbmdlIG1lIHRvIGEgcmFuZG9tIHRva2VuIHZhbHVl"
+	newTokenDao := func(expiresAt, revokedAt *time.Time) *repository.APITokenDao {
+		return repository.NewAPITokenDao(
+			uuid.MustParse("7c6b5a49-3827-4165-8f4e-3d2c1b0a9f8e"), "ci", hashAPIToken(token),
+			[]string{string(APITokenScopeImport)}, fakeClock.Now(), expiresAt, revokedAt,
+		)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		tokenDao *repository.APITokenDao
+		wantErr  error
+	}{
+		{
+			name:     "valid token",
+			token:    token,
+			tokenDao: newTokenDao(nil, nil),
+		},
+		{
+			name:     "not yet expired token",
+			token:    token,
+			tokenDao: newTokenDao(testutil.Ptr(fakeClock.Now().Add(time.Second)), nil),
+		},
+		{
+			name:     "expired token",
+			token:    token,
+			tokenDao: newTokenDao(testutil.Ptr(fakeClock.Now()), nil),
+			wantErr:  ErrInvalidAPIToken,
+		},
+		{
+			name:     "revoked token",
+			token:    token,
+			tokenDao: newTokenDao(nil, testutil.Ptr(fakeClock.Now().Add(-time.Second))),
+			wantErr:  ErrInvalidAPIToken,
+		},
+		{
+			name:    "unknown token",
+			token:   token,
+			wantErr: ErrInvalidAPIToken,
+		},
+		{
+			name:    "token without prefix",
+			token:   "Q2hhbmdlIG1lIHRvIGEgcmFuZG9tIHRva2VuIHZhbHVl",
+			wantErr: ErrInvalidAPIToken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			repo := mock_repository.NewMockAPITokenRepository(ctrl)
+			if strings.HasPrefix(tt.token, apiTokenPrefix) {
+				repo.EXPECT().FindByTokenHash(gomock.Any(), hashAPIToken(tt.token)).
+					Return(tt.tokenDao, tt.tokenDao != nil, nil)
+			}
+
+			apiToken, err := NewAPITokenService(repo, fakeClock).Authenticate(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && apiToken.ID != tt.tokenDao.ID {
+				t.Errorf("Authenticate() ID = %v, want %v", apiToken.ID, tt.tokenDao.ID)
+			}
+		})
+	}
+}
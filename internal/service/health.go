@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/pki-vault/server/internal/db"
+	"github.com/pki-vault/server/internal/encryption"
+)
+
+// Names of the readiness checks
+const (
+	HealthCheckDatabase   = "database"
+	HealthCheckMigrations = "migrations"
+	HealthCheckSeal       = "seal"
+)
+
+// HealthCheckDto is the result of a single readiness check. Err is nil if the check passed.
+type HealthCheckDto struct {
+	Name string
+	Err  error
+}
+
+// ReadinessDto is the result of HealthService.Ready. The server is ready if all checks passed.
+type ReadinessDto struct {
+	Ready  bool
+	Checks []*HealthCheckDto
+}
+
+type VersionDto struct {
+	Version       string
+	SchemaVersion uint
+	DatabaseType  db.SQLDatabaseType
+}
+
+// HealthService checks whether the server is ready to serve requests: the database is reachable, its schema is
+// migrated to the latest migration in the migrations base path and the shamir seal, if used, is unsealed.
+type HealthService struct {
+	backend            db.SqlBackend
+	migrationsBasePath string
+	seal               *encryption.ShamirSeal
+	version            string
+}
+
+func NewHealthService(
+	backend db.SqlBackend, migrationsBasePath string, seal *encryption.ShamirSeal, version string,
+) *HealthService {
+	return &HealthService{backend: backend, migrationsBasePath: migrationsBasePath, seal: seal, version: version}
+}
+
+// Ready runs all readiness checks. The seal is only checked if the shamir seal is used, as the server is never sealed
+// otherwise.
+func (h *HealthService) Ready(ctx context.Context) *ReadinessDto {
+	checks := []*HealthCheckDto{
+		{Name: HealthCheckDatabase, Err: h.backend.Db().PingContext(ctx)},
+		{Name: HealthCheckMigrations, Err: h.checkMigrations(ctx)},
+	}
+	if h.seal != nil {
+		var err error
+		if h.seal.Status().Sealed {
+			err = encryption.ErrSealed
+		}
+		checks = append(checks, &HealthCheckDto{Name: HealthCheckSeal, Err: err})
+	}
+
+	readiness := &ReadinessDto{Ready: true, Checks: checks}
+	for _, check := range checks {
+		if check.Err != nil {
+			readiness.Ready = false
+		}
+	}
+	return readiness
+}
+
+// Version returns the build version of the server and the version and type of its database schema.
+func (h *HealthService) Version(ctx context.Context) (*VersionDto, error) {
+	schemaVersion, _, err := h.backend.SchemaVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read schema version: %w", err)
+	}
+	return &VersionDto{Version: h.version, SchemaVersion: schemaVersion, DatabaseType: h.backend.DatabaseType()}, nil
+}
+
+func (h *HealthService) checkMigrations(ctx context.Context) error {
+	expectedVersion, err := db.LatestMigrationVersion(h.backend, h.migrationsBasePath)
+	if err != nil {
+		return fmt.Errorf("unable to read migrations: %w", err)
+	}
+	schemaVersion, dirty, err := h.backend.SchemaVersion(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to read schema version: %w", err)
+	}
+	if dirty {
+		return fmt.Errorf("migration %d failed", schemaVersion)
+	}
+	if schemaVersion != expectedVersion {
+		return fmt.Errorf("schema version is %d, expected %d", schemaVersion, expectedVersion)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/golang-migrate/migrate/v4/database"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/pki-vault/server/internal/db"
+	"github.com/pki-vault/server/internal/encryption"
+	"reflect"
+	"testing"
+)
+
+// healthTestMigrationsBasePath contains the migrations 1 and 2
+const healthTestMigrationsBasePath = "testdata/migrations"
+
+type fakeSqlBackend struct {
+	db               *sql.DB
+	schemaVersion    uint
+	dirty            bool
+	schemaVersionErr error
+}
+
+func (f *fakeSqlBackend) MigrationDriver() (database.Driver, error) {
+	return nil, errors.New("not supported")
+}
+
+func (f *fakeSqlBackend) Db() *sql.DB {
+	return f.db
+}
+
+func (f *fakeSqlBackend) DatabaseType() db.SQLDatabaseType {
+	return db.PostgresqlDatabaseType
+}
+
+func (f *fakeSqlBackend) SchemaVersion(context.Context) (uint, bool, error) {
+	return f.schemaVersion, f.dirty, f.schemaVersionErr
+}
+
+// fakeConnector opens connections which only support pings, or fails with err.
+type fakeConnector struct {
+	err error
+}
+
+func (f fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return fakeConn{}, nil
+}
+
+func (f fakeConnector) Driver() driver.Driver {
+	return nil
+}
+
+type fakeConn struct{}
+
+func (fakeConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("not supported")
+}
+
+func (fakeConn) Close() error {
+	return nil
+}
+
+func (fakeConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("not supported")
+}
+
+func TestHealthService_Ready(t *testing.T) {
+	tests := []struct {
+		name           string
+		connectErr     error
+		schemaVersion  uint
+		dirty          bool
+		seal           *encryption.ShamirSeal
+		want           bool
+		wantFailChecks []string
+	}{
+		{name: "ready", schemaVersion: 2, want: true},
+		{
+			name:           "unreachable database",
+			connectErr:     errors.New("connection refused"),
+			schemaVersion:  2,
+			wantFailChecks: []string{HealthCheckDatabase},
+		},
+		{name: "outdated schema", schemaVersion: 1, wantFailChecks: []string{HealthCheckMigrations}},
+		{name: "failed migration", schemaVersion: 2, dirty: true, wantFailChecks: []string{HealthCheckMigrations}},
+		{
+			name:           "sealed",
+			schemaVersion:  2,
+			seal:           encryption.NewShamirSeal(),
+			wantFailChecks: []string{HealthCheckSeal},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sqlDb := sql.OpenDB(fakeConnector{err: tt.connectErr})
+			t.Cleanup(func() { _ = sqlDb.Close() })
+			backend := &fakeSqlBackend{db: sqlDb, schemaVersion: tt.schemaVersion, dirty: tt.dirty}
+
+			got := NewHealthService(backend, healthTestMigrationsBasePath, tt.seal, "v1.0.0").Ready(context.Background())
+			if got.Ready != tt.want {
+				t.Errorf("Ready() ready = %v, want %v", got.Ready, tt.want)
+			}
+			var gotFailChecks []string
+			for _, check := range got.Checks {
+				if check.Err != nil {
+					gotFailChecks = append(gotFailChecks, check.Name)
+				}
+			}
+			if !reflect.DeepEqual(gotFailChecks, tt.wantFailChecks) {
+				t.Errorf("Ready() failed checks = %v, want %v", gotFailChecks, tt.wantFailChecks)
+			}
+		})
+	}
+}
+
+func TestHealthService_Version(t *testing.T) {
+	backend := &fakeSqlBackend{schemaVersion: 2}
+	got, err := NewHealthService(backend, healthTestMigrationsBasePath, nil, "v1.0.0").Version(context.Background())
+	if err != nil {
+		t.Fatalf("Version() got unexpected error: %v", err)
+	}
+	want := &VersionDto{Version: "v1.0.0", SchemaVersion: 2, DatabaseType: db.PostgresqlDatabaseType}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Version() = %v, want %v", got, want)
+	}
+}
@@ -6,10 +6,65 @@ import (
 	"crypto/ed25519"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/pem"
 	"errors"
+	"fmt"
 	"github.com/pki-vault/server/internal/db/repository"
 )
 
+var (
+	// ErrPrivateKeyPassphraseRequired is returned for encrypted private keys without passphrase.
+	ErrPrivateKeyPassphraseRequired = errors.New("private key is encrypted, but no passphrase was given")
+	// ErrInvalidPrivateKeyPassphrase is returned for encrypted private keys which can't be decrypted, e.g. because the
+	// passphrase is wrong or the encryption isn't supported.
+	ErrInvalidPrivateKeyPassphrase = errors.New("could not decrypt private key with passphrase")
+)
+
+// DecryptPrivateKeyPem decrypts an encrypted PKCS#8 "ENCRYPTED PRIVATE KEY" block or a legacy OpenSSL PEM block with
+// Proc-Type and DEK-Info headers and returns the private key as unencrypted PKCS#8 "PRIVATE KEY" block. PKCS#8 keys may
+// be encrypted with PBES2 using PBKDF2 or scrypt and AES, or with the 3DES of PKCS#12. Unencrypted blocks are returned
+// as they are.
+func DecryptPrivateKeyPem(privKeyPem *pem.Block, passphrase string) (*pem.Block, error) {
+	if privKeyPem == nil {
+		return nil, errors.New("private key is no PEM block")
+	}
+
+	var der []byte
+	var err error
+	switch {
+	case privKeyPem.Type == "ENCRYPTED PRIVATE KEY":
+		if passphrase == "" {
+			return nil, ErrPrivateKeyPassphraseRequired
+		}
+		var keyInfo encryptedPrivateKeyInfo
+		if err = unmarshalDer(privKeyPem.Bytes, &keyInfo); err == nil {
+			der, err = decryptPBE(keyInfo.EncryptionAlgorithm, keyInfo.EncryptedData, passphrase)
+		}
+	// Legacy PEM encryption is deprecated as it's insecure, but still produced, e.g. by OpenSSL's -traditional option
+	case x509.IsEncryptedPEMBlock(privKeyPem):
+		if passphrase == "" {
+			return nil, ErrPrivateKeyPassphraseRequired
+		}
+		der, err = x509.DecryptPEMBlock(privKeyPem, []byte(passphrase))
+	default:
+		return privKeyPem, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPrivateKeyPassphrase, err)
+	}
+
+	// A wrong passphrase may still result in valid padding, so the key has to be parsed to detect it
+	privKey, _, err := ParsePrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPrivateKeyPassphrase, err)
+	}
+	der, err = x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}, nil
+}
+
 func ParsePrivateKey(der []byte) (key crypto.PrivateKey, keyType string, err error) {
 	key, err = x509.ParsePKCS1PrivateKey(der)
 	if err == nil {
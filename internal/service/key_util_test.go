@@ -4,6 +4,7 @@ import (
 	"crypto"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"github.com/pki-vault/server/internal/db/repository"
 	"os"
 	"reflect"
@@ -123,6 +124,111 @@ func TestParsePrivateKey(t *testing.T) {
 	}
 }
 
+func TestDecryptPrivateKeyPem(t *testing.T) {
+	tests := []struct {
+		name        string
+		filePath    string
+		passphrase  string
+		wantKeyPath string
+		wantType    string
+		wantErr     error
+	}{
+		{
+			name:        "PKCS8 PBKDF2 HMAC-SHA-256 AES-256",
+			filePath:    "testdata/private_keys/pkcs8_rsa_2048_pbkdf2_aes256.pem",
+			passphrase:  "password",
+			wantKeyPath: "testdata/private_keys/pkcs8_rsa_2048.pem",
+		},
+		{
+			name:        "PKCS8 PBKDF2 default HMAC-SHA-1 AES-128",
+			filePath:    "testdata/private_keys/pkcs8_ecdsa_prime256v1_pbkdf2_sha1_aes128.pem",
+			passphrase:  "password",
+			wantKeyPath: "testdata/private_keys/pkcs8_ecdsa_prime256v1.pem",
+		},
+		{
+			name:        "PKCS8 scrypt AES-256",
+			filePath:    "testdata/private_keys/pkcs8_ecdsa_prime256v1_scrypt_aes256.pem",
+			passphrase:  "password",
+			wantKeyPath: "testdata/private_keys/pkcs8_ecdsa_prime256v1.pem",
+		},
+		{
+			name:        "PKCS8 PKCS12 3DES",
+			filePath:    "testdata/private_keys/pkcs8_ed25519_256_pkcs12_3des.pem",
+			passphrase:  "password",
+			wantKeyPath: "testdata/private_keys/pkcs8_ed25519_256.pem",
+		},
+		{
+			name:        "legacy PEM PKCS1 AES-256",
+			filePath:    "testdata/private_keys/pkcs1_rsa_2048_legacy_aes256.pem",
+			passphrase:  "password",
+			wantKeyPath: "testdata/private_keys/pkcs1_rsa_2048.pem",
+		},
+		{
+			name:        "legacy PEM EC 3DES",
+			filePath:    "testdata/private_keys/ec_ecdsa_prime256v1_legacy_des3.pem",
+			passphrase:  "password",
+			wantKeyPath: "testdata/private_keys/ec_ecdsa_prime256v1.pem",
+		},
+		{
+			name:        "unencrypted",
+			filePath:    "testdata/private_keys/pkcs1_rsa_2048.pem",
+			wantKeyPath: "testdata/private_keys/pkcs1_rsa_2048.pem",
+			wantType:    "RSA PRIVATE KEY",
+		},
+		{
+			name:       "PKCS8 wrong passphrase",
+			filePath:   "testdata/private_keys/pkcs8_rsa_2048_pbkdf2_aes256.pem",
+			passphrase: "wrong",
+			wantErr:    ErrInvalidPrivateKeyPassphrase,
+		},
+		{
+			name:       "legacy PEM wrong passphrase",
+			filePath:   "testdata/private_keys/ec_ecdsa_prime256v1_legacy_des3.pem",
+			passphrase: "wrong",
+			wantErr:    ErrInvalidPrivateKeyPassphrase,
+		},
+		{
+			name:     "missing passphrase",
+			filePath: "testdata/private_keys/pkcs8_ecdsa_prime256v1_scrypt_aes256.pem",
+			wantErr:  ErrPrivateKeyPassphraseRequired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecryptPrivateKeyPem(readPemFile(t, tt.filePath), tt.passphrase)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecryptPrivateKeyPem() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			wantType := tt.wantType
+			if wantType == "" {
+				wantType = "PRIVATE KEY"
+			}
+			if got.Type != wantType {
+				t.Errorf("DecryptPrivateKeyPem() type = %v, want %v", got.Type, wantType)
+			}
+			gotKey, _, err := ParsePrivateKey(got.Bytes)
+			if err != nil {
+				t.Fatalf("DecryptPrivateKeyPem() returned unparsable key: %v", err)
+			}
+			wantKey, _, err := ParsePrivateKey(readPemFile(t, tt.wantKeyPath).Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotKey, wantKey) {
+				t.Errorf("DecryptPrivateKeyPem() key = %v, want %v", gotKey, wantKey)
+			}
+		})
+	}
+
+	// pem.Decode returns nil for data without PEM block
+	if _, err := DecryptPrivateKeyPem(nil, ""); err == nil {
+		t.Errorf("DecryptPrivateKeyPem() of nil block expected error")
+	}
+}
+
 func readPemFile(t *testing.T, filePath string) *pem.Block {
 	file, err := os.ReadFile(filePath)
 	if err != nil {
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/pki-vault/server/internal/db/repository"
+	"time"
+)
+
+// Event types written to the outbox by imports
+const (
+	// OutboxEventCertificateCreated is written for every certificate created by an import.
+	OutboxEventCertificateCreated = "certificate.created"
+	// OutboxEventCertificateLinked is written for every existing certificate which got its parent from an import.
+	OutboxEventCertificateLinked = "certificate.linked"
+	// OutboxEventPrivateKeyLinked is written for every existing certificate which got its private key from an import.
+	OutboxEventPrivateKeyLinked = "private_key.linked"
+)
+
+// CertificateCreatedEventDto is the payload of OutboxEventCertificateCreated events.
+type CertificateCreatedEventDto struct {
+	CertificateID       uuid.UUID  `json:"certificate_id"`
+	CommonName          string     `json:"common_name"`
+	SubjectAltNames     []string   `json:"subject_alt_names"`
+	ParentCertificateID *uuid.UUID `json:"parent_certificate_id"`
+	PrivateKeyID        *uuid.UUID `json:"private_key_id"`
+	NotBefore           time.Time  `json:"not_before"`
+	NotAfter            time.Time  `json:"not_after"`
+}
+
+// CertificateLinkedEventDto is the payload of OutboxEventCertificateLinked events.
+type CertificateLinkedEventDto struct {
+	CertificateID       uuid.UUID `json:"certificate_id"`
+	ParentCertificateID uuid.UUID `json:"parent_certificate_id"`
+}
+
+// PrivateKeyLinkedEventDto is the payload of OutboxEventPrivateKeyLinked events.
+type PrivateKeyLinkedEventDto struct {
+	PrivateKeyID  uuid.UUID `json:"private_key_id"`
+	CertificateID uuid.UUID `json:"certificate_id"`
+}
+
+// writeImportOutboxEvents writes the events of an import to the outbox. It is called within the transaction of the
+// import, so events are only published if the import is committed.
+func (x *X509ImportService) writeImportOutboxEvents(
+	ctx context.Context, createdCerts []*repository.X509CertificateDao,
+	parentLinkedCerts []*repository.X509CertificateDao, privKeyLinkedCerts []*repository.X509CertificateDao,
+) error {
+	for _, cert := range createdCerts {
+		subjectAltNames := cert.SubjectAltNames
+		if subjectAltNames == nil {
+			subjectAltNames = []string{}
+		}
+		err := x.writeOutboxEvent(ctx, OutboxEventCertificateCreated, &CertificateCreatedEventDto{
+			CertificateID:       cert.ID,
+			CommonName:          cert.CommonName,
+			SubjectAltNames:     subjectAltNames,
+			ParentCertificateID: cert.ParentCertificateID,
+			PrivateKeyID:        cert.PrivateKeyID,
+			NotBefore:           cert.NotBefore,
+			NotAfter:            cert.NotAfter,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, cert := range parentLinkedCerts {
+		err := x.writeOutboxEvent(ctx, OutboxEventCertificateLinked, &CertificateLinkedEventDto{
+			CertificateID:       cert.ID,
+			ParentCertificateID: *cert.ParentCertificateID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for _, cert := range privKeyLinkedCerts {
+		err := x.writeOutboxEvent(ctx, OutboxEventPrivateKeyLinked, &PrivateKeyLinkedEventDto{
+			PrivateKeyID:  *cert.PrivateKeyID,
+			CertificateID: cert.ID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *X509ImportService) writeOutboxEvent(ctx context.Context, eventType string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	now := x.clock.Now()
+	_, err = x.OutboxEventRepository().Create(ctx, repository.NewOutboxEventDao(
+		uuid.New(), eventType, payload, 0, &now, nil, now, nil,
+	))
+	return err
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestX509ImportService_writeImportOutboxEvents(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	outboxEventRepo := mock_repository.NewMockOutboxEventRepository(ctrl)
+
+	parentID := uuid.MustParse("6a0f3c1e-2b4d-4f8a-9c6e-1d3b5f7a9e2c")
+	privKeyID := uuid.MustParse("8c2e4a6f-1b3d-4e5f-a7c9-0e2f4b6d8a1c")
+	createdCert := repository.NewX509CertificateDao(
+		uuid.MustParse("2f4a6c8e-0b1d-4e3f-8a5c-7e9b1d3f5a7c"), "www.example.invalid", nil, nil, nil, nil, nil, nil,
+		&parentID, &privKeyID, fakeClock.Now(), fakeClock.Now().Add(24*time.Hour), fakeClock.Now(),
+	)
+	parentLinkedCert := repository.NewX509CertificateDao(
+		uuid.MustParse("4b6d8f0a-2c3e-4a5b-9d7f-1a3c5e7b9d0f"), "api.example.invalid", []string{"api.example.invalid"},
+		nil, nil, nil, nil, nil, &parentID, nil, fakeClock.Now(), fakeClock.Now(), fakeClock.Now(),
+	)
+	privKeyLinkedCert := repository.NewX509CertificateDao(
+		uuid.MustParse("9e1a3c5e-7f0b-4d2c-8e4a-6c8e0a2b4d6f"), "mail.example.invalid", nil,
+		nil, nil, nil, nil, nil, nil, &privKeyID, fakeClock.Now(), fakeClock.Now(), fakeClock.Now(),
+	)
+
+	type wantEvent struct {
+		eventType string
+		data      any
+	}
+	wantEvents := []wantEvent{
+		{eventType: OutboxEventCertificateCreated, data: &CertificateCreatedEventDto{
+			CertificateID:       createdCert.ID,
+			CommonName:          createdCert.CommonName,
+			SubjectAltNames:     []string{},
+			ParentCertificateID: &parentID,
+			PrivateKeyID:        &privKeyID,
+			NotBefore:           createdCert.NotBefore,
+			NotAfter:            createdCert.NotAfter,
+		}},
+		{eventType: OutboxEventCertificateLinked, data: &CertificateLinkedEventDto{
+			CertificateID:       parentLinkedCert.ID,
+			ParentCertificateID: parentID,
+		}},
+		{eventType: OutboxEventPrivateKeyLinked, data: &PrivateKeyLinkedEventDto{
+			PrivateKeyID:  privKeyID,
+			CertificateID: privKeyLinkedCert.ID,
+		}},
+	}
+	var gotEvents []*repository.OutboxEventDao
+	outboxEventRepo.EXPECT().Create(ctx, gomock.Any()).Times(len(wantEvents)).DoAndReturn(
+		func(_ context.Context, event *repository.OutboxEventDao) (*repository.OutboxEventDao, error) {
+			gotEvents = append(gotEvents, event)
+			return event, nil
+		},
+	)
+
+	service := NewX509ImportService(&testRepositoryBundle{outboxEventRepo: outboxEventRepo}, nil, nil, fakeClock)
+	err := service.writeImportOutboxEvents(
+		ctx, []*repository.X509CertificateDao{createdCert}, []*repository.X509CertificateDao{parentLinkedCert},
+		[]*repository.X509CertificateDao{privKeyLinkedCert},
+	)
+	if err != nil {
+		t.Fatalf("writeImportOutboxEvents() got unexpected error: %v", err)
+	}
+
+	for idx, want := range wantEvents {
+		got := gotEvents[idx]
+		if got.EventType != want.eventType {
+			t.Errorf("writeImportOutboxEvents() event %d type = %v, want %v", idx, got.EventType, want.eventType)
+		}
+		if got.Attempts != 0 || got.PublishedAt != nil || got.NextAttemptAt == nil ||
+			!got.NextAttemptAt.Equal(fakeClock.Now()) {
+			t.Errorf("writeImportOutboxEvents() event %d is not due for its first attempt: %+v", idx, got)
+		}
+		wantPayload, err := json.Marshal(want.data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got.Payload, wantPayload) {
+			t.Errorf("writeImportOutboxEvents() event %d payload = %s, want %s", idx, got.Payload, wantPayload)
+		}
+	}
+}
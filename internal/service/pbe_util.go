@@ -0,0 +1,278 @@
+package service
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"hash"
+	"unicode/utf16"
+)
+
+// Password based encryption (PBE) as used by PKCS#8 and PKCS#12
+
+var (
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPBES2                         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2                        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt                        = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidHMACWithSHA1                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224                = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256                = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384                = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512                = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC                     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC                     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC                     = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// errInvalidPadding is returned for decrypted data without valid padding, usually because the password is wrong.
+var errInvalidPadding = errors.New("invalid padding")
+
+// Limits of the parameters of decrypted data, so uploads can't make the server derive keys for minutes
+const (
+	maxPBEIterations     = 1 << 21
+	maxScryptMemory      = 256 << 20
+	maxScryptParallelism = 16
+)
+
+type pbeParams struct {
+	Salt       []byte
+	Iterations int
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int                      `asn1:"optional"`
+	PRF        pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// encryptedPrivateKeyInfo is the ASN.1 structure of encrypted PKCS#8 private keys of RFC 5208.
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+// decryptPBE decrypts data encrypted with PBES2 using PBKDF2 or scrypt and AES-CBC, or with 3DES-CBC as specified by
+// PKCS#12.
+func decryptPBE(algorithm pkix.AlgorithmIdentifier, data []byte, password string) ([]byte, error) {
+	switch {
+	case algorithm.Algorithm.Equal(oidPBES2):
+		return decryptPBES2(algorithm.Parameters.FullBytes, data, password)
+	case algorithm.Algorithm.Equal(oidPBEWithSHAAnd3KeyTripleDESCBC):
+		var params pbeParams
+		if err := unmarshalDer(algorithm.Parameters.FullBytes, &params); err != nil {
+			return nil, err
+		}
+		if params.Iterations > maxPBEIterations {
+			return nil, fmt.Errorf("iteration count %d exceeds the maximum of %d", params.Iterations, maxPBEIterations)
+		}
+		bmpPassword := bmpStringZeroTerminated(password)
+		key := pkcs12KDF(sha1.New, params.Salt, bmpPassword, params.Iterations, pkcs12KDFKeyID, 24)
+		iv := pkcs12KDF(sha1.New, params.Salt, bmpPassword, params.Iterations, pkcs12KDFIVID, des.BlockSize)
+		block, err := des.NewTripleDESCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return decryptCBC(block, iv, data)
+	default:
+		return nil, fmt.Errorf("unsupported encryption algorithm %s", algorithm.Algorithm)
+	}
+}
+
+func decryptPBES2(paramsDer []byte, data []byte, password string) ([]byte, error) {
+	var params pbes2Params
+	if err := unmarshalDer(paramsDer, &params); err != nil {
+		return nil, err
+	}
+
+	var keyLength int
+	switch {
+	case params.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keyLength = 16
+	case params.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keyLength = 24
+	case params.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keyLength = 32
+	default:
+		return nil, fmt.Errorf("unsupported PBES2 encryption scheme %s", params.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if err := unmarshalDer(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	switch {
+	case params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2):
+		var kdfParams pbkdf2Params
+		if err := unmarshalDer(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+			return nil, err
+		}
+		if kdfParams.Iterations > maxPBEIterations {
+			return nil, fmt.Errorf("iteration count %d exceeds the maximum of %d", kdfParams.Iterations, maxPBEIterations)
+		}
+		var prf func() hash.Hash
+		switch {
+		// HMAC-SHA-1 is the default if the PRF is left out
+		case len(kdfParams.PRF.Algorithm) == 0, kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA1):
+			prf = sha1.New
+		case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA224):
+			prf = sha256.New224
+		case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA256):
+			prf = sha256.New
+		case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA384):
+			prf = sha512.New384
+		case kdfParams.PRF.Algorithm.Equal(oidHMACWithSHA512):
+			prf = sha512.New
+		default:
+			return nil, fmt.Errorf("unsupported PBKDF2 PRF %s", kdfParams.PRF.Algorithm)
+		}
+		key = pbkdf2.Key([]byte(password), kdfParams.Salt, kdfParams.Iterations, keyLength, prf)
+	case params.KeyDerivationFunc.Algorithm.Equal(oidScrypt):
+		var kdfParams scryptParams
+		if err := unmarshalDer(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+			return nil, err
+		}
+		// scrypt needs 128 * N * r bytes of memory
+		if kdfParams.CostParameter <= 0 || kdfParams.BlockSize <= 0 ||
+			kdfParams.CostParameter > maxScryptMemory/128/kdfParams.BlockSize ||
+			kdfParams.ParallelizationParameter > maxScryptParallelism {
+			return nil, errors.New("scrypt parameters exceed the maximum cost")
+		}
+		var err error
+		key, err = scrypt.Key([]byte(password), kdfParams.Salt,
+			kdfParams.CostParameter, kdfParams.BlockSize, kdfParams.ParallelizationParameter, keyLength,
+		)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported PBES2 key derivation function %s", params.KeyDerivationFunc.Algorithm)
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return decryptCBC(block, iv, data)
+}
+
+// decryptCBC decrypts the data in CBC mode and removes the PKCS#7 padding.
+func decryptCBC(block cipher.Block, iv []byte, data []byte) ([]byte, error) {
+	blockSize := block.BlockSize()
+	if len(iv) != blockSize {
+		return nil, errors.New("invalid IV length")
+	}
+	if len(data) == 0 || len(data)%blockSize != 0 {
+		return nil, errors.New("encrypted data isn't a multiple of the block size")
+	}
+	decrypted := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, data)
+
+	padLen := int(decrypted[len(decrypted)-1])
+	if padLen == 0 || padLen > blockSize ||
+		!bytes.Equal(decrypted[len(decrypted)-padLen:], bytes.Repeat([]byte{byte(padLen)}, padLen)) {
+		return nil, errInvalidPadding
+	}
+	return decrypted[:len(decrypted)-padLen], nil
+}
+
+// unmarshalDer unmarshals the DER into out and fails on trailing data.
+func unmarshalDer(der []byte, out any) error {
+	rest, err := asn1.Unmarshal(der, out)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return errors.New("trailing data after ASN.1 structure")
+	}
+	return nil
+}
+
+// Purposes of keys derived by the PKCS#12 KDF
+const (
+	pkcs12KDFKeyID = 1
+	pkcs12KDFIVID  = 2
+	pkcs12KDFMACID = 3
+)
+
+// pkcs12KDF derives size bytes from the BMPString password as specified by RFC 7292, Appendix B.2.
+func pkcs12KDF(newHash func() hash.Hash, salt, password []byte, iterations int, id byte, size int) []byte {
+	h := newHash()
+	u, v := h.Size(), h.BlockSize()
+
+	diversifier := bytes.Repeat([]byte{id}, v)
+	input := append(fillWithRepeats(salt, v), fillWithRepeats(password, v)...)
+	derived := make([]byte, 0, size+u)
+	for len(derived) < size {
+		h.Reset()
+		h.Write(diversifier)
+		h.Write(input)
+		digest := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			h.Reset()
+			h.Write(digest)
+			digest = h.Sum(digest[:0])
+		}
+		derived = append(derived, digest...)
+
+		// Add the digest repeated to a block plus one to each block of the input
+		b := fillWithRepeats(digest, v)
+		for j := 0; j < len(input); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(input[j+k]) + int(b[k]) + carry
+				input[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return derived[:size]
+}
+
+// fillWithRepeats repeats the pattern up to the next multiple of v bytes.
+func fillWithRepeats(pattern []byte, v int) []byte {
+	if len(pattern) == 0 {
+		return nil
+	}
+	length := v * ((len(pattern) + v - 1) / v)
+	return bytes.Repeat(pattern, (length+len(pattern)-1)/len(pattern))[:length]
+}
+
+// bmpString encodes the string as big-endian UTF-16 as done for ASN.1 BMPStrings.
+func bmpString(s string) []byte {
+	encoded := make([]byte, 0, 2*len(s))
+	for _, c := range utf16.Encode([]rune(s)) {
+		encoded = append(encoded, byte(c>>8), byte(c))
+	}
+	return encoded
+}
+
+// bmpStringZeroTerminated encodes passwords for the PKCS#12 KDF.
+func bmpStringZeroTerminated(s string) []byte {
+	return append(bmpString(s), 0, 0)
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sync/atomic"
+)
+
+var ErrAccessDenied = errors.New("access denied")
+
+// PolicyDto limits the subscriptions of the principals bound to it. Principals are bound by the names of their API
+// tokens, which are unique among tokens which aren't revoked, or client certificates. SubjectAltNames are path.Match
+// patterns, e.g. *.team-a.example.com, where * matches any sequence of characters except /, ? a single character,
+// [...] a character class and \ escapes the next character. PrivateKeys allows subscriptions including private keys.
+type PolicyDto struct {
+	Name               string
+	APITokens          []string
+	ClientCertificates []string
+	SubjectAltNames    []string
+	PrivateKeys        bool
+}
+
+func NewPolicyDto(
+	name string, apiTokens []string, clientCertificates []string, subjectAltNames []string, privateKeys bool,
+) *PolicyDto {
+	return &PolicyDto{
+		Name:               name,
+		APITokens:          apiTokens,
+		ClientCertificates: clientCertificates,
+		SubjectAltNames:    subjectAltNames,
+		PrivateKeys:        privateKeys,
+	}
+}
+
+// PolicyService authorizes the subscriptions of principals. Without any policies, all principals are unrestricted.
+// Once policies are configured, principals may only use subscriptions allowed by a policy bound to them.
+// The policies can be replaced at runtime with Update.
+type PolicyService struct {
+	policies atomic.Pointer[[]*PolicyDto]
+}
+
+func NewPolicyService(policies []*PolicyDto) (*PolicyService, error) {
+	policyService := &PolicyService{}
+	if err := policyService.Update(policies); err != nil {
+		return nil, err
+	}
+	return policyService, nil
+}
+
+// Update validates and replaces all policies. The current policies are kept if the new ones are invalid.
+func (p *PolicyService) Update(policies []*PolicyDto) error {
+	policyNames := make(map[string]bool, len(policies))
+	for _, policy := range policies {
+		if policy.Name == "" {
+			return errors.New("policy name must not be empty")
+		}
+		if policyNames[policy.Name] {
+			return fmt.Errorf("duplicate policy %s", policy.Name)
+		}
+		policyNames[policy.Name] = true
+
+		for _, pattern := range policy.SubjectAltNames {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid SAN pattern %s of policy %s: %w", pattern, policy.Name, err)
+			}
+		}
+	}
+
+	p.policies.Store(&policies)
+	return nil
+}
+
+// AuthorizeSubscription returns ErrAccessDenied if the principal may not use a subscription with the SANs,
+// i.e. if not every SAN is matched by a policy bound to the principal which also allows private keys if requested.
+// A nil principal, i.e. an internal call, is always authorized.
+func (p *PolicyService) AuthorizeSubscription(
+	principal *PrincipalDto, subjectAltNames []string, includePrivateKey bool,
+) error {
+	policies := *p.policies.Load()
+	if len(policies) == 0 || principal == nil {
+		return nil
+	}
+
+	var boundPolicies []*PolicyDto
+	for _, policy := range policies {
+		if policy.binds(principal) {
+			boundPolicies = append(boundPolicies, policy)
+		}
+	}
+	if len(boundPolicies) == 0 {
+		return fmt.Errorf("%w: no policy is bound to %s %s", ErrAccessDenied, principal.Type, principal.Name)
+	}
+
+outerSANLoop:
+	for _, subjectAltName := range subjectAltNames {
+		for _, policy := range boundPolicies {
+			if policy.matches(subjectAltName) && (policy.PrivateKeys || !includePrivateKey) {
+				continue outerSANLoop
+			}
+		}
+		if includePrivateKey {
+			return fmt.Errorf("%w: no policy allows SAN %s with private keys", ErrAccessDenied, subjectAltName)
+		}
+		return fmt.Errorf("%w: no policy allows SAN %s", ErrAccessDenied, subjectAltName)
+	}
+
+	return nil
+}
+
+// AuthorizeCertificate returns ErrAccessDenied if the principal may not subscribe to the certificate, see
+// AuthorizeSubscription. Certificates without SANs are authorized by their common name.
+func (p *PolicyService) AuthorizeCertificate(
+	principal *PrincipalDto, cert *X509CertificateDto, includePrivateKey bool,
+) error {
+	subjectAltNames := cert.SubjectAltNames
+	if len(subjectAltNames) == 0 {
+		subjectAltNames = []string{cert.CommonName}
+	}
+	return p.AuthorizeSubscription(principal, subjectAltNames, includePrivateKey)
+}
+
+func (p *PolicyDto) binds(principal *PrincipalDto) bool {
+	names := p.APITokens
+	if principal.Type == PrincipalTypeClientCertificate {
+		names = p.ClientCertificates
+	}
+	for _, name := range names {
+		if name == principal.Name {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *PolicyDto) matches(subjectAltName string) bool {
+	for _, pattern := range p.SubjectAltNames {
+		// Patterns are validated on update
+		if matched, _ := path.Match(pattern, subjectAltName); matched {
+			return true
+		}
+	}
+	return false
+}
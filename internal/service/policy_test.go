@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/jonboulle/clockwork"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"testing"
+)
+
+func TestPolicyService_AuthorizeSubscription(t *testing.T) {
+	policies := []*PolicyDto{
+		NewPolicyDto("team-a", []string{"team-a-ci"}, []string{"team-a.example.invalid"},
+			[]string{"*.team-a.example.invalid"}, false),
+		NewPolicyDto("team-a-keys", []string{"team-a-ci"}, nil,
+			[]string{"keys.team-a.example.invalid"}, true),
+	}
+	wildcardPolicies := []*PolicyDto{
+		NewPolicyDto("wildcards", []string{"team-a-ci"}, nil,
+			[]string{`\*.team-a.example.invalid`, "node?.team-a.example.invalid"}, false),
+	}
+	teamAToken := &PrincipalDto{Type: PrincipalTypeAPIToken, Name: "team-a-ci"}
+	teamACert := &PrincipalDto{Type: PrincipalTypeClientCertificate, Name: "team-a.example.invalid"}
+
+	tests := []struct {
+		name              string
+		policies          []*PolicyDto
+		principal         *PrincipalDto
+		subjectAltNames   []string
+		includePrivateKey bool
+		wantErr           error
+	}{
+		{
+			name:              "no policies",
+			principal:         teamAToken,
+			subjectAltNames:   []string{"team-b.example.invalid"},
+			includePrivateKey: true,
+		},
+		{
+			name:            "internal call",
+			policies:        policies,
+			subjectAltNames: []string{"team-b.example.invalid"},
+		},
+		{
+			name:            "matching SANs",
+			policies:        policies,
+			principal:       teamAToken,
+			subjectAltNames: []string{"www.team-a.example.invalid", "*.team-a.example.invalid"},
+		},
+		{
+			name:            "client certificate bound by name",
+			policies:        policies,
+			principal:       teamACert,
+			subjectAltNames: []string{"www.team-a.example.invalid"},
+		},
+		{
+			name:            "not matching SAN",
+			policies:        policies,
+			principal:       teamAToken,
+			subjectAltNames: []string{"www.team-a.example.invalid", "www.team-b.example.invalid"},
+			wantErr:         ErrAccessDenied,
+		},
+		{
+			name:              "private key not allowed",
+			policies:          policies,
+			principal:         teamAToken,
+			subjectAltNames:   []string{"www.team-a.example.invalid"},
+			includePrivateKey: true,
+			wantErr:           ErrAccessDenied,
+		},
+		{
+			name:              "private key allowed by other policy",
+			policies:          policies,
+			principal:         teamAToken,
+			subjectAltNames:   []string{"keys.team-a.example.invalid"},
+			includePrivateKey: true,
+		},
+		{
+			name:              "private key policy not bound to client certificate",
+			policies:          policies,
+			principal:         teamACert,
+			subjectAltNames:   []string{"keys.team-a.example.invalid"},
+			includePrivateKey: true,
+			wantErr:           ErrAccessDenied,
+		},
+		{
+			name:            "escaped wildcard and single character",
+			policies:        wildcardPolicies,
+			principal:       teamAToken,
+			subjectAltNames: []string{"*.team-a.example.invalid", "node1.team-a.example.invalid"},
+		},
+		{
+			name:            "escaped wildcard not matching any characters",
+			policies:        wildcardPolicies,
+			principal:       teamAToken,
+			subjectAltNames: []string{"www.team-a.example.invalid"},
+			wantErr:         ErrAccessDenied,
+		},
+		{
+			name:            "single character not matching more characters",
+			policies:        wildcardPolicies,
+			principal:       teamAToken,
+			subjectAltNames: []string{"node10.team-a.example.invalid"},
+			wantErr:         ErrAccessDenied,
+		},
+		{
+			name:            "principal of other type with same name",
+			policies:        policies,
+			principal:       &PrincipalDto{Type: PrincipalTypeClientCertificate, Name: "team-a-ci"},
+			subjectAltNames: []string{"www.team-a.example.invalid"},
+			wantErr:         ErrAccessDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyService, err := NewPolicyService(tt.policies)
+			if err != nil {
+				t.Fatalf("NewPolicyService() got unexpected error: %v", err)
+			}
+
+			err = policyService.AuthorizeSubscription(tt.principal, tt.subjectAltNames, tt.includePrivateKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("AuthorizeSubscription() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyService_AuthorizeCertificate(t *testing.T) {
+	policyService, err := NewPolicyService([]*PolicyDto{
+		NewPolicyDto("team-a", []string{"team-a-ci"}, nil, []string{"*.team-a.example.invalid"}, false),
+	})
+	if err != nil {
+		t.Fatalf("NewPolicyService() got unexpected error: %v", err)
+	}
+	teamAToken := &PrincipalDto{Type: PrincipalTypeAPIToken, Name: "team-a-ci"}
+
+	tests := []struct {
+		name    string
+		cert    *X509CertificateDto
+		wantErr error
+	}{
+		{
+			name: "matching SANs",
+			cert: &X509CertificateDto{
+				CommonName: "other.example.invalid", SubjectAltNames: []string{"www.team-a.example.invalid"},
+			},
+		},
+		{
+			name: "not matching SANs",
+			cert: &X509CertificateDto{
+				CommonName: "www.team-a.example.invalid", SubjectAltNames: []string{"other.example.invalid"},
+			},
+			wantErr: ErrAccessDenied,
+		},
+		{
+			name: "matching common name without SANs",
+			cert: &X509CertificateDto{CommonName: "www.team-a.example.invalid"},
+		},
+		{
+			name:    "not matching common name without SANs",
+			cert:    &X509CertificateDto{CommonName: "other.example.invalid"},
+			wantErr: ErrAccessDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := policyService.AuthorizeCertificate(teamAToken, tt.cert, false); !errors.Is(err, tt.wantErr) {
+				t.Errorf("AuthorizeCertificate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyService_Update(t *testing.T) {
+	principal := &PrincipalDto{Type: PrincipalTypeAPIToken, Name: "team-a-ci"}
+	policyService, err := NewPolicyService(nil)
+	if err != nil {
+		t.Fatalf("NewPolicyService() got unexpected error: %v", err)
+	}
+
+	err = policyService.Update([]*PolicyDto{
+		NewPolicyDto("team-a", []string{"team-a-ci"}, nil, []string{"*.team-a.example.invalid"}, false),
+	})
+	if err != nil {
+		t.Fatalf("Update() got unexpected error: %v", err)
+	}
+	err = policyService.AuthorizeSubscription(principal, []string{"www.team-b.example.invalid"}, false)
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("AuthorizeSubscription() error = %v, wantErr %v", err, ErrAccessDenied)
+	}
+
+	// Invalid policies must not replace the current ones
+	invalidPolicies := [][]*PolicyDto{
+		{NewPolicyDto("", nil, nil, nil, false)},
+		{NewPolicyDto("team-a", nil, nil, nil, false), NewPolicyDto("team-a", nil, nil, nil, false)},
+		{NewPolicyDto("team-a", nil, nil, []string{"[.team-a.example.invalid"}, false)},
+	}
+	for _, policies := range invalidPolicies {
+		if err := policyService.Update(policies); err == nil {
+			t.Errorf("Update() expected error for invalid policies %v", policies)
+		}
+	}
+	err = policyService.AuthorizeSubscription(principal, []string{"www.team-a.example.invalid"}, false)
+	if err != nil {
+		t.Errorf("AuthorizeSubscription() got unexpected error: %v", err)
+	}
+}
+
+func TestX509CertificateSubscriptionService_Create_AccessDenied(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	// The subscription must not be created
+	subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+
+	policyService, err := NewPolicyService([]*PolicyDto{
+		NewPolicyDto("team-a", []string{"team-a-ci"}, nil, []string{"*.team-a.example.invalid"}, false),
+	})
+	if err != nil {
+		t.Fatalf("NewPolicyService() got unexpected error: %v", err)
+	}
+
+	_, err = NewX509CertificateSubscriptionService(subRepo, policyService, clockwork.NewFakeClock()).Create(
+		context.Background(),
+		&PrincipalDto{Type: PrincipalTypeAPIToken, Name: "team-a-ci"},
+		NewCreateX509CertificateSubscriptionDto([]string{"www.team-a.example.invalid"}, true),
+	)
+	if !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("Create() error = %v, wantErr %v", err, ErrAccessDenied)
+	}
+}
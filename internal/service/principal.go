@@ -0,0 +1,122 @@
+package service
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+)
+
+type PrincipalType string
+
+// Enum values for PrincipalType
+const (
+	PrincipalTypeAPIToken          PrincipalType = "api_token"
+	PrincipalTypeClientCertificate PrincipalType = "client_certificate"
+)
+
+type ClientCertificatePrincipalSource string
+
+// Enum values for ClientCertificatePrincipalSource
+const (
+	// ClientCertificatePrincipalSAN uses the first DNS name, URI or email address SAN, in this order.
+	ClientCertificatePrincipalSAN ClientCertificatePrincipalSource = "san"
+	// ClientCertificatePrincipalSubject uses the subject distinguished name, e.g. CN=team-a,O=Example.
+	ClientCertificatePrincipalSubject ClientCertificatePrincipalSource = "subject"
+)
+
+var ErrInvalidClientCertificate = errors.New("invalid client certificate")
+
+// PrincipalDto is the authenticated identity of a request, either an API token or a verified client certificate.
+// ID identifies the credential, i.e. the API token ID or the client certificate serial number, while Name is the
+// identity authorization rules refer to.
+type PrincipalDto struct {
+	Type   PrincipalType
+	ID     string
+	Name   string
+	Scopes []APITokenScope
+}
+
+// HasScope reports whether the principal has the scope. A nil principal has no scopes.
+func (p *PrincipalDto) HasScope(scope APITokenScope) bool {
+	if p == nil {
+		return false
+	}
+	return containsScope(p.Scopes, scope)
+}
+
+// Principal returns the principal authenticated by the API token.
+func (a *APITokenDto) Principal() *PrincipalDto {
+	return &PrincipalDto{
+		Type:   PrincipalTypeAPIToken,
+		ID:     a.ID.String(),
+		Name:   a.Name,
+		Scopes: a.Scopes,
+	}
+}
+
+// ClientCertificateAuthenticator maps verified client certificates to principals. The scopes of a principal are
+// configured by its name, principals without configured scopes are authenticated without any scopes.
+type ClientCertificateAuthenticator struct {
+	principalSource   ClientCertificatePrincipalSource
+	scopesByPrincipal map[string][]APITokenScope
+}
+
+func NewClientCertificateAuthenticator(
+	principalSource ClientCertificatePrincipalSource, scopesByPrincipal map[string][]APITokenScope,
+) (*ClientCertificateAuthenticator, error) {
+	switch principalSource {
+	case ClientCertificatePrincipalSAN, ClientCertificatePrincipalSubject:
+	default:
+		return nil, fmt.Errorf("unknown client certificate principal source %s", principalSource)
+	}
+	for principal, scopes := range scopesByPrincipal {
+		for _, scope := range scopes {
+			if !isValidAPITokenScope(scope) {
+				return nil, fmt.Errorf("%w: %s of client certificate principal %s", ErrInvalidAPITokenScope, scope, principal)
+			}
+		}
+	}
+	return &ClientCertificateAuthenticator{principalSource: principalSource, scopesByPrincipal: scopesByPrincipal}, nil
+}
+
+// Authenticate returns the principal of the client certificate. The certificate must already be verified, e.g. by the
+// TLS handshake. It returns ErrInvalidClientCertificate if the certificate lacks the configured principal source.
+func (c *ClientCertificateAuthenticator) Authenticate(cert *x509.Certificate) (*PrincipalDto, error) {
+	name := c.principalName(cert)
+	if name == "" {
+		return nil, fmt.Errorf("%w: no %s to use as principal", ErrInvalidClientCertificate, c.principalSource)
+	}
+
+	return &PrincipalDto{
+		Type:   PrincipalTypeClientCertificate,
+		ID:     cert.SerialNumber.Text(16),
+		Name:   name,
+		Scopes: c.scopesByPrincipal[name],
+	}, nil
+}
+
+func (c *ClientCertificateAuthenticator) principalName(cert *x509.Certificate) string {
+	if c.principalSource == ClientCertificatePrincipalSubject {
+		return cert.Subject.String()
+	}
+
+	switch {
+	case len(cert.DNSNames) != 0:
+		return cert.DNSNames[0]
+	case len(cert.URIs) != 0:
+		return cert.URIs[0].String()
+	case len(cert.EmailAddresses) != 0:
+		return cert.EmailAddresses[0]
+	default:
+		return ""
+	}
+}
+
+func containsScope(scopes []APITokenScope, scope APITokenScope) bool {
+	for _, containedScope := range scopes {
+		if containedScope == scope {
+			return true
+		}
+	}
+	return false
+}
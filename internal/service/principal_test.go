@@ -0,0 +1,108 @@
+package service
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestClientCertificateAuthenticator_Authenticate(t *testing.T) {
+	scopesByPrincipal := map[string][]APITokenScope{
+		"team-a.example.invalid":  {APITokenScopeUpdatesRead},
+		"CN=team-b,O=Example Org": {APITokenScopeImport},
+	}
+	tests := []struct {
+		name            string
+		principalSource ClientCertificatePrincipalSource
+		cert            *x509.Certificate
+		want            *PrincipalDto
+		wantErr         error
+	}{
+		{
+			name:            "DNS SAN with scopes",
+			principalSource: ClientCertificatePrincipalSAN,
+			cert: &x509.Certificate{
+				SerialNumber: big.NewInt(0xab12),
+				DNSNames:     []string{"team-a.example.invalid", "other.example.invalid"},
+				URIs:         []*url.URL{{Scheme: "spiffe", Host: "example.invalid", Path: "/team-a"}},
+			},
+			want: &PrincipalDto{
+				Type:   PrincipalTypeClientCertificate,
+				ID:     "ab12",
+				Name:   "team-a.example.invalid",
+				Scopes: []APITokenScope{APITokenScopeUpdatesRead},
+			},
+		},
+		{
+			name:            "URI SAN without scopes",
+			principalSource: ClientCertificatePrincipalSAN,
+			cert: &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				URIs:         []*url.URL{{Scheme: "spiffe", Host: "example.invalid", Path: "/team-a"}},
+			},
+			want: &PrincipalDto{
+				Type: PrincipalTypeClientCertificate,
+				ID:   "1",
+				Name: "spiffe://example.invalid/team-a",
+			},
+		},
+		{
+			name:            "no SAN",
+			principalSource: ClientCertificatePrincipalSAN,
+			cert: &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				Subject:      pkix.Name{CommonName: "team-a"},
+			},
+			wantErr: ErrInvalidClientCertificate,
+		},
+		{
+			name:            "subject",
+			principalSource: ClientCertificatePrincipalSubject,
+			cert: &x509.Certificate{
+				SerialNumber: big.NewInt(2),
+				Subject:      pkix.Name{CommonName: "team-b", Organization: []string{"Example Org"}},
+				DNSNames:     []string{"team-a.example.invalid"},
+			},
+			want: &PrincipalDto{
+				Type:   PrincipalTypeClientCertificate,
+				ID:     "2",
+				Name:   "CN=team-b,O=Example Org",
+				Scopes: []APITokenScope{APITokenScopeImport},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authenticator, err := NewClientCertificateAuthenticator(tt.principalSource, scopesByPrincipal)
+			if err != nil {
+				t.Fatalf("NewClientCertificateAuthenticator() got unexpected error: %v", err)
+			}
+
+			got, err := authenticator.Authenticate(tt.cert)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Authenticate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClientCertificateAuthenticator(t *testing.T) {
+	_, err := NewClientCertificateAuthenticator("issuer", nil)
+	if err == nil {
+		t.Errorf("NewClientCertificateAuthenticator() expected error for unknown principal source")
+	}
+
+	_, err = NewClientCertificateAuthenticator(ClientCertificatePrincipalSAN, map[string][]APITokenScope{
+		"team-a.example.invalid": {"unknown"},
+	})
+	if !errors.Is(err, ErrInvalidAPITokenScope) {
+		t.Errorf("NewClientCertificateAuthenticator() error = %v, want %v", err, ErrInvalidAPITokenScope)
+	}
+}
@@ -0,0 +1,160 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/encryption"
+)
+
+var (
+	ErrSealAlreadyInitialized  = errors.New("the seal is already initialized")
+	ErrShamirSealNotConfigured = errors.New("the server is not configured to use the shamir seal")
+)
+
+type SealStatusDto struct {
+	Initialized     bool `json:"initialized" toml:"initialized" yaml:"initialized"`
+	Sealed          bool `json:"sealed" toml:"sealed" yaml:"sealed"`
+	Progress        int  `json:"progress" toml:"progress" yaml:"progress"`
+	SecretShares    int  `json:"secret_shares" toml:"secret_shares" yaml:"secret_shares"`
+	SecretThreshold int  `json:"secret_threshold" toml:"secret_threshold" yaml:"secret_threshold"`
+}
+
+type InitSealDto struct {
+	// UnsealKeys are base64 encoded. They are only returned once and never persisted.
+	UnsealKeys      []string
+	SecretShares    int
+	SecretThreshold int
+	MasterKeyID     string
+}
+
+// SealService initializes the shamir seal and unseals it with unseal keys submitted by operators.
+// The seal is nil if the master key is configured directly, in which case the server is never sealed.
+type SealService struct {
+	sealConfigRepo repository.SealConfigurationRepository
+	seal           *encryption.ShamirSeal
+	clock          clockwork.Clock
+}
+
+func NewSealService(
+	sealConfigRepo repository.SealConfigurationRepository, seal *encryption.ShamirSeal, clock clockwork.Clock,
+) *SealService {
+	return &SealService{sealConfigRepo: sealConfigRepo, seal: seal, clock: clock}
+}
+
+// Init generates a new master key, splits it into secretShares unseal keys and persists the seal configuration.
+func (s *SealService) Init(ctx context.Context, secretShares int, secretThreshold int) (*InitSealDto, error) {
+	_, exists, err := s.sealConfigRepo.Find(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load seal configuration: %w", err)
+	}
+	if exists {
+		return nil, ErrSealAlreadyInitialized
+	}
+
+	sealConfig, unsealKeys, err := encryption.InitShamirSeal(secretShares, secretThreshold)
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.sealConfigRepo.Create(ctx, repository.NewSealConfigurationDao(
+		sealConfig.SecretShares,
+		sealConfig.SecretThreshold,
+		sealConfig.MasterKeyID,
+		s.clock.Now(),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("unable to persist seal configuration: %w", err)
+	}
+
+	encodedUnsealKeys := make([]string, len(unsealKeys))
+	for idx, unsealKey := range unsealKeys {
+		encodedUnsealKeys[idx] = base64.StdEncoding.EncodeToString(unsealKey)
+	}
+	return &InitSealDto{
+		UnsealKeys:      encodedUnsealKeys,
+		SecretShares:    sealConfig.SecretShares,
+		SecretThreshold: sealConfig.SecretThreshold,
+		MasterKeyID:     sealConfig.MasterKeyID,
+	}, nil
+}
+
+func (s *SealService) Status(ctx context.Context) (*SealStatusDto, error) {
+	if s.seal == nil {
+		return &SealStatusDto{Initialized: true, Sealed: false}, nil
+	}
+	if err := s.loadSealConfig(ctx); err != nil && !errors.Is(err, encryption.ErrSealNotInitialized) {
+		return nil, err
+	}
+	return sealStatusToDto(s.seal.Status()), nil
+}
+
+// Unseal submits a base64 encoded unseal key. The returned status reports whether the seal is still sealed.
+func (s *SealService) Unseal(ctx context.Context, unsealKey string) (*SealStatusDto, error) {
+	if s.seal == nil {
+		return nil, ErrShamirSealNotConfigured
+	}
+	if err := s.loadSealConfig(ctx); err != nil {
+		return nil, err
+	}
+
+	decodedUnsealKey, err := base64.StdEncoding.DecodeString(unsealKey)
+	if err != nil {
+		return nil, encryption.ErrInvalidUnsealKeyShare
+	}
+	status, err := s.seal.Unseal(decodedUnsealKey)
+	if err != nil {
+		return nil, err
+	}
+	return sealStatusToDto(status), nil
+}
+
+// ResetUnsealProgress discards all unseal keys submitted since the last unseal attempt.
+func (s *SealService) ResetUnsealProgress(ctx context.Context) (*SealStatusDto, error) {
+	if s.seal == nil {
+		return nil, ErrShamirSealNotConfigured
+	}
+	if err := s.loadSealConfig(ctx); err != nil {
+		return nil, err
+	}
+	return sealStatusToDto(s.seal.ResetUnsealProgress()), nil
+}
+
+// loadSealConfig initializes the seal with the persisted configuration. The configuration is loaded lazily,
+// because the seal may get initialized by an operator while the server is already running.
+func (s *SealService) loadSealConfig(ctx context.Context) error {
+	if s.seal.Status().Initialized {
+		return nil
+	}
+
+	sealConfig, exists, err := s.sealConfigRepo.Find(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to load seal configuration: %w", err)
+	}
+	if !exists {
+		return encryption.ErrSealNotInitialized
+	}
+
+	err = s.seal.Initialize(&encryption.SealConfig{
+		SecretShares:    sealConfig.SecretShares,
+		SecretThreshold: sealConfig.SecretThreshold,
+		MasterKeyID:     sealConfig.MasterKeyID,
+	})
+	// Another request may have initialized the seal concurrently
+	if err != nil && !s.seal.Status().Initialized {
+		return err
+	}
+	return nil
+}
+
+func sealStatusToDto(status encryption.SealStatus) *SealStatusDto {
+	return &SealStatusDto{
+		Initialized:     status.Initialized,
+		Sealed:          status.Sealed,
+		Progress:        status.Progress,
+		SecretShares:    status.SecretShares,
+		SecretThreshold: status.SecretThreshold,
+	}
+}
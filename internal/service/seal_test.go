@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/encryption"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"testing"
+)
+
+func TestSealService_Init(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+
+	t.Run("initialize seal", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		sealConfigRepo := mock_repository.NewMockSealConfigurationRepository(ctrl)
+		sealConfigRepo.EXPECT().Find(gomock.Any()).Return(nil, false, nil)
+		sealConfigRepo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, sealConfig *repository.SealConfigurationDao) (*repository.SealConfigurationDao, error) {
+				if sealConfig.SecretShares != 5 || sealConfig.SecretThreshold != 3 || sealConfig.MasterKeyID == "" {
+					t.Errorf("Create() got unexpected seal configuration %+v", sealConfig)
+				}
+				return sealConfig, nil
+			})
+
+		initResult, err := NewSealService(sealConfigRepo, nil, fakeClock).Init(ctx, 5, 3)
+		if err != nil {
+			t.Fatalf("Init() got unexpected error: %v", err)
+		}
+		if len(initResult.UnsealKeys) != 5 {
+			t.Errorf("Init() returned %d unseal keys, want 5", len(initResult.UnsealKeys))
+		}
+	})
+	t.Run("already initialized", func(t *testing.T) {
+		ctrl := gomock.NewController(t)
+		sealConfigRepo := mock_repository.NewMockSealConfigurationRepository(ctrl)
+		sealConfigRepo.EXPECT().Find(gomock.Any()).
+			Return(repository.NewSealConfigurationDao(5, 3, "id", fakeClock.Now()), true, nil)
+
+		if _, err := NewSealService(sealConfigRepo, nil, fakeClock).Init(ctx, 5, 3); !errors.Is(err, ErrSealAlreadyInitialized) {
+			t.Errorf("Init() error = %v, want %v", err, ErrSealAlreadyInitialized)
+		}
+	})
+}
+
+func TestSealService_Unseal(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+
+	var persistedSealConfig *repository.SealConfigurationDao
+	sealConfigRepo := mock_repository.NewMockSealConfigurationRepository(ctrl)
+	sealConfigRepo.EXPECT().Find(gomock.Any()).DoAndReturn(
+		func(_ context.Context) (*repository.SealConfigurationDao, bool, error) {
+			return persistedSealConfig, persistedSealConfig != nil, nil
+		}).AnyTimes()
+	sealConfigRepo.EXPECT().Create(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, sealConfig *repository.SealConfigurationDao) (*repository.SealConfigurationDao, error) {
+			persistedSealConfig = sealConfig
+			return sealConfig, nil
+		})
+
+	seal := encryption.NewShamirSeal()
+	service := NewSealService(sealConfigRepo, seal, fakeClock)
+
+	status, err := service.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() got unexpected error: %v", err)
+	}
+	if status.Initialized || !status.Sealed {
+		t.Errorf("Status() = %+v, want sealed and not initialized", status)
+	}
+	if _, err := service.Unseal(ctx, "key"); !errors.Is(err, encryption.ErrSealNotInitialized) {
+		t.Errorf("Unseal() error = %v, want %v", err, encryption.ErrSealNotInitialized)
+	}
+
+	// The seal gets initialized while the server is already running
+	initResult, err := service.Init(ctx, 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.Unseal(ctx, "not base64"); !errors.Is(err, encryption.ErrInvalidUnsealKeyShare) {
+		t.Errorf("Unseal() error = %v, want %v", err, encryption.ErrInvalidUnsealKeyShare)
+	}
+	status, err = service.Unseal(ctx, initResult.UnsealKeys[1])
+	if err != nil {
+		t.Fatalf("Unseal() got unexpected error: %v", err)
+	}
+	if !status.Initialized || !status.Sealed || status.Progress != 1 {
+		t.Errorf("Unseal() = %+v, want sealed with progress 1", status)
+	}
+	status, err = service.Unseal(ctx, initResult.UnsealKeys[2])
+	if err != nil {
+		t.Fatalf("Unseal() got unexpected error: %v", err)
+	}
+	if status.Sealed {
+		t.Errorf("Unseal() = %+v, want unsealed", status)
+	}
+	if _, err := seal.Encrypt([]byte("private key der"), nil); err != nil {
+		t.Errorf("Encrypt() got unexpected error after unsealing: %v", err)
+	}
+}
+
+func TestSealService_NotConfigured(t *testing.T) {
+	service := NewSealService(nil, nil, clockwork.NewFakeClock())
+
+	status, err := service.Status(context.Background())
+	if err != nil {
+		t.Fatalf("Status() got unexpected error: %v", err)
+	}
+	if status.Sealed {
+		t.Errorf("Status() = %+v, want unsealed without shamir seal", status)
+	}
+	if _, err := service.Unseal(context.Background(), "key"); !errors.Is(err, ErrShamirSealNotConfigured) {
+		t.Errorf("Unseal() error = %v, want %v", err, ErrShamirSealNotConfigured)
+	}
+}
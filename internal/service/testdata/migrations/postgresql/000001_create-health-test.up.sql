@@ -0,0 +1 @@
+CREATE TABLE health_test (id uuid PRIMARY KEY);
@@ -0,0 +1 @@
+ALTER TABLE health_test DROP COLUMN name;
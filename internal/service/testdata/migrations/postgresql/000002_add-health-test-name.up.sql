@@ -0,0 +1 @@
+ALTER TABLE health_test ADD COLUMN name varchar(255);
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// WebhookEventSubscriptionUpdated is delivered when imported certificates become the latest matches of a subscription.
+const WebhookEventSubscriptionUpdated = "x509_certificate_subscription.updated"
+
+const (
+	MinWebhookSecretLength          = 16
+	DefaultWebhookDeliveryListLimit = 50
+	MaxWebhookDeliveryListLimit     = 500
+)
+
+var (
+	ErrInvalidWebhook                = errors.New("invalid webhook")
+	ErrInvalidWebhookDeliveryListing = errors.New("invalid webhook delivery listing")
+)
+
+// WebhookDto is the webhook of a subscription. The secret is never returned after it was set.
+type WebhookDto struct {
+	SubscriptionID uuid.UUID
+	URL            string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+type WebhookDeliveryDto struct {
+	ID             uuid.UUID
+	SubscriptionID uuid.UUID
+	EventType      string
+	Status         string
+	Attempts       int
+	NextAttemptAt  *time.Time
+	LastAttemptAt  *time.Time
+	LastStatusCode *int
+	LastError      *string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+// WebhookDeliveryPageDto is a page of deliveries, newest first. NextCursor is empty on the last page.
+type WebhookDeliveryPageDto struct {
+	Deliveries []*WebhookDeliveryDto
+	NextCursor string
+}
+
+// webhookDeliveryCursor is the position after the last delivery of a page. It is opaque to clients and contains the
+// sort key, so listing continues even if that delivery was cleaned up meanwhile.
+type webhookDeliveryCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uuid.UUID `json:"i"`
+}
+
+// WebhookEventDto is the payload delivered to webhooks. It only references certificates and private keys by ID,
+// they have to be retrieved through the authenticated API.
+type WebhookEventDto struct {
+	ID             uuid.UUID   `json:"id"`
+	Type           string      `json:"type"`
+	CreatedAt      time.Time   `json:"created_at"`
+	SubscriptionID uuid.UUID   `json:"subscription_id"`
+	CertificateIDs []uuid.UUID `json:"certificate_ids"`
+	PrivateKeyIDs  []uuid.UUID `json:"private_key_ids"`
+}
+
+type WebhookService struct {
+	webhookRepo  repository.WebhookRepository
+	deliveryRepo repository.WebhookDeliveryRepository
+	certRepo     repository.X509CertificateRepository
+	subService   *X509CertificateSubscriptionService
+	clock        clockwork.Clock
+}
+
+func NewWebhookService(
+	webhookRepo repository.WebhookRepository, deliveryRepo repository.WebhookDeliveryRepository,
+	certRepo repository.X509CertificateRepository, subService *X509CertificateSubscriptionService, clock clockwork.Clock,
+) *WebhookService {
+	return &WebhookService{
+		webhookRepo: webhookRepo, deliveryRepo: deliveryRepo, certRepo: certRepo, subService: subService, clock: clock,
+	}
+}
+
+// Save sets the webhook of the subscription, replacing an existing one. It returns ErrInvalidWebhook for URLs which
+// aren't absolute HTTP(S) URLs or secrets shorter than MinWebhookSecretLength and ErrAccessDenied if the policies
+// don't allow the subscription for the principal. Secrets are encrypted, so it fails with encryption.ErrSealed while
+// the vault is sealed, like Find.
+func (w *WebhookService) Save(
+	ctx context.Context, principal *PrincipalDto, subID uuid.UUID, webhookURL string, secret string,
+) (webhook *WebhookDto, exists bool, err error) {
+	parsedURL, err := url.Parse(webhookURL)
+	if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return nil, false, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if len(secret) < MinWebhookSecretLength {
+		return nil, false, fmt.Errorf(
+			"%w: secret must be at least %d characters long", ErrInvalidWebhook, MinWebhookSecretLength,
+		)
+	}
+
+	exists, err = w.subService.Authorize(ctx, principal, subID)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+
+	now := w.clock.Now()
+	savedWebhook, err := w.webhookRepo.Save(ctx, repository.NewWebhookDao(subID, webhookURL, secret, now, now))
+	if err != nil {
+		return nil, true, err
+	}
+	return webhookDaoToDto(savedWebhook), true, nil
+}
+
+// Find returns the webhook of the subscription. exists is false if either the subscription or its webhook doesn't
+// exist.
+func (w *WebhookService) Find(
+	ctx context.Context, principal *PrincipalDto, subID uuid.UUID,
+) (webhook *WebhookDto, exists bool, err error) {
+	exists, err = w.subService.Authorize(ctx, principal, subID)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+
+	foundWebhook, exists, err := w.webhookRepo.FindBySubscriptionID(ctx, subID)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return webhookDaoToDto(foundWebhook), true, nil
+}
+
+// Delete removes the webhook of the subscription. Pending deliveries of the subscription are dead on their next
+// attempt.
+func (w *WebhookService) Delete(
+	ctx context.Context, principal *PrincipalDto, subID uuid.UUID,
+) (rowsDeleted int64, err error) {
+	exists, err := w.subService.Authorize(ctx, principal, subID)
+	if err != nil || !exists {
+		return 0, err
+	}
+	return w.webhookRepo.Delete(ctx, subID)
+}
+
+// ListDeliveries returns a page of the delivery history of the subscription. The cursor is the NextCursor of the
+// previous page, limit defaults to DefaultWebhookDeliveryListLimit. It returns ErrInvalidWebhookDeliveryListing for
+// invalid limits or cursors.
+func (w *WebhookService) ListDeliveries(
+	ctx context.Context, principal *PrincipalDto, subID uuid.UUID, cursor string, limit int,
+) (page *WebhookDeliveryPageDto, exists bool, err error) {
+	switch {
+	case limit == 0:
+		limit = DefaultWebhookDeliveryListLimit
+	case limit < 0 || limit > MaxWebhookDeliveryListLimit:
+		return nil, false, fmt.Errorf(
+			"%w: limit must be between 1 and %d", ErrInvalidWebhookDeliveryListing, MaxWebhookDeliveryListLimit,
+		)
+	}
+	var after *repository.WebhookDeliveryPosition
+	if cursor != "" {
+		decodedCursor, err := decodeWebhookDeliveryCursor(cursor)
+		if err != nil {
+			return nil, false, err
+		}
+		after = &repository.WebhookDeliveryPosition{CreatedAt: decodedCursor.CreatedAt, ID: decodedCursor.ID}
+	}
+
+	exists, err = w.subService.Authorize(ctx, principal, subID)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+
+	// Fetch one more delivery to know if there is a next page
+	fetchedDeliveries, err := w.deliveryRepo.FindBySubscriptionID(ctx, subID, after, limit+1)
+	if err != nil {
+		return nil, true, err
+	}
+
+	page = &WebhookDeliveryPageDto{}
+	if len(fetchedDeliveries) > limit {
+		fetchedDeliveries = fetchedDeliveries[:limit]
+		nextCursor, err := encodeWebhookDeliveryCursor(&webhookDeliveryCursor{
+			CreatedAt: fetchedDeliveries[limit-1].CreatedAt,
+			ID:        fetchedDeliveries[limit-1].ID,
+		})
+		if err != nil {
+			return nil, true, err
+		}
+		page.NextCursor = nextCursor
+	}
+	page.Deliveries = make([]*WebhookDeliveryDto, len(fetchedDeliveries))
+	for i, delivery := range fetchedDeliveries {
+		page.Deliveries[i] = webhookDeliveryDaoToDto(delivery)
+	}
+	return page, true, nil
+}
+
+func encodeWebhookDeliveryCursor(cursor *webhookDeliveryCursor) (string, error) {
+	cursorJson, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cursorJson), nil
+}
+
+func decodeWebhookDeliveryCursor(encodedCursor string) (*webhookDeliveryCursor, error) {
+	cursorJson, err := base64.RawURLEncoding.DecodeString(encodedCursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidWebhookDeliveryListing)
+	}
+	var cursor webhookDeliveryCursor
+	if err := json.Unmarshal(cursorJson, &cursor); err != nil || cursor.ID == uuid.Nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidWebhookDeliveryListing)
+	}
+	return &cursor, nil
+}
+
+// EnqueueCertificateEvents creates a pending delivery for every subscription with a webhook whose latest matching
+// certificates include one of the changed certs, i.e. certificates which were created or got their parent linked, or
+// one of the privKeyLinkedCerts if the subscription includes private keys. It is called within the transaction
+// persisting the certs, so deliveries only exist if the certs do.
+func (w *WebhookService) EnqueueCertificateEvents(
+	ctx context.Context, changedCerts []*repository.X509CertificateDao,
+	privKeyLinkedCerts []*repository.X509CertificateDao,
+) error {
+	if len(changedCerts) == 0 && len(privKeyLinkedCerts) == 0 {
+		return nil
+	}
+	subIDs, err := w.webhookRepo.FindSubscriptionIDs(ctx)
+	if err != nil || len(subIDs) == 0 {
+		return err
+	}
+
+	subs, err := w.subService.FindByIDs(ctx, subIDs)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		certsByID := make(map[uuid.UUID]*repository.X509CertificateDao)
+		for _, cert := range changedCerts {
+			if certCoversSANs(cert, sub.SANs) {
+				certsByID[cert.ID] = cert
+			}
+		}
+		if sub.IncludePrivateKey {
+			for _, cert := range privKeyLinkedCerts {
+				if certCoversSANs(cert, sub.SANs) {
+					certsByID[cert.ID] = cert
+				}
+			}
+		}
+		// Only subscriptions matching a changed certificate are queried, as the import holds the lock of the change
+		// sequence until it is committed
+		if len(certsByID) == 0 {
+			continue
+		}
+
+		latestCerts, err := w.certRepo.FindLatestActiveBySANsAndCreatedAtAfter(ctx, sub.SANs, time.Time{})
+		if err != nil {
+			return err
+		}
+
+		event := &WebhookEventDto{
+			ID:             uuid.New(),
+			Type:           WebhookEventSubscriptionUpdated,
+			CreatedAt:      w.clock.Now(),
+			SubscriptionID: sub.ID,
+			CertificateIDs: []uuid.UUID{},
+			PrivateKeyIDs:  []uuid.UUID{},
+		}
+		for _, latestCert := range latestCerts {
+			if _, ok := certsByID[latestCert.ID]; !ok {
+				continue
+			}
+			event.CertificateIDs = append(event.CertificateIDs, latestCert.ID)
+			if sub.IncludePrivateKey && latestCert.PrivateKeyID != nil {
+				event.PrivateKeyIDs = append(event.PrivateKeyIDs, *latestCert.PrivateKeyID)
+			}
+		}
+		if len(event.CertificateIDs) == 0 {
+			continue
+		}
+
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		nextAttemptAt := event.CreatedAt
+		_, err = w.deliveryRepo.Create(ctx, repository.NewWebhookDeliveryDao(
+			event.ID, sub.ID, event.Type, payload, repository.WebhookDeliveryStatusPending, 0, &nextAttemptAt,
+			nil, nil, nil, event.CreatedAt, nil,
+		))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// certCoversSANs reports whether the SANs and common name of the cert cover all subjectAltNames, like the latest
+// matching certificates of subscriptions are found. Wildcards of the cert, e.g. *.example.com, match any characters.
+func certCoversSANs(cert *repository.X509CertificateDao, subjectAltNames []string) bool {
+	certNames := append([]string{cert.CommonName}, cert.SubjectAltNames...)
+outerSANLoop:
+	for _, subjectAltName := range subjectAltNames {
+		for _, certName := range certNames {
+			if certName == subjectAltName || likeMatch(strings.ReplaceAll(certName, "*", "%"), subjectAltName) {
+				continue outerSANLoop
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// likeMatch reports whether the value matches the SQL LIKE pattern with $ as escape character, where % matches any
+// characters and _ a single character.
+func likeMatch(pattern string, value string) bool {
+	var expr strings.Builder
+	expr.WriteString("(?s)^")
+	escaped := false
+	for _, char := range pattern {
+		switch {
+		case escaped:
+			expr.WriteString(regexp.QuoteMeta(string(char)))
+			escaped = false
+		case char == '$':
+			escaped = true
+		case char == '%':
+			expr.WriteString(".*")
+		case char == '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(char)))
+		}
+	}
+	expr.WriteString("$")
+	matched, _ := regexp.MatchString(expr.String(), value)
+	return matched
+}
+
+func webhookDaoToDto(dao *repository.WebhookDao) *WebhookDto {
+	return &WebhookDto{
+		SubscriptionID: dao.SubscriptionID,
+		URL:            dao.URL,
+		CreatedAt:      dao.CreatedAt,
+		UpdatedAt:      dao.UpdatedAt,
+	}
+}
+
+func webhookDeliveryDaoToDto(dao *repository.WebhookDeliveryDao) *WebhookDeliveryDto {
+	return &WebhookDeliveryDto{
+		ID:             dao.ID,
+		SubscriptionID: dao.SubscriptionID,
+		EventType:      dao.EventType,
+		Status:         string(dao.Status),
+		Attempts:       dao.Attempts,
+		NextAttemptAt:  dao.NextAttemptAt,
+		LastAttemptAt:  dao.LastAttemptAt,
+		LastStatusCode: dao.LastStatusCode,
+		LastError:      dao.LastError,
+		CreatedAt:      dao.CreatedAt,
+		DeliveredAt:    dao.DeliveredAt,
+	}
+}
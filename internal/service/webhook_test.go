@@ -0,0 +1,230 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"github.com/pki-vault/server/internal/testutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWebhookService_Save(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	policyService, err := NewPolicyService(nil)
+	if err != nil {
+		t.Fatalf("NewPolicyService() got unexpected error: %v", err)
+	}
+	subID := uuid.MustParse("1e3c5a7b-9d2f-4e6a-8c1b-3d5f7a9c2e4b")
+
+	tests := []struct {
+		name    string
+		url     string
+		secret  string
+		wantErr error
+	}{
+		{name: "valid webhook", url: "https://hooks.example.invalid/pki", secret: "0123456789abcdef"},
+		{name: "relative url", url: "/pki", secret: "0123456789abcdef", wantErr: ErrInvalidWebhook},
+		{name: "other scheme", url: "ftp://hooks.example.invalid/pki", secret: "0123456789abcdef", wantErr: ErrInvalidWebhook},
+		{name: "too short secret", url: "https://hooks.example.invalid/pki", secret: "secret", wantErr: ErrInvalidWebhook},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+			webhookRepo := mock_repository.NewMockWebhookRepository(ctrl)
+			if tt.wantErr == nil {
+				subRepo.EXPECT().FindByID(gomock.Any(), subID).Return(
+					repository.NewX509CertificateSubscriptionDao(
+						subID, []string{"www.example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+					), true, nil,
+				)
+				webhookRepo.EXPECT().Save(gomock.Any(), gomock.Any()).DoAndReturn(
+					func(_ context.Context, webhook *repository.WebhookDao) (*repository.WebhookDao, error) {
+						return webhook, nil
+					},
+				)
+			}
+
+			service := NewWebhookService(
+				webhookRepo, nil, nil, NewX509CertificateSubscriptionService(subRepo, policyService, fakeClock), fakeClock,
+			)
+			got, exists, err := service.Save(ctx, nil, subID, tt.url, tt.secret)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Save() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			want := &WebhookDto{SubscriptionID: subID, URL: tt.url, CreatedAt: fakeClock.Now(), UpdatedAt: fakeClock.Now()}
+			if !exists || !reflect.DeepEqual(got, want) {
+				t.Errorf("Save() = %+v, %v, want %+v, true", got, exists, want)
+			}
+		})
+	}
+}
+
+func TestWebhookService_EnqueueCertificateEvents(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	webhookRepo := mock_repository.NewMockWebhookRepository(ctrl)
+	deliveryRepo := mock_repository.NewMockWebhookDeliveryRepository(ctrl)
+	certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+	subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+
+	withKeySub := repository.NewX509CertificateSubscriptionDao(
+		uuid.MustParse("8a2c4e6f-1b3d-4f5a-9c7e-2b4d6f8a1c3e"), []string{"with-key.example.invalid"}, true,
+		fakeClock.Now(), fakeClock.Now(),
+	)
+	withoutKeySub := repository.NewX509CertificateSubscriptionDao(
+		uuid.MustParse("1d3f5a7c-9e2b-4d6f-8a1c-3e5b7d9f2a4c"), []string{"with-key.example.invalid"}, false,
+		fakeClock.Now(), fakeClock.Now(),
+	)
+	wildcardSub := repository.NewX509CertificateSubscriptionDao(
+		uuid.MustParse("5e7a9c2d-4f6b-4a8c-9e1d-3f5a7c9e2b4d"), []string{"www.wildcard.example.invalid"}, false,
+		fakeClock.Now(), fakeClock.Now(),
+	)
+	unchangedSub := repository.NewX509CertificateSubscriptionDao(
+		uuid.MustParse("4f6a8c1e-3b5d-4e7f-a9c2-6d8f1a3c5e7b"), []string{"unchanged.example.invalid"}, true,
+		fakeClock.Now(), fakeClock.Now(),
+	)
+	// An existing certificate whose private key was imported
+	keyLinkedCert := repository.NewX509CertificateDao(
+		uuid.MustParse("6c8e1a3b-5d7f-4a9c-b2e4-8f1a3c5e7d9b"), "with-key.example.invalid", nil,
+		nil, nil, nil, nil, nil, nil,
+		testutil.Ptr(uuid.MustParse("9e1b3d5f-7a2c-4e6b-8d1f-3a5c7e9b2d4f")),
+		fakeClock.Now(), fakeClock.Now().Add(24*time.Hour), fakeClock.Now(),
+	)
+	// An existing certificate whose parent was imported
+	parentLinkedCert := repository.NewX509CertificateDao(
+		uuid.MustParse("7b9d2f4a-6c8e-4b1d-a3f5-7c9e2b4d6f8a"), "wildcard.example.invalid",
+		[]string{"*.wildcard.example.invalid"}, nil, nil, nil, nil, nil,
+		testutil.Ptr(uuid.MustParse("3c5e7a9b-2d4f-4c6e-8a1b-5d7f9a2c4e6b")), nil,
+		fakeClock.Now(), fakeClock.Now().Add(24*time.Hour), fakeClock.Now(),
+	)
+
+	subIDs := []uuid.UUID{withKeySub.ID, withoutKeySub.ID, wildcardSub.ID, unchangedSub.ID}
+	webhookRepo.EXPECT().FindSubscriptionIDs(gomock.Any()).Return(subIDs, nil)
+	subRepo.EXPECT().FindByIDs(gomock.Any(), subIDs).Return(
+		[]*repository.X509CertificateSubscriptionDao{withKeySub, withoutKeySub, wildcardSub, unchangedSub}, nil,
+	)
+	// Only the subscriptions matching a changed certificate are queried, private keys only change subscriptions
+	// including them
+	certRepo.EXPECT().FindLatestActiveBySANsAndCreatedAtAfter(gomock.Any(), withKeySub.SubjectAltNames, time.Time{}).
+		Return([]*repository.X509CertificateDao{keyLinkedCert}, nil)
+	certRepo.EXPECT().FindLatestActiveBySANsAndCreatedAtAfter(gomock.Any(), wildcardSub.SubjectAltNames, time.Time{}).
+		Return([]*repository.X509CertificateDao{parentLinkedCert}, nil)
+
+	wantEvents := map[uuid.UUID]WebhookEventDto{
+		withKeySub.ID: {
+			Type:           WebhookEventSubscriptionUpdated,
+			CreatedAt:      fakeClock.Now(),
+			SubscriptionID: withKeySub.ID,
+			CertificateIDs: []uuid.UUID{keyLinkedCert.ID},
+			PrivateKeyIDs:  []uuid.UUID{*keyLinkedCert.PrivateKeyID},
+		},
+		wildcardSub.ID: {
+			Type:           WebhookEventSubscriptionUpdated,
+			CreatedAt:      fakeClock.Now(),
+			SubscriptionID: wildcardSub.ID,
+			CertificateIDs: []uuid.UUID{parentLinkedCert.ID},
+			PrivateKeyIDs:  []uuid.UUID{},
+		},
+	}
+	deliveryRepo.EXPECT().Create(gomock.Any(), gomock.Any()).Times(len(wantEvents)).DoAndReturn(
+		func(_ context.Context, delivery *repository.WebhookDeliveryDao) (*repository.WebhookDeliveryDao, error) {
+			wantEvent, ok := wantEvents[delivery.SubscriptionID]
+			if !ok || delivery.Status != repository.WebhookDeliveryStatusPending {
+				t.Fatalf("Create() got unexpected delivery %+v", delivery)
+			}
+			var event WebhookEventDto
+			if err := json.Unmarshal(delivery.Payload, &event); err != nil {
+				t.Fatalf("Create() got undecodable payload: %v", err)
+			}
+			wantEvent.ID = delivery.ID
+			if !event.CreatedAt.Equal(wantEvent.CreatedAt) {
+				t.Errorf("Create() event created at = %v, want %v", event.CreatedAt, wantEvent.CreatedAt)
+			}
+			event.CreatedAt = wantEvent.CreatedAt
+			if !reflect.DeepEqual(event, wantEvent) {
+				t.Errorf("Create() event = %+v, want %+v", event, wantEvent)
+			}
+			return delivery, nil
+		},
+	)
+
+	service := NewWebhookService(
+		webhookRepo, deliveryRepo, certRepo, NewX509CertificateSubscriptionService(subRepo, nil, fakeClock), fakeClock,
+	)
+	err := service.EnqueueCertificateEvents(
+		ctx, []*repository.X509CertificateDao{parentLinkedCert}, []*repository.X509CertificateDao{keyLinkedCert},
+	)
+	if err != nil {
+		t.Fatalf("EnqueueCertificateEvents() got unexpected error: %v", err)
+	}
+}
+
+func TestWebhookService_ListDeliveries(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+	deliveryRepo := mock_repository.NewMockWebhookDeliveryRepository(ctrl)
+	policyService, err := NewPolicyService(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewWebhookService(
+		nil, deliveryRepo, nil, NewX509CertificateSubscriptionService(subRepo, policyService, fakeClock), fakeClock,
+	)
+
+	sub := repository.NewX509CertificateSubscriptionDao(
+		uuid.New(), []string{"example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+	)
+	subRepo.EXPECT().FindByID(gomock.Any(), sub.ID).Return(sub, true, nil).AnyTimes()
+	deliveries := make([]*repository.WebhookDeliveryDao, 3)
+	for i := range deliveries {
+		deliveries[i] = repository.NewWebhookDeliveryDao(
+			uuid.New(), sub.ID, WebhookEventSubscriptionUpdated, []byte(`{}`), repository.WebhookDeliveryStatusPending,
+			0, testutil.Ptr(fakeClock.Now()), nil, nil, nil, fakeClock.Now().Add(-time.Duration(i)*time.Minute), nil,
+		)
+	}
+
+	// The first page has a next page, so one more delivery than the limit is fetched
+	deliveryRepo.EXPECT().FindBySubscriptionID(gomock.Any(), sub.ID, nil, 3).Return(deliveries, nil)
+	firstPage, exists, err := service.ListDeliveries(ctx, nil, sub.ID, "", 2)
+	if err != nil || !exists {
+		t.Fatalf("ListDeliveries() = exists %v, error %v, want existing page", exists, err)
+	}
+	if len(firstPage.Deliveries) != 2 || firstPage.NextCursor == "" {
+		t.Fatalf("ListDeliveries() = %d deliveries with next cursor %q, want 2 deliveries with next cursor",
+			len(firstPage.Deliveries), firstPage.NextCursor)
+	}
+
+	// The cursor continues after the position of the last delivery of the previous page, even if it was cleaned up.
+	// It carries the creation time in UTC without monotonic clock reading.
+	deliveryRepo.EXPECT().FindBySubscriptionID(gomock.Any(), sub.ID, &repository.WebhookDeliveryPosition{
+		CreatedAt: deliveries[1].CreatedAt.UTC(), ID: deliveries[1].ID,
+	}, 3).Return(deliveries[2:], nil)
+	lastPage, _, err := service.ListDeliveries(ctx, nil, sub.ID, firstPage.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("ListDeliveries() got unexpected error: %v", err)
+	}
+	if len(lastPage.Deliveries) != 1 || lastPage.NextCursor != "" {
+		t.Errorf("ListDeliveries() = %d deliveries with next cursor %q, want 1 delivery without next cursor",
+			len(lastPage.Deliveries), lastPage.NextCursor)
+	}
+
+	_, _, err = service.ListDeliveries(ctx, nil, sub.ID, "not-a-cursor!", 2)
+	if !errors.Is(err, ErrInvalidWebhookDeliveryListing) {
+		t.Errorf("ListDeliveries() error = %v, wantErr %v", err, ErrInvalidWebhookDeliveryListing)
+	}
+}
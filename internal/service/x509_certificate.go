@@ -2,14 +2,23 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
 	"errors"
+	"fmt"
 	"github.com/google/uuid"
 	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"sync"
 	"time"
 )
 
+var tracer = otel.Tracer(tracing.InstrumentationName)
+
 type X509CertificateDto struct {
 	ID                  uuid.UUID  `binding:"required" validate:"required" json:"id" toml:"id" yaml:"id"`
 	CommonName          string     `binding:"required" validate:"required" json:"common_name" toml:"common_name" yaml:"common_name"`
@@ -39,19 +48,65 @@ func NewX509CertificateService(
 	return &X509CertificateService{certRepo: certRepo, subService: subService, privKeyService: privKeyService}
 }
 
+// ErrInvalidUpdatesCursor is returned for cursors which weren't returned by X509CertificateService.GetUpdates.
+var ErrInvalidUpdatesCursor = errors.New("invalid updates cursor")
+
+// X509CertificateUpdatesDto is the result of X509CertificateService.GetUpdates.
+// Certificates and PrivateKeys are deduplicated over all subscriptions, Subscriptions tells which of them were
+// delivered for which subscription. NextCursor continues after the changes of this result.
+type X509CertificateUpdatesDto struct {
+	Certificates  []*X509CertificateDto
+	PrivateKeys   []*X509PrivateKeyDto
+	Subscriptions []*X509CertificateSubscriptionUpdateDto
+	NextCursor    string
+}
+
+// X509CertificateSubscriptionUpdateDto lists the certificates and private keys delivered for a single subscription.
+type X509CertificateSubscriptionUpdateDto struct {
+	SubscriptionID uuid.UUID
+	CertificateIDs []uuid.UUID
+	PrivateKeyIDs  []uuid.UUID
+}
+
+// x509CertificateUpdatesCursor is the position in the change sequence up to which updates were delivered. It is
+// opaque to clients.
+type x509CertificateUpdatesCursor struct {
+	ChangeSequence int64 `json:"c"`
+}
+
 type getUpdatesResultStruct struct {
-	certs []*X509CertificateDto
-	err   error
+	sub        *X509CertificateSubscriptionDto
+	certs      []*X509CertificateDto
+	privKeyIDs []uuid.UUID
+	err        error
 }
 
-// GetUpdates returns the latest active certificate for each subscription.
-// Also includes the private key for a certificate if it exists and is configured in the subscription.
+// GetUpdates returns the latest active certificate for each subscription which changed since the cursor, i.e. was
+// created or got its chain or private key linked. Without cursor, all latest active certificates are returned.
+// Private keys are only included for subscriptions which are configured to include them, and only for the
+// certificates matching the subscription, never for certificates of their chain. It returns ErrInvalidUpdatesCursor
+// for malformed cursors.
 func (x *X509CertificateService) GetUpdates(
-	ctx context.Context, subIDs []uuid.UUID, after time.Time, includeCertChainIfExists bool,
-) ([]*X509CertificateDto, []*X509PrivateKeyDto, error) {
+	ctx context.Context, subIDs []uuid.UUID, cursor string, includeCertChainIfExists bool,
+) (updates *X509CertificateUpdatesDto, err error) {
+	ctx, span := tracer.Start(ctx, "X509CertificateService.GetUpdates",
+		trace.WithAttributes(attribute.Int("subscriptions", len(subIDs)), attribute.Bool("cursor", cursor != "")),
+	)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	var changedAfter int64
+	if cursor != "" {
+		decodedCursor, err := decodeX509CertificateUpdatesCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		changedAfter = decodedCursor.ChangeSequence
+	}
+
+	subIDs = removeDuplicates(subIDs)
 	subs, err := x.subService.FindByIDs(ctx, subIDs)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Check if we found all subs
@@ -64,10 +119,19 @@ func (x *X509CertificateService) GetUpdates(
 			}
 		}
 		if !foundSub {
-			return nil, nil, errors.New("at least one subscription not found")
+			return nil, errors.New("at least one subscription not found")
 		}
 	}
 
+	// Changes after the latest one are left to the next cursor, as they may not be visible to all queries yet
+	changedUntil, err := x.certRepo.GetLatestChangeSequence(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if changedUntil < changedAfter {
+		changedUntil = changedAfter
+	}
+
 	var wg sync.WaitGroup
 	certResults := make(chan getUpdatesResultStruct, len(subs))
 
@@ -76,8 +140,10 @@ func (x *X509CertificateService) GetUpdates(
 		sub := sub
 		go func() {
 			defer wg.Done()
-			certificates, err := x.getLatestSubscriptionCertificates(ctx, sub, after, includeCertChainIfExists)
-			certResults <- getUpdatesResultStruct{err: err, certs: certificates}
+			certificates, privKeyIDs, err := x.getLatestSubscriptionCertificates(
+				ctx, sub, changedAfter, changedUntil, includeCertChainIfExists,
+			)
+			certResults <- getUpdatesResultStruct{sub: sub, err: err, certs: certificates, privKeyIDs: privKeyIDs}
 		}()
 	}
 
@@ -86,12 +152,20 @@ func (x *X509CertificateService) GetUpdates(
 
 	var certDtos []*X509CertificateDto
 	var privKeyIDs []uuid.UUID
+	subUpdatesByID := make(map[uuid.UUID]*X509CertificateSubscriptionUpdateDto, len(subs))
 	for result := range certResults {
 		if result.err != nil {
-			return nil, nil, result.err
+			return nil, result.err
+		}
+
+		subUpdate := &X509CertificateSubscriptionUpdateDto{
+			SubscriptionID: result.sub.ID,
+			CertificateIDs: []uuid.UUID{},
+			PrivateKeyIDs:  []uuid.UUID{},
 		}
 	outerCertLoop:
 		for _, resultCert := range result.certs {
+			subUpdate.CertificateIDs = append(subUpdate.CertificateIDs, resultCert.ID)
 			// Skip duplicate certificates
 			for _, certificate := range certDtos {
 				if certificate.ID == resultCert.ID {
@@ -101,46 +175,205 @@ func (x *X509CertificateService) GetUpdates(
 			certDtos = append(certDtos, resultCert)
 		}
 
-		for _, cert := range result.certs {
-			if cert.PrivateKeyID != nil {
-				privKeyIDs = append(privKeyIDs, *cert.PrivateKeyID)
-			}
+		subUpdate.PrivateKeyIDs = append(subUpdate.PrivateKeyIDs, result.privKeyIDs...)
+		privKeyIDs = append(privKeyIDs, result.privKeyIDs...)
+		subUpdatesByID[result.sub.ID] = subUpdate
+	}
+
+	// Keep the order of the requested subscriptions
+	subUpdates := make([]*X509CertificateSubscriptionUpdateDto, 0, len(subUpdatesByID))
+	for _, id := range subIDs {
+		if subUpdate, exists := subUpdatesByID[id]; exists {
+			subUpdates = append(subUpdates, subUpdate)
 		}
 	}
 
+	var privKeyDtos []*X509PrivateKeyDto
 	privKeyIDs = removeDuplicates(privKeyIDs)
-	privKeyDtos, err := x.privKeyService.FindByIDs(ctx, privKeyIDs)
+	if len(privKeyIDs) != 0 {
+		privKeyDtos, err = x.privKeyService.FindByIDs(ctx, privKeyIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	nextCursor, err := encodeX509CertificateUpdatesCursor(&x509CertificateUpdatesCursor{ChangeSequence: changedUntil})
+	if err != nil {
+		return nil, err
+	}
+	return &X509CertificateUpdatesDto{
+		Certificates:  certDtos,
+		PrivateKeys:   privKeyDtos,
+		Subscriptions: subUpdates,
+		NextCursor:    nextCursor,
+	}, nil
+}
 
-	return certDtos, privKeyDtos, nil
+// GetLatestUpdatesCursor returns a cursor after all changes so far, so GetUpdates only returns later changes.
+func (x *X509CertificateService) GetLatestUpdatesCursor(ctx context.Context) (string, error) {
+	latestChangeSeq, err := x.certRepo.GetLatestChangeSequence(ctx)
+	if err != nil {
+		return "", err
+	}
+	return encodeX509CertificateUpdatesCursor(&x509CertificateUpdatesCursor{ChangeSequence: latestChangeSeq})
 }
 
+// getLatestSubscriptionCertificates returns the latest certificates matching the subscription which changed between
+// the change sequence numbers, followed by their chain certificates if requested. The returned private key IDs belong
+// to the matching certificates and are only set if the subscription includes private keys.
 func (x *X509CertificateService) getLatestSubscriptionCertificates(
-	ctx context.Context, sub *X509CertificateSubscriptionDto, after time.Time, includeCertChainIfExists bool,
-) ([]*X509CertificateDto, error) {
-	fetchedCerts, err := x.certRepo.FindLatestActiveBySANsAndCreatedAtAfter(ctx, sub.SANs, after)
+	ctx context.Context, sub *X509CertificateSubscriptionDto, changedAfter int64, changedUntil int64,
+	includeCertChainIfExists bool,
+) (certs []*X509CertificateDto, privKeyIDs []uuid.UUID, err error) {
+	// Runs concurrently for all subscriptions, so their spans show which of them are slow
+	ctx, span := tracer.Start(ctx, "X509CertificateService.getLatestSubscriptionCertificates",
+		trace.WithAttributes(attribute.String("subscription.id", sub.ID.String())),
+	)
+	defer func() { tracing.EndSpan(span, err) }()
+
+	fetchedCerts, err := x.certRepo.FindLatestActiveBySubscriptionAndChangedBetween(
+		ctx, sub.ID, changedAfter, changedUntil,
+	)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	certs := make([]*X509CertificateDto, len(fetchedCerts))
+	certs = make([]*X509CertificateDto, len(fetchedCerts))
 	for i, cert := range fetchedCerts {
 		certs[i] = certificateDaoToDto(cert)
+		if sub.IncludePrivateKey && cert.PrivateKeyID != nil {
+			privKeyIDs = append(privKeyIDs, *cert.PrivateKeyID)
+		}
 	}
 
 	if includeCertChainIfExists {
 		for _, cert := range fetchedCerts {
 			chainCerts, err := x.certRepo.FindCertificateChain(ctx, cert.ID)
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 
 			for _, chainCert := range chainCerts {
+				// The chain starts with the certificate itself which is already part of the result
+				if chainCert.ID == cert.ID {
+					continue
+				}
 				certs = append(certs, certificateDaoToDto(chainCert))
 			}
 		}
 	}
 
-	return certs, nil
+	return certs, privKeyIDs, nil
+}
+
+func encodeX509CertificateUpdatesCursor(cursor *x509CertificateUpdatesCursor) (string, error) {
+	cursorJson, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cursorJson), nil
+}
+
+func decodeX509CertificateUpdatesCursor(encodedCursor string) (*x509CertificateUpdatesCursor, error) {
+	cursorJson, err := base64.RawURLEncoding.DecodeString(encodedCursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidUpdatesCursor)
+	}
+	var cursor x509CertificateUpdatesCursor
+	if err := json.Unmarshal(cursorJson, &cursor); err != nil || cursor.ChangeSequence < 0 {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidUpdatesCursor)
+	}
+	return &cursor, nil
+}
+
+// X509CertificateDetailsDto is the result of X509CertificateService.FindByID.
+// Chain starts with the parent of the certificate and ends with the topmost known authority certificate.
+type X509CertificateDetailsDto struct {
+	Certificate *X509CertificateDto
+	Chain       []*X509CertificateDto
+	PrivateKey  *X509PrivateKeyDto
+}
+
+// FindByID returns the certificate and, if requested, its parent chain and its private key if one is linked.
+// It returns ErrAccessDenied if the policies don't allow the certificate for the principal. Callers should answer that
+// like a missing certificate. Access is checked before the private key is loaded, so denied principals can't tell from
+// ErrSealed that the certificate exists either.
+func (x *X509CertificateService) FindByID(
+	ctx context.Context, principal *PrincipalDto, id uuid.UUID, includeChain bool, includePrivateKey bool,
+) (details *X509CertificateDetailsDto, exists bool, err error) {
+	cert, exists, err := x.certRepo.FindByID(ctx, id)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	details = &X509CertificateDetailsDto{Certificate: certificateDaoToDto(cert)}
+
+	err = x.subService.policyService.AuthorizeCertificate(principal, details.Certificate, includePrivateKey)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if includeChain {
+		chainCerts, err := x.certRepo.FindCertificateChain(ctx, cert.ID)
+		if err != nil {
+			return nil, false, err
+		}
+		details.Chain = []*X509CertificateDto{}
+		for _, chainCert := range chainCerts {
+			// The chain starts with the certificate itself
+			if chainCert.ID == cert.ID {
+				continue
+			}
+			details.Chain = append(details.Chain, certificateDaoToDto(chainCert))
+		}
+	}
+
+	if includePrivateKey && cert.PrivateKeyID != nil {
+		privKeys, err := x.privKeyService.FindByIDs(ctx, []uuid.UUID{*cert.PrivateKeyID})
+		if err != nil {
+			return nil, false, err
+		}
+		if len(privKeys) != 1 {
+			return nil, false, fmt.Errorf("private key %s of certificate %s not found", cert.PrivateKeyID, cert.ID)
+		}
+		details.PrivateKey = privKeys[0]
+	}
+
+	return details, true, nil
+}
+
+// X509CertificateKeyPairDto is a certificate followed by its chain together with its private key.
+type X509CertificateKeyPairDto struct {
+	CertificateChain []*X509CertificateDto
+	PrivateKey       *X509PrivateKeyDto
+}
+
+// GetLatestKeyPair returns the latest active certificate having the SAN and a private key, e.g. to serve TLS with it.
+func (x *X509CertificateService) GetLatestKeyPair(
+	ctx context.Context, subjectAltName string,
+) (keyPair *X509CertificateKeyPairDto, exists bool, err error) {
+	latestCert, exists, err := x.certRepo.FindLatestActiveWithPrivateKeyBySAN(ctx, subjectAltName)
+	if err != nil || !exists {
+		return nil, false, err
+	}
+
+	chainCerts, err := x.certRepo.FindCertificateChain(ctx, latestCert.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	privKeys, err := x.privKeyService.FindByIDs(ctx, []uuid.UUID{*latestCert.PrivateKeyID})
+	if err != nil {
+		return nil, false, err
+	}
+	if len(privKeys) != 1 {
+		return nil, false, fmt.Errorf("private key %s of certificate %s not found", latestCert.PrivateKeyID, latestCert.ID)
+	}
+
+	// The chain starts with the certificate itself
+	certDtos := make([]*X509CertificateDto, len(chainCerts))
+	for i, chainCert := range chainCerts {
+		certDtos[i] = certificateDaoToDto(chainCert)
+	}
+	return &X509CertificateKeyPairDto{CertificateChain: certDtos, PrivateKey: privKeys[0]}, true, nil
 }
 
 func certificateDaoToDto(cert *repository.X509CertificateDao) *X509CertificateDto {
@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pki-vault/server/internal/db/repository"
+	"time"
+)
+
+type X509CertificateSortField string
+
+// Enum values for X509CertificateSortField
+const (
+	X509CertificateSortCreatedAt  X509CertificateSortField = "created_at"
+	X509CertificateSortNotAfter   X509CertificateSortField = "not_after"
+	X509CertificateSortCommonName X509CertificateSortField = "common_name"
+)
+
+const (
+	DefaultX509CertificateSearchLimit = 50
+	MaxX509CertificateSearchLimit     = 500
+)
+
+var ErrInvalidSearch = errors.New("invalid certificate search")
+
+// SearchX509CertificatesDto filters and sorts certificates. Unset filters are ignored. SubjectAltName and CommonName
+// match exactly unless they contain *, which matches any sequence of characters. Cursor continues a previous search
+// with the same sorting, Limit defaults to DefaultX509CertificateSearchLimit.
+type SearchX509CertificatesDto struct {
+	SubjectAltName string
+	CommonName     string
+	IssuerID       *uuid.UUID
+	NotAfterBefore *time.Time
+	NotAfterAfter  *time.Time
+	HasPrivateKey  *bool
+	CreatedBefore  *time.Time
+	CreatedAfter   *time.Time
+	SortBy         X509CertificateSortField
+	SortDescending bool
+	Cursor         string
+	Limit          int
+}
+
+// X509CertificatePageDto is a page of a certificate search. NextCursor is empty on the last page.
+type X509CertificatePageDto struct {
+	Certificates []*X509CertificateDto
+	NextCursor   string
+}
+
+// x509CertificateCursor is the position after the last certificate of a page. It is opaque to clients and contains
+// the sorting to reject cursors of searches with a different sorting. It holds the sort values of the certificate, so
+// the search continues even if the certificate was deleted meanwhile.
+type x509CertificateCursor struct {
+	SortBy          X509CertificateSortField `json:"s"`
+	SortDescending  bool                     `json:"d"`
+	AfterCreatedAt  time.Time                `json:"c"`
+	AfterNotAfter   time.Time                `json:"n"`
+	AfterCommonName string                   `json:"cn"`
+	AfterID         uuid.UUID                `json:"a"`
+}
+
+// Search returns a page of the certificates matching the search which the policies allow for the principal. It returns
+// ErrInvalidSearch for invalid sort fields, limits or cursors.
+func (x *X509CertificateService) Search(
+	ctx context.Context, principal *PrincipalDto, search *SearchX509CertificatesDto,
+) (*X509CertificatePageDto, error) {
+	sortBy := search.SortBy
+	switch sortBy {
+	case "":
+		sortBy = X509CertificateSortCreatedAt
+	case X509CertificateSortCreatedAt, X509CertificateSortNotAfter, X509CertificateSortCommonName:
+	default:
+		return nil, fmt.Errorf("%w: unknown sort field %s", ErrInvalidSearch, sortBy)
+	}
+	limit := search.Limit
+	switch {
+	case limit == 0:
+		limit = DefaultX509CertificateSearchLimit
+	case limit < 0 || limit > MaxX509CertificateSearchLimit:
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidSearch, MaxX509CertificateSearchLimit)
+	}
+
+	var after *repository.X509CertificatePosition
+	if search.Cursor != "" {
+		cursor, err := decodeX509CertificateCursor(search.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.SortBy != sortBy || cursor.SortDescending != search.SortDescending {
+			return nil, fmt.Errorf("%w: cursor belongs to a search with a different sorting", ErrInvalidSearch)
+		}
+		after = &repository.X509CertificatePosition{
+			CreatedAt:  cursor.AfterCreatedAt,
+			NotAfter:   cursor.AfterNotAfter,
+			CommonName: cursor.AfterCommonName,
+			ID:         cursor.AfterID,
+		}
+	}
+
+	// Collect one more certificate than the limit to know if there is a next page. Certificates the principal may not
+	// access are skipped, so batches are fetched until enough certificates were collected or none are left.
+	var certs []*X509CertificateDto
+	for len(certs) <= limit {
+		fetchedCerts, err := x.certRepo.Search(ctx, &repository.X509CertificateSearchDao{
+			SubjectAltName: search.SubjectAltName,
+			CommonName:     search.CommonName,
+			IssuerID:       search.IssuerID,
+			NotAfterBefore: search.NotAfterBefore,
+			NotAfterAfter:  search.NotAfterAfter,
+			HasPrivateKey:  search.HasPrivateKey,
+			CreatedBefore:  search.CreatedBefore,
+			CreatedAfter:   search.CreatedAfter,
+			SortBy:         repository.X509CertificateSortField(sortBy),
+			SortDescending: search.SortDescending,
+			After:          after,
+			Limit:          limit + 1,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, fetchedCert := range fetchedCerts {
+			cert := certificateDaoToDto(fetchedCert)
+			if x.subService.policyService.AuthorizeCertificate(principal, cert, false) == nil {
+				certs = append(certs, cert)
+			}
+		}
+		if len(fetchedCerts) <= limit {
+			break
+		}
+		lastCert := fetchedCerts[len(fetchedCerts)-1]
+		after = &repository.X509CertificatePosition{
+			CreatedAt:  lastCert.CreatedAt,
+			NotAfter:   lastCert.NotAfter,
+			CommonName: lastCert.CommonName,
+			ID:         lastCert.ID,
+		}
+	}
+
+	page := &X509CertificatePageDto{Certificates: []*X509CertificateDto{}}
+	if len(certs) > limit {
+		certs = certs[:limit]
+		lastCert := certs[limit-1]
+		nextCursor, err := encodeX509CertificateCursor(&x509CertificateCursor{
+			SortBy:          sortBy,
+			SortDescending:  search.SortDescending,
+			AfterCreatedAt:  lastCert.CreatedAt,
+			AfterNotAfter:   lastCert.NotAfter,
+			AfterCommonName: lastCert.CommonName,
+			AfterID:         lastCert.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = nextCursor
+	}
+	page.Certificates = append(page.Certificates, certs...)
+	return page, nil
+}
+
+func encodeX509CertificateCursor(cursor *x509CertificateCursor) (string, error) {
+	cursorJson, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cursorJson), nil
+}
+
+func decodeX509CertificateCursor(encodedCursor string) (*x509CertificateCursor, error) {
+	cursorJson, err := base64.RawURLEncoding.DecodeString(encodedCursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+	}
+	var cursor x509CertificateCursor
+	if err := json.Unmarshal(cursorJson, &cursor); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidSearch)
+	}
+	return &cursor, nil
+}
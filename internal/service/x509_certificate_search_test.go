@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestX509CertificateService_Search(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+	policyService, err := NewPolicyService(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subService := NewX509CertificateSubscriptionService(nil, policyService, fakeClock)
+	service := NewX509CertificateService(certRepo, subService, nil)
+
+	certs := make([]*repository.X509CertificateDao, 3)
+	for i := range certs {
+		certs[i] = repository.NewX509CertificateDao(
+			uuid.New(), "example.invalid", []string{"example.invalid"}, nil, nil, nil, nil, nil, nil, nil,
+			fakeClock.Now(), fakeClock.Now().Add(24*time.Hour), fakeClock.Now(),
+		)
+	}
+
+	// The first page has a next page, so one more certificate than the limit is fetched
+	certRepo.EXPECT().Search(gomock.Any(), &repository.X509CertificateSearchDao{
+		SubjectAltName: "*.invalid",
+		SortBy:         repository.X509CertificateSortNotAfter,
+		SortDescending: true,
+		Limit:          3,
+	}).Return(certs, nil)
+	firstPage, err := service.Search(ctx, nil, &SearchX509CertificatesDto{
+		SubjectAltName: "*.invalid",
+		SortBy:         X509CertificateSortNotAfter,
+		SortDescending: true,
+		Limit:          2,
+	})
+	if err != nil {
+		t.Fatalf("Search() got unexpected error: %v", err)
+	}
+	wantCerts := []*X509CertificateDto{certificateDaoToDto(certs[0]), certificateDaoToDto(certs[1])}
+	if !reflect.DeepEqual(firstPage.Certificates, wantCerts) {
+		t.Errorf("Search() certificates = %v, want %v", firstPage.Certificates, wantCerts)
+	}
+	if firstPage.NextCursor == "" {
+		t.Fatalf("Search() expected next cursor")
+	}
+
+	// The cursor continues after the sort values of the last certificate of the previous page, even if it was deleted.
+	// It carries the times in UTC without monotonic clock reading.
+	certRepo.EXPECT().Search(gomock.Any(), &repository.X509CertificateSearchDao{
+		SubjectAltName: "*.invalid",
+		SortBy:         repository.X509CertificateSortNotAfter,
+		SortDescending: true,
+		After: &repository.X509CertificatePosition{
+			CreatedAt:  certs[1].CreatedAt.UTC(),
+			NotAfter:   certs[1].NotAfter.UTC(),
+			CommonName: certs[1].CommonName,
+			ID:         certs[1].ID,
+		},
+		Limit: 3,
+	}).Return(certs[2:], nil)
+	lastPage, err := service.Search(ctx, nil, &SearchX509CertificatesDto{
+		SubjectAltName: "*.invalid",
+		SortBy:         X509CertificateSortNotAfter,
+		SortDescending: true,
+		Cursor:         firstPage.NextCursor,
+		Limit:          2,
+	})
+	if err != nil {
+		t.Fatalf("Search() got unexpected error: %v", err)
+	}
+	if len(lastPage.Certificates) != 1 || lastPage.NextCursor != "" {
+		t.Errorf("Search() = %d certificates with next cursor %q, want 1 certificate without next cursor",
+			len(lastPage.Certificates), lastPage.NextCursor)
+	}
+
+	invalidSearches := map[string]*SearchX509CertificatesDto{
+		"unknown sort field":         {SortBy: "bytes"},
+		"too large limit":            {Limit: MaxX509CertificateSearchLimit + 1},
+		"malformed cursor":           {Cursor: "not-a-cursor!"},
+		"cursor of other sort order": {Cursor: firstPage.NextCursor, SortBy: X509CertificateSortNotAfter},
+		"cursor of other sort field": {Cursor: firstPage.NextCursor, SortDescending: true},
+	}
+	for name, search := range invalidSearches {
+		t.Run(name, func(t *testing.T) {
+			if _, err := service.Search(ctx, nil, search); !errors.Is(err, ErrInvalidSearch) {
+				t.Errorf("Search() error = %v, wantErr %v", err, ErrInvalidSearch)
+			}
+		})
+	}
+}
+
+func TestX509CertificateService_Search_Authorized(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+	policyService, err := NewPolicyService([]*PolicyDto{
+		NewPolicyDto("team-a", []string{"team-a-ci"}, nil, []string{"*.team-a.example.invalid"}, false),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subService := NewX509CertificateSubscriptionService(nil, policyService, fakeClock)
+	service := NewX509CertificateService(certRepo, subService, nil)
+	teamAToken := &PrincipalDto{Type: PrincipalTypeAPIToken, Name: "team-a-ci"}
+
+	newCert := func(commonName string) *repository.X509CertificateDao {
+		return repository.NewX509CertificateDao(
+			uuid.New(), commonName, []string{commonName}, nil, nil, nil, nil, nil, nil, nil,
+			fakeClock.Now(), fakeClock.Now().Add(24*time.Hour), fakeClock.Now(),
+		)
+	}
+	teamACerts := []*repository.X509CertificateDao{
+		newCert("a.team-a.example.invalid"), newCert("b.team-a.example.invalid"), newCert("c.team-a.example.invalid"),
+	}
+	teamBCerts := []*repository.X509CertificateDao{
+		newCert("a.team-b.example.invalid"), newCert("b.team-b.example.invalid"), newCert("c.team-b.example.invalid"),
+	}
+
+	// The first batch only holds a single certificate of team A, so batches are fetched until the page is full
+	gomock.InOrder(
+		certRepo.EXPECT().Search(gomock.Any(), &repository.X509CertificateSearchDao{
+			SortBy: repository.X509CertificateSortCreatedAt, Limit: 3,
+		}).Return([]*repository.X509CertificateDao{teamBCerts[0], teamACerts[0], teamBCerts[1]}, nil),
+		certRepo.EXPECT().Search(gomock.Any(), &repository.X509CertificateSearchDao{
+			SortBy: repository.X509CertificateSortCreatedAt,
+			After: &repository.X509CertificatePosition{
+				CreatedAt:  teamBCerts[1].CreatedAt,
+				NotAfter:   teamBCerts[1].NotAfter,
+				CommonName: teamBCerts[1].CommonName,
+				ID:         teamBCerts[1].ID,
+			},
+			Limit: 3,
+		}).Return([]*repository.X509CertificateDao{teamBCerts[2], teamACerts[1], teamACerts[2]}, nil),
+	)
+	page, err := service.Search(ctx, teamAToken, &SearchX509CertificatesDto{Limit: 2})
+	if err != nil {
+		t.Fatalf("Search() got unexpected error: %v", err)
+	}
+	wantCerts := []*X509CertificateDto{certificateDaoToDto(teamACerts[0]), certificateDaoToDto(teamACerts[1])}
+	if !reflect.DeepEqual(page.Certificates, wantCerts) {
+		t.Errorf("Search() certificates = %v, want %v", page.Certificates, wantCerts)
+	}
+	if page.NextCursor == "" {
+		t.Fatalf("Search() expected next cursor")
+	}
+
+	// The next page continues after the last returned certificate, not after the last fetched one
+	certRepo.EXPECT().Search(gomock.Any(), &repository.X509CertificateSearchDao{
+		SortBy: repository.X509CertificateSortCreatedAt,
+		After: &repository.X509CertificatePosition{
+			CreatedAt:  teamACerts[1].CreatedAt.UTC(),
+			NotAfter:   teamACerts[1].NotAfter.UTC(),
+			CommonName: teamACerts[1].CommonName,
+			ID:         teamACerts[1].ID,
+		},
+		Limit: 3,
+	}).Return([]*repository.X509CertificateDao{teamACerts[2]}, nil)
+	page, err = service.Search(ctx, teamAToken, &SearchX509CertificatesDto{Cursor: page.NextCursor, Limit: 2})
+	if err != nil {
+		t.Fatalf("Search() got unexpected error: %v", err)
+	}
+	wantCerts = []*X509CertificateDto{certificateDaoToDto(teamACerts[2])}
+	if !reflect.DeepEqual(page.Certificates, wantCerts) || page.NextCursor != "" {
+		t.Errorf("Search() = %v with next cursor %q, want %v without next cursor",
+			page.Certificates, page.NextCursor, wantCerts)
+	}
+}
@@ -2,6 +2,9 @@ package service
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jonboulle/clockwork"
@@ -14,6 +17,28 @@ type X509CertificateSubscriptionDto struct {
 	SANs              []string  `binding:"required" validate:"required" json:"sans" toml:"sans" yaml:"sans"`
 	IncludePrivateKey bool      `binding:"required" validate:"required" json:"include_private_key" toml:"include_private_key" yaml:"include_private_key"`
 	CreatedAt         time.Time `binding:"required" validate:"required" json:"created_at" toml:"created_at" yaml:"created_at"`
+	UpdatedAt         time.Time `binding:"required" validate:"required" json:"updated_at" toml:"updated_at" yaml:"updated_at"`
+}
+
+const (
+	DefaultX509CertificateSubscriptionListLimit = 50
+	MaxX509CertificateSubscriptionListLimit     = 500
+)
+
+var ErrInvalidSubscriptionListing = errors.New("invalid subscription listing")
+
+// X509CertificateSubscriptionPageDto is a page of subscriptions ordered by creation. NextCursor is empty on the
+// last page.
+type X509CertificateSubscriptionPageDto struct {
+	Subscriptions []*X509CertificateSubscriptionDto
+	NextCursor    string
+}
+
+// x509CertificateSubscriptionCursor is the position after the last subscription of a page. It is opaque to clients
+// and contains the sort key, so listing continues even if that subscription was deleted meanwhile.
+type x509CertificateSubscriptionCursor struct {
+	CreatedAt time.Time `json:"c"`
+	ID        uuid.UUID `json:"i"`
 }
 
 type CreateX509CertificateSubscriptionDto struct {
@@ -25,25 +50,44 @@ func NewCreateX509CertificateSubscriptionDto(subjectAltNames []string, includePr
 	return &CreateX509CertificateSubscriptionDto{SubjectAltNames: subjectAltNames, IncludePrivateKey: includePrivateKey}
 }
 
+// UpdateX509CertificateSubscriptionDto changes a subscription in place. Nil fields are left unchanged.
+type UpdateX509CertificateSubscriptionDto struct {
+	SubjectAltNames   []string
+	IncludePrivateKey *bool
+}
+
+func NewUpdateX509CertificateSubscriptionDto(subjectAltNames []string, includePrivateKey *bool) *UpdateX509CertificateSubscriptionDto {
+	return &UpdateX509CertificateSubscriptionDto{SubjectAltNames: subjectAltNames, IncludePrivateKey: includePrivateKey}
+}
+
 type X509CertificateSubscriptionService struct {
-	repository repository.X509CertificateSubscriptionRepository
-	clock      clockwork.Clock
+	repository    repository.X509CertificateSubscriptionRepository
+	policyService *PolicyService
+	clock         clockwork.Clock
 }
 
 func NewX509CertificateSubscriptionService(
-	repository repository.X509CertificateSubscriptionRepository, clock clockwork.Clock,
+	repository repository.X509CertificateSubscriptionRepository, policyService *PolicyService, clock clockwork.Clock,
 ) *X509CertificateSubscriptionService {
-	return &X509CertificateSubscriptionService{repository: repository, clock: clock}
+	return &X509CertificateSubscriptionService{repository: repository, policyService: policyService, clock: clock}
 }
 
+// Create creates the subscription if the policies allow it for the principal, otherwise it returns ErrAccessDenied.
 func (x *X509CertificateSubscriptionService) Create(
-	ctx context.Context, request *CreateX509CertificateSubscriptionDto,
+	ctx context.Context, principal *PrincipalDto, request *CreateX509CertificateSubscriptionDto,
 ) (*X509CertificateSubscriptionDto, error) {
+	err := x.policyService.AuthorizeSubscription(principal, request.SubjectAltNames, request.IncludePrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now := x.clock.Now()
 	createdSubscription, err := x.repository.Create(ctx, repository.NewX509CertificateSubscriptionDao(
 		uuid.New(),
 		request.SubjectAltNames,
 		request.IncludePrivateKey,
-		x.clock.Now(),
+		now,
+		now,
 	))
 	if err != nil {
 		return nil, err
@@ -51,6 +95,140 @@ func (x *X509CertificateSubscriptionService) Create(
 	return certificateSubscriptionDaoToDto(createdSubscription), nil
 }
 
+// Update changes the subscription while keeping its ID. Both the current and the updated subscription must be allowed
+// for the principal by the policies, otherwise it returns ErrAccessDenied.
+func (x *X509CertificateSubscriptionService) Update(
+	ctx context.Context, principal *PrincipalDto, subID uuid.UUID, request *UpdateX509CertificateSubscriptionDto,
+) (updatedSub *X509CertificateSubscriptionDto, exists bool, err error) {
+	sub, exists, err := x.repository.FindByID(ctx, subID)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	err = x.policyService.AuthorizeSubscription(principal, sub.SubjectAltNames, sub.IncludePrivateKey)
+	if err != nil {
+		return nil, true, err
+	}
+
+	if request.SubjectAltNames != nil {
+		sub.SubjectAltNames = request.SubjectAltNames
+	}
+	if request.IncludePrivateKey != nil {
+		sub.IncludePrivateKey = *request.IncludePrivateKey
+	}
+	err = x.policyService.AuthorizeSubscription(principal, sub.SubjectAltNames, sub.IncludePrivateKey)
+	if err != nil {
+		return nil, true, err
+	}
+
+	updatedSubDao, exists, err := x.repository.Update(ctx, sub)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return certificateSubscriptionDaoToDto(updatedSubDao), true, nil
+}
+
+// Authorize returns ErrAccessDenied if the policies don't allow the subscription for the principal.
+func (x *X509CertificateSubscriptionService) Authorize(
+	ctx context.Context, principal *PrincipalDto, subID uuid.UUID,
+) (exists bool, err error) {
+	sub, exists, err := x.repository.FindByID(ctx, subID)
+	if err != nil || !exists {
+		return exists, err
+	}
+	return true, x.policyService.AuthorizeSubscription(principal, sub.SubjectAltNames, sub.IncludePrivateKey)
+}
+
+func (x *X509CertificateSubscriptionService) FindByID(
+	ctx context.Context, subID uuid.UUID,
+) (sub *X509CertificateSubscriptionDto, exists bool, err error) {
+	foundSub, exists, err := x.repository.FindByID(ctx, subID)
+	if err != nil || !exists {
+		return nil, exists, err
+	}
+	return certificateSubscriptionDaoToDto(foundSub), true, nil
+}
+
+// List returns a page of the subscriptions which the policies allow for the principal. The cursor is the NextCursor of
+// the previous page, limit defaults to DefaultX509CertificateSubscriptionListLimit. It returns
+// ErrInvalidSubscriptionListing for invalid limits or cursors.
+func (x *X509CertificateSubscriptionService) List(
+	ctx context.Context, principal *PrincipalDto, cursor string, limit int,
+) (*X509CertificateSubscriptionPageDto, error) {
+	switch {
+	case limit == 0:
+		limit = DefaultX509CertificateSubscriptionListLimit
+	case limit < 0 || limit > MaxX509CertificateSubscriptionListLimit:
+		return nil, fmt.Errorf(
+			"%w: limit must be between 1 and %d", ErrInvalidSubscriptionListing, MaxX509CertificateSubscriptionListLimit,
+		)
+	}
+
+	var after *repository.X509CertificateSubscriptionPosition
+	if cursor != "" {
+		decodedCursor, err := decodeX509CertificateSubscriptionCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &repository.X509CertificateSubscriptionPosition{CreatedAt: decodedCursor.CreatedAt, ID: decodedCursor.ID}
+	}
+
+	// Collect one more subscription than the limit to know if there is a next page. Subscriptions the principal may
+	// not access are skipped, so batches are fetched until enough subscriptions were collected or none are left.
+	var subs []*repository.X509CertificateSubscriptionDao
+	for len(subs) <= limit {
+		fetchedSubs, err := x.repository.FindAll(ctx, after, limit+1)
+		if err != nil {
+			return nil, err
+		}
+		for _, fetchedSub := range fetchedSubs {
+			err := x.policyService.AuthorizeSubscription(principal, fetchedSub.SubjectAltNames, fetchedSub.IncludePrivateKey)
+			if err == nil {
+				subs = append(subs, fetchedSub)
+			}
+		}
+		if len(fetchedSubs) <= limit {
+			break
+		}
+		lastSub := fetchedSubs[len(fetchedSubs)-1]
+		after = &repository.X509CertificateSubscriptionPosition{CreatedAt: lastSub.CreatedAt, ID: lastSub.ID}
+	}
+
+	page := &X509CertificateSubscriptionPageDto{}
+	if len(subs) > limit {
+		subs = subs[:limit]
+		nextCursor, err := encodeX509CertificateSubscriptionCursor(&x509CertificateSubscriptionCursor{
+			CreatedAt: subs[limit-1].CreatedAt,
+			ID:        subs[limit-1].ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = nextCursor
+	}
+	page.Subscriptions = certificateSubscriptionDaoListToDtoList(subs)
+	return page, nil
+}
+
+func encodeX509CertificateSubscriptionCursor(cursor *x509CertificateSubscriptionCursor) (string, error) {
+	cursorJson, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(cursorJson), nil
+}
+
+func decodeX509CertificateSubscriptionCursor(encodedCursor string) (*x509CertificateSubscriptionCursor, error) {
+	cursorJson, err := base64.RawURLEncoding.DecodeString(encodedCursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidSubscriptionListing)
+	}
+	var cursor x509CertificateSubscriptionCursor
+	if err := json.Unmarshal(cursorJson, &cursor); err != nil || cursor.ID == uuid.Nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidSubscriptionListing)
+	}
+	return &cursor, nil
+}
+
 func (x *X509CertificateSubscriptionService) FindByIDs(
 	ctx context.Context, IDs []uuid.UUID,
 ) ([]*X509CertificateSubscriptionDto, error) {
@@ -80,7 +258,14 @@ outerLoop:
 	return notExistingIDs, nil
 }
 
-func (x *X509CertificateSubscriptionService) Delete(ctx context.Context, subID uuid.UUID) (rowsDeleted int64, err error) {
+// Delete removes the subscription if the policies allow it for the principal, otherwise it returns ErrAccessDenied.
+func (x *X509CertificateSubscriptionService) Delete(
+	ctx context.Context, principal *PrincipalDto, subID uuid.UUID,
+) (rowsDeleted int64, err error) {
+	exists, err := x.Authorize(ctx, principal, subID)
+	if err != nil || !exists {
+		return 0, err
+	}
 	return x.repository.Delete(ctx, subID)
 }
 
@@ -98,5 +283,6 @@ func certificateSubscriptionDaoToDto(dao *repository.X509CertificateSubscription
 		SANs:              dao.SubjectAltNames,
 		IncludePrivateKey: dao.IncludePrivateKey,
 		CreatedAt:         dao.CreatedAt,
+		UpdatedAt:         dao.UpdatedAt,
 	}
 }
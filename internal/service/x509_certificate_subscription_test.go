@@ -0,0 +1,252 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"github.com/pki-vault/server/internal/testutil"
+	"reflect"
+	"testing"
+)
+
+func TestX509CertificateSubscriptionService_Update(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	policyService, err := NewPolicyService([]*PolicyDto{
+		NewPolicyDto("team-a", []string{"team-a-ci"}, nil, []string{"*.team-a.example.invalid"}, false),
+	})
+	if err != nil {
+		t.Fatalf("NewPolicyService() got unexpected error: %v", err)
+	}
+	teamAToken := &PrincipalDto{Type: PrincipalTypeAPIToken, Name: "team-a-ci"}
+	subID := uuid.MustParse("7c9098f4-7dbd-471e-83fb-19be7095ae04")
+
+	tests := []struct {
+		name       string
+		existing   *repository.X509CertificateSubscriptionDao
+		request    *UpdateX509CertificateSubscriptionDto
+		wantUpdate *repository.X509CertificateSubscriptionDao
+		wantExists bool
+		wantErr    error
+	}{
+		{
+			name: "update subject alt names only",
+			existing: repository.NewX509CertificateSubscriptionDao(
+				subID, []string{"www.team-a.example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+			),
+			request: NewUpdateX509CertificateSubscriptionDto([]string{"api.team-a.example.invalid"}, nil),
+			wantUpdate: repository.NewX509CertificateSubscriptionDao(
+				subID, []string{"api.team-a.example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+			),
+			wantExists: true,
+		},
+		{
+			name: "updated subscription denied",
+			existing: repository.NewX509CertificateSubscriptionDao(
+				subID, []string{"www.team-a.example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+			),
+			request:    NewUpdateX509CertificateSubscriptionDto(nil, testutil.Ptr(true)),
+			wantExists: true,
+			wantErr:    ErrAccessDenied,
+		},
+		{
+			name: "current subscription denied",
+			existing: repository.NewX509CertificateSubscriptionDao(
+				subID, []string{"www.team-b.example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+			),
+			request:    NewUpdateX509CertificateSubscriptionDto([]string{"www.team-a.example.invalid"}, nil),
+			wantExists: true,
+			wantErr:    ErrAccessDenied,
+		},
+		{
+			name:       "not existing subscription",
+			request:    NewUpdateX509CertificateSubscriptionDto([]string{"www.team-a.example.invalid"}, nil),
+			wantExists: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+			subRepo.EXPECT().FindByID(gomock.Any(), subID).Return(tt.existing, tt.existing != nil, nil)
+			if tt.wantUpdate != nil {
+				subRepo.EXPECT().Update(gomock.Any(), tt.wantUpdate).Return(tt.wantUpdate, true, nil)
+			}
+
+			service := NewX509CertificateSubscriptionService(subRepo, policyService, fakeClock)
+			got, exists, err := service.Update(ctx, teamAToken, subID, tt.request)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if exists != tt.wantExists {
+				t.Errorf("Update() exists = %v, want %v", exists, tt.wantExists)
+			}
+			if tt.wantUpdate != nil && !reflect.DeepEqual(got, certificateSubscriptionDaoToDto(tt.wantUpdate)) {
+				t.Errorf("Update() = %+v, want %+v", got, certificateSubscriptionDaoToDto(tt.wantUpdate))
+			}
+		})
+	}
+}
+
+func TestX509CertificateSubscriptionService_Delete(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	policyService, err := NewPolicyService([]*PolicyDto{
+		NewPolicyDto("team-a", []string{"team-a-ci"}, nil, []string{"*.team-a.example.invalid"}, false),
+	})
+	if err != nil {
+		t.Fatalf("NewPolicyService() got unexpected error: %v", err)
+	}
+	teamAToken := &PrincipalDto{Type: PrincipalTypeAPIToken, Name: "team-a-ci"}
+	subID := uuid.MustParse("7c9098f4-7dbd-471e-83fb-19be7095ae04")
+
+	tests := []struct {
+		name            string
+		existing        *repository.X509CertificateSubscriptionDao
+		wantRowsDeleted int64
+		wantErr         error
+	}{
+		{
+			name: "allowed subscription",
+			existing: repository.NewX509CertificateSubscriptionDao(
+				subID, []string{"www.team-a.example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+			),
+			wantRowsDeleted: 1,
+		},
+		{
+			name: "denied subscription",
+			existing: repository.NewX509CertificateSubscriptionDao(
+				subID, []string{"www.team-b.example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+			),
+			wantErr: ErrAccessDenied,
+		},
+		{
+			name: "not existing subscription",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+			subRepo.EXPECT().FindByID(gomock.Any(), subID).Return(tt.existing, tt.existing != nil, nil)
+			if tt.wantRowsDeleted > 0 {
+				subRepo.EXPECT().Delete(gomock.Any(), subID).Return(tt.wantRowsDeleted, nil)
+			}
+
+			service := NewX509CertificateSubscriptionService(subRepo, policyService, fakeClock)
+			rowsDeleted, err := service.Delete(ctx, teamAToken, subID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Delete() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if rowsDeleted != tt.wantRowsDeleted {
+				t.Errorf("Delete() rowsDeleted = %v, want %v", rowsDeleted, tt.wantRowsDeleted)
+			}
+		})
+	}
+}
+
+func TestX509CertificateSubscriptionService_List(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+	policyService, err := NewPolicyService(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewX509CertificateSubscriptionService(subRepo, policyService, fakeClock)
+
+	subs := make([]*repository.X509CertificateSubscriptionDao, 3)
+	for i := range subs {
+		subs[i] = repository.NewX509CertificateSubscriptionDao(
+			uuid.New(), []string{"example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+		)
+	}
+
+	// The first page has a next page, so one more subscription than the limit is fetched
+	subRepo.EXPECT().FindAll(gomock.Any(), nil, 3).Return(subs, nil)
+	firstPage, err := service.List(ctx, nil, "", 2)
+	if err != nil {
+		t.Fatalf("List() got unexpected error: %v", err)
+	}
+	wantSubs := certificateSubscriptionDaoListToDtoList(subs[:2])
+	if !reflect.DeepEqual(firstPage.Subscriptions, wantSubs) {
+		t.Errorf("List() subscriptions = %v, want %v", firstPage.Subscriptions, wantSubs)
+	}
+	if firstPage.NextCursor == "" {
+		t.Fatalf("List() expected next cursor")
+	}
+
+	// The cursor continues after the position of the last subscription of the previous page, even if it was deleted.
+	// It carries the creation time in UTC without monotonic clock reading.
+	subRepo.EXPECT().FindAll(gomock.Any(), &repository.X509CertificateSubscriptionPosition{
+		CreatedAt: subs[1].CreatedAt.UTC(), ID: subs[1].ID,
+	}, 3).Return(subs[2:], nil)
+	lastPage, err := service.List(ctx, nil, firstPage.NextCursor, 2)
+	if err != nil {
+		t.Fatalf("List() got unexpected error: %v", err)
+	}
+	if len(lastPage.Subscriptions) != 1 || lastPage.NextCursor != "" {
+		t.Errorf("List() = %d subscriptions with next cursor %q, want 1 subscription without next cursor",
+			len(lastPage.Subscriptions), lastPage.NextCursor)
+	}
+
+	if _, err := service.List(ctx, nil, "not-a-cursor!", 2); !errors.Is(err, ErrInvalidSubscriptionListing) {
+		t.Errorf("List() error = %v, wantErr %v", err, ErrInvalidSubscriptionListing)
+	}
+	_, err = service.List(ctx, nil, "", MaxX509CertificateSubscriptionListLimit+1)
+	if !errors.Is(err, ErrInvalidSubscriptionListing) {
+		t.Errorf("List() error = %v, wantErr %v", err, ErrInvalidSubscriptionListing)
+	}
+}
+
+func TestX509CertificateSubscriptionService_List_Authorized(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+	policyService, err := NewPolicyService([]*PolicyDto{
+		NewPolicyDto("team-a", []string{"team-a-ci"}, nil, []string{"*.team-a.example.invalid"}, false),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := NewX509CertificateSubscriptionService(subRepo, policyService, fakeClock)
+	teamAToken := &PrincipalDto{Type: PrincipalTypeAPIToken, Name: "team-a-ci"}
+
+	newSub := func(subjectAltName string, includePrivateKey bool) *repository.X509CertificateSubscriptionDao {
+		return repository.NewX509CertificateSubscriptionDao(
+			uuid.New(), []string{subjectAltName}, includePrivateKey, fakeClock.Now(), fakeClock.Now(),
+		)
+	}
+	teamASubs := []*repository.X509CertificateSubscriptionDao{
+		newSub("a.team-a.example.invalid", false), newSub("b.team-a.example.invalid", false),
+	}
+	deniedSubs := []*repository.X509CertificateSubscriptionDao{
+		newSub("a.team-b.example.invalid", false), newSub("keys.team-a.example.invalid", true),
+		newSub("b.team-b.example.invalid", false),
+	}
+
+	// The first batch only holds a single subscription of team A, so batches are fetched until the page is full
+	gomock.InOrder(
+		subRepo.EXPECT().FindAll(gomock.Any(), nil, 3).
+			Return([]*repository.X509CertificateSubscriptionDao{deniedSubs[0], teamASubs[0], deniedSubs[1]}, nil),
+		subRepo.EXPECT().FindAll(gomock.Any(), &repository.X509CertificateSubscriptionPosition{
+			CreatedAt: deniedSubs[1].CreatedAt, ID: deniedSubs[1].ID,
+		}, 3).
+			Return([]*repository.X509CertificateSubscriptionDao{deniedSubs[2], teamASubs[1]}, nil),
+	)
+	page, err := service.List(ctx, teamAToken, "", 2)
+	if err != nil {
+		t.Fatalf("List() got unexpected error: %v", err)
+	}
+	wantSubs := certificateSubscriptionDaoListToDtoList(teamASubs)
+	if !reflect.DeepEqual(page.Subscriptions, wantSubs) || page.NextCursor != "" {
+		t.Errorf("List() = %v with next cursor %q, want %v without next cursor",
+			page.Subscriptions, page.NextCursor, wantSubs)
+	}
+}
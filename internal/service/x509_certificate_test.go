@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"github.com/pki-vault/server/internal/testutil"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestX509CertificateService_GetUpdates(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	ctx := context.Background()
+	certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+	subRepo := mock_repository.NewMockX509CertificateSubscriptionRepository(ctrl)
+	privKeyRepo := mock_repository.NewMockPrivateKeyRepository(ctrl)
+
+	withKeySub := repository.NewX509CertificateSubscriptionDao(
+		uuid.MustParse("2f0e4b4e-3a0c-4a3f-8d57-2d9f3e0f7a11"), []string{"with-key.example.invalid"}, true, fakeClock.Now(), fakeClock.Now(),
+	)
+	withoutKeySub := repository.NewX509CertificateSubscriptionDao(
+		uuid.MustParse("9d5c1f2a-6b7e-4c8d-9e0f-1a2b3c4d5e6f"), []string{"without-key.example.invalid"}, false, fakeClock.Now(), fakeClock.Now(),
+	)
+	withKeyCert := repository.NewX509CertificateDao(
+		uuid.MustParse("0b6f4a57-5d0b-4a0e-9c47-8f5e8a1d2c3b"), "with-key.example.invalid", nil,
+		nil, nil, nil, nil, nil, nil,
+		testutil.Ptr(uuid.MustParse("6a1d8c2e-1f3b-4d5e-8a7b-9c0d1e2f3a4b")),
+		fakeClock.Now(), fakeClock.Now().Add(24*time.Hour), fakeClock.Now(),
+	)
+	withoutKeyCert := repository.NewX509CertificateDao(
+		uuid.MustParse("c3d4e5f6-a7b8-4c9d-8e0f-1a2b3c4d5e6f"), "without-key.example.invalid", nil,
+		nil, nil, nil, nil, nil, nil,
+		testutil.Ptr(uuid.MustParse("e1f2a3b4-c5d6-4e7f-8a9b-0c1d2e3f4a5b")),
+		fakeClock.Now(), fakeClock.Now().Add(24*time.Hour), fakeClock.Now(),
+	)
+	withKeyPrivKey := repository.NewX509PrivateKeyDao(
+		*withKeyCert.PrivateKeyID, repository.PrivateKeyTypeRSA, "PRIVATE KEY", nil, []byte("random data"), nil, fakeClock.Now(),
+	)
+
+	cursor, err := encodeX509CertificateUpdatesCursor(&x509CertificateUpdatesCursor{ChangeSequence: 17})
+	if err != nil {
+		t.Fatal(err)
+	}
+	subRepo.EXPECT().
+		FindByIDs(gomock.Any(), gomock.Any()).
+		Return([]*repository.X509CertificateSubscriptionDao{withKeySub, withoutKeySub}, nil)
+	certRepo.EXPECT().GetLatestChangeSequence(gomock.Any()).Return(int64(42), nil)
+	certRepo.EXPECT().
+		FindLatestActiveBySubscriptionAndChangedBetween(gomock.Any(), withKeySub.ID, int64(17), int64(42)).
+		Return([]*repository.X509CertificateDao{withKeyCert}, nil)
+	certRepo.EXPECT().
+		FindLatestActiveBySubscriptionAndChangedBetween(gomock.Any(), withoutKeySub.ID, int64(17), int64(42)).
+		Return([]*repository.X509CertificateDao{withoutKeyCert}, nil)
+	// Only the private key of the subscription including private keys must be requested
+	privKeyRepo.EXPECT().
+		FindByIDs(gomock.Any(), []uuid.UUID{withKeyPrivKey.ID}).
+		Return([]*repository.X509PrivateKeyDao{withKeyPrivKey}, nil)
+
+	policyService, err := NewPolicyService(nil)
+	if err != nil {
+		t.Fatalf("NewPolicyService() got unexpected error: %v", err)
+	}
+	service := NewX509CertificateService(
+		certRepo,
+		NewX509CertificateSubscriptionService(subRepo, policyService, fakeClock),
+		NewDefaultX509PrivateKeyService(privKeyRepo, fakeClock),
+	)
+	updates, err := service.GetUpdates(ctx, []uuid.UUID{withKeySub.ID, withoutKeySub.ID}, cursor, false)
+	if err != nil {
+		t.Fatalf("GetUpdates() got unexpected error: %v", err)
+	}
+
+	if len(updates.Certificates) != 2 {
+		t.Errorf("GetUpdates() expected 2 certificates, but got %d", len(updates.Certificates))
+	}
+	expectedPrivKeys := []*X509PrivateKeyDto{privateKeyDaoToDto(withKeyPrivKey)}
+	if !reflect.DeepEqual(updates.PrivateKeys, expectedPrivKeys) {
+		t.Errorf("GetUpdates() private keys = %v, want %v", updates.PrivateKeys, expectedPrivKeys)
+	}
+	expectedSubUpdates := []*X509CertificateSubscriptionUpdateDto{
+		{
+			SubscriptionID: withKeySub.ID,
+			CertificateIDs: []uuid.UUID{withKeyCert.ID},
+			PrivateKeyIDs:  []uuid.UUID{withKeyPrivKey.ID},
+		},
+		{
+			SubscriptionID: withoutKeySub.ID,
+			CertificateIDs: []uuid.UUID{withoutKeyCert.ID},
+			PrivateKeyIDs:  []uuid.UUID{},
+		},
+	}
+	if !reflect.DeepEqual(updates.Subscriptions, expectedSubUpdates) {
+		t.Errorf("GetUpdates() subscriptions = %v, want %v", updates.Subscriptions, expectedSubUpdates)
+	}
+	// The next updates continue after the latest change
+	nextCursor, err := decodeX509CertificateUpdatesCursor(updates.NextCursor)
+	if err != nil || nextCursor.ChangeSequence != 42 {
+		t.Errorf("GetUpdates() next cursor = %v, %v, want change sequence 42", nextCursor, err)
+	}
+
+	for _, invalidCursor := range []string{"not base64!", "bm90IGpzb24", "eyJjIjotMX0"} {
+		_, err := service.GetUpdates(ctx, []uuid.UUID{withKeySub.ID}, invalidCursor, false)
+		if !errors.Is(err, ErrInvalidUpdatesCursor) {
+			t.Errorf("GetUpdates() with cursor %s error = %v, want %v", invalidCursor, err, ErrInvalidUpdatesCursor)
+		}
+	}
+}
+
+func TestX509CertificateService_FindByID(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+
+	rootCert := repository.NewX509CertificateDao(
+		uuid.MustParse("4f3e2d1c-0b9a-4876-a543-210fedcba987"), "root.example.invalid", nil,
+		nil, nil, nil, nil, nil, nil, nil,
+		fakeClock.Now(), fakeClock.Now().Add(24*time.Hour), fakeClock.Now(),
+	)
+	leafCert := repository.NewX509CertificateDao(
+		uuid.MustParse("a1b2c3d4-e5f6-4a7b-8c9d-0e1f2a3b4c5d"), "leaf.example.invalid", []string{"leaf.example.invalid"},
+		nil, nil, nil, nil, nil, &rootCert.ID,
+		testutil.Ptr(uuid.MustParse("b2c3d4e5-f6a7-4b8c-9d0e-1f2a3b4c5d6e")),
+		fakeClock.Now(), fakeClock.Now().Add(24*time.Hour), fakeClock.Now(),
+	)
+	leafPrivKey := repository.NewX509PrivateKeyDao(
+		*leafCert.PrivateKeyID, repository.PrivateKeyTypeRSA, "PRIVATE KEY", nil, []byte("random data"), nil, fakeClock.Now(),
+	)
+	policyService, err := NewPolicyService([]*PolicyDto{
+		NewPolicyDto("leaf", []string{"leaf-ci"}, nil, []string{"leaf.example.invalid"}, false),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafToken := &PrincipalDto{Type: PrincipalTypeAPIToken, Name: "leaf-ci"}
+
+	tests := []struct {
+		name              string
+		principal         *PrincipalDto
+		id                uuid.UUID
+		includeChain      bool
+		includePrivateKey bool
+		want              *X509CertificateDetailsDto
+		wantExists        bool
+		wantErr           error
+	}{
+		{
+			name:       "certificate only",
+			id:         leafCert.ID,
+			want:       &X509CertificateDetailsDto{Certificate: certificateDaoToDto(leafCert)},
+			wantExists: true,
+		},
+		{
+			name:              "certificate with chain and private key",
+			id:                leafCert.ID,
+			includeChain:      true,
+			includePrivateKey: true,
+			want: &X509CertificateDetailsDto{
+				Certificate: certificateDaoToDto(leafCert),
+				Chain:       []*X509CertificateDto{certificateDaoToDto(rootCert)},
+				PrivateKey:  privateKeyDaoToDto(leafPrivKey),
+			},
+			wantExists: true,
+		},
+		{
+			name:              "root certificate without private key",
+			id:                rootCert.ID,
+			includeChain:      true,
+			includePrivateKey: true,
+			want: &X509CertificateDetailsDto{
+				Certificate: certificateDaoToDto(rootCert),
+				Chain:       []*X509CertificateDto{},
+			},
+			wantExists: true,
+		},
+		{
+			name:       "non existing certificate",
+			id:         uuid.MustParse("00000000-0000-4000-8000-000000000000"),
+			wantExists: false,
+		},
+		{
+			name:       "certificate allowed by policy",
+			principal:  leafToken,
+			id:         leafCert.ID,
+			want:       &X509CertificateDetailsDto{Certificate: certificateDaoToDto(leafCert)},
+			wantExists: true,
+		},
+		{
+			name:              "private key denied by policy is not loaded",
+			principal:         leafToken,
+			id:                leafCert.ID,
+			includePrivateKey: true,
+			wantExists:        true,
+			wantErr:           ErrAccessDenied,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+			privKeyRepo := mock_repository.NewMockPrivateKeyRepository(ctrl)
+
+			certsByID := map[uuid.UUID]*repository.X509CertificateDao{leafCert.ID: leafCert, rootCert.ID: rootCert}
+			certRepo.EXPECT().FindByID(gomock.Any(), tt.id).Return(certsByID[tt.id], certsByID[tt.id] != nil, nil)
+			certRepo.EXPECT().FindCertificateChain(gomock.Any(), leafCert.ID).
+				Return([]*repository.X509CertificateDao{leafCert, rootCert}, nil).AnyTimes()
+			certRepo.EXPECT().FindCertificateChain(gomock.Any(), rootCert.ID).
+				Return([]*repository.X509CertificateDao{rootCert}, nil).AnyTimes()
+			if tt.wantErr == nil {
+				privKeyRepo.EXPECT().FindByIDs(gomock.Any(), []uuid.UUID{leafPrivKey.ID}).
+					Return([]*repository.X509PrivateKeyDao{leafPrivKey}, nil).AnyTimes()
+			}
+
+			subService := NewX509CertificateSubscriptionService(nil, policyService, fakeClock)
+			service := NewX509CertificateService(
+				certRepo, subService, NewDefaultX509PrivateKeyService(privKeyRepo, fakeClock),
+			)
+			got, exists, err := service.FindByID(ctx, tt.principal, tt.id, tt.includeChain, tt.includePrivateKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("FindByID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if exists != tt.wantExists {
+				t.Errorf("FindByID() exists = %v, want %v", exists, tt.wantExists)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindByID() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -9,24 +9,74 @@ import (
 	"github.com/google/uuid"
 	"github.com/jonboulle/clockwork"
 	"github.com/pki-vault/server/internal/db/repository"
+	"time"
 )
 
+// X509ImportStatsDto summarizes a committed import. LinkedCertificates are certificates stored before the import which
+// got their parent or private key from it.
+type X509ImportStatsDto struct {
+	CreatedCertificates  int
+	ExistingCertificates int
+	LinkedCertificates   int
+	CreatedPrivateKeys   int
+}
+
+// X509ImportObserver observes committed imports, e.g. to export metrics.
+type X509ImportObserver interface {
+	ObserveX509Import(stats *X509ImportStatsDto, duration time.Duration)
+}
+
 type X509ImportService struct {
 	repository.Bundle
-	clock clockwork.Clock
+	webhookService *WebhookService
+	importObserver X509ImportObserver
+	clock          clockwork.Clock
 }
 
-func NewX509ImportService(bundle repository.Bundle, clock clockwork.Clock) *X509ImportService {
-	return &X509ImportService{Bundle: bundle, clock: clock}
+// NewX509ImportService returns an import service. importObserver may be nil.
+func NewX509ImportService(
+	bundle repository.Bundle, webhookService *WebhookService, importObserver X509ImportObserver, clock clockwork.Clock,
+) *X509ImportService {
+	return &X509ImportService{Bundle: bundle, webhookService: webhookService, importObserver: importObserver, clock: clock}
 }
 
 func (x *X509ImportService) Import(
 	ctx context.Context, certPems []*pem.Block, privKeyPems []*pem.Block,
 ) ([]*X509CertificateDto, []*X509PrivateKeyDto, error) {
-	txCtx, err := x.TransactionManager().BeginTx(ctx)
+	result, err := x.importPems(ctx, certPems, privKeyPems)
 	if err != nil {
 		return nil, nil, err
 	}
+
+	certDtos := make([]*X509CertificateDto, len(result.createdCerts)+len(result.existingCerts))
+	for i, dao := range append(result.createdCerts, result.existingCerts...) {
+		certDtos[i] = certificateDaoToDto(dao)
+	}
+	privKeyDtos := make([]*X509PrivateKeyDto, len(result.privKeys))
+	for i, dao := range result.privKeys {
+		privKeyDtos[i] = privateKeyDaoToDto(dao)
+	}
+
+	return certDtos, privKeyDtos, nil
+}
+
+// x509ImportResult contains the certificates and private keys of a committed import. privKeys contains the created and
+// the already existing private keys, newPrivKeyIDs only the created ones.
+type x509ImportResult struct {
+	createdCerts  []*repository.X509CertificateDao
+	existingCerts []*repository.X509CertificateDao
+	privKeys      []*repository.X509PrivateKeyDao
+	newPrivKeyIDs map[uuid.UUID]struct{}
+}
+
+func (x *X509ImportService) importPems(
+	ctx context.Context, certPems []*pem.Block, privKeyPems []*pem.Block,
+) (*x509ImportResult, error) {
+	startedAt := x.clock.Now()
+	txCtx, err := x.TransactionManager().BeginTx(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer func() {
 		if p := recover(); p != nil && txCtx != nil {
 			rollbackErr := x.TransactionManager().RollbackTx(txCtx)
@@ -44,6 +94,7 @@ func (x *X509ImportService) Import(
 	}()
 
 	var createdPrivKeys []*repository.X509PrivateKeyDao
+	newPrivKeyIDs := make(map[uuid.UUID]struct{})
 	{
 		privKeyPems = removeDuplicates(privKeyPems)
 		// parse deduplicated private keys
@@ -51,67 +102,98 @@ func (x *X509ImportService) Import(
 		for idx, privKey := range privKeyPems {
 			privateKey, err := x.parseX509PrivateKey(privKey)
 			if err != nil {
-				return nil, nil, err
+				return nil, err
 			}
 			privKeys[idx] = privateKey
 		}
 
 		createdPrivKeys, err = x.persistPrivateKeys(txCtx, privKeys)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
+		}
+		// Existing keys are returned with their stored ID
+		for idx, privKey := range createdPrivKeys {
+			if privKey.ID == privKeys[idx].ID {
+				newPrivKeyIDs[privKey.ID] = struct{}{}
+			}
 		}
 	}
 
 	toBeCreatedCerts, alreadyExistingCerts, err := x.filterToBeCreatedCertificates(txCtx, certPems)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	privKeyLinkDeferredCertUpdates, err := x.linkPrivateKeysToCertificates(txCtx, createdPrivKeys, toBeCreatedCerts)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	err = x.linkParentCertificatesAmongThemselves(toBeCreatedCerts)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	err = x.linkCertificatesFromDBAsParents(txCtx, toBeCreatedCerts)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 	deferredCertUpdates, err := x.linkCertificatesAsParentsInDBCertificates(txCtx, toBeCreatedCerts)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	createdCerts, err := x.sortAndPersistCertificates(txCtx, toBeCreatedCerts)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Update all certificates in the DB which got a parent or a private key from the current import.
 	// This has to be deferred because we first need to persist the import certificates and private keys.
 	err = x.executeDeferredCertUpdates(txCtx, append(privKeyLinkDeferredCertUpdates, deferredCertUpdates...))
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
-	err = x.TransactionManager().CommitTx(txCtx)
+	err = x.writeImportOutboxEvents(txCtx, createdCerts, deferredCertUpdates, privKeyLinkDeferredCertUpdates)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-
-	certDtos := make([]*X509CertificateDto, len(createdCerts)+len(alreadyExistingCerts))
-	for i, dao := range append(createdCerts, alreadyExistingCerts...) {
-		certDtos[i] = certificateDaoToDto(dao)
+	changedCerts := append(append([]*repository.X509CertificateDao{}, createdCerts...), deferredCertUpdates...)
+	err = x.webhookService.EnqueueCertificateEvents(txCtx, changedCerts, privKeyLinkDeferredCertUpdates)
+	if err != nil {
+		return nil, err
 	}
-	privKeyDtos := make([]*X509PrivateKeyDto, len(createdPrivKeys))
-	for i, dao := range createdPrivKeys {
-		privKeyDtos[i] = privateKeyDaoToDto(dao)
+	if len(createdCerts) != 0 || len(deferredCertUpdates) != 0 || len(privKeyLinkDeferredCertUpdates) != 0 {
+		// Listeners are notified once the transaction is committed
+		err = x.X509CertificateUpdateNotifier().Notify(txCtx)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return certDtos, privKeyDtos, nil
+	err = x.TransactionManager().CommitTx(txCtx)
+	if err != nil {
+		return nil, err
+	}
+	if x.importObserver != nil {
+		linkedCertIDs := make(map[uuid.UUID]struct{})
+		for _, cert := range append(privKeyLinkDeferredCertUpdates, deferredCertUpdates...) {
+			linkedCertIDs[cert.ID] = struct{}{}
+		}
+		x.importObserver.ObserveX509Import(&X509ImportStatsDto{
+			CreatedCertificates:  len(createdCerts),
+			ExistingCertificates: len(alreadyExistingCerts),
+			LinkedCertificates:   len(linkedCertIDs),
+			CreatedPrivateKeys:   len(newPrivKeyIDs),
+		}, x.clock.Since(startedAt))
+	}
+
+	return &x509ImportResult{
+		createdCerts:  createdCerts,
+		existingCerts: alreadyExistingCerts,
+		privKeys:      createdPrivKeys,
+		newPrivKeyIDs: newPrivKeyIDs,
+	}, nil
 }
 
 // filterToBeCreatedCertificates find existing certificates in the database and overwrite.
@@ -491,13 +573,18 @@ func (x *X509ImportService) parseX509PrivateKey(privKeyPem *pem.Block) (*reposit
 	if err != nil {
 		return nil, err
 	}
+	// Keys are stored as PKCS#8, no matter if they were imported as PKCS#1, SEC1 or PKCS#8
+	privKeyDer, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, err
+	}
 
 	return repository.NewX509PrivateKeyDao(
 		uuid.New(),
 		repository.PrivateKeyType(privKeyType),
-		privKeyPem.Type,
-		ComputeBytesHash(privKeyPem.Bytes),
-		privKeyPem.Bytes,
+		"PRIVATE KEY",
+		ComputeBytesHash(privKeyDer),
+		privKeyDer,
 		pubKeyHash,
 		x.clock.Now(),
 	), nil
@@ -0,0 +1,455 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/pki-vault/server/internal/db/repository"
+	"io"
+	"path"
+)
+
+// ErrInvalidImportFile is returned for file imports exceeding the limits of the number of files, the decompressed size
+// or the nesting of archives.
+var ErrInvalidImportFile = errors.New("invalid import file")
+
+const (
+	// maxImportFilesDecompressedSize limits the bytes decompressed from the archives of a file import, so small
+	// archives can't expand to exhaust the memory.
+	maxImportFilesDecompressedSize = 64 << 20
+	// maxImportFilesCount limits the number of uploaded files and archive entries of a file import.
+	maxImportFilesCount = 10000
+	// maxImportArchiveDepth limits the nesting of archives in archives.
+	maxImportArchiveDepth = 4
+)
+
+// X509ImportFileFormat is the format of an uploaded file, which is detected by its content.
+type X509ImportFileFormat string
+
+const (
+	// X509ImportFileFormatPEM is a file with PEM-encoded certificates, private keys and PKCS#7 blocks.
+	X509ImportFileFormatPEM X509ImportFileFormat = "pem"
+	// X509ImportFileFormatDER is a DER-encoded certificate or private key, e.g. a .cer file.
+	X509ImportFileFormatDER X509ImportFileFormat = "der"
+	// X509ImportFileFormatPKCS7 is a DER-encoded PKCS#7 (.p7b) file.
+	X509ImportFileFormatPKCS7 X509ImportFileFormat = "pkcs7"
+	// X509ImportFileFormatPKCS12 is a PKCS#12 (.p12/.pfx) file.
+	X509ImportFileFormatPKCS12 X509ImportFileFormat = "pkcs12"
+	// X509ImportFileFormatUnknown is a file which isn't supported and which is skipped.
+	X509ImportFileFormatUnknown X509ImportFileFormat = "unknown"
+)
+
+// X509ImportFileDto is an uploaded file of a file import.
+type X509ImportFileDto struct {
+	Name string
+	Data []byte
+}
+
+// X509ImportFileReportDto reports the certificates and private keys of a file of a file import. Archives are reported
+// by their entries, which are named by their path within the archive. Certificates and private keys are skipped if
+// they were already stored or if an earlier file of the import contained them. SkippedReason is set if the whole file
+// was skipped, e.g. because its format isn't supported or it can't be decoded.
+type X509ImportFileReportDto struct {
+	Name                  string
+	Format                X509ImportFileFormat
+	CreatedCertificateIDs []uuid.UUID
+	SkippedCertificateIDs []uuid.UUID
+	CreatedPrivateKeyIDs  []uuid.UUID
+	SkippedPrivateKeyIDs  []uuid.UUID
+	SkippedReason         string
+}
+
+// ImportFiles imports the certificates and private keys of the uploaded files in a single import. The format of each
+// file is detected by its content: PEM, DER-encoded certificates and private keys, PKCS#7 and PKCS#12. Zip, tar and
+// gzip-compressed archives are extracted. The password decrypts PKCS#12 files, the passphrase encrypted private keys.
+// It reports per file which certificates and private keys were created and which were skipped. Files which can't be
+// decoded, e.g. because the password of a PKCS#12 file is wrong, are skipped too, so they don't fail the import of the
+// other files. It returns ErrInvalidImportFile if the import exceeds the limits of file imports.
+func (x *X509ImportService) ImportFiles(
+	ctx context.Context, files []*X509ImportFileDto, password string, passphrase string,
+) ([]*X509CertificateDto, []*X509PrivateKeyDto, []*X509ImportFileReportDto, error) {
+	extractor := &x509ImportFileExtractor{
+		password:                password,
+		passphrase:              passphrase,
+		remainingDecompressSize: maxImportFilesDecompressedSize,
+		remainingCount:          maxImportFilesCount,
+	}
+	for _, file := range files {
+		if err := extractor.extract(file.Name, file.Data, 0); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// Files often contain the same certificates, e.g. the chain, so they are only passed once to the import
+	var certPems, privKeyPems []*pem.Block
+	certsByHash := make(map[string]*repository.X509CertificateDao)
+	privKeysByPubKeyHash := make(map[string]*repository.X509PrivateKeyDao)
+	for _, content := range extractor.contents {
+		for _, certPem := range content.certPems {
+			certHash := string(ComputeBytesHash(certPem.Bytes))
+			if _, exists := certsByHash[certHash]; !exists {
+				certsByHash[certHash] = nil
+				certPems = append(certPems, certPem)
+			}
+		}
+		for idx, privKeyPem := range content.privKeyPems {
+			pubKeyHash := string(content.privKeyPubKeyHashes[idx])
+			if _, exists := privKeysByPubKeyHash[pubKeyHash]; !exists {
+				privKeysByPubKeyHash[pubKeyHash] = nil
+				privKeyPems = append(privKeyPems, privKeyPem)
+			}
+		}
+	}
+
+	result, err := x.importPems(ctx, certPems, privKeyPems)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	newCertIDs := make(map[uuid.UUID]struct{})
+	for _, cert := range result.createdCerts {
+		newCertIDs[cert.ID] = struct{}{}
+		certsByHash[string(cert.BytesHash)] = cert
+	}
+	for _, cert := range result.existingCerts {
+		certsByHash[string(cert.BytesHash)] = cert
+	}
+	for _, privKey := range result.privKeys {
+		privKeysByPubKeyHash[string(privKey.PublicKeyHash)] = privKey
+	}
+
+	// Objects are reported as created for the first file containing them and as skipped for later ones
+	reportedIDs := make(map[uuid.UUID]struct{})
+	reports := make([]*X509ImportFileReportDto, len(extractor.contents))
+	for i, content := range extractor.contents {
+		report := content.report
+		for _, certPem := range content.certPems {
+			cert := certsByHash[string(ComputeBytesHash(certPem.Bytes))]
+			if _, isNew := newCertIDs[cert.ID]; isNew && !isReported(reportedIDs, cert.ID) {
+				report.CreatedCertificateIDs = append(report.CreatedCertificateIDs, cert.ID)
+			} else {
+				report.SkippedCertificateIDs = append(report.SkippedCertificateIDs, cert.ID)
+			}
+		}
+		for _, pubKeyHash := range content.privKeyPubKeyHashes {
+			privKey := privKeysByPubKeyHash[string(pubKeyHash)]
+			if _, isNew := result.newPrivKeyIDs[privKey.ID]; isNew && !isReported(reportedIDs, privKey.ID) {
+				report.CreatedPrivateKeyIDs = append(report.CreatedPrivateKeyIDs, privKey.ID)
+			} else {
+				report.SkippedPrivateKeyIDs = append(report.SkippedPrivateKeyIDs, privKey.ID)
+			}
+		}
+		reports[i] = report
+	}
+
+	certDtos := make([]*X509CertificateDto, len(result.createdCerts)+len(result.existingCerts))
+	for i, dao := range append(result.createdCerts, result.existingCerts...) {
+		certDtos[i] = certificateDaoToDto(dao)
+	}
+	privKeyDtos := make([]*X509PrivateKeyDto, len(result.privKeys))
+	for i, dao := range result.privKeys {
+		privKeyDtos[i] = privateKeyDaoToDto(dao)
+	}
+	return certDtos, privKeyDtos, reports, nil
+}
+
+// isReported returns whether the ID was reported before and marks it as reported.
+func isReported(reportedIDs map[uuid.UUID]struct{}, id uuid.UUID) bool {
+	if _, reported := reportedIDs[id]; reported {
+		return true
+	}
+	reportedIDs[id] = struct{}{}
+	return false
+}
+
+// x509ImportFileContent contains the certificates and private keys of an uploaded file or archive entry.
+// privKeyPubKeyHashes contains the public key hashes of privKeyPems, which identify the stored private keys.
+type x509ImportFileContent struct {
+	report              *X509ImportFileReportDto
+	certPems            []*pem.Block
+	privKeyPems         []*pem.Block
+	privKeyPubKeyHashes [][]byte
+}
+
+// x509ImportFileExtractor extracts the archives of a file import and decodes their entries and the other files.
+type x509ImportFileExtractor struct {
+	password                string
+	passphrase              string
+	remainingDecompressSize int64
+	remainingCount          int
+	contents                []*x509ImportFileContent
+}
+
+func (e *x509ImportFileExtractor) extract(name string, data []byte, depth int) error {
+	if e.remainingCount == 0 {
+		return fmt.Errorf("%w: %s: the import exceeds %d files", ErrInvalidImportFile, name, maxImportFilesCount)
+	}
+	e.remainingCount--
+
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return e.extractZip(name, data, depth)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		return e.extractGzip(name, data, depth)
+	case isTar(data):
+		return e.extractTar(name, data, depth)
+	}
+
+	content, err := e.decode(data)
+	if err != nil {
+		e.skip(name, content.report.Format, err)
+		return nil
+	}
+	content.report.Name = name
+	e.contents = append(e.contents, content)
+	return nil
+}
+
+// skip reports the file as skipped because it can't be decoded. Broken archives are reported like files of an unknown
+// format, together with the entries which were extracted before the error.
+func (e *x509ImportFileExtractor) skip(name string, format X509ImportFileFormat, err error) {
+	e.contents = append(e.contents, &x509ImportFileContent{report: &X509ImportFileReportDto{
+		Name:          name,
+		Format:        format,
+		SkippedReason: fmt.Sprintf("the file could not be decoded: %s", err),
+	}})
+}
+
+// checkArchiveDepth returns an error if the archive at depth may not contain further files.
+func (e *x509ImportFileExtractor) checkArchiveDepth(name string, depth int) error {
+	if depth >= maxImportArchiveDepth {
+		return fmt.Errorf("%w: %s: archives are nested deeper than %d levels", ErrInvalidImportFile, name,
+			maxImportArchiveDepth)
+	}
+	return nil
+}
+
+func (e *x509ImportFileExtractor) extractZip(name string, data []byte, depth int) error {
+	if err := e.checkArchiveDepth(name, depth); err != nil {
+		return err
+	}
+	zipReader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		e.skip(name, X509ImportFileFormatUnknown, err)
+		return nil
+	}
+	for _, file := range zipReader.File {
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		entryName := path.Join(name, file.Name)
+		entry, err := file.Open()
+		if err != nil {
+			e.skip(entryName, X509ImportFileFormatUnknown, err)
+			continue
+		}
+		entryData, err := e.decompress(entryName, entry)
+		_ = entry.Close()
+		if errors.Is(err, ErrInvalidImportFile) {
+			return err
+		}
+		if err != nil {
+			e.skip(entryName, X509ImportFileFormatUnknown, err)
+			continue
+		}
+		if err = e.extract(entryName, entryData, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractGzip decompresses the data and extracts it as tar archive, or decodes it as file named like the compressed
+// one without extension.
+func (e *x509ImportFileExtractor) extractGzip(name string, data []byte, depth int) error {
+	if err := e.checkArchiveDepth(name, depth); err != nil {
+		return err
+	}
+	gzipReader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		e.skip(name, X509ImportFileFormatUnknown, err)
+		return nil
+	}
+	decompressed, err := e.decompress(name, gzipReader)
+	if errors.Is(err, ErrInvalidImportFile) {
+		return err
+	}
+	if err != nil {
+		e.skip(name, X509ImportFileFormatUnknown, err)
+		return nil
+	}
+	if isTar(decompressed) {
+		return e.extractTar(name, decompressed, depth)
+	}
+	return e.extract(trimExtension(name, ".gz"), decompressed, depth+1)
+}
+
+func (e *x509ImportFileExtractor) extractTar(name string, data []byte, depth int) error {
+	if err := e.checkArchiveDepth(name, depth); err != nil {
+		return err
+	}
+	tarReader := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			e.skip(name, X509ImportFileFormatUnknown, err)
+			return nil
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		entryName := path.Join(name, header.Name)
+		// Entries are read from the data in memory, so they don't count as decompressed
+		entryData, err := io.ReadAll(tarReader)
+		if err != nil {
+			e.skip(entryName, X509ImportFileFormatUnknown, err)
+			return nil
+		}
+		if err = e.extract(entryName, entryData, depth+1); err != nil {
+			return err
+		}
+	}
+}
+
+// decompress reads the decompressed data. It returns ErrInvalidImportFile if the import exceeds
+// maxImportFilesDecompressedSize.
+func (e *x509ImportFileExtractor) decompress(name string, reader io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(reader, e.remainingDecompressSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > e.remainingDecompressSize {
+		return nil, fmt.Errorf("%w: %s: the archives exceed %d bytes when decompressed", ErrInvalidImportFile, name,
+			maxImportFilesDecompressedSize)
+	}
+	e.remainingDecompressSize -= int64(len(data))
+	return data, nil
+}
+
+// decode detects the format of a file which isn't an archive and decodes its certificates and private keys. The
+// content is returned with the detected format on errors too.
+func (e *x509ImportFileExtractor) decode(data []byte) (*x509ImportFileContent, error) {
+	content := &x509ImportFileContent{report: &X509ImportFileReportDto{}}
+	if block, _ := pem.Decode(data); block != nil {
+		content.report.Format = X509ImportFileFormatPEM
+		for rest := data; ; {
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if err := e.decodePemBlock(content, block); err != nil {
+				return content, err
+			}
+		}
+		if len(content.certPems) == 0 && len(content.privKeyPems) == 0 {
+			content.report.SkippedReason = "the file contains no certificates or private keys"
+		}
+		return content, nil
+	}
+
+	var pkcs7Content contentInfo
+	var pfx pkcs12Pfx
+	var encryptedKeyInfo encryptedPrivateKeyInfo
+	switch {
+	case len(data) == 0 || data[0] != 0x30:
+		// DER-encoded files are a SEQUENCE
+		content.report.Format = X509ImportFileFormatUnknown
+		content.report.SkippedReason = "the format of the file is not supported"
+	case unmarshalDer(data, &pkcs7Content) == nil && pkcs7Content.ContentType.Equal(oidSignedDataContentType):
+		content.report.Format = X509ImportFileFormatPKCS7
+		certPems, err := ParsePKCS7(data)
+		if err != nil {
+			return content, err
+		}
+		content.certPems = certPems
+	case unmarshalDer(data, &pfx) == nil && pfx.Version == 3:
+		content.report.Format = X509ImportFileFormatPKCS12
+		certPems, privKeyPem, err := ParsePKCS12(data, e.password)
+		if err != nil {
+			return content, err
+		}
+		content.certPems = certPems
+		if err = content.addPrivateKey(privKeyPem); err != nil {
+			return content, err
+		}
+	case unmarshalDer(data, &encryptedKeyInfo) == nil:
+		content.report.Format = X509ImportFileFormatDER
+		if err := e.decodePemBlock(content, &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: data}); err != nil {
+			return content, err
+		}
+	default:
+		content.report.Format = X509ImportFileFormatDER
+		if _, err := x509.ParseCertificate(data); err == nil {
+			content.certPems = []*pem.Block{{Type: "CERTIFICATE", Bytes: data}}
+		} else if _, _, err = ParsePrivateKey(data); err == nil {
+			if err = content.addPrivateKey(&pem.Block{Type: "PRIVATE KEY", Bytes: data}); err != nil {
+				return content, err
+			}
+		} else {
+			content.report.Format = X509ImportFileFormatUnknown
+			content.report.SkippedReason = "the DER-encoded file is no certificate, private key, PKCS#7 or PKCS#12 file"
+		}
+	}
+	return content, nil
+}
+
+// decodePemBlock adds the certificates and private keys of the PEM block. Other blocks, e.g. public keys and
+// certificate requests, are ignored.
+func (e *x509ImportFileExtractor) decodePemBlock(content *x509ImportFileContent, block *pem.Block) error {
+	switch block.Type {
+	case "CERTIFICATE":
+		if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return err
+		}
+		content.certPems = append(content.certPems, block)
+	case "PKCS7":
+		certPems, err := ParsePKCS7(block.Bytes)
+		if err != nil {
+			return err
+		}
+		content.certPems = append(content.certPems, certPems...)
+	case "PRIVATE KEY", "RSA PRIVATE KEY", "EC PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+		privKeyPem, err := DecryptPrivateKeyPem(block, e.passphrase)
+		if err != nil {
+			return err
+		}
+		return content.addPrivateKey(privKeyPem)
+	}
+	return nil
+}
+
+func (c *x509ImportFileContent) addPrivateKey(privKeyPem *pem.Block) error {
+	privKey, _, err := ParsePrivateKey(privKeyPem.Bytes)
+	if err != nil {
+		return err
+	}
+	pubKeyHash, err := ComputePublicKeyTypeSpecificHashFromPrivateKey(privKey)
+	if err != nil {
+		return err
+	}
+	c.privKeyPems = append(c.privKeyPems, privKeyPem)
+	c.privKeyPubKeyHashes = append(c.privKeyPubKeyHashes, pubKeyHash)
+	return nil
+}
+
+// isTar returns whether the data starts with a POSIX or GNU tar header.
+func isTar(data []byte) bool {
+	return len(data) >= 512 && bytes.Equal(data[257:262], []byte("ustar"))
+}
+
+func trimExtension(name string, extension string) string {
+	if path.Ext(name) == extension {
+		return name[:len(name)-len(extension)]
+	}
+	return name
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"os"
+	"reflect"
+	"software.sslmate.com/src/go-pkcs12"
+	"sort"
+	"testing"
+)
+
+func TestX509ImportFileExtractor_extract(t *testing.T) {
+	leaf, ca, leafKey := newTestCertificateChain(t)
+	leafKeyDer, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+	pfxData, err := pkcs12.Modern.Encode(leafKey, leaf, []*x509.Certificate{ca}, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pfxWithoutMacData, err := pkcs12.Passwordless.Encode(leafKey, leaf, []*x509.Certificate{ca}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7bData, err := EncodePKCS7(&X509CertificateDetailsDto{
+		Certificate: &X509CertificateDto{CertificatePem: string(leafPem)},
+		Chain:       []*X509CertificateDto{{CertificatePem: string(caPem)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryptedKey, err := os.ReadFile("testdata/private_keys/pkcs8_rsa_2048_pbkdf2_aes256.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type wantContent struct {
+		name          string
+		format        X509ImportFileFormat
+		certCount     int
+		privKeyCount  int
+		skippedReason bool
+	}
+	tests := []struct {
+		name         string
+		files        []*X509ImportFileDto
+		noPasswords  bool
+		wantContents []wantContent
+	}{
+		{
+			name: "PEM and DER",
+			files: []*X509ImportFileDto{
+				{Name: "chain.pem", Data: append(append([]byte{}, leafPem...), caPem...)},
+				{Name: "leaf.cer", Data: leaf.Raw},
+				{Name: "leaf.key", Data: leafKeyDer},
+				{Name: "encrypted.key", Data: encryptedKey},
+			},
+			wantContents: []wantContent{
+				{name: "chain.pem", format: X509ImportFileFormatPEM, certCount: 2},
+				{name: "leaf.cer", format: X509ImportFileFormatDER, certCount: 1},
+				{name: "leaf.key", format: X509ImportFileFormatDER, privKeyCount: 1},
+				{name: "encrypted.key", format: X509ImportFileFormatPEM, privKeyCount: 1},
+			},
+		},
+		{
+			name: "PKCS#7 and PKCS#12",
+			files: []*X509ImportFileDto{
+				{Name: "chain.p7b", Data: p7bData},
+				{Name: "chain.p7c", Data: pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: p7bData})},
+				{Name: "leaf.pfx", Data: pfxData},
+				{Name: "unencrypted.pfx", Data: pfxWithoutMacData},
+			},
+			wantContents: []wantContent{
+				{name: "chain.p7b", format: X509ImportFileFormatPKCS7, certCount: 2},
+				{name: "chain.p7c", format: X509ImportFileFormatPEM, certCount: 2},
+				{name: "leaf.pfx", format: X509ImportFileFormatPKCS12, certCount: 2, privKeyCount: 1},
+				{name: "unencrypted.pfx", format: X509ImportFileFormatPKCS12, certCount: 2, privKeyCount: 1},
+			},
+		},
+		{
+			name: "archives",
+			files: []*X509ImportFileDto{
+				{Name: "certs.zip", Data: newTestZip(t, map[string][]byte{"leaf.pem": leafPem, "README": []byte("text")})},
+				{Name: "certs.tar.gz", Data: newTestTarGz(t, map[string][]byte{"ca/ca.crt": ca.Raw})},
+				{Name: "leaf.pem.gz", Data: newTestGzip(t, leafPem)},
+			},
+			wantContents: []wantContent{
+				{name: "certs.zip/README", format: X509ImportFileFormatUnknown, skippedReason: true},
+				{name: "certs.zip/leaf.pem", format: X509ImportFileFormatPEM, certCount: 1},
+				{name: "certs.tar.gz/ca/ca.crt", format: X509ImportFileFormatDER, certCount: 1},
+				{name: "leaf.pem", format: X509ImportFileFormatPEM, certCount: 1},
+			},
+		},
+		{
+			name: "PEM without certificates",
+			files: []*X509ImportFileDto{
+				{Name: "request.csr", Data: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST"})},
+			},
+			wantContents: []wantContent{
+				{name: "request.csr", format: X509ImportFileFormatPEM, skippedReason: true},
+			},
+		},
+		{
+			name:        "wrong PKCS#12 password",
+			files:       []*X509ImportFileDto{{Name: "leaf.pfx", Data: pfxData}, {Name: "leaf.pem", Data: leafPem}},
+			noPasswords: true,
+			wantContents: []wantContent{
+				{name: "leaf.pfx", format: X509ImportFileFormatPKCS12, skippedReason: true},
+				{name: "leaf.pem", format: X509ImportFileFormatPEM, certCount: 1},
+			},
+		},
+		{
+			name:        "encrypted private key without passphrase",
+			files:       []*X509ImportFileDto{{Name: "encrypted.key", Data: encryptedKey}},
+			noPasswords: true,
+			wantContents: []wantContent{
+				{name: "encrypted.key", format: X509ImportFileFormatPEM, skippedReason: true},
+			},
+		},
+		{
+			name: "malformed certificate",
+			files: []*X509ImportFileDto{
+				{Name: "leaf.pem", Data: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte{0x30}})},
+			},
+			wantContents: []wantContent{
+				{name: "leaf.pem", format: X509ImportFileFormatPEM, skippedReason: true},
+			},
+		},
+		{
+			name: "broken archive",
+			files: []*X509ImportFileDto{
+				{Name: "certs.zip", Data: []byte("PK\x03\x04broken")},
+				{Name: "certs.tar.gz", Data: newTestGzip(t, []byte("broken"))[:20]},
+			},
+			wantContents: []wantContent{
+				{name: "certs.zip", format: X509ImportFileFormatUnknown, skippedReason: true},
+				{name: "certs.tar.gz", format: X509ImportFileFormatUnknown, skippedReason: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor := &x509ImportFileExtractor{
+				remainingDecompressSize: maxImportFilesDecompressedSize,
+				remainingCount:          maxImportFilesCount,
+			}
+			if !tt.noPasswords {
+				extractor.password = "password"
+				extractor.passphrase = "password"
+			}
+			for _, file := range tt.files {
+				if err := extractor.extract(file.Name, file.Data, 0); err != nil {
+					t.Fatalf("extract() got unexpected error: %v", err)
+				}
+			}
+
+			var gotContents []wantContent
+			for _, content := range extractor.contents {
+				gotContents = append(gotContents, wantContent{
+					name:          content.report.Name,
+					format:        content.report.Format,
+					certCount:     len(content.certPems),
+					privKeyCount:  len(content.privKeyPems),
+					skippedReason: content.report.SkippedReason != "",
+				})
+			}
+			if !reflect.DeepEqual(gotContents, tt.wantContents) {
+				t.Errorf("extract() contents = %v, want %v", gotContents, tt.wantContents)
+			}
+		})
+	}
+
+	t.Run("decompressed size limit", func(t *testing.T) {
+		extractor := &x509ImportFileExtractor{remainingDecompressSize: 1024, remainingCount: maxImportFilesCount}
+		err := extractor.extract("zeros.gz", newTestGzip(t, make([]byte, 2048)), 0)
+		if !errors.Is(err, ErrInvalidImportFile) {
+			t.Errorf("extract() error = %v, wantErr %v", err, ErrInvalidImportFile)
+		}
+	})
+	t.Run("nested archives", func(t *testing.T) {
+		data := leafPem
+		for i := 0; i <= maxImportArchiveDepth; i++ {
+			data = newTestGzip(t, data)
+		}
+		extractor := &x509ImportFileExtractor{
+			remainingDecompressSize: maxImportFilesDecompressedSize, remainingCount: maxImportFilesCount,
+		}
+		if err := extractor.extract("leaf.pem.gz", data, 0); !errors.Is(err, ErrInvalidImportFile) {
+			t.Errorf("extract() error = %v, wantErr %v", err, ErrInvalidImportFile)
+		}
+	})
+}
+
+func TestX509ImportService_ImportFiles(t *testing.T) {
+	type txCtxKey struct{}
+	ctx := context.Background()
+	txCtx := context.WithValue(ctx, txCtxKey{}, "tx")
+	fakeClock := clockwork.NewFakeClock()
+	ctrl := gomock.NewController(t)
+	certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+	privKeyRepo := mock_repository.NewMockPrivateKeyRepository(ctrl)
+	outboxEventRepo := mock_repository.NewMockOutboxEventRepository(ctrl)
+	webhookRepo := mock_repository.NewMockWebhookRepository(ctrl)
+	notifier := mock_repository.NewMockX509CertificateUpdateNotifier(ctrl)
+	txManager := mock_repository.NewMockTransactionManager(ctrl)
+	service := NewX509ImportService(
+		&testRepositoryBundle{
+			certRepo: certRepo, privKeyRepo: privKeyRepo, outboxEventRepo: outboxEventRepo, notifier: notifier,
+			txManager: txManager,
+		},
+		NewWebhookService(webhookRepo, nil, certRepo, nil, fakeClock), nil, fakeClock,
+	)
+
+	leaf, ca, leafKey := newTestCertificateChain(t)
+	leafKeyDer, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+	leafKeyPem := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: leafKeyDer})
+	pfxData, err := pkcs12.Modern.Encode(leafKey, leaf, []*x509.Certificate{ca}, "other password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The authority certificate is already stored
+	storedCA, err := service.parseX509Certificate(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txManager.EXPECT().BeginTx(ctx).Return(txCtx, nil)
+	txManager.EXPECT().CommitTx(txCtx).Return(nil)
+	certRepo.EXPECT().FindAllByByteHashes(txCtx, gomock.Any()).
+		Return([]*repository.X509CertificateDao{storedCA}, nil)
+	certRepo.EXPECT().FindByPublicKeyHashAndNoPrivateKeySet(txCtx, gomock.Any()).Return(nil, nil)
+	certRepo.EXPECT().FindBySubjectHash(txCtx, gomock.Any()).
+		Return([]*repository.X509CertificateDao{storedCA}, nil)
+	certRepo.EXPECT().FindByIssuerHashAndNoParentSet(txCtx, gomock.Any()).Return(nil, nil)
+	// Certificates and private keys contained by several files are only imported once
+	certRepo.EXPECT().GetOrCreate(txCtx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, cert *repository.X509CertificateDao) (*repository.X509CertificateDao, error) {
+			return cert, nil
+		},
+	)
+	privKeyRepo.EXPECT().GetOrCreate(txCtx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, privKey *repository.X509PrivateKeyDao) (*repository.X509PrivateKeyDao, error) {
+			return privKey, nil
+		},
+	)
+	outboxEventRepo.EXPECT().Create(txCtx, gomock.Any()).Return(nil, nil)
+	webhookRepo.EXPECT().FindSubscriptionIDs(txCtx).Return(nil, nil)
+	notifier.EXPECT().Notify(txCtx).Return(nil)
+
+	certs, privKeys, reports, err := service.ImportFiles(ctx, []*X509ImportFileDto{
+		{Name: "leaf.pem", Data: bytes.Join([][]byte{leafPem, caPem, leafKeyPem}, nil)},
+		{Name: "chain.pem", Data: bytes.Join([][]byte{leafPem, caPem}, nil)},
+		{Name: "leaf.pfx", Data: pfxData},
+	}, "password", "")
+	if err != nil {
+		t.Fatalf("ImportFiles() got unexpected error: %v", err)
+	}
+	if len(certs) != 2 || len(privKeys) != 1 {
+		t.Fatalf("ImportFiles() = %d certificates and %d private keys, want 2 and 1", len(certs), len(privKeys))
+	}
+	var leafID uuid.UUID
+	for _, cert := range certs {
+		if cert.ID != storedCA.ID {
+			leafID = cert.ID
+		}
+	}
+	privKeyID := privKeys[0].ID
+
+	wantReports := []*X509ImportFileReportDto{
+		{
+			Name:                  "leaf.pem",
+			Format:                X509ImportFileFormatPEM,
+			CreatedCertificateIDs: []uuid.UUID{leafID},
+			SkippedCertificateIDs: []uuid.UUID{storedCA.ID},
+			CreatedPrivateKeyIDs:  []uuid.UUID{privKeyID},
+		},
+		{
+			Name:                  "chain.pem",
+			Format:                X509ImportFileFormatPEM,
+			SkippedCertificateIDs: []uuid.UUID{leafID, storedCA.ID},
+		},
+	}
+	if len(reports) != 3 {
+		t.Fatalf("ImportFiles() = %d reports, want 3", len(reports))
+	}
+	for idx, want := range wantReports {
+		if !reflect.DeepEqual(reports[idx], want) {
+			t.Errorf("ImportFiles() report %d = %+v, want %+v", idx, reports[idx], want)
+		}
+	}
+	// The PKCS#12 file with another password doesn't fail the import of the other files
+	if reports[2].Name != "leaf.pfx" || reports[2].Format != X509ImportFileFormatPKCS12 || reports[2].SkippedReason == "" {
+		t.Errorf("ImportFiles() report 2 = %+v, want skipped PKCS#12 file", reports[2])
+	}
+}
+
+func newTestZip(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zipWriter := zip.NewWriter(&buf)
+	// Sorted like the expected contents, as maps aren't ordered
+	for _, name := range sortedKeys(files) {
+		writer, err := zipWriter.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = writer.Write(files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func newTestTarGz(t *testing.T, files map[string][]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	for _, name := range sortedKeys(files) {
+		err := tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name]))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = tarWriter.Write(files[name]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return newTestGzip(t, buf.Bytes())
+}
+
+func newTestGzip(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gzipWriter := gzip.NewWriter(&buf)
+	if _, err := gzipWriter.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sortedKeys(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"github.com/golang/mock/gomock"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"reflect"
+	"testing"
+)
+
+func TestX509ImportService_Import_PrivateKeyFormats(t *testing.T) {
+	type txCtxKey struct{}
+	ctx := context.Background()
+	txCtx := context.WithValue(ctx, txCtxKey{}, "tx")
+
+	tests := []struct {
+		name     string
+		filePath string
+	}{
+		{name: "PKCS1", filePath: "testdata/private_keys/pkcs1_rsa_2048.pem"},
+		{name: "SEC1", filePath: "testdata/private_keys/ec_ecdsa_prime256v1.pem"},
+		{name: "PKCS8", filePath: "testdata/private_keys/pkcs8_ed25519_256.pem"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			certRepo := mock_repository.NewMockX509CertificateRepository(ctrl)
+			privKeyRepo := mock_repository.NewMockPrivateKeyRepository(ctrl)
+			txManager := mock_repository.NewMockTransactionManager(ctrl)
+
+			txManager.EXPECT().BeginTx(ctx).Return(txCtx, nil)
+			txManager.EXPECT().CommitTx(txCtx).Return(nil)
+			certRepo.EXPECT().FindAllByByteHashes(txCtx, gomock.Any()).Return(nil, nil).AnyTimes()
+			certRepo.EXPECT().FindByPublicKeyHashAndNoPrivateKeySet(txCtx, gomock.Any()).Return(nil, nil)
+			var storedPrivKey *repository.X509PrivateKeyDao
+			privKeyRepo.EXPECT().GetOrCreate(txCtx, gomock.Any()).DoAndReturn(
+				func(_ context.Context, privKey *repository.X509PrivateKeyDao) (*repository.X509PrivateKeyDao, error) {
+					storedPrivKey = privKey
+					return privKey, nil
+				},
+			)
+
+			service := NewX509ImportService(
+				&testRepositoryBundle{certRepo: certRepo, privKeyRepo: privKeyRepo, txManager: txManager},
+				nil, nil, clockwork.NewFakeClock(),
+			)
+			privKeyPem := readPemFile(t, tt.filePath)
+			_, _, err := service.Import(ctx, nil, []*pem.Block{privKeyPem})
+			if err != nil {
+				t.Fatalf("Import() got unexpected error: %v", err)
+			}
+
+			if storedPrivKey.PemBlockType != "PRIVATE KEY" {
+				t.Errorf("Import() stored PEM block type = %v, want PRIVATE KEY", storedPrivKey.PemBlockType)
+			}
+			gotKey, err := x509.ParsePKCS8PrivateKey(storedPrivKey.Bytes)
+			if err != nil {
+				t.Fatalf("Import() stored key which isn't PKCS#8: %v", err)
+			}
+			wantKey, _, err := ParsePrivateKey(privKeyPem.Bytes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotKey, wantKey) {
+				t.Errorf("Import() stored key = %v, want %v", gotKey, wantKey)
+			}
+			if !reflect.DeepEqual(storedPrivKey.BytesHash, ComputeBytesHash(storedPrivKey.Bytes)) {
+				t.Errorf("Import() stored bytes hash doesn't match the PKCS#8 bytes")
+			}
+		})
+	}
+}
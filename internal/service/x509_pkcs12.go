@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+var (
+	// ErrInvalidPKCS12 is returned for PKCS#12 data which can't be decoded, e.g. because the password is wrong.
+	ErrInvalidPKCS12 = errors.New("invalid PKCS#12 data or password")
+	// ErrNoPrivateKey is returned when exporting a certificate without private key as PKCS#12.
+	ErrNoPrivateKey = errors.New("certificate has no private key")
+)
+
+// PKCS12Algorithm selects how exported PKCS#12 data is encrypted and authenticated.
+type PKCS12Algorithm string
+
+const (
+	// PKCS12AlgorithmAES256 encrypts with PBES2 using PBKDF2-HMAC-SHA-256 and AES-256-CBC and authenticates with
+	// HMAC-SHA-256, like OpenSSL 3 does by default. It's supported by Java 12 and Windows Server 2019 and later.
+	PKCS12AlgorithmAES256 PKCS12Algorithm = "aes256"
+	// PKCS12AlgorithmLegacy encrypts with 3DES and authenticates with HMAC-SHA-1, like OpenSSL's -descert option. It's
+	// weak, but supported by most software.
+	PKCS12AlgorithmLegacy PKCS12Algorithm = "legacy"
+)
+
+var (
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidFriendlyName        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+// ASN.1 structures of RFC 7292
+
+type pkcs12Pfx struct {
+	Version  int
+	AuthSafe contentInfo
+	MacData  pkcs12MacData `asn1:"optional"`
+}
+
+type pkcs12MacData struct {
+	Mac        pkcs12DigestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type pkcs12DigestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pkcs12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID     asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// ParsePKCS12 decodes the PKCS#12 data into PEM blocks as they are imported: the certificate followed by its chain,
+// and the private key as PKCS#8. The data has to contain exactly one certificate with its private key. Both the legacy
+// RC2 and 3DES and the AES based encryption are supported. Data without MAC is decoded without password, so its
+// certificate and private key must not be encrypted.
+func ParsePKCS12(pfxData []byte, password string) (certPems []*pem.Block, privKeyPem *pem.Block, err error) {
+	// go-pkcs12 only accepts data without MAC, which has nothing to verify the password with, with an empty password
+	var pfx pkcs12Pfx
+	if unmarshalDer(pfxData, &pfx) == nil && len(pfx.MacData.Mac.Algorithm.Algorithm) == 0 {
+		password = ""
+	}
+
+	privKey, cert, caCerts, err := pkcs12.DecodeChain(pfxData, password)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidPKCS12, err)
+	}
+	privKeyDer, err := x509.MarshalPKCS8PrivateKey(privKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", ErrInvalidPKCS12, err)
+	}
+
+	certPems = make([]*pem.Block, 0, len(caCerts)+1)
+	for _, cert := range append([]*x509.Certificate{cert}, caCerts...) {
+		certPems = append(certPems, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return certPems, &pem.Block{Type: "PRIVATE KEY", Bytes: privKeyDer}, nil
+}
+
+// ImportPKCS12 imports the certificate, chain and private key of the PKCS#12 data like Import. It returns
+// ErrInvalidPKCS12 if the data can't be decoded.
+func (x *X509ImportService) ImportPKCS12(
+	ctx context.Context, pfxData []byte, password string,
+) ([]*X509CertificateDto, []*X509PrivateKeyDto, error) {
+	certPems, privKeyPem, err := ParsePKCS12(pfxData, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	return x.Import(ctx, certPems, []*pem.Block{privKeyPem})
+}
+
+// EncodePKCS12 encodes the certificate, its chain and its private key as PKCS#12 data protected by the password. If
+// the friendly name isn't empty, it's set on the private key, e.g. Java and Windows use it as alias of the key entry.
+// It returns ErrNoPrivateKey if the details don't contain a private key.
+func EncodePKCS12(
+	details *X509CertificateDetailsDto, password string, algorithm PKCS12Algorithm, friendlyName string,
+) ([]byte, error) {
+	if details.PrivateKey == nil {
+		return nil, ErrNoPrivateKey
+	}
+
+	var encoder *pkcs12.Encoder
+	switch algorithm {
+	case PKCS12AlgorithmAES256:
+		encoder = pkcs12.Modern
+	case PKCS12AlgorithmLegacy:
+		// LegacyDES derives the MAC key with a single iteration, OpenSSL uses 2048 like for the encryption keys
+		encoder = pkcs12.LegacyDES.WithIterations(pkcs12MACIterations)
+	default:
+		return nil, fmt.Errorf("unsupported PKCS#12 algorithm %s", algorithm)
+	}
+
+	privKeyPem, _ := pem.Decode([]byte(details.PrivateKey.PemPrivateKey))
+	if privKeyPem == nil {
+		return nil, fmt.Errorf("private key %s is no PEM block", details.PrivateKey.ID)
+	}
+	privKey, _, err := ParsePrivateKey(privKeyPem.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	certs := make([]*x509.Certificate, 0, len(details.Chain)+1)
+	for _, cert := range append([]*X509CertificateDto{details.Certificate}, details.Chain...) {
+		certPem, _ := pem.Decode([]byte(cert.CertificatePem))
+		if certPem == nil {
+			return nil, fmt.Errorf("certificate %s is no PEM block", cert.ID)
+		}
+		parsedCert, err := x509.ParseCertificate(certPem.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, parsedCert)
+	}
+
+	pfxData, err := encoder.Encode(privKey, certs[0], certs[1:], password)
+	if err != nil {
+		return nil, err
+	}
+	if friendlyName == "" {
+		return pfxData, nil
+	}
+	return setPKCS12FriendlyName(pfxData, password, friendlyName)
+}
+
+// pkcs12MACIterations is the iteration count of the MAC key derivation of legacy PKCS#12 data.
+const pkcs12MACIterations = 2048
+
+// setPKCS12FriendlyName adds the friendly name attribute, which go-pkcs12 doesn't support, to the private key bag of
+// the PKCS#12 data and recomputes the MAC. The key bag isn't encrypted as a whole, only the key inside it is, so the
+// attribute can be added without decrypting anything.
+func setPKCS12FriendlyName(pfxData []byte, password string, friendlyName string) ([]byte, error) {
+	var pfx pkcs12Pfx
+	if err := unmarshalDer(pfxData, &pfx); err != nil {
+		return nil, err
+	}
+	var authSafeDer []byte
+	if err := unmarshalDer(pfx.AuthSafe.Content.Bytes, &authSafeDer); err != nil {
+		return nil, err
+	}
+	var authSafe []contentInfo
+	if err := unmarshalDer(authSafeDer, &authSafe); err != nil {
+		return nil, err
+	}
+
+	friendlyNameDer, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: bmpString(friendlyName)})
+	if err != nil {
+		return nil, err
+	}
+	for idx, content := range authSafe {
+		if !content.ContentType.Equal(oidDataContentType) {
+			continue
+		}
+		var bagsDer []byte
+		if err := unmarshalDer(content.Content.Bytes, &bagsDer); err != nil {
+			return nil, err
+		}
+		var bags []pkcs12SafeBag
+		if err := unmarshalDer(bagsDer, &bags); err != nil {
+			return nil, err
+		}
+		for bagIdx := range bags {
+			if bags[bagIdx].ID.Equal(oidPKCS8ShroudedKeyBag) {
+				bags[bagIdx].Attributes = append(bags[bagIdx].Attributes, pkcs12Attribute{
+					ID: oidFriendlyName, Values: []asn1.RawValue{{FullBytes: friendlyNameDer}},
+				})
+			}
+		}
+		if authSafe[idx], err = pkcs12Data(bags); err != nil {
+			return nil, err
+		}
+	}
+
+	if authSafeDer, err = asn1.Marshal(authSafe); err != nil {
+		return nil, err
+	}
+	if pfx.AuthSafe, err = pkcs12Data(asn1.RawValue{FullBytes: authSafeDer}); err != nil {
+		return nil, err
+	}
+
+	macHash := sha1.New
+	if pfx.MacData.Mac.Algorithm.Algorithm.Equal(oidSHA256) {
+		macHash = sha256.New
+	}
+	mac := hmac.New(macHash, pkcs12KDF(
+		macHash, pfx.MacData.MacSalt, bmpStringZeroTerminated(password), pfx.MacData.Iterations, pkcs12KDFMACID,
+		macHash().Size(),
+	))
+	mac.Write(authSafeDer)
+	pfx.MacData.Mac.Digest = mac.Sum(nil)
+	return asn1.Marshal(pfx)
+}
+
+// pkcs12Data wraps the DER encoding of the value in a data content info.
+func pkcs12Data(value any) (contentInfo, error) {
+	der, err := asn1.Marshal(value)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	octetString, err := asn1.Marshal(der)
+	if err != nil {
+		return contentInfo{}, err
+	}
+	return contentInfo{ContentType: oidDataContentType, Content: explicitContent(octetString)}, nil
+}
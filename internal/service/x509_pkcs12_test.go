@@ -0,0 +1,209 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"reflect"
+	"software.sslmate.com/src/go-pkcs12"
+	"testing"
+	"time"
+)
+
+// newTestCertificateChain returns a leaf certificate for example.invalid issued by a self-signed CA, and the private
+// key of the leaf certificate.
+func newTestCertificateChain(t *testing.T) (leaf *x509.Certificate, ca *x509.Certificate, leafKey crypto.Signer) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notBefore := time.Now().Add(-time.Hour)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDer, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err = x509.ParseCertificate(caDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "example.invalid"},
+		DNSNames:     []string{"example.invalid"},
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	leafDer, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, leafKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err = x509.ParseCertificate(leafDer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf, ca, leafKey
+}
+
+func TestParsePKCS12(t *testing.T) {
+	leaf, ca, leafKey := newTestCertificateChain(t)
+	wantCertPems := []*pem.Block{
+		{Type: "CERTIFICATE", Bytes: leaf.Raw},
+		{Type: "CERTIFICATE", Bytes: ca.Raw},
+	}
+	leafKeyDer, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPrivKeyPem := &pem.Block{Type: "PRIVATE KEY", Bytes: leafKeyDer}
+
+	tests := []struct {
+		name     string
+		encoder  *pkcs12.Encoder
+		password string
+		wantErr  error
+	}{
+		{name: "legacy RC2", encoder: pkcs12.LegacyRC2, password: "password"},
+		{name: "legacy 3DES", encoder: pkcs12.LegacyDES, password: "password"},
+		{name: "AES", encoder: pkcs12.Modern, password: "password"},
+		{name: "wrong password", encoder: pkcs12.Modern, password: "wrong", wantErr: ErrInvalidPKCS12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pfxData, err := tt.encoder.Encode(leafKey, leaf, []*x509.Certificate{ca}, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			gotCertPems, gotPrivKeyPem, err := ParsePKCS12(pfxData, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParsePKCS12() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			if !reflect.DeepEqual(gotCertPems, wantCertPems) {
+				t.Errorf("ParsePKCS12() gotCertPems = %v, want %v", gotCertPems, wantCertPems)
+			}
+			if !reflect.DeepEqual(gotPrivKeyPem, wantPrivKeyPem) {
+				t.Errorf("ParsePKCS12() gotPrivKeyPem = %v, want %v", gotPrivKeyPem, wantPrivKeyPem)
+			}
+		})
+	}
+	t.Run("without MAC", func(t *testing.T) {
+		pfxData, err := pkcs12.Passwordless.Encode(leafKey, leaf, []*x509.Certificate{ca}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The password can't be verified without MAC and is ignored
+		gotCertPems, gotPrivKeyPem, err := ParsePKCS12(pfxData, "password")
+		if err != nil {
+			t.Fatalf("ParsePKCS12() got unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(gotCertPems, wantCertPems) || !reflect.DeepEqual(gotPrivKeyPem, wantPrivKeyPem) {
+			t.Errorf("ParsePKCS12() = %v, %v, want %v, %v", gotCertPems, gotPrivKeyPem, wantCertPems, wantPrivKeyPem)
+		}
+	})
+	t.Run("malformed data", func(t *testing.T) {
+		if _, _, err := ParsePKCS12([]byte("not a PKCS#12 file"), "password"); !errors.Is(err, ErrInvalidPKCS12) {
+			t.Errorf("ParsePKCS12() error = %v, wantErr %v", err, ErrInvalidPKCS12)
+		}
+	})
+}
+
+func TestEncodePKCS12(t *testing.T) {
+	leaf, ca, leafKey := newTestCertificateChain(t)
+	leafKeyDer, err := x509.MarshalPKCS8PrivateKey(leafKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafDto := &X509CertificateDto{
+		CertificatePem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})),
+	}
+	caDto := &X509CertificateDto{
+		CertificatePem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+	}
+	privKeyDto := &X509PrivateKeyDto{
+		PemPrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: leafKeyDer})),
+	}
+
+	for _, algorithm := range []PKCS12Algorithm{PKCS12AlgorithmAES256, PKCS12AlgorithmLegacy} {
+		t.Run(string(algorithm), func(t *testing.T) {
+			details := &X509CertificateDetailsDto{
+				Certificate: leafDto, Chain: []*X509CertificateDto{caDto}, PrivateKey: privKeyDto,
+			}
+			pfxData, err := EncodePKCS12(details, "password", algorithm, "")
+			if err != nil {
+				t.Fatalf("EncodePKCS12() got unexpected error: %v", err)
+			}
+			gotPrivKey, gotCert, gotCaCerts, err := pkcs12.DecodeChain(pfxData, "password")
+			if err != nil {
+				t.Fatalf("EncodePKCS12() returned undecodable data: %v", err)
+			}
+			if !gotCert.Equal(leaf) {
+				t.Errorf("EncodePKCS12() certificate = %v, want %v", gotCert.Subject, leaf.Subject)
+			}
+			if len(gotCaCerts) != 1 || !gotCaCerts[0].Equal(ca) {
+				t.Errorf("EncodePKCS12() chain = %v, want %v", gotCaCerts, []*x509.Certificate{ca})
+			}
+			if !leafKey.(*ecdsa.PrivateKey).Equal(gotPrivKey) {
+				t.Errorf("EncodePKCS12() private key doesn't match")
+			}
+
+			// ToPEM only supports a certificate and a private key, but exposes the attributes of both. It verifies the
+			// MAC, which has to be recomputed for the friendly name.
+			details.Chain = nil
+			pfxData, err = EncodePKCS12(details, "password", algorithm, "example")
+			if err != nil {
+				t.Fatalf("EncodePKCS12() got unexpected error: %v", err)
+			}
+			blocks, err := pkcs12.ToPEM(pfxData, "password")
+			if err != nil {
+				t.Fatalf("EncodePKCS12() returned undecodable data: %v", err)
+			}
+			for _, block := range blocks {
+				if got := block.Headers["friendlyName"]; block.Type == "PRIVATE KEY" && got != "example" {
+					t.Errorf("EncodePKCS12() friendly name of %s = %v, want %v", block.Type, got, "example")
+				}
+			}
+
+			var pfx pkcs12Pfx
+			if err := unmarshalDer(pfxData, &pfx); err != nil {
+				t.Fatal(err)
+			}
+			if pfx.MacData.Iterations < 2048 {
+				t.Errorf("EncodePKCS12() MAC iterations = %d, want at least 2048", pfx.MacData.Iterations)
+			}
+		})
+	}
+
+	t.Run("without private key", func(t *testing.T) {
+		details := &X509CertificateDetailsDto{Certificate: leafDto}
+		if _, err := EncodePKCS12(details, "password", PKCS12AlgorithmAES256, ""); !errors.Is(err, ErrNoPrivateKey) {
+			t.Errorf("EncodePKCS12() error = %v, wantErr %v", err, ErrNoPrivateKey)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidPKCS7 is returned for PKCS#7 data which can't be decoded or doesn't contain certificates.
+var ErrInvalidPKCS7 = errors.New("invalid PKCS#7 data")
+
+var (
+	oidDataContentType       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedDataContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+)
+
+// ASN.1 structures of RFC 2315, which are also used by PKCS#12
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"optional"`
+}
+
+type pkcs7SignedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     pkcs7RawCertificates `asn1:"optional,tag:0"`
+	CRLs             []asn1.RawValue      `asn1:"optional,tag:1"`
+	SignerInfos      []asn1.RawValue      `asn1:"set"`
+}
+
+// pkcs7RawCertificates contains the [0] IMPLICIT SET OF certificates, which are decoded by x509.ParseCertificates.
+type pkcs7RawCertificates struct {
+	Raw asn1.RawContent
+}
+
+// ParsePKCS7 decodes the certificates of PKCS#7 SignedData, e.g. of a .p7b file, into PEM blocks as they are imported.
+// The data may be DER or a "PKCS7" PEM block. The signature of the SignedData isn't verified, as bundles of
+// certificates usually aren't signed.
+func ParsePKCS7(data []byte) (certPems []*pem.Block, err error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "PKCS7" {
+			return nil, fmt.Errorf("%w: unexpected PEM block %s", ErrInvalidPKCS7, block.Type)
+		}
+		der = block.Bytes
+	}
+
+	var content contentInfo
+	if err = unmarshalDer(der, &content); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPKCS7, err)
+	}
+	if !content.ContentType.Equal(oidSignedDataContentType) {
+		return nil, fmt.Errorf("%w: unsupported content type %s", ErrInvalidPKCS7, content.ContentType)
+	}
+	var signedData pkcs7SignedData
+	if err = unmarshalDer(content.Content.Bytes, &signedData); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPKCS7, err)
+	}
+	var rawCerts asn1.RawValue
+	if len(signedData.Certificates.Raw) != 0 {
+		if err = unmarshalDer(signedData.Certificates.Raw, &rawCerts); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidPKCS7, err)
+		}
+	}
+	certs, err := x509.ParseCertificates(rawCerts.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidPKCS7, err)
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("%w: no certificates", ErrInvalidPKCS7)
+	}
+
+	certPems = make([]*pem.Block, len(certs))
+	for idx, cert := range certs {
+		certPems[idx] = &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}
+	}
+	return certPems, nil
+}
+
+// ImportPKCS7 imports the certificates of the PKCS#7 data like Import. It returns ErrInvalidPKCS7 if the data can't be
+// decoded.
+func (x *X509ImportService) ImportPKCS7(
+	ctx context.Context, data []byte,
+) ([]*X509CertificateDto, error) {
+	certPems, err := ParsePKCS7(data)
+	if err != nil {
+		return nil, err
+	}
+	createdCerts, _, err := x.Import(ctx, certPems, nil)
+	return createdCerts, err
+}
+
+// EncodePKCS7 encodes the certificate and its chain as degenerate PKCS#7 SignedData without content and signers, as
+// used by .p7b files.
+func EncodePKCS7(details *X509CertificateDetailsDto) ([]byte, error) {
+	var certDers bytes.Buffer
+	for _, cert := range append([]*X509CertificateDto{details.Certificate}, details.Chain...) {
+		certPem, _ := pem.Decode([]byte(cert.CertificatePem))
+		if certPem == nil {
+			return nil, fmt.Errorf("certificate %s is no PEM block", cert.ID)
+		}
+		certDers.Write(certPem.Bytes)
+	}
+	rawCerts, err := asn1.Marshal(asn1.RawValue{
+		Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certDers.Bytes(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signedDataDer, err := asn1.Marshal(pkcs7SignedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{},
+		ContentInfo:      contentInfo{ContentType: oidDataContentType},
+		Certificates:     pkcs7RawCertificates{Raw: rawCerts},
+		SignerInfos:      []asn1.RawValue{},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{ContentType: oidSignedDataContentType, Content: explicitContent(signedDataDer)})
+}
+
+// explicitContent tags the DER with [0] EXPLICIT.
+func explicitContent(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
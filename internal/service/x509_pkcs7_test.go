@@ -0,0 +1,97 @@
+package service
+
+import (
+	"encoding/pem"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestEncodePKCS7(t *testing.T) {
+	leaf, ca, _ := newTestCertificateChain(t)
+	details := &X509CertificateDetailsDto{
+		Certificate: &X509CertificateDto{
+			CertificatePem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})),
+		},
+		Chain: []*X509CertificateDto{{
+			CertificatePem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+		}},
+	}
+	wantCertPems := []*pem.Block{
+		{Type: "CERTIFICATE", Bytes: leaf.Raw},
+		{Type: "CERTIFICATE", Bytes: ca.Raw},
+	}
+
+	p7bData, err := EncodePKCS7(details)
+	if err != nil {
+		t.Fatalf("EncodePKCS7() got unexpected error: %v", err)
+	}
+	gotCertPems, err := ParsePKCS7(p7bData)
+	if err != nil {
+		t.Fatalf("EncodePKCS7() returned undecodable data: %v", err)
+	}
+	if !reflect.DeepEqual(gotCertPems, wantCertPems) {
+		t.Errorf("EncodePKCS7() certificates = %v, want %v", gotCertPems, wantCertPems)
+	}
+}
+
+func TestParsePKCS7(t *testing.T) {
+	leaf, ca, _ := newTestCertificateChain(t)
+	p7bDer, err := EncodePKCS7(&X509CertificateDetailsDto{
+		Certificate: &X509CertificateDto{
+			CertificatePem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})),
+		},
+		Chain: []*X509CertificateDto{{
+			CertificatePem: string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantCertPems := []*pem.Block{
+		{Type: "CERTIFICATE", Bytes: leaf.Raw},
+		{Type: "CERTIFICATE", Bytes: ca.Raw},
+	}
+	opensslP7b, err := os.ReadFile("testdata/pkcs7/crl2pkcs7.p7b")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		data         []byte
+		wantCertPems []*pem.Block
+		wantErr      error
+	}{
+		{name: "DER", data: p7bDer, wantCertPems: wantCertPems},
+		{
+			name:         "PEM",
+			data:         pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: p7bDer}),
+			wantCertPems: wantCertPems,
+		},
+		{
+			name:         "openssl crl2pkcs7",
+			data:         opensslP7b,
+			wantCertPems: []*pem.Block{{Type: "CERTIFICATE", Bytes: readPemFile(t, "testdata/pkcs7/certificate.pem").Bytes}},
+		},
+		{
+			name:    "other PEM block",
+			data:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw}),
+			wantErr: ErrInvalidPKCS7,
+		},
+		{name: "certificate DER", data: leaf.Raw, wantErr: ErrInvalidPKCS7},
+		{name: "malformed data", data: []byte("not a PKCS#7 file"), wantErr: ErrInvalidPKCS7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotCertPems, err := ParsePKCS7(tt.data)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParsePKCS7() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(gotCertPems, tt.wantCertPems) {
+				t.Errorf("ParsePKCS7() gotCertPems = %v, want %v", gotCertPems, tt.wantCertPems)
+			}
+		})
+	}
+}
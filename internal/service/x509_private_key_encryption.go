@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/pki-vault/server/internal/db/repository"
+)
+
+// X509PrivateKeyEncryptionService maintains the encryption of persisted private keys and webhook secrets.
+// All operations process the keys in batches, each batch in its own transaction. An interrupted operation thus keeps
+// the progress of its committed batches and can simply be started again.
+type X509PrivateKeyEncryptionService struct {
+	repository.Bundle
+}
+
+func NewX509PrivateKeyEncryptionService(bundle repository.Bundle) *X509PrivateKeyEncryptionService {
+	return &X509PrivateKeyEncryptionService{Bundle: bundle}
+}
+
+// EncryptPlaintextKeys encrypts all private keys persisted before encryption was enabled.
+func (x *X509PrivateKeyEncryptionService) EncryptPlaintextKeys(ctx context.Context, batchSize int) (int64, error) {
+	return x.processInBatches(ctx, batchSize, x.X509PrivateKeyRepository().EncryptPlaintextKeys)
+}
+
+// RewrapDataKeys re-wraps all data keys which are not wrapped by the current master key yet.
+// Once it finished, previous master keys are no longer needed to decrypt private keys.
+func (x *X509PrivateKeyEncryptionService) RewrapDataKeys(ctx context.Context, batchSize int) (int64, error) {
+	return x.processInBatches(ctx, batchSize, x.X509PrivateKeyRepository().RewrapDataKeys)
+}
+
+// EncryptPlaintextWebhookSecrets encrypts all webhook secrets persisted before encryption was enabled.
+func (x *X509PrivateKeyEncryptionService) EncryptPlaintextWebhookSecrets(ctx context.Context, batchSize int) (int64, error) {
+	return x.processInBatches(ctx, batchSize, x.WebhookRepository().EncryptPlaintextSecrets)
+}
+
+// RewrapWebhookDataKeys re-wraps all data keys of webhook secrets which are not wrapped by the current master key
+// yet.
+func (x *X509PrivateKeyEncryptionService) RewrapWebhookDataKeys(ctx context.Context, batchSize int) (int64, error) {
+	return x.processInBatches(ctx, batchSize, x.WebhookRepository().RewrapDataKeys)
+}
+
+func (x *X509PrivateKeyEncryptionService) processInBatches(
+	ctx context.Context, batchSize int, processBatch func(ctx context.Context, limit int) (int64, error),
+) (processedKeys int64, err error) {
+	if batchSize <= 0 {
+		return 0, fmt.Errorf("batch size must be positive, got %d", batchSize)
+	}
+
+	for {
+		processedBatchKeys, err := x.processBatch(ctx, batchSize, processBatch)
+		if err != nil {
+			return processedKeys, err
+		}
+		processedKeys += processedBatchKeys
+		if processedBatchKeys < int64(batchSize) {
+			return processedKeys, nil
+		}
+	}
+}
+
+func (x *X509PrivateKeyEncryptionService) processBatch(
+	ctx context.Context, batchSize int, processBatch func(ctx context.Context, limit int) (int64, error),
+) (processedKeys int64, err error) {
+	txCtx, err := x.TransactionManager().BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			rollbackErr := x.TransactionManager().RollbackTx(txCtx)
+			if rollbackErr != nil {
+				panic(fmt.Errorf("unable to rollback transaction for panic: %s: %w", p, rollbackErr))
+			}
+			panic(p)
+		}
+		if err != nil {
+			rollbackErr := x.TransactionManager().RollbackTx(txCtx)
+			if rollbackErr != nil {
+				panic(fmt.Errorf("unable to rollback transaction: %w", err))
+			}
+		}
+	}()
+
+	processedKeys, err = processBatch(txCtx, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	err = x.TransactionManager().CommitTx(txCtx)
+	if err != nil {
+		return 0, err
+	}
+	return processedKeys, nil
+}
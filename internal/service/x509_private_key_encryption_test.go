@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/pki-vault/server/internal/db/repository"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"testing"
+)
+
+type testRepositoryBundle struct {
+	certRepo        repository.X509CertificateRepository
+	privKeyRepo     repository.PrivateKeyRepository
+	outboxEventRepo repository.OutboxEventRepository
+	notifier        repository.X509CertificateUpdateNotifier
+	txManager       repository.TransactionManager
+}
+
+func (t *testRepositoryBundle) X509CertificateRepository() repository.X509CertificateRepository {
+	return t.certRepo
+}
+
+func (t *testRepositoryBundle) X509CertificateSubscriptionRepository() repository.X509CertificateSubscriptionRepository {
+	return nil
+}
+
+func (t *testRepositoryBundle) X509PrivateKeyRepository() repository.PrivateKeyRepository {
+	return t.privKeyRepo
+}
+
+func (t *testRepositoryBundle) SealConfigurationRepository() repository.SealConfigurationRepository {
+	return nil
+}
+
+func (t *testRepositoryBundle) APITokenRepository() repository.APITokenRepository {
+	return nil
+}
+
+func (t *testRepositoryBundle) WebhookRepository() repository.WebhookRepository {
+	return nil
+}
+
+func (t *testRepositoryBundle) WebhookDeliveryRepository() repository.WebhookDeliveryRepository {
+	return nil
+}
+
+func (t *testRepositoryBundle) X509CertificateUpdateNotifier() repository.X509CertificateUpdateNotifier {
+	return t.notifier
+}
+
+func (t *testRepositoryBundle) OutboxEventRepository() repository.OutboxEventRepository {
+	return t.outboxEventRepo
+}
+
+func (t *testRepositoryBundle) ExpiryAlertRepository() repository.ExpiryAlertRepository {
+	return nil
+}
+
+func (t *testRepositoryBundle) TransactionManager() repository.TransactionManager {
+	return t.txManager
+}
+
+func TestX509PrivateKeyEncryptionService_RewrapDataKeys(t *testing.T) {
+	type txCtxKey struct{}
+	ctx := context.Background()
+	txCtx := context.WithValue(ctx, txCtxKey{}, "tx")
+
+	tests := []struct {
+		name         string
+		batchSize    int
+		batches      []int64
+		batchErr     error
+		want         int64
+		wantErr      bool
+		wantRollback bool
+	}{
+		{
+			name:      "process batches until a batch is not full",
+			batchSize: 2,
+			batches:   []int64{2, 2, 1},
+			want:      5,
+		},
+		{
+			name:      "process an empty batch if all batches were full",
+			batchSize: 2,
+			batches:   []int64{2, 0},
+			want:      2,
+		},
+		{
+			name:         "keep committed batches on error",
+			batchSize:    2,
+			batches:      []int64{2},
+			batchErr:     errors.New("failed"),
+			want:         2,
+			wantErr:      true,
+			wantRollback: true,
+		},
+		{
+			name:      "reject invalid batch size",
+			batchSize: 0,
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			privKeyRepo := mock_repository.NewMockPrivateKeyRepository(ctrl)
+			txManager := mock_repository.NewMockTransactionManager(ctrl)
+
+			var calls []*gomock.Call
+			for _, batch := range tt.batches {
+				calls = append(calls,
+					txManager.EXPECT().BeginTx(ctx).Return(txCtx, nil),
+					privKeyRepo.EXPECT().RewrapDataKeys(txCtx, tt.batchSize).Return(batch, nil),
+					txManager.EXPECT().CommitTx(txCtx).Return(nil),
+				)
+			}
+			if tt.batchErr != nil {
+				calls = append(calls,
+					txManager.EXPECT().BeginTx(ctx).Return(txCtx, nil),
+					privKeyRepo.EXPECT().RewrapDataKeys(txCtx, tt.batchSize).Return(int64(0), tt.batchErr),
+				)
+			}
+			if tt.wantRollback {
+				calls = append(calls, txManager.EXPECT().RollbackTx(txCtx).Return(nil))
+			}
+			gomock.InOrder(calls...)
+
+			service := NewX509PrivateKeyEncryptionService(&testRepositoryBundle{privKeyRepo: privKeyRepo, txManager: txManager})
+			got, err := service.RewrapDataKeys(ctx, tt.batchSize)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RewrapDataKeys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("RewrapDataKeys() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"github.com/pki-vault/server/internal/config"
+	"os"
+)
+
+// NewServerConfig returns the TLS config serving the certificate of the reloader and verifying client certificates
+// against the configured client CAs. If tls.client_auth is not set, client certificates are optional if client CAs
+// are configured and not requested otherwise.
+func NewServerConfig(tlsConfig config.TLS, reloader *CertificateReloader) (*tls.Config, error) {
+	serverConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	clientAuth := tlsConfig.ClientAuth
+	if clientAuth == "" {
+		clientAuth = config.ClientAuthNone
+		if tlsConfig.ClientCAFile != "" {
+			clientAuth = config.ClientAuthOptional
+		}
+	}
+
+	switch clientAuth {
+	case config.ClientAuthNone:
+		if tlsConfig.ClientCAFile != "" {
+			return nil, fmt.Errorf("tls.client_ca_file must not be set if tls.client_auth is %s", config.ClientAuthNone)
+		}
+		serverConfig.ClientAuth = tls.NoClientCert
+		return serverConfig, nil
+	case config.ClientAuthOptional:
+		serverConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown tls.client_auth %s", clientAuth)
+	}
+
+	if tlsConfig.ClientCAFile == "" {
+		return nil, fmt.Errorf("tls.client_ca_file must be set if tls.client_auth is %s", clientAuth)
+	}
+	clientCAs, err := loadCertPool(tlsConfig.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load tls.client_ca_file: %w", err)
+	}
+	serverConfig.ClientCAs = clientCAs
+
+	return serverConfig, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pemCerts, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(pemCerts) {
+		return nil, errors.New("no PEM encoded certificates found")
+	}
+	return certPool, nil
+}
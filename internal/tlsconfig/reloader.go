@@ -0,0 +1,77 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"go.uber.org/zap"
+	"sync/atomic"
+	"time"
+)
+
+// CertificateReloader serves the certificate of its source and reloads it periodically, so renewed certificates are
+// used without a restart. The previous certificate is kept if reloading fails.
+type CertificateReloader struct {
+	source      CertificateSource
+	logger      *zap.Logger
+	certificate atomic.Pointer[tls.Certificate]
+}
+
+// NewCertificateReloader loads the initial certificate and fails if it can't be loaded.
+func NewCertificateReloader(
+	ctx context.Context, source CertificateSource, logger *zap.Logger,
+) (*CertificateReloader, error) {
+	reloader := &CertificateReloader{source: source, logger: logger}
+	if _, err := reloader.Reload(ctx); err != nil {
+		return nil, fmt.Errorf("unable to load TLS server certificate: %w", err)
+	}
+	return reloader, nil
+}
+
+// GetCertificate can be used as tls.Config.GetCertificate.
+func (c *CertificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.certificate.Load(), nil
+}
+
+// Reload loads the certificate from the source and reports whether it changed.
+func (c *CertificateReloader) Reload(ctx context.Context) (changed bool, err error) {
+	certificate, err := c.source.Load(ctx)
+	if err != nil {
+		return false, err
+	}
+	if certificate.Leaf == nil {
+		certificate.Leaf, err = x509.ParseCertificate(certificate.Certificate[0])
+		if err != nil {
+			return false, err
+		}
+	}
+
+	current := c.certificate.Load()
+	if current != nil && bytes.Equal(current.Certificate[0], certificate.Certificate[0]) {
+		return false, nil
+	}
+	c.certificate.Store(certificate)
+	c.logger.Info("loaded TLS server certificate",
+		zap.String("subject", certificate.Leaf.Subject.String()),
+		zap.Time("not-after", certificate.Leaf.NotAfter),
+	)
+	return true, nil
+}
+
+// Run reloads the certificate every interval until the context is done.
+func (c *CertificateReloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := c.Reload(ctx); err != nil {
+				c.logger.Error("could not reload TLS server certificate, keeping the current one", zap.Error(err))
+			}
+		}
+	}
+}
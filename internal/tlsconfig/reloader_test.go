@@ -0,0 +1,82 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"go.uber.org/zap"
+	"testing"
+)
+
+type fakeCertificateSource struct {
+	certificate *tls.Certificate
+	err         error
+}
+
+func (f *fakeCertificateSource) Load(_ context.Context) (*tls.Certificate, error) {
+	return f.certificate, f.err
+}
+
+func newFakeCertificate(commonName string) *tls.Certificate {
+	return &tls.Certificate{
+		Certificate: [][]byte{[]byte(commonName)},
+		Leaf:        &x509.Certificate{Subject: pkix.Name{CommonName: commonName}},
+	}
+}
+
+func TestCertificateReloader_Reload(t *testing.T) {
+	ctx := context.Background()
+	initialCertificate := newFakeCertificate("initial.example.invalid")
+	source := &fakeCertificateSource{certificate: initialCertificate}
+
+	reloader, err := NewCertificateReloader(ctx, source, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewCertificateReloader() got unexpected error: %v", err)
+	}
+	assertServedCertificate(t, reloader, initialCertificate)
+
+	// The same certificate is not reloaded
+	source.certificate = newFakeCertificate("initial.example.invalid")
+	changed, err := reloader.Reload(ctx)
+	if err != nil || changed {
+		t.Errorf("Reload() = %v, %v, want false, nil", changed, err)
+	}
+	assertServedCertificate(t, reloader, initialCertificate)
+
+	renewedCertificate := newFakeCertificate("renewed.example.invalid")
+	source.certificate = renewedCertificate
+	changed, err = reloader.Reload(ctx)
+	if err != nil || !changed {
+		t.Errorf("Reload() = %v, %v, want true, nil", changed, err)
+	}
+	assertServedCertificate(t, reloader, renewedCertificate)
+
+	// The current certificate is kept if the source fails
+	source.certificate, source.err = nil, errors.New("file not found")
+	if _, err = reloader.Reload(ctx); err == nil {
+		t.Errorf("Reload() expected error of source")
+	}
+	assertServedCertificate(t, reloader, renewedCertificate)
+}
+
+func TestNewCertificateReloader_SourceError(t *testing.T) {
+	_, err := NewCertificateReloader(
+		context.Background(), &fakeCertificateSource{err: errors.New("file not found")}, zap.NewNop(),
+	)
+	if err == nil {
+		t.Errorf("NewCertificateReloader() expected error of source")
+	}
+}
+
+func assertServedCertificate(t *testing.T, reloader *CertificateReloader, want *tls.Certificate) {
+	t.Helper()
+	got, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatalf("GetCertificate() got unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("GetCertificate() served %s, want %s", got.Leaf.Subject, want.Leaf.Subject)
+	}
+}
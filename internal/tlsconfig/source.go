@@ -0,0 +1,65 @@
+package tlsconfig
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/pki-vault/server/internal/service"
+)
+
+// CertificateSource loads the current server certificate.
+type CertificateSource interface {
+	Load(ctx context.Context) (*tls.Certificate, error)
+}
+
+// FileCertificateSource loads the certificate chain and private key from PEM files.
+type FileCertificateSource struct {
+	certFile string
+	keyFile  string
+}
+
+func NewFileCertificateSource(certFile string, keyFile string) *FileCertificateSource {
+	return &FileCertificateSource{certFile: certFile, keyFile: keyFile}
+}
+
+func (f *FileCertificateSource) Load(_ context.Context) (*tls.Certificate, error) {
+	certificate, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
+
+// VaultCertificateSource loads the latest certificate with the SAN and a private key stored in the vault.
+// Renewed certificates are picked up once imported.
+type VaultCertificateSource struct {
+	certificateService *service.X509CertificateService
+	subjectAltName     string
+}
+
+func NewVaultCertificateSource(
+	certificateService *service.X509CertificateService, subjectAltName string,
+) *VaultCertificateSource {
+	return &VaultCertificateSource{certificateService: certificateService, subjectAltName: subjectAltName}
+}
+
+func (v *VaultCertificateSource) Load(ctx context.Context) (*tls.Certificate, error) {
+	keyPair, exists, err := v.certificateService.GetLatestKeyPair(ctx, v.subjectAltName)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("no active certificate with private key for SAN %s in the vault", v.subjectAltName)
+	}
+
+	var certPem bytes.Buffer
+	for _, cert := range keyPair.CertificateChain {
+		certPem.WriteString(cert.CertificatePem)
+	}
+	certificate, err := tls.X509KeyPair(certPem.Bytes(), []byte(keyPair.PrivateKey.PemPrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	return &certificate, nil
+}
@@ -0,0 +1,54 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// InstrumentationName is the name of the tracers of the server.
+const InstrumentationName = "github.com/pki-vault/server"
+
+// NewTracerProvider returns a provider batching the spans of sampled traces to the exporter. Traces are sampled by
+// sampleRatio, unless the remote parent of the root span propagated its sampling decision.
+func NewTracerProvider(
+	exporter sdktrace.SpanExporter, serviceName string, sampleRatio float64,
+) (*sdktrace.TracerProvider, error) {
+	res, err := resource.Merge(
+		resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(serviceName)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRatio))),
+	), nil
+}
+
+// EndSpan ends the span and records the error, if any, as its status.
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// LoggerFields returns the trace and span ID of the span of the context, or no fields if the context lacks a span.
+func LoggerFields(ctx context.Context) []zap.Field {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return nil
+	}
+	return []zap.Field{
+		zap.String("trace-id", spanContext.TraceID().String()),
+		zap.String("span-id", spanContext.SpanID().String()),
+	}
+}
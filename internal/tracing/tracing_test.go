@@ -0,0 +1,69 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"reflect"
+	"testing"
+)
+
+func TestEndSpan(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+		wantEvents int
+	}{
+		{name: "without error", wantStatus: codes.Unset},
+		{name: "with error", err: errors.New("connection refused"), wantStatus: codes.Error, wantEvents: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := tracetest.NewSpanRecorder()
+			provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+			_, span := provider.Tracer(InstrumentationName).Start(context.Background(), "test")
+
+			EndSpan(span, tt.err)
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("EndSpan() ended %v spans, want 1", len(spans))
+			}
+			if got := spans[0].Status().Code; got != tt.wantStatus {
+				t.Errorf("EndSpan() set status %v, want %v", got, tt.wantStatus)
+			}
+			if got := len(spans[0].Events()); got != tt.wantEvents {
+				t.Errorf("EndSpan() recorded %v events, want %v", got, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestLoggerFields(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	ctx, span := provider.Tracer(InstrumentationName).Start(context.Background(), "test")
+	defer span.End()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want []zap.Field
+	}{
+		{name: "without span", ctx: context.Background()},
+		{name: "with span", ctx: ctx, want: []zap.Field{
+			zap.String("trace-id", span.SpanContext().TraceID().String()),
+			zap.String("span-id", span.SpanContext().SpanID().String()),
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LoggerFields(tt.ctx); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoggerFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package updates
+
+import (
+	"context"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"go.uber.org/zap"
+	"sync"
+	"time"
+)
+
+// listenRetryInterval is the delay before listening again after the listener failed.
+const listenRetryInterval = 5 * time.Second
+
+// Hub fans out the certificate update notifications of all server replicas to the subscriptions of this replica, so a
+// single listener serves any number of subscriptions.
+type Hub struct {
+	notifier repository.X509CertificateUpdateNotifier
+	clock    clockwork.Clock
+	logger   *zap.Logger
+
+	lock          sync.Mutex
+	subscriptions map[*Subscription]struct{}
+
+	done         chan struct{}
+	shutdownOnce sync.Once
+}
+
+func NewHub(notifier repository.X509CertificateUpdateNotifier, clock clockwork.Clock, logger *zap.Logger) *Hub {
+	return &Hub{
+		notifier:      notifier,
+		clock:         clock,
+		logger:        logger,
+		subscriptions: make(map[*Subscription]struct{}),
+		done:          make(chan struct{}),
+	}
+}
+
+// Run publishes the notifications of the listener until the context is done. A failed listener is restarted.
+func (h *Hub) Run(ctx context.Context) {
+	for {
+		err := h.notifier.Listen(ctx, h.Publish)
+		if ctx.Err() != nil {
+			return
+		}
+		h.logger.Error("stopped listening for certificate updates, retrying", zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-h.clock.After(listenRetryInterval):
+		}
+		// Any certificates may have been imported in the meantime
+		h.Publish()
+	}
+}
+
+// Publish delivers a notification to all subscriptions.
+func (h *Hub) Publish() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for subscription := range h.subscriptions {
+		subscription.add()
+	}
+}
+
+// Subscribe returns a subscription to all notifications published from now on. It has to be closed.
+func (h *Hub) Subscribe() *Subscription {
+	subscription := &Subscription{hub: h, ready: make(chan struct{}, 1)}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.subscriptions[subscription] = struct{}{}
+	return subscription
+}
+
+// Shutdown signals all subscriptions, including later ones, to end, so long polls and streams don't hold up the
+// graceful shutdown of the server. Notifications are still delivered.
+func (h *Hub) Shutdown() {
+	h.shutdownOnce.Do(func() { close(h.done) })
+}
+
+func (h *Hub) unsubscribe(subscription *Subscription) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	delete(h.subscriptions, subscription)
+}
+
+// Subscription receives the notifications of a Hub. Notifications which weren't taken yet are combined, so slow
+// subscriptions never block the hub.
+type Subscription struct {
+	hub   *Hub
+	ready chan struct{}
+
+	lock    sync.Mutex
+	pending bool
+}
+
+// Ready is signalled when notifications can be taken.
+func (s *Subscription) Ready() <-chan struct{} {
+	return s.ready
+}
+
+// Done is closed once the hub is shut down.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.hub.done
+}
+
+// Take returns whether there were notifications since the last call.
+func (s *Subscription) Take() (ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ok = s.pending
+	s.pending = false
+	return ok
+}
+
+// Close stops the delivery of notifications to the subscription.
+func (s *Subscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+func (s *Subscription) add() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.pending = true
+	select {
+	case s.ready <- struct{}{}:
+	default:
+		// Already signalled
+	}
+}
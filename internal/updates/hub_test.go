@@ -0,0 +1,121 @@
+package updates
+
+import (
+	"context"
+	"errors"
+	"github.com/golang/mock/gomock"
+	"github.com/jonboulle/clockwork"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestHub_Publish(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	hub := NewHub(nil, fakeClock, zap.NewNop())
+
+	first := hub.Subscribe()
+	t.Cleanup(first.Close)
+	second := hub.Subscribe()
+	closed := hub.Subscribe()
+	closed.Close()
+
+	hub.Publish()
+	hub.Publish()
+	hub.Publish()
+
+	// Notifications which weren't taken yet are combined
+	for name, subscription := range map[string]*Subscription{"first": first, "second": second} {
+		select {
+		case <-subscription.Ready():
+		default:
+			t.Fatalf("%s subscription is not ready", name)
+		}
+		if !subscription.Take() {
+			t.Errorf("Take() expected notifications for %s subscription", name)
+		}
+		if subscription.Take() {
+			t.Errorf("Take() expected no further notifications for %s subscription", name)
+		}
+	}
+
+	second.Close()
+	hub.Publish()
+	if second.Take() {
+		t.Errorf("Take() expected no notifications after Close()")
+	}
+	if closed.Take() {
+		t.Errorf("Take() expected no notifications for subscription closed before publishing")
+	}
+	if !first.Take() {
+		t.Errorf("Take() expected notifications for first subscription")
+	}
+}
+
+func TestHub_Run(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	ctrl := gomock.NewController(t)
+	notifier := mock_repository.NewMockX509CertificateUpdateNotifier(ctrl)
+	hub := NewHub(notifier, fakeClock, zap.NewNop())
+	subscription := hub.Subscribe()
+	t.Cleanup(subscription.Close)
+
+	gomock.InOrder(
+		notifier.EXPECT().Listen(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(_ context.Context, handle func()) error {
+				handle()
+				return errors.New("connection lost")
+			},
+		),
+		notifier.EXPECT().Listen(gomock.Any(), gomock.Any()).DoAndReturn(
+			func(ctx context.Context, _ func()) error {
+				<-ctx.Done()
+				return nil
+			},
+		),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		hub.Run(ctx)
+		close(done)
+	}()
+
+	<-subscription.Ready()
+	if !subscription.Take() {
+		t.Errorf("Take() expected the notification of the listener")
+	}
+
+	// Notifications may have been missed until the listener is restarted
+	fakeClock.BlockUntil(1)
+	fakeClock.Advance(listenRetryInterval)
+	<-subscription.Ready()
+	if !subscription.Take() {
+		t.Errorf("Take() expected a notification after restarting the listener")
+	}
+
+	cancel()
+	<-done
+}
+
+func TestHub_Shutdown(t *testing.T) {
+	hub := NewHub(nil, clockwork.NewFakeClock(), zap.NewNop())
+	before := hub.Subscribe()
+	t.Cleanup(before.Close)
+
+	hub.Shutdown()
+	// Shutting down again must not panic
+	hub.Shutdown()
+	after := hub.Subscribe()
+	t.Cleanup(after.Close)
+
+	for name, subscription := range map[string]*Subscription{"before": before, "after": after} {
+		select {
+		case <-subscription.Done():
+		default:
+			t.Errorf("Done() of %s subscription is not closed after Shutdown()", name)
+		}
+	}
+}
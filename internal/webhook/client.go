@@ -0,0 +1,64 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrForbiddenAddress is returned when a webhook resolves to an address which isn't public and isn't allowed.
+var ErrForbiddenAddress = errors.New("webhook address is not allowed")
+
+// ParseNetworks parses the CIDR notations of the networks webhooks may be delivered to besides public addresses.
+func ParseNetworks(cidrs []string) ([]netip.Prefix, error) {
+	networks := make([]netip.Prefix, len(cidrs))
+	for idx, cidr := range cidrs {
+		network, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, err
+		}
+		networks[idx] = network.Masked()
+	}
+	return networks, nil
+}
+
+// newClient returns a client which refuses to connect to private, loopback, link-local and other non-public
+// addresses unless they are in one of the allowed networks. Addresses are checked after the host was resolved, when
+// dialing, so hosts resolving to internal addresses and redirects to them are refused too. Proxies aren't used, as
+// they would connect on behalf of the client.
+func newClient(timeout time.Duration, allowedNetworks []netip.Prefix) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: 30 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			return checkAddress(address, allowedNetworks)
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// checkAddress returns ErrForbiddenAddress if the resolved ip:port address isn't public and isn't in one of the
+// allowed networks.
+func checkAddress(address string, allowedNetworks []netip.Prefix) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+	addr := addrPort.Addr().Unmap()
+	for _, network := range allowedNetworks {
+		if network.Contains(addr) {
+			return nil
+		}
+	}
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckAddress(t *testing.T) {
+	allowedNetworks := []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}
+	tests := []struct {
+		name    string
+		address string
+		wantErr error
+	}{
+		{name: "public IPv4", address: "93.184.216.34:443"},
+		{name: "public IPv6", address: "[2606:2800:220:1:248:1893:25c8:1946]:443"},
+		{name: "allowed private network", address: "10.1.2.3:443"},
+		{name: "private IPv4", address: "10.2.0.1:443", wantErr: ErrForbiddenAddress},
+		{name: "private IPv6", address: "[fd00::1]:443", wantErr: ErrForbiddenAddress},
+		{name: "loopback IPv4", address: "127.0.0.1:80", wantErr: ErrForbiddenAddress},
+		{name: "loopback IPv6", address: "[::1]:80", wantErr: ErrForbiddenAddress},
+		{name: "IPv4-mapped loopback", address: "[::ffff:127.0.0.1]:80", wantErr: ErrForbiddenAddress},
+		{name: "link-local metadata service", address: "169.254.169.254:80", wantErr: ErrForbiddenAddress},
+		{name: "link-local IPv6", address: "[fe80::1]:80", wantErr: ErrForbiddenAddress},
+		{name: "unspecified", address: "0.0.0.0:80", wantErr: ErrForbiddenAddress},
+		{name: "multicast", address: "224.0.0.1:80", wantErr: ErrForbiddenAddress},
+		{name: "malformed", address: "localhost:80", wantErr: ErrForbiddenAddress},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkAddress(tt.address, allowedNetworks); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name            string
+		allowedNetworks []netip.Prefix
+		wantErr         error
+	}{
+		{name: "loopback refused", wantErr: ErrForbiddenAddress},
+		{name: "loopback allowed", allowedNetworks: []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := newClient(time.Second, tt.allowedNetworks).Get(server.URL)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				_ = response.Body.Close()
+			}
+		})
+	}
+}
+
+func TestParseNetworks(t *testing.T) {
+	got, err := ParseNetworks([]string{"10.1.2.3/16", "fd00::/8"})
+	if err != nil {
+		t.Fatalf("ParseNetworks() got unexpected error: %v", err)
+	}
+	want := []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16"), netip.MustParsePrefix("fd00::/8")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseNetworks() = %v, want %v", got, want)
+	}
+	if _, err := ParseNetworks([]string{"10.1.2.3"}); err == nil {
+		t.Errorf("ParseNetworks() expected error for address without prefix length")
+	}
+}
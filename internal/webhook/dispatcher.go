@@ -0,0 +1,201 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/encryption"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"time"
+)
+
+// Headers of webhook requests. SignatureHeader has the format t=<unix timestamp>,v1=<signature>, see Sign.
+const (
+	EventHeader     = "X-Pki-Vault-Event"
+	DeliveryHeader  = "X-Pki-Vault-Delivery"
+	SignatureHeader = "X-Pki-Vault-Signature"
+)
+
+// Dispatcher attempts pending webhook deliveries. Deliveries are claimed before they are attempted, so multiple
+// server replicas can dispatch concurrently. A claim expires if the attempt isn't recorded, e.g. because the
+// server stopped, and the delivery is attempted again.
+type Dispatcher struct {
+	deliveryRepo repository.WebhookDeliveryRepository
+	webhookRepo  repository.WebhookRepository
+	config       config.Webhooks
+	client       *http.Client
+	clock        clockwork.Clock
+	logger       *zap.Logger
+}
+
+// NewDispatcher returns a dispatcher which only delivers to public addresses and addresses in the allowedNetworks.
+func NewDispatcher(
+	deliveryRepo repository.WebhookDeliveryRepository, webhookRepo repository.WebhookRepository,
+	config config.Webhooks, allowedNetworks []netip.Prefix, clock clockwork.Clock, logger *zap.Logger,
+) *Dispatcher {
+	return &Dispatcher{
+		deliveryRepo: deliveryRepo,
+		webhookRepo:  webhookRepo,
+		config:       config,
+		client:       newClient(config.Timeout, allowedNetworks),
+		clock:        clock,
+		logger:       logger,
+	}
+}
+
+// Run dispatches due deliveries and deletes expired finished deliveries every poll interval until the context is
+// done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := d.clock.NewTicker(d.config.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.Chan():
+			if err := d.DispatchDue(ctx); err != nil {
+				d.logger.Error("could not dispatch webhook deliveries", zap.Error(err))
+			}
+			if _, err := d.Cleanup(ctx); err != nil {
+				d.logger.Error("could not delete finished webhook deliveries", zap.Error(err))
+			}
+		}
+	}
+}
+
+// DispatchDue attempts all deliveries which are due. Deliveries are claimed one at a time right before their attempt,
+// so a claim can't expire while the deliveries claimed before it are attempted.
+func (d *Dispatcher) DispatchDue(ctx context.Context) error {
+	for {
+		now := d.clock.Now()
+		// The claim outlasts the attempt, including the time to record it
+		deliveries, err := d.deliveryRepo.ClaimDue(ctx, now, now.Add(2*d.config.Timeout+time.Minute), 1)
+		if err != nil || len(deliveries) == 0 {
+			return err
+		}
+		if err = d.attempt(ctx, deliveries[0]); err != nil {
+			return err
+		}
+	}
+}
+
+// Cleanup deletes the delivered and dead deliveries whose last attempt was longer than the retention ago.
+func (d *Dispatcher) Cleanup(ctx context.Context) (rowsDeleted int64, err error) {
+	return d.deliveryRepo.DeleteFinishedBefore(ctx, d.clock.Now().Add(-d.config.Retention))
+}
+
+// attempt sends the delivery to the webhook of its subscription and records the result.
+func (d *Dispatcher) attempt(ctx context.Context, delivery *repository.WebhookDeliveryDao) error {
+	webhook, exists, err := d.webhookRepo.FindBySubscriptionID(ctx, delivery.SubscriptionID)
+	if errors.Is(err, encryption.ErrSealed) {
+		// The secret can't be decrypted, the delivery is attempted again once its claim expired
+		d.logger.Debug("vault is sealed, postponing webhook delivery", zap.String("webhook-delivery-id", delivery.ID.String()))
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	now := d.clock.Now()
+	delivery.Attempts++
+	delivery.LastAttemptAt = &now
+	delivery.LastStatusCode = nil
+	delivery.LastError = nil
+	if exists {
+		delivery.LastStatusCode, err = d.send(ctx, webhook, delivery)
+	} else {
+		err = errors.New("subscription has no webhook")
+	}
+
+	logger := d.logger.With(
+		zap.String("webhook-delivery-id", delivery.ID.String()),
+		zap.String("subscription-id", delivery.SubscriptionID.String()),
+		zap.Int("attempts", delivery.Attempts),
+	)
+	switch {
+	case err == nil:
+		delivery.Status = repository.WebhookDeliveryStatusDelivered
+		delivery.NextAttemptAt = nil
+		delivery.DeliveredAt = &now
+		logger.Debug("delivered webhook event")
+	case !exists || delivery.Attempts >= d.config.MaxAttempts:
+		errMessage := err.Error()
+		delivery.Status = repository.WebhookDeliveryStatusDead
+		delivery.NextAttemptAt = nil
+		delivery.LastError = &errMessage
+		logger.Warn("webhook delivery is dead", zap.Error(err))
+	default:
+		errMessage := err.Error()
+		nextAttemptAt := now.Add(Backoff(delivery.Attempts, d.config.InitialBackoff, d.config.MaxBackoff))
+		delivery.NextAttemptAt = &nextAttemptAt
+		delivery.LastError = &errMessage
+		logger.Info("webhook delivery failed, retrying", zap.Time("next-attempt-at", nextAttemptAt), zap.Error(err))
+	}
+
+	return d.deliveryRepo.Update(ctx, delivery)
+}
+
+// send posts the signed payload and returns the response status code if a response was received.
+// Only 2xx status codes are successful deliveries.
+func (d *Dispatcher) send(
+	ctx context.Context, webhook *repository.WebhookDao, delivery *repository.WebhookDeliveryDao,
+) (statusCode *int, err error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+	now := d.clock.Now()
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.EventType)
+	request.Header.Set(DeliveryHeader, delivery.ID.String())
+	request.Header.Set(SignatureHeader, fmt.Sprintf(
+		"t=%d,v1=%s", now.Unix(), Sign(webhook.Secret, now, delivery.Payload),
+	))
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	// Drain a bounded part of the body, so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 64*1024))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return &response.StatusCode, fmt.Errorf("webhook responded with status code %d", response.StatusCode)
+	}
+	return &response.StatusCode, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "<unix timestamp>.<payload>" keyed with the secret.
+// Receivers should recompute it and reject old timestamps to prevent replays.
+func Sign(secret string, timestamp time.Time, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff returns the delay after the given number of failed attempts. It doubles with every attempt, starting at
+// initial and capped at max.
+func Backoff(attempts int, initial time.Duration, max time.Duration) time.Duration {
+	backoff := initial
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		return max
+	}
+	return backoff
+}
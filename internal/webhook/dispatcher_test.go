@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"github.com/golang/mock/gomock"
+	"github.com/google/uuid"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/encryption"
+	mock_repository "github.com/pki-vault/server/internal/mocks/db"
+	"github.com/pki-vault/server/internal/testutil"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDispatcher_DispatchDue(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	webhooksConfig := config.Webhooks{
+		PollInterval:   5 * time.Second,
+		Timeout:        10 * time.Second,
+		MaxAttempts:    3,
+		InitialBackoff: 30 * time.Second,
+		MaxBackoff:     time.Hour,
+	}
+	subID := uuid.MustParse("3b8f6c52-5e1d-4f0a-9b7c-2d4e6f8a0b1c")
+	deliveryID := uuid.MustParse("5d7e9f1a-3b5c-4d7e-8f9a-1b3c5d7e9f1a")
+	payload := []byte(`{"type":"x509_certificate_subscription.updated"}`)
+	secret := "0123456789abcdef"
+
+	tests := []struct {
+		name           string
+		attempts       int
+		statusCode     int
+		withoutWebhook bool
+		want           *repository.WebhookDeliveryDao
+	}{
+		{
+			name:       "delivered",
+			statusCode: http.StatusNoContent,
+			want: repository.NewWebhookDeliveryDao(
+				deliveryID, subID, "x509_certificate_subscription.updated", payload,
+				repository.WebhookDeliveryStatusDelivered, 1, nil, testutil.Ptr(fakeClock.Now()),
+				testutil.Ptr(http.StatusNoContent), nil, fakeClock.Now(), testutil.Ptr(fakeClock.Now()),
+			),
+		},
+		{
+			name:       "failed and retried",
+			attempts:   1,
+			statusCode: http.StatusInternalServerError,
+			want: repository.NewWebhookDeliveryDao(
+				deliveryID, subID, "x509_certificate_subscription.updated", payload,
+				repository.WebhookDeliveryStatusPending, 2, testutil.Ptr(fakeClock.Now().Add(time.Minute)),
+				testutil.Ptr(fakeClock.Now()), testutil.Ptr(http.StatusInternalServerError),
+				testutil.Ptr("webhook responded with status code 500"), fakeClock.Now(), nil,
+			),
+		},
+		{
+			name:       "dead after max attempts",
+			attempts:   2,
+			statusCode: http.StatusBadGateway,
+			want: repository.NewWebhookDeliveryDao(
+				deliveryID, subID, "x509_certificate_subscription.updated", payload,
+				repository.WebhookDeliveryStatusDead, 3, nil, testutil.Ptr(fakeClock.Now()),
+				testutil.Ptr(http.StatusBadGateway), testutil.Ptr("webhook responded with status code 502"),
+				fakeClock.Now(), nil,
+			),
+		},
+		{
+			name:           "dead without webhook",
+			withoutWebhook: true,
+			want: repository.NewWebhookDeliveryDao(
+				deliveryID, subID, "x509_certificate_subscription.updated", payload,
+				repository.WebhookDeliveryStatusDead, 1, nil, testutil.Ptr(fakeClock.Now()), nil,
+				testutil.Ptr("subscription has no webhook"), fakeClock.Now(), nil,
+			),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				wantSignature := fmt.Sprintf("t=%d,v1=%s", fakeClock.Now().Unix(), Sign(secret, fakeClock.Now(), payload))
+				if got := r.Header.Get(SignatureHeader); got != wantSignature {
+					t.Errorf("%s = %v, want %v", SignatureHeader, got, wantSignature)
+				}
+				if got := r.Header.Get(DeliveryHeader); got != deliveryID.String() {
+					t.Errorf("%s = %v, want %v", DeliveryHeader, got, deliveryID)
+				}
+				if !reflect.DeepEqual(body, payload) {
+					t.Errorf("body = %s, want %s", body, payload)
+				}
+				w.WriteHeader(tt.statusCode)
+			}))
+			t.Cleanup(server.Close)
+
+			ctrl := gomock.NewController(t)
+			deliveryRepo := mock_repository.NewMockWebhookDeliveryRepository(ctrl)
+			webhookRepo := mock_repository.NewMockWebhookRepository(ctrl)
+
+			delivery := repository.NewWebhookDeliveryDao(
+				deliveryID, subID, "x509_certificate_subscription.updated", payload,
+				repository.WebhookDeliveryStatusPending, tt.attempts, testutil.Ptr(fakeClock.Now()), nil, nil, nil,
+				fakeClock.Now(), nil,
+			)
+			gomock.InOrder(
+				deliveryRepo.EXPECT().ClaimDue(gomock.Any(), fakeClock.Now(), gomock.Any(), 1).
+					Return([]*repository.WebhookDeliveryDao{delivery}, nil),
+				deliveryRepo.EXPECT().ClaimDue(gomock.Any(), fakeClock.Now(), gomock.Any(), 1).Return(nil, nil),
+			)
+			if tt.withoutWebhook {
+				webhookRepo.EXPECT().FindBySubscriptionID(gomock.Any(), subID).Return(nil, false, nil)
+			} else {
+				webhookRepo.EXPECT().FindBySubscriptionID(gomock.Any(), subID).Return(
+					repository.NewWebhookDao(subID, server.URL, secret, fakeClock.Now(), fakeClock.Now()), true, nil,
+				)
+			}
+			deliveryRepo.EXPECT().Update(gomock.Any(), tt.want).Return(nil)
+
+			// The test server listens on a loopback address, which has to be allowed explicitly
+			dispatcher := NewDispatcher(
+				deliveryRepo, webhookRepo, webhooksConfig, []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")},
+				fakeClock, zap.NewNop(),
+			)
+			if err := dispatcher.DispatchDue(ctx); err != nil {
+				t.Fatalf("DispatchDue() got unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDispatcher_DispatchDue_Sealed(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	subID := uuid.MustParse("3b8f6c52-5e1d-4f0a-9b7c-2d4e6f8a0b1c")
+	ctrl := gomock.NewController(t)
+	deliveryRepo := mock_repository.NewMockWebhookDeliveryRepository(ctrl)
+	webhookRepo := mock_repository.NewMockWebhookRepository(ctrl)
+
+	delivery := repository.NewWebhookDeliveryDao(
+		uuid.MustParse("5d7e9f1a-3b5c-4d7e-8f9a-1b3c5d7e9f1a"), subID, "x509_certificate_subscription.updated",
+		[]byte(`{}`), repository.WebhookDeliveryStatusPending, 0, testutil.Ptr(fakeClock.Now()), nil, nil, nil,
+		fakeClock.Now(), nil,
+	)
+	gomock.InOrder(
+		deliveryRepo.EXPECT().ClaimDue(gomock.Any(), fakeClock.Now(), gomock.Any(), 1).
+			Return([]*repository.WebhookDeliveryDao{delivery}, nil),
+		deliveryRepo.EXPECT().ClaimDue(gomock.Any(), fakeClock.Now(), gomock.Any(), 1).Return(nil, nil),
+	)
+	webhookRepo.EXPECT().FindBySubscriptionID(gomock.Any(), subID).
+		Return(nil, false, fmt.Errorf("unable to decrypt secret: %w", encryption.ErrSealed))
+	// The delivery isn't updated, it stays pending and is attempted again once the claim expired
+
+	dispatcher := NewDispatcher(
+		deliveryRepo, webhookRepo, config.Webhooks{Timeout: time.Second}, nil, fakeClock, zap.NewNop(),
+	)
+	if err := dispatcher.DispatchDue(ctx); err != nil {
+		t.Fatalf("DispatchDue() got unexpected error: %v", err)
+	}
+}
+
+func TestDispatcher_Cleanup(t *testing.T) {
+	fakeClock := clockwork.NewFakeClock()
+	ctx := context.Background()
+	ctrl := gomock.NewController(t)
+	deliveryRepo := mock_repository.NewMockWebhookDeliveryRepository(ctrl)
+	deliveryRepo.EXPECT().DeleteFinishedBefore(ctx, fakeClock.Now().Add(-24*time.Hour)).Return(int64(3), nil)
+
+	dispatcher := NewDispatcher(
+		deliveryRepo, nil, config.Webhooks{Retention: 24 * time.Hour}, nil, fakeClock, zap.NewNop(),
+	)
+	got, err := dispatcher.Cleanup(ctx)
+	if err != nil {
+		t.Fatalf("Cleanup() got unexpected error: %v", err)
+	}
+	if got != 3 {
+		t.Errorf("Cleanup() got = %v, want %v", got, 3)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 1, want: 30 * time.Second},
+		{attempts: 2, want: time.Minute},
+		{attempts: 4, want: 4 * time.Minute},
+		{attempts: 8, want: time.Hour},
+		{attempts: 1000, want: time.Hour},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d attempts", tt.attempts), func(t *testing.T) {
+			if got := Backoff(tt.attempts, 30*time.Second, time.Hour); got != tt.want {
+				t.Errorf("Backoff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	timestamp := time.Unix(1700000000, 0)
+	payload := []byte(`{"id":"5d7e9f1a-3b5c-4d7e-8f9a-1b3c5d7e9f1a"}`)
+
+	signature := Sign("0123456789abcdef", timestamp, payload)
+	if signature != Sign("0123456789abcdef", timestamp, payload) {
+		t.Errorf("Sign() is not deterministic")
+	}
+	if signature == Sign("fedcba9876543210", timestamp, payload) {
+		t.Errorf("Sign() = %v for different secrets", signature)
+	}
+	if signature == Sign("0123456789abcdef", timestamp.Add(time.Second), payload) {
+		t.Errorf("Sign() = %v for different timestamps", signature)
+	}
+}
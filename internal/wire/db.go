@@ -1,7 +1,9 @@
 package wire
 
 import (
+	"database/sql"
 	"github.com/google/wire"
+	postgresqlrepository "github.com/pki-vault/server/internal/db/postgresql/repository"
 	"github.com/pki-vault/server/internal/db/repository"
 )
 
@@ -9,6 +11,12 @@ var repositorySet = wire.NewSet(
 	ProvidePostgresqlX509CertificateRepository,
 	ProvidePostgresqlX509CertificateSubscriptionRepository,
 	ProvidePostgresqlX509PrivateKeyRepository,
+	ProvidePostgresqlSealConfigurationRepository,
+	ProvidePostgresqlAPITokenRepository,
+	ProvidePostgresqlWebhookRepository,
+	ProvidePostgresqlWebhookDeliveryRepository,
+	ProvidePostgresqlOutboxEventRepository,
+	ProvidePostgresqlExpiryAlertRepository,
 	ProvidePostgresqlX509TransactionManager,
 )
 
@@ -24,6 +32,36 @@ func ProvidePostgresqlX509PrivateKeyRepository(repositoryBundle repository.Bundl
 	return repositoryBundle.X509PrivateKeyRepository()
 }
 
+func ProvidePostgresqlSealConfigurationRepository(repositoryBundle repository.Bundle) repository.SealConfigurationRepository {
+	return repositoryBundle.SealConfigurationRepository()
+}
+
+func ProvidePostgresqlAPITokenRepository(repositoryBundle repository.Bundle) repository.APITokenRepository {
+	return repositoryBundle.APITokenRepository()
+}
+
+func ProvidePostgresqlWebhookRepository(repositoryBundle repository.Bundle) repository.WebhookRepository {
+	return repositoryBundle.WebhookRepository()
+}
+
+func ProvidePostgresqlWebhookDeliveryRepository(repositoryBundle repository.Bundle) repository.WebhookDeliveryRepository {
+	return repositoryBundle.WebhookDeliveryRepository()
+}
+
+func ProvidePostgresqlOutboxEventRepository(repositoryBundle repository.Bundle) repository.OutboxEventRepository {
+	return repositoryBundle.OutboxEventRepository()
+}
+
+func ProvidePostgresqlExpiryAlertRepository(repositoryBundle repository.Bundle) repository.ExpiryAlertRepository {
+	return repositoryBundle.ExpiryAlertRepository()
+}
+
+func ProvidePostgresqlX509CertificateUpdateNotifier(
+	db *sql.DB, dataSourceName DataSourceName,
+) *postgresqlrepository.X509CertificateUpdateNotifier {
+	return postgresqlrepository.NewX509CertificateUpdateNotifier(db, string(dataSourceName))
+}
+
 func ProvidePostgresqlX509TransactionManager(repositoryBundle repository.Bundle) repository.TransactionManager {
 	return repositoryBundle.TransactionManager()
 }
@@ -5,16 +5,23 @@ package wire
 
 import (
 	"database/sql"
+	"github.com/XSAM/otelsql"
 	"github.com/google/wire"
 	"github.com/jonboulle/clockwork"
 	"github.com/pki-vault/server/internal/db/postgresql"
 	postgresqlrepository "github.com/pki-vault/server/internal/db/postgresql/repository"
+	"github.com/pki-vault/server/internal/encryption"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 )
 
 type DataSourceName string
 
 func InitializePostgresqlDb(dataSourceName DataSourceName) (*sql.DB, func(), error) {
-	sqlDb, err := sql.Open("postgres", string(dataSourceName))
+	// Every statement is traced with the global tracer provider, once it is installed by InitializeTracing
+	sqlDb, err := otelsql.Open("postgres", string(dataSourceName),
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{OmitConnResetSession: true, OmitRows: true}),
+	)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -34,13 +41,20 @@ func InitializePostgresqlBackend(dataSourceName DataSourceName) (*postgresql.Bac
 	return &postgresql.Backend{}, nil, nil
 }
 
-func InitializePostgresqlRepositoryBundle(dataSourceName DataSourceName) (*postgresqlrepository.Bundle, func(), error) {
+func InitializePostgresqlRepositoryBundle(dataSourceName DataSourceName, keyEncryptor encryption.KeyEncryptor) (*postgresqlrepository.Bundle, func(), error) {
 	wire.Build(
 		postgresqlrepository.NewRepositoryBundle,
 		InitializePostgresqlDb,
 		postgresqlrepository.NewX509CertificateRepository,
 		postgresqlrepository.NewX509CertificateSubscriptionRepository,
 		postgresqlrepository.NewX509PrivateKeyRepository,
+		postgresqlrepository.NewSealConfigurationRepository,
+		postgresqlrepository.NewAPITokenRepository,
+		postgresqlrepository.NewWebhookRepository,
+		postgresqlrepository.NewWebhookDeliveryRepository,
+		ProvidePostgresqlX509CertificateUpdateNotifier,
+		postgresqlrepository.NewOutboxEventRepository,
+		postgresqlrepository.NewExpiryAlertRepository,
 		postgresqlrepository.NewTransactionManager,
 		clockwork.NewRealClock,
 	)
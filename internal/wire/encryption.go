@@ -0,0 +1,89 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/encryption"
+)
+
+// InitializeKeyEncryptor returns the envelope encryptor for the configured master keys
+// or a plaintext encryptor if encryption is not enabled.
+func InitializeKeyEncryptor(encryptionConfig config.Encryption) (encryption.KeyEncryptor, error) {
+	if encryptionConfig.ShamirSeal() {
+		return nil, errors.New("the master key of the shamir seal must be reconstructed from unseal keys")
+	}
+	if err := validateSeal(encryptionConfig); err != nil {
+		return nil, err
+	}
+	if !encryptionConfig.Enabled() {
+		if len(encryptionConfig.PreviousMasterKeys) > 0 {
+			return nil, errors.New("encryption.previous_master_keys requires encryption.master_key to be set")
+		}
+		return encryption.NewPlaintextKeyEncryptor(), nil
+	}
+
+	masterKey, err := loadMasterKey(encryptionConfig.MasterKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load encryption.master_key: %w", err)
+	}
+	previousMasterKeys, err := loadPreviousMasterKeys(encryptionConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return encryption.NewEnvelopeKeyEncryptor(masterKey, previousMasterKeys...), nil
+}
+
+// InitializeShamirSeal returns a sealed shamir seal which uses the configured previous master keys once unsealed.
+func InitializeShamirSeal(encryptionConfig config.Encryption) (*encryption.ShamirSeal, error) {
+	if err := validateSeal(encryptionConfig); err != nil {
+		return nil, err
+	}
+	if !encryptionConfig.ShamirSeal() {
+		return nil, fmt.Errorf("encryption.seal must be %s", config.SealShamir)
+	}
+	if encryptionConfig.MasterKey.File != "" || encryptionConfig.MasterKey.Env != "" {
+		return nil, errors.New("encryption.master_key must not be set if the shamir seal is used")
+	}
+
+	previousMasterKeys, err := loadPreviousMasterKeys(encryptionConfig)
+	if err != nil {
+		return nil, err
+	}
+	return encryption.NewShamirSeal(previousMasterKeys...), nil
+}
+
+func validateSeal(encryptionConfig config.Encryption) error {
+	switch encryptionConfig.Seal {
+	case "", config.SealShamir:
+		return nil
+	default:
+		return fmt.Errorf("unknown encryption.seal %s", encryptionConfig.Seal)
+	}
+}
+
+func loadPreviousMasterKeys(encryptionConfig config.Encryption) ([]*encryption.MasterKey, error) {
+	previousMasterKeys := make([]*encryption.MasterKey, len(encryptionConfig.PreviousMasterKeys))
+	for idx, previousMasterKeySource := range encryptionConfig.PreviousMasterKeys {
+		var err error
+		previousMasterKeys[idx], err = loadMasterKey(previousMasterKeySource)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load encryption.previous_master_keys[%d]: %w", idx, err)
+		}
+	}
+	return previousMasterKeys, nil
+}
+
+func loadMasterKey(source config.MasterKeySource) (*encryption.MasterKey, error) {
+	switch {
+	case source.File != "" && source.Env != "":
+		return nil, errors.New("only one of file and env may be set")
+	case source.File != "":
+		return encryption.LoadMasterKeyFromFile(source.File)
+	case source.Env != "":
+		return encryption.LoadMasterKeyFromEnv(source.Env)
+	default:
+		return nil, errors.New("one of file and env must be set")
+	}
+}
@@ -0,0 +1,68 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/expiry"
+	"net/smtp"
+	"net/url"
+)
+
+// InitializeExpiryMonitor returns the monitor of the certificates in the repository bundle. It alerts through the
+// configured notifiers.
+func InitializeExpiryMonitor(repositoryBundle repository.Bundle, expiryConfig config.Expiry) (*expiry.Monitor, error) {
+	if expiryConfig.ScanInterval <= 0 {
+		return nil, errors.New("expiry.scan_interval must be positive")
+	}
+	for _, threshold := range expiryConfig.Thresholds {
+		if threshold <= 0 {
+			return nil, errors.New("expiry.thresholds must be positive")
+		}
+	}
+	logger, err := InitializeZapLogger()
+	if err != nil {
+		return nil, err
+	}
+	clock := clockwork.NewRealClock()
+
+	var notifiers []expiry.Notifier
+	if expiryConfig.Notifiers.Log {
+		notifiers = append(notifiers, expiry.NewLogNotifier(logger))
+	}
+	if len(expiryConfig.Notifiers.Webhooks) != 0 && expiryConfig.Notifiers.WebhookTimeout <= 0 {
+		return nil, errors.New("expiry.notifiers.webhook_timeout must be positive")
+	}
+	for idx, webhookNotifier := range expiryConfig.Notifiers.Webhooks {
+		parsedURL, err := url.Parse(webhookNotifier.URL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return nil, fmt.Errorf("expiry.notifiers.webhooks[%d].url must be an absolute http or https URL", idx)
+		}
+		if webhookNotifier.Secret == "" {
+			return nil, fmt.Errorf("expiry.notifiers.webhooks[%d].secret must be set", idx)
+		}
+		notifiers = append(notifiers, expiry.NewWebhookNotifier(
+			webhookNotifier.URL, webhookNotifier.Secret, expiryConfig.Notifiers.WebhookTimeout, clock,
+		))
+	}
+	if smtpConfig := expiryConfig.Notifiers.SMTP; smtpConfig.Host != "" {
+		if smtpConfig.Port <= 0 || smtpConfig.From == "" || len(smtpConfig.To) == 0 {
+			return nil, errors.New("expiry.notifiers.smtp requires port, from and to")
+		}
+		var auth smtp.Auth
+		if smtpConfig.Username != "" {
+			auth = smtp.PlainAuth("", smtpConfig.Username, smtpConfig.Password, smtpConfig.Host)
+		}
+		notifiers = append(notifiers, expiry.NewSMTPNotifier(
+			smtpConfig.Host, smtpConfig.Port, auth, smtpConfig.From, smtpConfig.To, smtp.SendMail,
+		))
+	}
+
+	return expiry.NewMonitor(
+		repositoryBundle.X509CertificateRepository(), repositoryBundle.X509CertificateSubscriptionRepository(),
+		repositoryBundle.ExpiryAlertRepository(), repositoryBundle.TransactionManager(), notifiers, expiryConfig, clock,
+		logger,
+	), nil
+}
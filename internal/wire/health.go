@@ -0,0 +1,17 @@
+package wire
+
+import (
+	"github.com/pki-vault/server/internal/buildinfo"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db"
+	"github.com/pki-vault/server/internal/encryption"
+	"github.com/pki-vault/server/internal/service"
+)
+
+// InitializeHealthService returns the health service checking the database of the backend against the configured
+// migrations. The seal is nil unless the shamir seal is used.
+func InitializeHealthService(
+	backend db.SqlBackend, seal *encryption.ShamirSeal, migrationConfig config.Migration,
+) *service.HealthService {
+	return service.NewHealthService(backend, migrationConfig.BasePath, seal, buildinfo.Version())
+}
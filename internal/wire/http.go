@@ -0,0 +1,48 @@
+package wire
+
+import (
+	"crypto/tls"
+	"errors"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/restserver"
+	"net/http"
+)
+
+// InitializeHTTPServers returns a server of the handler for each listen address with the configured timeouts. The
+// servers use TLS if the TLS config is set. Without listen addresses, they listen on :8443 with TLS, otherwise on
+// :8080.
+func InitializeHTTPServers(
+	listenAddresses []string, httpConfig config.HTTP, handler http.Handler, tlsConfig *tls.Config,
+) ([]*http.Server, error) {
+	switch {
+	case httpConfig.ReadTimeout <= 0:
+		return nil, errors.New("http.read_timeout must be positive")
+	case httpConfig.WriteTimeout <= restserver.MaxUpdatesWait:
+		return nil, errors.New("http.write_timeout must exceed the maximum wait of long polls for updates of 60s")
+	case httpConfig.IdleTimeout <= 0:
+		return nil, errors.New("http.idle_timeout must be positive")
+	case httpConfig.MaxBodySize <= 0:
+		return nil, errors.New("http.max_body_size must be positive")
+	case httpConfig.ShutdownTimeout <= 0:
+		return nil, errors.New("http.shutdown_timeout must be positive")
+	}
+
+	if len(listenAddresses) == 0 {
+		listenAddresses = []string{":8080"}
+		if tlsConfig != nil {
+			listenAddresses = []string{":8443"}
+		}
+	}
+	servers := make([]*http.Server, len(listenAddresses))
+	for idx, listenAddress := range listenAddresses {
+		servers[idx] = &http.Server{
+			Addr:         listenAddress,
+			Handler:      handler,
+			TLSConfig:    tlsConfig,
+			ReadTimeout:  httpConfig.ReadTimeout,
+			WriteTimeout: httpConfig.WriteTimeout,
+			IdleTimeout:  httpConfig.IdleTimeout,
+		}
+	}
+	return servers, nil
+}
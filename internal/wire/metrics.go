@@ -0,0 +1,27 @@
+package wire
+
+import (
+	"errors"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/metrics"
+)
+
+// InitializeMetricsInventory returns the updater of the inventory gauges of the metrics from the repository bundle.
+func InitializeMetricsInventory(
+	repositoryBundle repository.Bundle, serverMetrics *metrics.Metrics, metricsConfig config.Metrics,
+) (*metrics.Inventory, error) {
+	if metricsConfig.InventoryInterval <= 0 {
+		return nil, errors.New("metrics.inventory_interval must be positive")
+	}
+	logger, err := InitializeZapLogger()
+	if err != nil {
+		return nil, err
+	}
+
+	return metrics.NewInventory(
+		repositoryBundle.X509CertificateRepository(), repositoryBundle.X509CertificateSubscriptionRepository(),
+		serverMetrics, metricsConfig.InventoryInterval, clockwork.NewRealClock(), logger,
+	), nil
+}
@@ -0,0 +1,51 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/outbox"
+	"net/url"
+)
+
+// InitializeOutboxDispatcher returns the dispatcher of the outbox events in the repository bundle. It publishes to
+// the configured sinks.
+func InitializeOutboxDispatcher(
+	repositoryBundle repository.Bundle, outboxConfig config.Outbox,
+) (*outbox.Dispatcher, error) {
+	if outboxConfig.PollInterval <= 0 || outboxConfig.Retention <= 0 {
+		return nil, errors.New("outbox.poll_interval and outbox.retention must be positive")
+	}
+	if outboxConfig.InitialBackoff <= 0 || outboxConfig.MaxBackoff < outboxConfig.InitialBackoff {
+		return nil, errors.New("outbox.initial_backoff must be positive and not exceed outbox.max_backoff")
+	}
+	logger, err := InitializeZapLogger()
+	if err != nil {
+		return nil, err
+	}
+	clock := clockwork.NewRealClock()
+
+	var sinks []outbox.Sink
+	if outboxConfig.Sinks.Log {
+		sinks = append(sinks, outbox.NewLogSink(logger))
+	}
+	if len(outboxConfig.Sinks.Webhooks) != 0 && outboxConfig.Sinks.WebhookTimeout <= 0 {
+		return nil, errors.New("outbox.sinks.webhook_timeout must be positive")
+	}
+	for idx, webhookSink := range outboxConfig.Sinks.Webhooks {
+		parsedURL, err := url.Parse(webhookSink.URL)
+		if err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+			return nil, fmt.Errorf("outbox.sinks.webhooks[%d].url must be an absolute http or https URL", idx)
+		}
+		if webhookSink.Secret == "" {
+			return nil, fmt.Errorf("outbox.sinks.webhooks[%d].secret must be set", idx)
+		}
+		sinks = append(sinks, outbox.NewWebhookSink(
+			webhookSink.URL, webhookSink.Secret, outboxConfig.Sinks.WebhookTimeout, clock,
+		))
+	}
+
+	return outbox.NewDispatcher(repositoryBundle.OutboxEventRepository(), sinks, outboxConfig, clock, logger), nil
+}
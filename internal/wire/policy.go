@@ -0,0 +1,20 @@
+package wire
+
+import (
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/service"
+)
+
+func InitializePolicyService(policies []config.Policy) (*service.PolicyService, error) {
+	return service.NewPolicyService(PolicyDtos(policies))
+}
+
+func PolicyDtos(policies []config.Policy) []*service.PolicyDto {
+	policyDtos := make([]*service.PolicyDto, len(policies))
+	for idx, policy := range policies {
+		policyDtos[idx] = service.NewPolicyDto(
+			policy.Name, policy.APITokens, policy.ClientCertificates, policy.SubjectAltNames, policy.PrivateKeys,
+		)
+	}
+	return policyDtos
+}
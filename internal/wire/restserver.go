@@ -7,19 +7,41 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/google/wire"
 	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
 	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/encryption"
+	"github.com/pki-vault/server/internal/metrics"
 	"github.com/pki-vault/server/internal/restserver"
+	"github.com/pki-vault/server/internal/service"
+	"github.com/pki-vault/server/internal/updates"
 )
 
-func ProvideGinEngine(repositoryBundle repository.Bundle) (*gin.Engine, error) {
+func ProvideGinEngine(
+	repositoryBundle repository.Bundle, seal *encryption.ShamirSeal, tlsConfig config.TLS,
+	policyService *service.PolicyService, updatesHub *updates.Hub, serverMetrics *metrics.Metrics,
+	healthService *service.HealthService, httpConfig config.HTTP,
+) (*gin.Engine, error) {
 	wire.Build(
 		restserver.InitializeGinEngine,
+		InitializeClientCertificateAuthenticator,
 		restserver.NewRestHandlerImpl,
 		repositorySet,
 		InitializeZapLogger,
 		servicesSet,
 		clockwork.NewRealClock,
 		wire.Bind(new(restserver.StrictServerInterface), new(*restserver.RestHandlerImpl)),
+		wire.Bind(new(service.X509ImportObserver), new(*metrics.Metrics)),
 	)
 	return new(gin.Engine), nil
 }
+
+func ProvideX509CertificateService(
+	repositoryBundle repository.Bundle, policyService *service.PolicyService,
+) *service.X509CertificateService {
+	wire.Build(
+		repositorySet,
+		servicesSet,
+		clockwork.NewRealClock,
+	)
+	return new(service.X509CertificateService)
+}
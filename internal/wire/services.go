@@ -10,4 +10,7 @@ var servicesSet = wire.NewSet(
 	service.NewX509CertificateSubscriptionService,
 	service.NewDefaultX509PrivateKeyService,
 	service.NewX509ImportService,
+	service.NewSealService,
+	service.NewAPITokenService,
+	service.NewWebhookService,
 )
@@ -0,0 +1,57 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/service"
+	"github.com/pki-vault/server/internal/tlsconfig"
+	"go.uber.org/zap"
+)
+
+// InitializeClientCertificateAuthenticator returns the authenticator granting client certificate principals the
+// scopes configured in tls.client_principals.
+func InitializeClientCertificateAuthenticator(tlsConfig config.TLS) (*service.ClientCertificateAuthenticator, error) {
+	scopesByPrincipal := make(map[string][]service.APITokenScope, len(tlsConfig.ClientPrincipals))
+	for idx, clientPrincipal := range tlsConfig.ClientPrincipals {
+		if clientPrincipal.Name == "" {
+			return nil, fmt.Errorf("tls.client_principals[%d].name must be set", idx)
+		}
+		if _, exists := scopesByPrincipal[clientPrincipal.Name]; exists {
+			return nil, fmt.Errorf("tls.client_principals[%d] duplicates principal %s", idx, clientPrincipal.Name)
+		}
+		scopes := make([]service.APITokenScope, len(clientPrincipal.Scopes))
+		for i, scope := range clientPrincipal.Scopes {
+			scopes[i] = service.APITokenScope(scope)
+		}
+		scopesByPrincipal[clientPrincipal.Name] = scopes
+	}
+
+	return service.NewClientCertificateAuthenticator(
+		service.ClientCertificatePrincipalSource(tlsConfig.ClientPrincipal), scopesByPrincipal,
+	)
+}
+
+// InitializeCertificateReloader returns the reloader of the server certificate, loaded either from the configured
+// files or from the vault.
+func InitializeCertificateReloader(
+	ctx context.Context, tlsConfig config.TLS, certificateService *service.X509CertificateService, logger *zap.Logger,
+) (*tlsconfig.CertificateReloader, error) {
+	var source tlsconfig.CertificateSource
+	switch {
+	case tlsConfig.VaultCertificateSAN != "" && (tlsConfig.CertFile != "" || tlsConfig.KeyFile != ""):
+		return nil, errors.New("tls.cert_file and tls.key_file must not be set if tls.vault_certificate_san is set")
+	case tlsConfig.VaultCertificateSAN != "":
+		source = tlsconfig.NewVaultCertificateSource(certificateService, tlsConfig.VaultCertificateSAN)
+	case tlsConfig.CertFile == "" || tlsConfig.KeyFile == "":
+		return nil, errors.New("tls.cert_file and tls.key_file must both be set")
+	default:
+		source = tlsconfig.NewFileCertificateSource(tlsConfig.CertFile, tlsConfig.KeyFile)
+	}
+	if tlsConfig.ReloadInterval <= 0 {
+		return nil, errors.New("tls.reload_interval must be positive")
+	}
+
+	return tlsconfig.NewCertificateReloader(ctx, source, logger)
+}
@@ -0,0 +1,67 @@
+package wire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.uber.org/zap"
+	"time"
+)
+
+// tracingShutdownTimeout limits how long the remaining spans are exported on shutdown.
+const tracingShutdownTimeout = 5 * time.Second
+
+// InitializeTracing installs the tracer provider exporting to the configured exporter as the global one, which the
+// restserver, the services and the database driver trace with. The W3C trace context of callers is propagated, also
+// if no exporter is configured, so logs carry their trace IDs. The cleanup exports the remaining spans.
+func InitializeTracing(tracingConfig config.Tracing) (func(), error) {
+	if tracingConfig.SampleRatio < 0 || tracingConfig.SampleRatio > 1 {
+		return nil, errors.New("tracing.sample_ratio must be between 0 and 1")
+	}
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch tracingConfig.Exporter {
+	case config.TracingExporterNone:
+		return func() {}, nil
+	case config.TracingExporterStdout:
+		exporter, err = stdouttrace.New()
+	case config.TracingExporterOTLP:
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(tracingConfig.OTLPEndpoint)}
+		if tracingConfig.OTLPInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q", tracingConfig.Exporter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	logger, err := InitializeZapLogger()
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := tracing.NewTracerProvider(exporter, tracingConfig.ServiceName, tracingConfig.SampleRatio)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(provider)
+	cleanup := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+		defer cancel()
+		if err := provider.Shutdown(ctx); err != nil {
+			logger.Error("could not export remaining spans", zap.Error(err))
+		}
+	}
+	return cleanup, nil
+}
@@ -0,0 +1,16 @@
+package wire
+
+import (
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/updates"
+)
+
+// InitializeUpdatesHub returns the hub of the certificate update notifications in the repository bundle.
+func InitializeUpdatesHub(repositoryBundle repository.Bundle) (*updates.Hub, error) {
+	logger, err := InitializeZapLogger()
+	if err != nil {
+		return nil, err
+	}
+	return updates.NewHub(repositoryBundle.X509CertificateUpdateNotifier(), clockwork.NewRealClock(), logger), nil
+}
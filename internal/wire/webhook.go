@@ -0,0 +1,38 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jonboulle/clockwork"
+	"github.com/pki-vault/server/internal/config"
+	"github.com/pki-vault/server/internal/db/repository"
+	"github.com/pki-vault/server/internal/webhook"
+)
+
+// InitializeWebhookDispatcher returns the dispatcher of the pending webhook deliveries in the repository bundle.
+func InitializeWebhookDispatcher(
+	repositoryBundle repository.Bundle, webhooksConfig config.Webhooks,
+) (*webhook.Dispatcher, error) {
+	if webhooksConfig.PollInterval <= 0 || webhooksConfig.Timeout <= 0 || webhooksConfig.Retention <= 0 {
+		return nil, errors.New("webhooks.poll_interval, webhooks.timeout and webhooks.retention must be positive")
+	}
+	if webhooksConfig.MaxAttempts < 1 {
+		return nil, errors.New("webhooks.max_attempts must be at least 1")
+	}
+	if webhooksConfig.InitialBackoff <= 0 || webhooksConfig.MaxBackoff < webhooksConfig.InitialBackoff {
+		return nil, errors.New("webhooks.initial_backoff must be positive and not exceed webhooks.max_backoff")
+	}
+	allowedNetworks, err := webhook.ParseNetworks(webhooksConfig.AllowedNetworks)
+	if err != nil {
+		return nil, fmt.Errorf("webhooks.allowed_networks must be in CIDR notation: %w", err)
+	}
+	logger, err := InitializeZapLogger()
+	if err != nil {
+		return nil, err
+	}
+
+	return webhook.NewDispatcher(
+		repositoryBundle.WebhookDeliveryRepository(), repositoryBundle.WebhookRepository(), webhooksConfig,
+		allowedNetworks, clockwork.NewRealClock(), logger,
+	), nil
+}